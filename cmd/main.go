@@ -3,26 +3,33 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/config"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/handler"
 	httpServer "github.com/VladislavsPerkanuks/Entain-test-task/internal/http"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/logging"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/metrics"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/tracing"
+	"github.com/VladislavsPerkanuks/Entain-test-task/migrations"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/lib/pq"
-
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 func migrateDB(db *sql.DB) error {
@@ -31,52 +38,584 @@ func migrateDB(db *sql.DB) error {
 		return fmt.Errorf("failed to create postgres driver: %w", err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
-		"postgres", driver)
+	src, err := migrations.Source()
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
 	if err != nil {
 		return fmt.Errorf("failed to create migrate instance: %w", err)
 	}
 
+	latest, err := migrations.Latest()
+	if err != nil {
+		return err
+	}
+
+	// A newer release migrated the database during a rolling deployment; its migrations are unknown
+	// to this binary and are left applied.
+	if version, dirty, err := m.Version(); err == nil && !dirty && version > latest {
+		slog.Warn("database schema is newer than the binary, skipping migrations",
+			"version", version, "expected", latest)
+
+		return nil
+	}
+
 	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	log.Println("Database migrations completed successfully")
+	slog.Info("database migrations completed")
 
 	return nil
 }
 
+// Backoff between attempts to connect to the database on startup.
+const (
+	connectBackoffInitial = 250 * time.Millisecond
+	connectBackoffMax     = 5 * time.Second
+)
+
+// openDB opens the connection pool of the configured size and connects to the database. While
+// the database is not ready yet, connecting is retried with exponential backoff until
+// DB_CONNECT_TIMEOUT passes.
+func openDB(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+
+	db.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DatabaseMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DatabaseConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DatabaseConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DatabaseConnectTimeout)
+	defer cancel()
+
+	if err = connectDB(ctx, db); err != nil {
+		_ = db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// connectDB pings db until it answers, doubling the delay between attempts up to
+// connectBackoffMax, or until ctx is done.
+func connectDB(ctx context.Context, db *sql.DB) error {
+	delay := connectBackoffInitial
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to ping DB after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("database not ready, retrying", "attempt", attempt, "retry_in", delay, logging.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to ping DB after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+
+		delay = min(2*delay, connectBackoffMax)
+	}
+}
+
+// Exit codes of the reconcile command.
+const (
+	exitNoDrift = 0
+	exitDrift   = 1
+	exitFailure = 2
+)
+
+// runReconcile compares all wallet balances with their history and with the ledger and prints the
+// report as JSON. It returns exitDrift if any balance drifted, even if it was corrected, so that
+// scheduled runs alert on every drift.
+func runReconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "correct balances drifted from their history to the expected balances")
+	reason := flags.String("reason", "", "audit reason recorded with every correction, required with -fix")
+
+	cfg, _, err := loadConfig(flags, args)
+	if err != nil {
+		return exitFailure
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		slog.Error("reconciliation failed", logging.Error(err))
+		return exitFailure
+	}
+	defer db.Close()
+
+	reconciler := service.NewReconciler(repository.NewRepository(db))
+
+	report, err := reconciler.Reconcile(context.Background(), *fix, *reason)
+	if err != nil {
+		slog.Error("reconciliation failed", logging.Error(err))
+		return exitFailure
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(report); err != nil {
+		slog.Error("failed to write report", logging.Error(err))
+		return exitFailure
+	}
+
+	if report.Drifted() {
+		return exitDrift
+	}
+
+	return exitNoDrift
+}
+
+// runProvider registers a provider and prints it as JSON. The secret is only ever shown here.
+func runProvider(args []string) int {
+	flags := flag.NewFlagSet("provider", flag.ContinueOnError)
+	name := flags.String("name", "", "name the provider sends in the Provider-ID header")
+	sourceTypes := flags.String("source-types", "", "comma-separated source types the provider may send")
+
+	cfg, values, err := loadConfig(flags, args)
+	if err != nil {
+		return exitFailure
+	}
+
+	provider := &model.Provider{Name: *name}
+	for _, name := range strings.Split(*sourceTypes, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			provider.SourceTypes = append(provider.SourceTypes, model.SourceType(name))
+		}
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		slog.Error("failed to register provider", logging.Error(err))
+		return exitFailure
+	}
+	defer db.Close()
+
+	secrets, err := providerSecrets(values)
+	if err != nil {
+		slog.Error("failed to register provider", logging.Error(err))
+		return exitFailure
+	}
+
+	providers := service.NewProviderService(repository.NewRepository(db), 0, secrets)
+
+	provider, err = providers.CreateProvider(context.Background(), provider.Name, provider.SourceTypes)
+	if err != nil {
+		slog.Error("failed to register provider", logging.Error(err))
+		return exitFailure
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(provider); err != nil {
+		slog.Error("failed to write provider", logging.Error(err))
+		return exitFailure
+	}
+
+	return 0
+}
+
+// runAPIKey issues an API key of a registered provider and prints it as JSON. It is used to issue
+// the first admin key, later keys can be issued through the admin API.
+func runAPIKey(args []string) int {
+	flags := flag.NewFlagSet("apikey", flag.ContinueOnError)
+	provider := flags.String("provider", "", "name of the provider the key belongs to")
+	scopeList := flags.String("scopes", "", "comma-separated scopes: balance:read, transactions:write, admin")
+
+	cfg, values, err := loadConfig(flags, args)
+	if err != nil {
+		return exitFailure
+	}
+
+	scopes, err := model.ToAPIKeyScopes(strings.Split(*scopeList, ","))
+	if err != nil {
+		slog.Error("failed to issue API key", logging.Error(err))
+		return exitFailure
+	}
+
+	secrets, err := providerSecrets(values)
+	if err != nil {
+		slog.Error("failed to issue API key", logging.Error(err))
+		return exitFailure
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		slog.Error("failed to issue API key", logging.Error(err))
+		return exitFailure
+	}
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	keys := service.NewAPIKeyService(repo, service.NewProviderService(repo, 0, secrets), 0)
+
+	apiKey, key, err := keys.IssueAPIKey(context.Background(), *provider, scopes)
+	if err != nil {
+		slog.Error("failed to issue API key", logging.Error(err))
+		return exitFailure
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err = encoder.Encode(map[string]any{
+		"keyId":    apiKey.ID,
+		"provider": apiKey.Provider,
+		"scopes":   apiKey.Scopes,
+		"key":      key,
+	}); err != nil {
+		slog.Error("failed to write API key", logging.Error(err))
+		return exitFailure
+	}
+
+	return 0
+}
+
+// sweepReservations releases expired reservations every interval until ctx is done.
+func sweepReservations(ctx context.Context, reservations service.ReservationService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := reservations.ExpireReservations(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to expire reservations", logging.Error(err))
+			}
+
+			if expired > 0 {
+				slog.InfoContext(ctx, "released expired reservations", "count", expired)
+			}
+		}
+	}
+}
+
+// providerSecrets creates the cipher of the provider secrets, or nil if PROVIDER_SECRET_KEY is not set.
+func providerSecrets(values *config.Values) (*service.SecretCipher, error) {
+	if values.ProviderSecretKey == nil {
+		return nil, nil
+	}
+
+	return service.NewSecretCipher(values.ProviderSecretKey)
+}
+
+// nonceSweepInterval is how often expired nonces of signed requests are dropped.
+const nonceSweepInterval = time.Minute
+
+// nonceStore creates the store of the nonces of signed requests.
+func nonceStore(cfg *config.Config, repo repository.Repository) (service.NonceService, error) {
+	switch cfg.NonceStore {
+	case "memory":
+		return service.NewLocalNonceService(), nil
+	case "postgres":
+		return service.NewNonceService(repo), nil
+	default:
+		return nil, fmt.Errorf("invalid NONCE_STORE: %q", cfg.NonceStore)
+	}
+}
+
+// sweepNonces drops the expired nonces of signatures every nonceSweepInterval until ctx is done.
+func sweepNonces(ctx context.Context, signatures *httpServer.SignatureVerifier) {
+	ticker := time.NewTicker(nonceSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := signatures.Sweep(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to sweep nonces", logging.Error(err))
+			}
+		}
+	}
+}
+
+// rateLimitSweepInterval is how often idle rate limit buckets are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter creates the rate limiter of the configured limits, or nil if all limits are disabled.
+func rateLimiter(cfg *config.Config, repo repository.Repository) (*httpServer.RateLimiter, error) {
+	provider := model.RateLimit{Rate: cfg.ProviderRateLimit, Burst: cfg.ProviderRateBurst}
+	user := model.RateLimit{Rate: cfg.UserRateLimit, Burst: cfg.UserRateBurst}
+
+	if !provider.Enabled() && !user.Enabled() {
+		slog.Warn("rate limits are disabled")
+
+		return nil, nil
+	}
+
+	switch cfg.RateLimitStore {
+	case "memory":
+		return httpServer.NewRateLimiter(service.NewLocalRateLimitService(), provider, user), nil
+	case "postgres":
+		return httpServer.NewRateLimiter(service.NewRateLimitService(repo), provider, user), nil
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_STORE: %q", cfg.RateLimitStore)
+	}
+}
+
+// sweepRateLimits drops the idle buckets of limits every rateLimitSweepInterval until ctx is done.
+func sweepRateLimits(ctx context.Context, limits *httpServer.RateLimiter) {
+	ticker := time.NewTicker(rateLimitSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := limits.Sweep(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to sweep rate limits", logging.Error(err))
+			}
+		}
+	}
+}
+
+// fatal logs msg with args and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// loadConfig adds the config flags to the command flags, loads the configuration with args and
+// sets up the default logger with it. All invalid settings are reported at once. It returns
+// flag.ErrHelp if only the usage was asked for.
+func loadConfig(flags *flag.FlagSet, args []string) (*config.Config, *config.Values, error) {
+	cfg, err := config.LoadFlags(flags, args)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		}
+
+		return nil, nil, err
+	}
+
+	// LoadFlags validated cfg already, this only takes the parsed values.
+	values, err := cfg.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logLevel, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\nLOG_LEVEL: %s\n", err)
+
+		return nil, nil, err
+	}
+
+	slog.SetDefault(logging.New(os.Stderr, logLevel))
+
+	return cfg, values, nil
+}
+
+// runConfig prints the effective configuration, with the config flags in args applied, in the
+// format of the config file. Secrets are masked.
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: main config print [flags]")
+
+		return 1
+	}
+
+	cfg, _, err := loadConfig(flag.NewFlagSet("config print", flag.ContinueOnError), args[1:])
+	if err != nil {
+		return 1
+	}
+
+	if err = cfg.Print(os.Stdout); err != nil {
+		slog.Error("failed to print config", logging.Error(err))
+
+		return 1
+	}
+
+	return 0
+}
+
 func main() {
-	serverConfig := config.DefaultConfig()
-	hostPort := net.JoinHostPort(serverConfig.DatabaseHost, serverConfig.DatabasePort)
-
-	dataSource := fmt.Sprintf(
-		"postgres://%s:%s@%s/%s?sslmode=disable",
-		serverConfig.DatabaseUser,
-		serverConfig.DatabasePassword,
-		hostPort,
-		serverConfig.DatabaseName,
-	)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile":
+			os.Exit(runReconcile(os.Args[2:]))
+		case "provider":
+			os.Exit(runProvider(os.Args[2:]))
+		case "apikey":
+			os.Exit(runAPIKey(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		}
+	}
+
+	serverConfig, values, err := loadConfig(flag.NewFlagSet(os.Args[0], flag.ContinueOnError), os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(1)
+	}
+
+	transactionRules := &rules.Engine{}
+	if serverConfig.RulesFile != "" {
+		if transactionRules, err = rules.Load(serverConfig.RulesFile); err != nil {
+			fatal("failed to load transaction rules", logging.Error(err))
+		}
+	}
 
-	db, err := sql.Open("postgres", dataSource)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     serverConfig.TracingExporter,
+		OTLPEndpoint: serverConfig.TracingOTLPEndpoint,
+		File:         serverConfig.TracingFile,
+		SampleRatio:  serverConfig.TracingSampleRatio,
+		ServiceName:  "wallet",
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+		fatal("failed to set up tracing", logging.Error(err))
 	}
 
-	// Test the connection
-	if err = db.PingContext(context.Background()); err != nil {
-		log.Fatalf("failed to ping DB: %s", err)
+	db, err := openDB(serverConfig)
+	if err != nil {
+		fatal("failed to open DB", logging.Error(err))
 	}
 
 	if err = migrateDB(db); err != nil {
-		log.Fatalf("failed to migrate DB: %s", err)
+		fatal("failed to migrate DB", logging.Error(err))
+	}
+
+	schemaVersion, err := migrations.Latest()
+	if err != nil {
+		fatal("failed to read migrations", logging.Error(err))
 	}
 
+	var appMetrics *metrics.Metrics
+
 	transactionRepository := repository.NewRepository(db)
-	transactionService := service.NewTransactionService(transactionRepository)
+	if serverConfig.MetricsEnabled {
+		appMetrics = metrics.New(db)
+		transactionRepository = appMetrics.Repository(transactionRepository)
+	}
+
+	sourceTypeService := service.NewSourceTypeService(transactionRepository)
+
+	var transactionService service.TransactionService = service.NewTransactionService(
+		transactionRepository,
+		service.WithDefaultCurrency(values.DefaultCurrency),
+		service.WithWalletAutoCreate(serverConfig.WalletAutoCreate),
+		service.WithSourceTypes(sourceTypeService),
+		service.WithRules(transactionRules),
+		service.WithBonusSpendOrder(values.BonusSpendOrder),
+		service.WithUserStatusPolicy(values.UserStatuses),
+	)
+
+	if appMetrics != nil {
+		transactionService = appMetrics.TransactionService(transactionService, func(err error) string {
+			return string(handler.CodeForError(err))
+		})
+	}
+
+	limitService := service.NewLimitService(transactionRepository, values.DefaultCurrency)
+	bonusService := service.NewBonusService(transactionRepository, values.DefaultCurrency)
+	reservationService := service.NewReservationService(
+		transactionRepository,
+		sourceTypeService,
+		transactionRules,
+		values.DefaultCurrency,
+		serverConfig.ReservationTTL,
+		values.UserStatuses,
+	)
+	userService := service.NewUserService(transactionRepository, values.DefaultCurrency)
+	adjustmentService := service.NewAdjustmentService(
+		transactionRepository,
+		values.DefaultCurrency,
+		values.AdjustmentApprovalThreshold,
+	)
+
+	secrets, err := providerSecrets(values)
+	if err != nil {
+		fatal("invalid provider secret key", logging.Error(err))
+	}
+
+	if secrets == nil {
+		slog.Warn("PROVIDER_SECRET_KEY is not set, provider secrets are stored in plaintext")
+	}
+
+	providerService := service.NewProviderService(
+		transactionRepository,
+		service.DefaultProviderCacheTTL,
+		secrets,
+	)
+	apiKeyService := service.NewAPIKeyService(transactionRepository, providerService, service.DefaultAPIKeyCacheTTL)
+	healthService := service.NewHealthService(transactionRepository, schemaVersion, serverConfig.ReadinessTimeout)
+
+	var auth *httpServer.Authenticator
+	if serverConfig.RequireAPIKeys {
+		auth = httpServer.NewAuthenticator(apiKeyService)
+	} else {
+		slog.Warn("API keys are disabled, requests are accepted unauthenticated")
+	}
+
+	var signatures *httpServer.SignatureVerifier
+	if serverConfig.RequireSignedRequests {
+		nonces, err := nonceStore(serverConfig, transactionRepository)
+		if err != nil {
+			fatal("invalid nonce store", logging.Error(err))
+		}
+
+		signatures = httpServer.NewSignatureVerifier(providerService, nonces, serverConfig.SignatureMaxSkew)
+	} else {
+		slog.Warn("request signing is disabled, transaction requests are accepted unsigned")
+	}
+
+	limits, err := rateLimiter(serverConfig, transactionRepository)
+	if err != nil {
+		fatal("invalid rate limits", logging.Error(err))
+	}
 
-	router := httpServer.NewRouter(transactionService)
+	sweepCtx, stopSweeping := context.WithCancel(context.Background())
+	defer stopSweeping()
+
+	go sweepReservations(sweepCtx, reservationService, serverConfig.ReservationSweepInterval)
+
+	if limits != nil {
+		go sweepRateLimits(sweepCtx, limits)
+	}
+
+	if signatures != nil {
+		go sweepNonces(sweepCtx, signatures)
+	}
+
+	router := httpServer.NewRouter(handler.Services{
+		Transactions: transactionService,
+		SourceTypes:  sourceTypeService,
+		Limits:       limitService,
+		Bonuses:      bonusService,
+		Reservations: reservationService,
+		Users:        userService,
+		Adjustments:  adjustmentService,
+		APIKeys:      apiKeyService,
+		Health:       healthService,
+	}, httpServer.Middleware{
+		Auth:       auth,
+		RateLimits: limits,
+		Signatures: signatures,
+		Metrics:    appMetrics,
+	})
 
 	stop := make(chan os.Signal, 1)
 	defer signal.Stop(stop)
@@ -84,7 +623,7 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
 	server := &http.Server{
-		Addr:              fmt.Sprintf(":%s", serverConfig.ServerPort),
+		Addr:              fmt.Sprintf(":%d", serverConfig.ServerPort),
 		Handler:           router,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
@@ -93,24 +632,32 @@ func main() {
 	}
 
 	go func() {
-		log.Printf("Starting server on :%s...\n", serverConfig.ServerPort)
+		slog.Info("starting server", "port", serverConfig.ServerPort)
 		if err = server.ListenAndServe(); err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
-				log.Fatalf("ListenAndServe error: %v", err)
+				fatal("failed to serve", logging.Error(err))
 			}
 		}
 	}()
 
 	// Wait for a signal
 	<-stop
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server, draining traffic", "delay", serverConfig.ShutdownDrainDelay)
+
+	// Fail readiness first and keep serving while load balancers take the instance out of rotation.
+	healthService.Drain()
+	time.Sleep(serverConfig.ShutdownDrainDelay)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err = server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		slog.Error("server forced to shut down", logging.Error(err))
+	}
+
+	if err = shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", logging.Error(err))
 	}
 
-	log.Println("Server stopped gracefully")
+	slog.Info("server stopped gracefully")
 }
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the config file unless the -config flag does.
+const FileEnv = "CONFIG_FILE"
+
+// secretFileSuffix marks environment variables naming a file that holds the value of a setting, as
+// Docker secrets are passed: DB_PASSWORD_FILE=/run/secrets/db_password.
+const secretFileSuffix = "_FILE"
+
+// masked replaces the values of secrets when the configuration is printed.
+const masked = "********"
+
+// Load reads the configuration from the defaults, the config file, the environment and the flags
+// in args, in increasing precedence, and validates it. All invalid settings are reported at once.
+func Load(name string, args []string) (*Config, error) {
+	return LoadFlags(flag.NewFlagSet(name, flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load for commands with flags of their own: the config flags are added to flags,
+// which then parses args, so that the command flags are set as well.
+func LoadFlags(flags *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	file := flags.String("config", os.Getenv(FileEnv), "YAML file with the settings, defaults to $"+FileEnv)
+
+	flagValues := make(map[string]string)
+
+	for _, s := range settings {
+		record := func(value string) error {
+			flagValues[s.env] = value
+
+			return nil
+		}
+
+		if s.isBool() {
+			flags.BoolFunc(s.flagName(), "overrides "+s.env, record)
+		} else {
+			flags.Func(s.flagName(), "overrides "+s.env, record)
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	var errs []error
+
+	if *file != "" {
+		errs = append(errs, loadFile(*file, settings))
+	}
+
+	for _, s := range settings {
+		raw, ok, err := lookupEnv(s.env)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if ok {
+			if err = s.set(raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w in the environment", s.env, err))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := flagValues[s.env]; ok {
+			if err := s.set(raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w in flag -%s", s.env, err, s.flagName()))
+			}
+		}
+	}
+
+	if _, err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile applies the settings of the YAML file path, a mapping of the file keys of settings to
+// their values.
+func loadFile(path string, settings []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]any
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.fileKey()] = s
+	}
+
+	var errs []error
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+
+			continue
+		}
+
+		if err = s.set(fileValue(values[key])); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w in %s", s.env, err, path))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// fileValue formats a value of the config file like the environment variable of its setting. Lists
+// become comma-separated.
+func fileValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fileValue(item))
+		}
+
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// lookupEnv returns the value of the environment variable env, or the contents of the file named
+// by env_FILE without the trailing newline. Setting both is an error.
+func lookupEnv(env string) (string, bool, error) {
+	value, ok := os.LookupEnv(env)
+
+	path, fromFile := os.LookupEnv(env + secretFileSuffix)
+	if !fromFile {
+		return value, ok, nil
+	}
+
+	if ok {
+		return "", false, fmt.Errorf("%s: set either %s or %s%s, not both", env, env, env, secretFileSuffix)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s%s: %w", env, secretFileSuffix, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// Print writes the settings of c to w in the format of the config file, with secrets masked.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, s := range c.settings() {
+		value := s.node()
+		if s.secret && value.Value != "" {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: masked}
+		}
+
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.fileKey()}, value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+// node returns the value of the setting as a YAML scalar.
+func (s setting) node() *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+
+	switch v := s.value.Interface().(type) {
+	case time.Duration:
+		node.Value = v.String()
+	case string:
+		node.Value = v
+	case bool:
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(v)
+	case int:
+		node.Tag, node.Value = "!!int", strconv.Itoa(v)
+	case float64:
+		node.Tag, node.Value = "!!float", strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	return node
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// OperatorHeader names the support operator on whose behalf an admin request is made. With API keys
+// required, the operator is bound to the key of the request: the four-eyes rule compares both.
+const OperatorHeader string = "Operator-ID"
+
+type adjustmentRequestBody struct {
+	TransactionID string `json:"transactionId"`
+	UserID        int    `json:"userId"`
+	Currency      string `json:"currency"`
+	Type          string `json:"type"`
+	Amount        string `json:"amount"`
+	ReasonCode    string `json:"reasonCode"`
+	Comment       string `json:"comment"`
+}
+
+type adjustmentDecisionRequestBody struct {
+	Comment string `json:"comment"`
+}
+
+type adjustmentView struct {
+	TransactionID string                 `json:"transactionId"`
+	UserID        int                    `json:"userId"`
+	Currency      model.Currency         `json:"currency"`
+	Type          model.AdjustmentType   `json:"type"`
+	Amount        string                 `json:"amount"`
+	ReasonCode    model.AdjustmentReason `json:"reasonCode"`
+	Comment       string                 `json:"comment"`
+	Status        model.AdjustmentStatus `json:"status"`
+	RequestedBy   string                 `json:"requestedBy"`
+	ReviewedBy    string                 `json:"reviewedBy,omitempty"`
+	ReviewComment string                 `json:"reviewComment,omitempty"`
+	CreatedAt     time.Time              `json:"createdAt"`
+	DecidedAt     *time.Time             `json:"decidedAt,omitempty"`
+	Audit         []model.AuditEvent     `json:"audit,omitempty"`
+}
+
+type adjustmentsResponse struct {
+	Adjustments []adjustmentView `json:"adjustments"`
+}
+
+func newAdjustmentView(adjustment *model.ManualAdjustment) adjustmentView {
+	return adjustmentView{
+		TransactionID: adjustment.ID.String(),
+		UserID:        adjustment.UserID,
+		Currency:      adjustment.Currency,
+		Type:          adjustment.Type,
+		Amount:        adjustment.Amount.StringFixed(2),
+		ReasonCode:    adjustment.ReasonCode,
+		Comment:       adjustment.Comment,
+		Status:        adjustment.Status,
+		RequestedBy:   adjustment.RequestedBy,
+		ReviewedBy:    adjustment.ReviewedBy,
+		ReviewComment: adjustment.ReviewComment,
+		CreatedAt:     adjustment.CreatedAt,
+		DecidedAt:     adjustment.DecidedAt,
+	}
+}
+
+func validateOperator(r *http.Request) (model.Operator, error) {
+	operator := model.Operator{Name: strings.TrimSpace(r.Header.Get(OperatorHeader))}
+	if operator.Name == "" {
+		return model.Operator{}, fmt.Errorf("%s header is required", OperatorHeader)
+	}
+
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		operator.KeyID = key.ID
+	}
+
+	return operator, nil
+}
+
+func validateAdjustmentRequest(r *http.Request) (*model.ManualAdjustment, error) {
+	operator, err := validateOperator(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqBody adjustmentRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+
+	transactionID, err := uuid.Parse(reqBody.TransactionID)
+	if err != nil || transactionID == uuid.Nil {
+		return nil, errors.New("invalid transactionId format")
+	}
+
+	if reqBody.UserID <= 0 {
+		return nil, errors.New("invalid user ID")
+	}
+
+	adjustmentType, err := model.ToAdjustmentType(reqBody.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := decimal.NewFromString(reqBody.Amount)
+	if err != nil || !amount.IsPositive() {
+		return nil, errors.New("amount must be a positive number")
+	}
+
+	reasonCode, err := model.ToAdjustmentReason(reqBody.ReasonCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(reqBody.Comment) == "" {
+		return nil, errors.New("comment is required")
+	}
+
+	adjustment := &model.ManualAdjustment{
+		ID:             transactionID,
+		UserID:         reqBody.UserID,
+		Type:           adjustmentType,
+		Amount:         amount,
+		ReasonCode:     reasonCode,
+		Comment:        reqBody.Comment,
+		RequestedBy:    operator.Name,
+		RequestedByKey: operator.KeyID,
+	}
+
+	if reqBody.Currency != "" {
+		if adjustment.Currency, err = model.ToCurrency(reqBody.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	return adjustment, nil
+}
+
+// RequestAdjustment credits or debits a wallet on behalf of an operator. Adjustments above the
+// approval threshold are accepted as pending until a second operator approves them.
+func (h *Handler) RequestAdjustment(w http.ResponseWriter, r *http.Request) {
+	adjustment, err := validateAdjustmentRequest(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	adjustment, err = h.as.RequestAdjustment(r.Context(), adjustment)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	status := http.StatusCreated
+	if adjustment.Status == model.AdjustmentPending {
+		status = http.StatusAccepted
+	}
+
+	writeJSON(w, status, newAdjustmentView(adjustment))
+}
+
+func (h *Handler) ListAdjustments(w http.ResponseWriter, r *http.Request) {
+	var (
+		status model.AdjustmentStatus
+		err    error
+	)
+
+	if value := r.URL.Query().Get("status"); value != "" {
+		if status, err = model.ToAdjustmentStatus(value); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	adjustments, err := h.as.ListAdjustments(r.Context(), status)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := adjustmentsResponse{Adjustments: make([]adjustmentView, 0, len(adjustments))}
+	for i := range adjustments {
+		response.Adjustments = append(response.Adjustments, newAdjustmentView(&adjustments[i]))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetAdjustment returns an adjustment together with its audit trail.
+func (h *Handler) GetAdjustment(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := validateTransactionID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	adjustment, err := h.as.GetAdjustment(ctx, transactionID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	events, err := h.as.ListAuditEvents(ctx, transactionID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	view := newAdjustmentView(adjustment)
+	view.Audit = events
+
+	writeJSON(w, http.StatusOK, view)
+}
+
+// ApproveAdjustment applies a pending adjustment. The approving operator must not be the requester.
+func (h *Handler) ApproveAdjustment(w http.ResponseWriter, r *http.Request) {
+	h.decideAdjustment(w, r, true)
+}
+
+// RejectAdjustment discards a pending adjustment. The rejecting operator must not be the requester.
+func (h *Handler) RejectAdjustment(w http.ResponseWriter, r *http.Request) {
+	h.decideAdjustment(w, r, false)
+}
+
+func (h *Handler) decideAdjustment(w http.ResponseWriter, r *http.Request, approve bool) {
+	transactionID, err := validateTransactionID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	operator, err := validateOperator(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// The body is optional.
+	var reqBody adjustmentDecisionRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil && !errors.Is(err, io.EOF) {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	decide := h.as.RejectAdjustment
+	if approve {
+		decide = h.as.ApproveAdjustment
+	}
+
+	adjustment, err := decide(r.Context(), transactionID, operator, reqBody.Comment)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAdjustmentView(adjustment))
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a copy of ctx carrying the API key the request was authenticated with.
+func WithAPIKey(ctx context.Context, key *model.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the API key stored by WithAPIKey, if any.
+func APIKeyFromContext(ctx context.Context) (*model.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(*model.APIKey)
+
+	return key, ok
+}
+
+type apiKeyRequestBody struct {
+	Scopes []string `json:"scopes"`
+}
+
+type apiKeyView struct {
+	KeyID      string              `json:"keyId"`
+	Provider   string              `json:"provider"`
+	Prefix     string              `json:"prefix"`
+	Scopes     []model.APIKeyScope `json:"scopes"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	LastUsedAt *time.Time          `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time          `json:"revokedAt,omitempty"`
+	// Key is only set when the key is issued.
+	Key string `json:"key,omitempty"`
+}
+
+type apiKeysResponse struct {
+	Keys []apiKeyView `json:"keys"`
+}
+
+func newAPIKeyView(key *model.APIKey) apiKeyView {
+	return apiKeyView{
+		KeyID:      key.ID.String(),
+		Provider:   key.Provider,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+func validateKeyID(r *http.Request) (uuid.UUID, error) {
+	keyID, err := uuid.Parse(chi.URLParam(r, "keyID"))
+	if err != nil || keyID == uuid.Nil {
+		return uuid.Nil, errors.New("invalid keyId format")
+	}
+
+	return keyID, nil
+}
+
+// managedProvider returns the provider whose keys are managed by r, or an error wrapping
+// ErrInsufficientScope if r was authenticated with a key of another provider.
+func managedProvider(r *http.Request) (string, error) {
+	provider := chi.URLParam(r, "provider")
+	if caller := providerName(r); caller != "" && caller != provider {
+		return "", fmt.Errorf("%w: keys of provider %s are managed with its own keys", service.ErrInsufficientScope, provider)
+	}
+
+	return provider, nil
+}
+
+// IssueAPIKey creates an API key of the provider. The key is only shown in this response.
+func (h *Handler) IssueAPIKey(w http.ResponseWriter, r *http.Request) {
+	var reqBody apiKeyRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	scopes, err := model.ToAPIKeyScopes(reqBody.Scopes)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	provider, err := managedProvider(r)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	key, secret, err := h.ks.IssueAPIKey(r.Context(), provider, scopes)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	view := newAPIKeyView(key)
+	view.Key = secret
+
+	writeJSON(w, http.StatusCreated, view)
+}
+
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	provider, err := managedProvider(r)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	keys, err := h.ks.ListAPIKeys(r.Context(), provider)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := apiKeysResponse{Keys: make([]apiKeyView, 0, len(keys))}
+	for i := range keys {
+		response.Keys = append(response.Keys, newAPIKeyView(&keys[i]))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// RotateAPIKey revokes an API key and issues a new one with the same scopes. The new key is only
+// shown in this response.
+func (h *Handler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := validateKeyID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	key, secret, err := h.ks.RotateAPIKey(r.Context(), keyID, providerName(r))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	view := newAPIKeyView(key)
+	view.Key = secret
+
+	writeJSON(w, http.StatusCreated, view)
+}
+
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := validateKeyID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	key, err := h.ks.RevokeAPIKey(r.Context(), keyID, providerName(r))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAPIKeyView(key))
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+)
+
+// MaxBatchSize caps the number of transactions accepted in one batch request.
+const MaxBatchSize = 5000
+
+type batchItemRequestBody struct {
+	transactionRequestBody
+
+	UserID int `json:"userId"`
+	// SourceType overrides the Source-Type header of the batch request for this item.
+	SourceType string `json:"sourceType"`
+}
+
+type batchRequestBody struct {
+	Mode         string                 `json:"mode"`
+	Transactions []batchItemRequestBody `json:"transactions"`
+}
+
+type batchItemResponse struct {
+	Index         int                  `json:"index"`
+	TransactionID string               `json:"transactionId"`
+	Status        int                  `json:"status"`
+	Code          ErrorCode            `json:"code,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	Detail        string               `json:"detail,omitempty"`
+	Result        *transactionResponse `json:"result,omitempty"`
+}
+
+type batchResponse struct {
+	Mode    model.BatchMode     `json:"mode"`
+	Results []batchItemResponse `json:"results"`
+}
+
+// ProcessBatch handles a batch of transactions for one or many users.
+// Items failing validation are reported per item in independent mode and reject
+// the whole batch in atomic mode.
+func (h *Handler) ProcessBatch(w http.ResponseWriter, r *http.Request) {
+	var reqBody batchRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	mode, err := model.ToBatchMode(reqBody.Mode)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	if len(reqBody.Transactions) == 0 || len(reqBody.Transactions) > MaxBatchSize {
+		writeValidationError(w, r, fmt.Errorf("batch must contain between 1 and %d transactions", MaxBatchSize))
+		return
+	}
+
+	results := make([]batchItemResponse, len(reqBody.Transactions))
+	txs := make([]*model.Transaction, 0, len(reqBody.Transactions))
+	indexes := make([]int, 0, len(reqBody.Transactions))
+
+	for i, item := range reqBody.Transactions {
+		tx, err := item.toBatchTransaction(sourceTypeHeader(r), r.Header.Get(CurrencyHeader))
+		if err != nil {
+			if mode == model.BatchModeAtomic {
+				writeValidationError(w, r, fmt.Errorf("transactions[%d]: %w", i, err))
+				return
+			}
+
+			results[i] = batchItemResponse{
+				Index:         i,
+				TransactionID: item.TransactionID,
+				Status:        http.StatusBadRequest,
+				Code:          CodeInvalidRequest,
+				Title:         "Invalid request",
+				Detail:        err.Error(),
+			}
+
+			continue
+		}
+
+		if tx.Provider, err = providerFor(r, tx.SourceType); err != nil {
+			if mode == model.BatchModeAtomic {
+				writeBatchItemError(w, r, &service.BatchItemError{Index: i, TransactionID: tx.ID, Err: err})
+				return
+			}
+
+			spec := specForError(err)
+			results[i] = batchItemResponse{
+				Index:         i,
+				TransactionID: item.TransactionID,
+				Status:        spec.status,
+				Code:          spec.code,
+				Title:         spec.title,
+			}
+
+			continue
+		}
+
+		txs = append(txs, &tx)
+		indexes = append(indexes, i)
+	}
+
+	processed, err := h.ts.ProcessBatch(r.Context(), txs, mode)
+	if err != nil {
+		var itemErr *service.BatchItemError
+		if errors.As(err, &itemErr) {
+			itemErr.Index = indexes[itemErr.Index]
+			writeBatchItemError(w, r, itemErr)
+
+			return
+		}
+
+		writeError(w, r, err)
+
+		return
+	}
+
+	for j, result := range processed {
+		i := indexes[j]
+		results[i] = batchItemResponse{Index: i, TransactionID: txs[j].ID.String()}
+
+		if result.Err != nil {
+			spec := specForError(result.Err)
+			results[i].Status, results[i].Code, results[i].Title = spec.status, spec.code, spec.title
+
+			continue
+		}
+
+		response := newTransactionResponse(result.Transaction)
+		results[i].Status = http.StatusOK
+		results[i].Result = &response
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = json.NewEncoder(w).Encode(batchResponse{Mode: mode, Results: results}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (b *batchItemRequestBody) toBatchTransaction(
+	defaultSourceType string,
+	defaultCurrency string,
+) (model.Transaction, error) {
+	if b.UserID <= 0 {
+		return model.Transaction{}, errors.New("invalid user ID")
+	}
+
+	if b.Currency == "" {
+		b.Currency = defaultCurrency
+	}
+
+	sourceType := b.SourceType
+	if sourceType == "" {
+		sourceType = defaultSourceType
+	}
+
+	return b.toTransaction(b.UserID, sourceType)
+}
+
+// writeBatchItemError writes the problem of the item that aborted an atomic batch,
+// identifying the item so that the caller can fix or drop it and resubmit.
+func writeBatchItemError(w http.ResponseWriter, r *http.Request, itemErr *service.BatchItemError) {
+	spec := specForError(itemErr.Err)
+	index := itemErr.Index
+
+	writeProblemDetails(w, spec.status, problem{
+		Type:          problemType(spec.code),
+		Title:         spec.title,
+		Status:        spec.status,
+		Detail:        "batch was rolled back, no transaction was applied",
+		Instance:      r.URL.Path,
+		Code:          spec.code,
+		Index:         &index,
+		TransactionID: itemErr.TransactionID.String(),
+	})
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type grantBonusRequestBody struct {
+	GrantID             string `json:"grantId"`
+	Amount              string `json:"amount"`
+	Currency            string `json:"currency"`
+	WageringRequirement string `json:"wageringRequirement"`
+}
+
+type bonusGrantView struct {
+	ID int64 `json:"id"`
+	// GrantID is omitted for grants made before grant IDs were required.
+	GrantID             *uuid.UUID             `json:"grantId,omitempty"`
+	Currency            model.Currency         `json:"currency"`
+	Amount              string                 `json:"amount"`
+	WageringRequirement string                 `json:"wageringRequirement"`
+	Wagered             string                 `json:"wagered"`
+	Status              model.BonusGrantStatus `json:"status"`
+	// ConvertedAmount is the bonus money that became real money. It is only set for converted grants.
+	ConvertedAmount *string    `json:"convertedAmount,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+}
+
+type bonusGrantsResponse struct {
+	UserID  int              `json:"userId"`
+	Bonuses []bonusGrantView `json:"bonuses"`
+}
+
+func newBonusGrantView(grant *model.BonusGrant) bonusGrantView {
+	view := bonusGrantView{
+		ID:                  grant.ID,
+		Currency:            grant.Currency,
+		Amount:              grant.Amount.StringFixed(2),
+		WageringRequirement: grant.WageringRequirement.StringFixed(2),
+		Wagered:             grant.Wagered.StringFixed(2),
+		Status:              grant.Status,
+		CreatedAt:           grant.CreatedAt,
+		CompletedAt:         grant.CompletedAt,
+	}
+
+	if grant.ConvertedAmount.Valid {
+		converted := grant.ConvertedAmount.Decimal.StringFixed(2)
+		view.ConvertedAmount = &converted
+	}
+
+	if grant.GrantID != uuid.Nil {
+		view.GrantID = &grant.GrantID
+	}
+
+	return view
+}
+
+func (h *Handler) ListBonusGrants(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	grants, err := h.bs.ListBonusGrants(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := bonusGrantsResponse{UserID: userID, Bonuses: make([]bonusGrantView, 0, len(grants))}
+	for i := range grants {
+		response.Bonuses = append(response.Bonuses, newBonusGrantView(&grants[i]))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GrantBonus credits bonus money that has to be wagered before it becomes real money. A retry with
+// the same grantId answers with the stored grant instead of crediting it again.
+func (h *Handler) GrantBonus(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	var reqBody grantBonusRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	grantID, err := uuid.Parse(reqBody.GrantID)
+	if err != nil || grantID == uuid.Nil {
+		writeValidationError(w, r, errors.New("invalid grantId format"))
+		return
+	}
+
+	amount, err := decimal.NewFromString(reqBody.Amount)
+	if err != nil || !amount.IsPositive() {
+		writeValidationError(w, r, errors.New("amount must be a positive number"))
+		return
+	}
+
+	wageringRequirement, err := decimal.NewFromString(reqBody.WageringRequirement)
+	if err != nil || !wageringRequirement.IsPositive() {
+		writeValidationError(w, r, errors.New("wageringRequirement must be a positive number"))
+		return
+	}
+
+	var currency model.Currency
+	if reqBody.Currency != "" {
+		if currency, err = model.ToCurrency(reqBody.Currency); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	grant, err := h.bs.GrantBonus(r.Context(), &model.BonusGrant{
+		GrantID:             grantID,
+		UserID:              userID,
+		Currency:            currency,
+		Amount:              amount,
+		WageringRequirement: wageringRequirement,
+	})
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newBonusGrantView(grant))
+}
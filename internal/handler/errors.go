@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/logging"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// ErrorCode is a stable, machine-readable identifier of an error response.
+// Clients should branch on it rather than on the human-readable title.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest        ErrorCode = "invalid_request"
+	CodeInvalidSignature      ErrorCode = "invalid_signature"
+	CodeSourceTypeForbidden   ErrorCode = "source_type_forbidden"
+	CodeUnauthenticated       ErrorCode = "unauthenticated"
+	CodeInsufficientScope     ErrorCode = "insufficient_scope"
+	CodeProviderNotFound      ErrorCode = "provider_not_found"
+	CodeAPIKeyNotFound        ErrorCode = "api_key_not_found"
+	CodeAPIKeyRevoked         ErrorCode = "api_key_revoked"
+	CodeRateLimited           ErrorCode = "rate_limited"
+	CodeUserNotFound          ErrorCode = "user_not_found"
+	CodeWalletNotFound        ErrorCode = "wallet_not_found"
+	CodeTransactionNotFound   ErrorCode = "transaction_not_found"
+	CodeSourceTypeNotFound    ErrorCode = "source_type_not_found"
+	CodeSourceTypeExists      ErrorCode = "source_type_exists"
+	CodeLimitNotFound         ErrorCode = "limit_not_found"
+	CodeUserSuspended         ErrorCode = "user_suspended"
+	CodeUserClosed            ErrorCode = "user_closed"
+	CodeReservationNotFound   ErrorCode = "reservation_not_found"
+	CodeReservationSettled    ErrorCode = "reservation_settled"
+	CodeTransactionReserved   ErrorCode = "transaction_reserved"
+	CodeAdjustmentNotFound    ErrorCode = "adjustment_not_found"
+	CodeAdjustmentDecided     ErrorCode = "adjustment_decided"
+	CodeSelfReview            ErrorCode = "self_review"
+	CodeLossLimitExceeded     ErrorCode = "loss_limit_exceeded"
+	CodeInsufficientFunds     ErrorCode = "insufficient_funds"
+	CodeDuplicateTransaction  ErrorCode = "duplicate_transaction"
+	CodeAlreadyRolledBack     ErrorCode = "already_rolled_back"
+	CodeTransactionRolledBack ErrorCode = "transaction_rolled_back"
+	CodeConstraintViolation   ErrorCode = "constraint_violation"
+	CodeServiceUnavailable    ErrorCode = "service_unavailable"
+	CodeInternalError         ErrorCode = "internal_error"
+)
+
+// problem is an RFC 7807 problem details object extended with an error code.
+type problem struct {
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Status   int       `json:"status"`
+	Detail   string    `json:"detail,omitempty"`
+	Instance string    `json:"instance,omitempty"`
+	Code     ErrorCode `json:"code"`
+	// Index and TransactionID identify the failing item of a batch request.
+	Index         *int   `json:"index,omitempty"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// problemSpec describes how an error is presented to the client.
+type problemSpec struct {
+	status int
+	code   ErrorCode
+	title  string
+}
+
+// specForError is the central mapping from service errors to HTTP responses.
+// Errors without a dedicated mapping are reported as internal errors.
+func specForError(err error) problemSpec {
+	var violation *service.RuleViolation
+
+	switch {
+	case errors.As(err, &violation):
+		// Rule violations carry their own code, documented with the rules.
+		return problemSpec{http.StatusUnprocessableEntity, ErrorCode(violation.Code), "Transaction violates a rule"}
+	case errors.Is(err, service.ErrInvalidTransaction),
+		errors.Is(err, service.ErrInvalidSourceType),
+		errors.Is(err, service.ErrInvalidLimit),
+		errors.Is(err, service.ErrInvalidBonus),
+		errors.Is(err, service.ErrInvalidAdjustment),
+		errors.Is(err, service.ErrInvalidAPIKey):
+		return problemSpec{http.StatusBadRequest, CodeInvalidRequest, "Invalid request"}
+	case errors.Is(err, service.ErrInvalidSignature):
+		return problemSpec{http.StatusUnauthorized, CodeInvalidSignature, "Request signature could not be verified"}
+	case errors.Is(err, service.ErrSourceTypeForbidden):
+		return problemSpec{http.StatusForbidden, CodeSourceTypeForbidden, "Provider may not send this source type"}
+	case errors.Is(err, service.ErrUnauthenticated):
+		return problemSpec{http.StatusUnauthorized, CodeUnauthenticated, "A valid API key is required"}
+	case errors.Is(err, service.ErrInsufficientScope):
+		return problemSpec{http.StatusForbidden, CodeInsufficientScope, "API key does not grant this operation"}
+	case errors.Is(err, service.ErrProviderNotFound):
+		return problemSpec{http.StatusNotFound, CodeProviderNotFound, "Provider not found"}
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return problemSpec{http.StatusNotFound, CodeAPIKeyNotFound, "API key not found"}
+	case errors.Is(err, service.ErrAPIKeyRevoked):
+		return problemSpec{http.StatusConflict, CodeAPIKeyRevoked, "API key already revoked"}
+	case errors.Is(err, service.ErrRateLimited):
+		return problemSpec{http.StatusTooManyRequests, CodeRateLimited, "Too many requests"}
+	case errors.Is(err, service.ErrUserNotFound):
+		return problemSpec{http.StatusNotFound, CodeUserNotFound, "User not found"}
+	case errors.Is(err, service.ErrWalletNotFound):
+		return problemSpec{http.StatusNotFound, CodeWalletNotFound, "User has no wallet in this currency"}
+	case errors.Is(err, service.ErrTransactionNotFound):
+		return problemSpec{http.StatusNotFound, CodeTransactionNotFound, "Transaction not found"}
+	case errors.Is(err, service.ErrSourceTypeNotFound):
+		return problemSpec{http.StatusNotFound, CodeSourceTypeNotFound, "Source type not found"}
+	case errors.Is(err, service.ErrSourceTypeExists):
+		return problemSpec{http.StatusConflict, CodeSourceTypeExists, "Source type already exists"}
+	case errors.Is(err, service.ErrUserLimitNotFound):
+		return problemSpec{http.StatusNotFound, CodeLimitNotFound, "No limit in force for this period"}
+	case errors.Is(err, service.ErrUserSuspended):
+		return problemSpec{http.StatusForbidden, CodeUserSuspended, "User is suspended"}
+	case errors.Is(err, service.ErrUserClosed):
+		return problemSpec{http.StatusForbidden, CodeUserClosed, "User is closed"}
+	case errors.Is(err, service.ErrReservationNotFound):
+		return problemSpec{http.StatusNotFound, CodeReservationNotFound, "Reservation not found"}
+	case errors.Is(err, service.ErrReservationSettled):
+		return problemSpec{http.StatusConflict, CodeReservationSettled, "Reservation already settled"}
+	case errors.Is(err, service.ErrTransactionReserved):
+		return problemSpec{http.StatusConflict, CodeTransactionReserved, "Transaction ID belongs to a reservation"}
+	case errors.Is(err, service.ErrAdjustmentNotFound):
+		return problemSpec{http.StatusNotFound, CodeAdjustmentNotFound, "Adjustment not found"}
+	case errors.Is(err, service.ErrAdjustmentDecided):
+		return problemSpec{http.StatusConflict, CodeAdjustmentDecided, "Adjustment already decided"}
+	case errors.Is(err, service.ErrSelfReview):
+		return problemSpec{http.StatusForbidden, CodeSelfReview, "Operators cannot review their own adjustments"}
+	case errors.Is(err, service.ErrLossLimitExceeded):
+		return problemSpec{http.StatusUnprocessableEntity, CodeLossLimitExceeded, "Loss limit exceeded"}
+	case errors.Is(err, service.ErrInsufficientFunds):
+		return problemSpec{http.StatusUnprocessableEntity, CodeInsufficientFunds, "Insufficient funds"}
+	case errors.Is(err, service.ErrDuplicateTransaction):
+		return problemSpec{
+			http.StatusConflict,
+			CodeDuplicateTransaction,
+			"Transaction ID already used with a different payload",
+		}
+	case errors.Is(err, service.ErrAlreadyRolledBack):
+		return problemSpec{http.StatusConflict, CodeAlreadyRolledBack, "Transaction already rolled back"}
+	case errors.Is(err, service.ErrTransactionRolledBack):
+		return problemSpec{http.StatusConflict, CodeTransactionRolledBack, "Transaction was rolled back"}
+	case errors.Is(err, service.ErrConstraintViolation):
+		return problemSpec{http.StatusConflict, CodeConstraintViolation, "Request conflicts with stored data"}
+	case errors.Is(err, service.ErrUnavailable):
+		return problemSpec{http.StatusServiceUnavailable, CodeServiceUnavailable, "Service temporarily unavailable"}
+	default:
+		return problemSpec{http.StatusInternalServerError, CodeInternalError, "Internal server error"}
+	}
+}
+
+// CodeForError returns the error code err is reported with, for instance to label the transaction
+// metrics by.
+func CodeForError(err error) ErrorCode {
+	return specForError(err).code
+}
+
+// WriteError writes the problem response matching err for middleware outside this package.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err)
+}
+
+// writeError writes the problem response matching err. Only invalid requests, invalid signatures,
+// missing scopes, rate limits and rule violations are explained in the detail, other errors may carry
+// internals that must not reach the client. Those of server errors are logged instead.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	spec := specForError(err)
+	if spec.status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "request failed", logging.Error(err))
+	}
+
+	var violation *service.RuleViolation
+
+	detail := ""
+	if spec.code == CodeInvalidRequest || spec.code == CodeInvalidSignature || spec.code == CodeInsufficientScope ||
+		spec.code == CodeRateLimited || errors.As(err, &violation) {
+		detail = err.Error()
+	}
+
+	writeProblem(w, r, spec.status, spec.code, spec.title, detail)
+}
+
+// writeValidationError writes a 400 problem response describing why the request was rejected.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request", err.Error())
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, title, detail string) {
+	trace.SpanFromContext(r.Context()).SetAttributes(tracing.ErrorCodeKey.String(string(code)))
+
+	writeProblemDetails(w, status, problem{
+		Type:     problemType(code),
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+func writeProblemDetails(w http.ResponseWriter, status int, p problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func problemType(code ErrorCode) string {
+	return "urn:problem-type:" + string(code)
+}
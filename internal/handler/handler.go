@@ -6,20 +6,53 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/tracing"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type Handler struct {
-	ts service.TransactionService
+	ts  service.TransactionService
+	sts service.SourceTypeService
+	ls  service.LimitService
+	bs  service.BonusService
+	rs  service.ReservationService
+	us  service.UserService
+	as  service.AdjustmentService
+	ks  service.APIKeyService
+	hs  service.HealthService
 }
 
-func NewHandler(ts service.TransactionService) *Handler {
-	return &Handler{ts: ts}
+// Services are the services the handlers call. Routes of a nil service must not be served.
+type Services struct {
+	Transactions service.TransactionService
+	SourceTypes  service.SourceTypeService
+	Limits       service.LimitService
+	Bonuses      service.BonusService
+	Reservations service.ReservationService
+	Users        service.UserService
+	Adjustments  service.AdjustmentService
+	APIKeys      service.APIKeyService
+	Health       service.HealthService
+}
+
+func NewHandler(services Services) *Handler {
+	return &Handler{
+		ts:  services.Transactions,
+		sts: services.SourceTypes,
+		ls:  services.Limits,
+		bs:  services.Bonuses,
+		rs:  services.Reservations,
+		us:  services.Users,
+		as:  services.Adjustments,
+		ks:  services.APIKeys,
+		hs:  services.Health,
+	}
 }
 
 func validateUserID(r *http.Request) (int, error) {
@@ -33,18 +66,34 @@ func validateUserID(r *http.Request) (int, error) {
 	return userIDInt, nil
 }
 
+// parseOptionalCurrency parses the currency query parameter. An empty currency selects the default one.
+func parseOptionalCurrency(r *http.Request) (model.Currency, error) {
+	value := r.URL.Query().Get("currency")
+	if value == "" {
+		return "", nil
+	}
+
+	return model.ToCurrency(value)
+}
+
 func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	userID, err := validateUserID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
+		return
+	}
+
+	currency, err := parseOptionalCurrency(r)
+	if err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
 
-	balance, err := h.ts.GetBalance(ctx, userID)
+	wallet, err := h.ts.GetBalance(ctx, userID, currency)
 	if err != nil {
-		http.Error(w, "Failed to get balance", http.StatusInternalServerError)
+		writeError(w, r, err)
 
 		return
 	}
@@ -52,10 +101,66 @@ func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	response := map[string]any{
-		"userId":  userID,
-		"balance": balance.StringFixed(2),
+		"userId":       userID,
+		"currency":     wallet.Currency,
+		"balance":      wallet.Total().StringFixed(2),
+		"realBalance":  wallet.Balance.StringFixed(2),
+		"bonusBalance": wallet.BonusBalance.StringFixed(2),
+		"heldBalance":  wallet.HeldBalance.StringFixed(2),
+	}
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// walletView shows the available balance with its breakdown into real and bonus money,
+// and the money held by open reservations.
+type walletView struct {
+	Currency     model.Currency `json:"currency"`
+	Balance      string         `json:"balance"`
+	RealBalance  string         `json:"realBalance"`
+	BonusBalance string         `json:"bonusBalance"`
+	HeldBalance  string         `json:"heldBalance"`
+}
+
+func newWalletView(wallet *model.Wallet) walletView {
+	return walletView{
+		Currency:     wallet.Currency,
+		Balance:      wallet.Total().StringFixed(2),
+		RealBalance:  wallet.Balance.StringFixed(2),
+		BonusBalance: wallet.BonusBalance.StringFixed(2),
+		HeldBalance:  wallet.HeldBalance.StringFixed(2),
+	}
+}
+
+type walletsResponse struct {
+	UserID  int          `json:"userId"`
+	Wallets []walletView `json:"wallets"`
+}
+
+func (h *Handler) ListWallets(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
 	}
 
+	wallets, err := h.ts.ListWallets(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := walletsResponse{UserID: userID, Wallets: make([]walletView, 0, len(wallets))}
+	for i := range wallets {
+		response.Wallets = append(response.Wallets, newWalletView(&wallets[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
 	if err = json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
@@ -64,11 +169,29 @@ func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 type transactionRequestBody struct {
 	State         string `json:"state"`
 	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
 	TransactionID string `json:"transactionId"`
+	// OriginalTransactionID is the transaction reversed by a rollback.
+	OriginalTransactionID string `json:"originalTransactionId"`
+}
+
+type transactionResponse struct {
+	TransactionID         string    `json:"transactionId"`
+	UserID                int       `json:"userId"`
+	State                 string    `json:"state"`
+	Amount                string    `json:"amount"`
+	Currency              string    `json:"currency"`
+	Balance               *string   `json:"balance,omitempty"`
+	ProcessedAt           time.Time `json:"processedAt"`
+	OriginalTransactionID *string   `json:"originalTransactionId,omitempty"`
+	Replayed              bool      `json:"replayed"`
 }
 
 const (
 	SourceTypeHeader string = "Source-Type"
+	CurrencyHeader   string = "Currency"
+	// ReplayedHeader is set on responses that return the outcome of an already processed transaction.
+	ReplayedHeader string = "Idempotent-Replayed"
 )
 
 func validateTransactionRequest(r *http.Request) (model.Transaction, error) {
@@ -82,48 +205,378 @@ func validateTransactionRequest(r *http.Request) (model.Transaction, error) {
 		return model.Transaction{}, errors.New("invalid request body")
 	}
 
-	amount, err := decimal.NewFromString(reqBody.Amount)
-	if err != nil || amount.LessThanOrEqual(decimal.Zero) {
-		return model.Transaction{}, errors.New("amount must be a positive number")
+	// The currency in the body takes precedence over the header; without both the default currency is used.
+	if reqBody.Currency == "" {
+		reqBody.Currency = r.Header.Get(CurrencyHeader)
 	}
 
-	state, err := model.ToTransactionState(reqBody.State)
+	return reqBody.toTransaction(userID, sourceTypeHeader(r))
+}
+
+// toTransaction validates the request body and converts it into a transaction of userID.
+func (b *transactionRequestBody) toTransaction(userID int, sourceTypeValue string) (model.Transaction, error) {
+	state, err := model.ToTransactionState(b.State)
 	if err != nil {
 		return model.Transaction{}, fmt.Errorf("invalid transaction state: %w", err)
 	}
 
-	sourceType, err := model.ToSourceType(r.Header.Get(SourceTypeHeader))
+	// The amount of a rollback is taken from the transaction it reverses.
+	var amount decimal.Decimal
+	if state != model.TransactionStateRollback {
+		amount, err = decimal.NewFromString(b.Amount)
+		if err != nil || amount.LessThanOrEqual(decimal.Zero) {
+			return model.Transaction{}, errors.New("amount must be a positive number")
+		}
+	}
+
+	sourceType, err := model.ToSourceType(sourceTypeValue)
 	if err != nil {
 		return model.Transaction{}, fmt.Errorf("invalid source type: %w", err)
 	}
 
-	transactionID, err := uuid.Parse(reqBody.TransactionID)
+	transactionID, err := uuid.Parse(b.TransactionID)
 	if err != nil || transactionID == uuid.Nil {
 		return model.Transaction{}, errors.New("invalid transactionId format")
 	}
 
-	return model.Transaction{
+	tx := model.Transaction{
 		ID:         transactionID,
 		UserID:     userID,
 		State:      state,
 		Amount:     amount,
 		SourceType: sourceType,
-	}, nil
+	}
+
+	if b.Currency != "" {
+		if tx.Currency, err = model.ToCurrency(b.Currency); err != nil {
+			return model.Transaction{}, err
+		}
+	}
+
+	switch {
+	case state == model.TransactionStateRollback:
+		originalID, err := uuid.Parse(b.OriginalTransactionID)
+		if err != nil || originalID == uuid.Nil || originalID == transactionID {
+			return model.Transaction{}, errors.New("rollback requires a valid originalTransactionId")
+		}
+
+		tx.OriginalTransactionID = &originalID
+	case b.OriginalTransactionID != "":
+		return model.Transaction{}, errors.New("originalTransactionId is only allowed for rollbacks")
+	}
+
+	return tx, nil
+}
+
+func newTransactionResponse(processed *model.ProcessedTransaction) transactionResponse {
+	response := transactionResponse{
+		TransactionID: processed.TransactionID.String(),
+		UserID:        processed.UserID,
+		State:         string(processed.State),
+		Amount:        processed.Amount.StringFixed(2),
+		Currency:      string(processed.Currency),
+		ProcessedAt:   processed.ProcessedAt,
+		Replayed:      processed.Replayed,
+	}
+
+	if processed.Balance.Valid {
+		balance := processed.Balance.Decimal.StringFixed(2)
+		response.Balance = &balance
+	}
+
+	if processed.OriginalTransactionID != nil {
+		originalID := processed.OriginalTransactionID.String()
+		response.OriginalTransactionID = &originalID
+	}
+
+	return response
 }
 
 func (h *Handler) ProcessTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(r.Context(), "Handler.ProcessTransaction")
+	defer span.End()
+
+	r = r.WithContext(ctx)
+
 	validatedReq, err := validateTransactionRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
 		return
 	}
-	ctx := r.Context()
+	if validatedReq.Provider, err = providerFor(r, validatedReq.SourceType); err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	span.SetAttributes(tracing.TransactionAttributes(&validatedReq)...)
+
+	processed, err := h.ts.ProcessTransaction(ctx, &validatedReq)
+	span.SetAttributes(tracing.OutcomeKey.String(tracing.TransactionOutcome(processed, err)))
+
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := newTransactionResponse(processed)
+
+	if processed.Replayed {
+		w.Header().Set(ReplayedHeader, "true")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// MaxPageSize caps the number of transactions returned in one page of the history.
+const MaxPageSize = 200
+
+// transactionView is the public representation of a stored transaction.
+type transactionView struct {
+	TransactionID         string    `json:"transactionId"`
+	UserID                int       `json:"userId"`
+	State                 string    `json:"state"`
+	Amount                string    `json:"amount"`
+	Currency              string    `json:"currency"`
+	SourceType            string    `json:"sourceType"`
+	CreatedAt             time.Time `json:"createdAt"`
+	BalanceAfter          *string   `json:"balanceAfter"`
+	OriginalTransactionID *string   `json:"originalTransactionId,omitempty"`
+	Provider              string    `json:"provider,omitempty"`
+}
+
+func newTransactionView(tx *model.Transaction) transactionView {
+	view := transactionView{
+		TransactionID: tx.ID.String(),
+		UserID:        tx.UserID,
+		State:         string(tx.State),
+		Amount:        tx.Amount.StringFixed(2),
+		Currency:      string(tx.Currency),
+		SourceType:    string(tx.SourceType),
+		CreatedAt:     tx.CreatedAt,
+		Provider:      tx.Provider,
+	}
+
+	if tx.BalanceAfter.Valid {
+		balance := tx.BalanceAfter.Decimal.StringFixed(2)
+		view.BalanceAfter = &balance
+	}
+
+	if tx.OriginalTransactionID != nil {
+		originalID := tx.OriginalTransactionID.String()
+		view.OriginalTransactionID = &originalID
+	}
+
+	return view
+}
+
+type transactionPageResponse struct {
+	UserID       int               `json:"userId"`
+	Transactions []transactionView `json:"transactions"`
+	NextCursor   string            `json:"nextCursor,omitempty"`
+}
+
+func validateTransactionID(r *http.Request) (uuid.UUID, error) {
+	transactionID, err := uuid.Parse(chi.URLParam(r, "transactionID"))
+	if err != nil || transactionID == uuid.Nil {
+		return uuid.Nil, errors.New("invalid transactionId format")
+	}
+
+	return transactionID, nil
+}
+
+func (h *Handler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := validateTransactionID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	tx, err := h.ts.GetTransaction(r.Context(), transactionID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	if !readable(r, tx.Provider) {
+		writeError(w, r, service.ErrTransactionNotFound)
+
+		return
+	}
+
+	writeTransaction(w, tx)
+}
+
+func (h *Handler) GetUserTransaction(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	transactionID, err := validateTransactionID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	tx, err := h.ts.GetUserTransaction(r.Context(), userID, transactionID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	if !readable(r, tx.Provider) {
+		writeError(w, r, service.ErrTransactionNotFound)
+
+		return
+	}
+
+	writeTransaction(w, tx)
+}
+
+func writeTransaction(w http.ResponseWriter, tx *model.Transaction) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(newTransactionView(tx)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func parseOptionalAmount(r *http.Request, param string) (decimal.NullDecimal, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+
+	amount, err := decimal.NewFromString(value)
+	if err != nil || amount.IsNegative() {
+		return decimal.NullDecimal{}, fmt.Errorf("%s must be a non-negative number", param)
+	}
+
+	return decimal.NewNullDecimal(amount), nil
+}
+
+func parseOptionalTime(r *http.Request, param string) (time.Time, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+	}
+
+	return t, nil
+}
+
+func validateTransactionFilter(r *http.Request) (model.TransactionFilter, error) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		return model.TransactionFilter{}, err
+	}
+
+	query := r.URL.Query()
+	filter := model.TransactionFilter{UserID: userID, Provider: providerName(r), Limit: service.DefaultPageSize}
+
+	if value := query.Get("state"); value != "" {
+		if filter.State, err = model.ToTransactionState(value); err != nil {
+			return model.TransactionFilter{}, err
+		}
+	}
+
+	if value := query.Get("sourceType"); value != "" {
+		if filter.SourceType, err = model.ToSourceType(value); err != nil {
+			return model.TransactionFilter{}, err
+		}
+	}
+
+	if filter.Currency, err = parseOptionalCurrency(r); err != nil {
+		return model.TransactionFilter{}, err
+	}
+
+	if filter.MinAmount, err = parseOptionalAmount(r, "minAmount"); err != nil {
+		return model.TransactionFilter{}, err
+	}
+
+	if filter.MaxAmount, err = parseOptionalAmount(r, "maxAmount"); err != nil {
+		return model.TransactionFilter{}, err
+	}
+
+	if filter.MinAmount.Valid && filter.MaxAmount.Valid &&
+		filter.MinAmount.Decimal.GreaterThan(filter.MaxAmount.Decimal) {
+		return model.TransactionFilter{}, errors.New("minAmount must not exceed maxAmount")
+	}
+
+	if filter.From, err = parseOptionalTime(r, "from"); err != nil {
+		return model.TransactionFilter{}, err
+	}
 
-	if err = h.ts.ProcessTransaction(ctx, &validatedReq); err != nil {
-		http.Error(w, "Failed to process transaction", http.StatusInternalServerError)
+	if filter.To, err = parseOptionalTime(r, "to"); err != nil {
+		return model.TransactionFilter{}, err
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return model.TransactionFilter{}, errors.New("from must be before to")
+	}
 
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 || filter.Limit > MaxPageSize {
+			return model.TransactionFilter{}, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := model.DecodeTransactionCursor(value)
+		if err != nil {
+			return model.TransactionFilter{}, err
+		}
+
+		filter.After = &cursor
+	}
+
+	return filter, nil
+}
+
+func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	filter, err := validateTransactionFilter(r)
+	if err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
 
+	page, err := h.ts.ListTransactions(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := transactionPageResponse{
+		UserID:       filter.UserID,
+		Transactions: make([]transactionView, 0, len(page.Transactions)),
+		NextCursor:   page.NextCursor,
+	}
+
+	for i := range page.Transactions {
+		response.Transactions = append(response.Transactions, newTransactionView(&page.Transactions[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
 }
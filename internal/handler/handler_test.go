@@ -5,12 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
@@ -25,19 +29,352 @@ type MockTransactionService struct {
 	processed []*model.Transaction
 }
 
-func (m *MockTransactionService) GetBalance(_ context.Context, userID int) (decimal.Decimal, error) {
+func (m *MockTransactionService) GetBalance(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+) (*model.Wallet, error) {
+	args := m.Called(userID, currency)
+	wallet, _ := args.Get(0).(*model.Wallet)
+	return wallet, args.Error(1)
+}
+
+func (m *MockTransactionService) ListWallets(_ context.Context, userID int) ([]model.Wallet, error) {
 	args := m.Called(userID)
-	return args.Get(0).(decimal.Decimal), args.Error(1)
+	wallets, _ := args.Get(0).([]model.Wallet)
+	return wallets, args.Error(1)
 }
 
-func (m *MockTransactionService) ProcessTransaction(_ context.Context, tx *model.Transaction) error {
+func (m *MockTransactionService) ProcessTransaction(
+	_ context.Context,
+	tx *model.Transaction,
+) (*model.ProcessedTransaction, error) {
 	args := m.Called(tx)
-	err := args.Error(0)
-	if err == nil {
-		m.processed = append(m.processed, tx)
+	err := args.Error(1)
+	if err != nil {
+		return nil, err
+	}
+
+	m.processed = append(m.processed, tx)
+
+	if processed, ok := args.Get(0).(*model.ProcessedTransaction); ok {
+		return processed, nil
 	}
 
-	return err
+	return &model.ProcessedTransaction{
+		TransactionID: tx.ID,
+		UserID:        tx.UserID,
+		State:         tx.State,
+		Amount:        tx.Amount,
+		ProcessedAt:   time.Now(),
+	}, nil
+}
+
+func (m *MockTransactionService) ListTransactions(
+	_ context.Context,
+	filter model.TransactionFilter,
+) (*model.TransactionPage, error) {
+	args := m.Called(filter)
+	page, _ := args.Get(0).(*model.TransactionPage)
+	return page, args.Error(1)
+}
+
+func (m *MockTransactionService) GetTransaction(_ context.Context, txID uuid.UUID) (*model.Transaction, error) {
+	args := m.Called(txID)
+	tx, _ := args.Get(0).(*model.Transaction)
+	return tx, args.Error(1)
+}
+
+func (m *MockTransactionService) GetUserTransaction(
+	_ context.Context,
+	userID int,
+	txID uuid.UUID,
+) (*model.Transaction, error) {
+	args := m.Called(userID, txID)
+	tx, _ := args.Get(0).(*model.Transaction)
+	return tx, args.Error(1)
+}
+
+func (m *MockTransactionService) ProcessBatch(
+	_ context.Context,
+	txs []*model.Transaction,
+	mode model.BatchMode,
+) ([]model.BatchItemResult, error) {
+	args := m.Called(txs, mode)
+	results, _ := args.Get(0).([]model.BatchItemResult)
+	return results, args.Error(1)
+}
+
+type MockSourceTypeService struct {
+	mock.Mock
+}
+
+func (m *MockSourceTypeService) Check(
+	_ context.Context,
+	sourceType model.SourceType,
+	state model.TransactionState,
+) error {
+	args := m.Called(sourceType, state)
+	return args.Error(0)
+}
+
+func (m *MockSourceTypeService) ListSourceTypes(_ context.Context) ([]model.SourceTypeSettings, error) {
+	args := m.Called()
+	sourceTypes, _ := args.Get(0).([]model.SourceTypeSettings)
+	return sourceTypes, args.Error(1)
+}
+
+func (m *MockSourceTypeService) CreateSourceType(_ context.Context, settings *model.SourceTypeSettings) error {
+	args := m.Called(settings)
+	return args.Error(0)
+}
+
+func (m *MockSourceTypeService) UpdateSourceType(
+	_ context.Context,
+	name model.SourceType,
+	update model.SourceTypeUpdate,
+) (*model.SourceTypeSettings, error) {
+	args := m.Called(name, update)
+	settings, _ := args.Get(0).(*model.SourceTypeSettings)
+	return settings, args.Error(1)
+}
+
+type MockLimitService struct {
+	mock.Mock
+}
+
+func (m *MockLimitService) ListLimits(_ context.Context, userID int) ([]model.UserLimit, error) {
+	args := m.Called(userID)
+	limits, _ := args.Get(0).([]model.UserLimit)
+	return limits, args.Error(1)
+}
+
+func (m *MockLimitService) SetLimit(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+	amount decimal.Decimal,
+) (*model.UserLimit, error) {
+	args := m.Called(userID, currency, period, amount.String())
+	limit, _ := args.Get(0).(*model.UserLimit)
+	return limit, args.Error(1)
+}
+
+func (m *MockLimitService) RemoveLimit(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+) (*model.UserLimit, error) {
+	args := m.Called(userID, currency, period)
+	limit, _ := args.Get(0).(*model.UserLimit)
+	return limit, args.Error(1)
+}
+
+type MockBonusService struct {
+	mock.Mock
+}
+
+func (m *MockBonusService) GrantBonus(_ context.Context, grant *model.BonusGrant) (*model.BonusGrant, error) {
+	args := m.Called(grant.GrantID, grant.UserID, grant.Currency, grant.Amount.String(),
+		grant.WageringRequirement.String())
+	granted, _ := args.Get(0).(*model.BonusGrant)
+	return granted, args.Error(1)
+}
+
+func (m *MockBonusService) ListBonusGrants(_ context.Context, userID int) ([]model.BonusGrant, error) {
+	args := m.Called(userID)
+	grants, _ := args.Get(0).([]model.BonusGrant)
+	return grants, args.Error(1)
+}
+
+type MockReservationService struct {
+	mock.Mock
+}
+
+func (m *MockReservationService) Reserve(
+	_ context.Context,
+	reservation *model.Reservation,
+) (*model.Reservation, error) {
+	args := m.Called(reservation)
+	stored, _ := args.Get(0).(*model.Reservation)
+	return stored, args.Error(1)
+}
+
+func (m *MockReservationService) GetReservation(
+	_ context.Context,
+	userID int,
+	id uuid.UUID,
+) (*model.Reservation, error) {
+	args := m.Called(userID, id)
+	reservation, _ := args.Get(0).(*model.Reservation)
+	return reservation, args.Error(1)
+}
+
+func (m *MockReservationService) Commit(
+	_ context.Context,
+	userID int,
+	id uuid.UUID,
+	provider string,
+) (*model.ProcessedTransaction, error) {
+	args := m.Called(userID, id, provider)
+	processed, _ := args.Get(0).(*model.ProcessedTransaction)
+	return processed, args.Error(1)
+}
+
+func (m *MockReservationService) Release(
+	_ context.Context,
+	userID int,
+	id uuid.UUID,
+	provider string,
+) (*model.Reservation, error) {
+	args := m.Called(userID, id, provider)
+	reservation, _ := args.Get(0).(*model.Reservation)
+	return reservation, args.Error(1)
+}
+
+func (m *MockReservationService) ExpireReservations(context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+type MockHealthService struct {
+	mock.Mock
+}
+
+func (m *MockHealthService) Readiness(_ context.Context) *model.HealthReport {
+	args := m.Called()
+	return args.Get(0).(*model.HealthReport)
+}
+
+func (m *MockHealthService) Drain() {
+	m.Called()
+}
+
+type MockUserService struct {
+	mock.Mock
+}
+
+func (m *MockUserService) CreateUser(_ context.Context, currency model.Currency) (*model.User, error) {
+	args := m.Called(currency)
+	user, _ := args.Get(0).(*model.User)
+	return user, args.Error(1)
+}
+
+func (m *MockUserService) GetUser(_ context.Context, userID int) (*model.User, error) {
+	args := m.Called(userID)
+	user, _ := args.Get(0).(*model.User)
+	return user, args.Error(1)
+}
+
+func (m *MockUserService) SetUserStatus(
+	_ context.Context,
+	userID int,
+	status model.UserStatus,
+) (*model.User, error) {
+	args := m.Called(userID, status)
+	user, _ := args.Get(0).(*model.User)
+	return user, args.Error(1)
+}
+
+type MockAdjustmentService struct {
+	mock.Mock
+}
+
+func (m *MockAdjustmentService) RequestAdjustment(
+	_ context.Context,
+	adjustment *model.ManualAdjustment,
+) (*model.ManualAdjustment, error) {
+	args := m.Called(adjustment)
+	result, _ := args.Get(0).(*model.ManualAdjustment)
+	return result, args.Error(1)
+}
+
+func (m *MockAdjustmentService) GetAdjustment(_ context.Context, id uuid.UUID) (*model.ManualAdjustment, error) {
+	args := m.Called(id)
+	adjustment, _ := args.Get(0).(*model.ManualAdjustment)
+	return adjustment, args.Error(1)
+}
+
+func (m *MockAdjustmentService) ListAdjustments(
+	_ context.Context,
+	status model.AdjustmentStatus,
+) ([]model.ManualAdjustment, error) {
+	args := m.Called(status)
+	adjustments, _ := args.Get(0).([]model.ManualAdjustment)
+	return adjustments, args.Error(1)
+}
+
+func (m *MockAdjustmentService) ListAuditEvents(_ context.Context, id uuid.UUID) ([]model.AuditEvent, error) {
+	args := m.Called(id)
+	events, _ := args.Get(0).([]model.AuditEvent)
+	return events, args.Error(1)
+}
+
+func (m *MockAdjustmentService) ApproveAdjustment(
+	_ context.Context,
+	id uuid.UUID,
+	reviewer model.Operator,
+	comment string,
+) (*model.ManualAdjustment, error) {
+	args := m.Called(id, reviewer, comment)
+	adjustment, _ := args.Get(0).(*model.ManualAdjustment)
+	return adjustment, args.Error(1)
+}
+
+func (m *MockAdjustmentService) RejectAdjustment(
+	_ context.Context,
+	id uuid.UUID,
+	reviewer model.Operator,
+	comment string,
+) (*model.ManualAdjustment, error) {
+	args := m.Called(id, reviewer, comment)
+	adjustment, _ := args.Get(0).(*model.ManualAdjustment)
+	return adjustment, args.Error(1)
+}
+
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) Authenticate(_ context.Context, key string) (*model.APIKey, *model.Provider, error) {
+	args := m.Called(key)
+	apiKey, _ := args.Get(0).(*model.APIKey)
+	provider, _ := args.Get(1).(*model.Provider)
+	return apiKey, provider, args.Error(2)
+}
+
+func (m *MockAPIKeyService) IssueAPIKey(
+	_ context.Context,
+	provider string,
+	scopes []model.APIKeyScope,
+) (*model.APIKey, string, error) {
+	args := m.Called(provider, scopes)
+	apiKey, _ := args.Get(0).(*model.APIKey)
+	return apiKey, args.String(1), args.Error(2)
+}
+
+func (m *MockAPIKeyService) RotateAPIKey(
+	_ context.Context,
+	id uuid.UUID,
+	provider string,
+) (*model.APIKey, string, error) {
+	args := m.Called(id, provider)
+	apiKey, _ := args.Get(0).(*model.APIKey)
+	return apiKey, args.String(1), args.Error(2)
+}
+
+func (m *MockAPIKeyService) RevokeAPIKey(_ context.Context, id uuid.UUID, provider string) (*model.APIKey, error) {
+	args := m.Called(id, provider)
+	apiKey, _ := args.Get(0).(*model.APIKey)
+	return apiKey, args.Error(1)
+}
+
+func (m *MockAPIKeyService) ListAPIKeys(_ context.Context, provider string) ([]model.APIKey, error) {
+	args := m.Called(provider)
+	keys, _ := args.Get(0).([]model.APIKey)
+	return keys, args.Error(1)
 }
 
 func TestValidateUserID(t *testing.T) {
@@ -107,7 +444,7 @@ func TestValidateTransactionRequest(t *testing.T) {
 		{
 			name:         "invalid source header",
 			userParam:    "5",
-			sourceHeader: "unknown",
+			sourceHeader: "Unknown Source",
 			body:         `{"state":"win","amount":"50.00","transactionId":"` + uuid.New().String() + `"}`,
 			wantErr:      true,
 		},
@@ -139,6 +476,51 @@ func TestValidateTransactionRequest(t *testing.T) {
 			body:         `{"state":"invalid","amount":"50.00","transactionId":"` + uuid.New().String() + `"}`,
 			wantErr:      true,
 		},
+		{
+			name:         "valid rollback without amount",
+			userParam:    "5",
+			sourceHeader: string(model.SourceTypeGame),
+			body: `{"state":"rollback","transactionId":"` + uuid.New().String() +
+				`","originalTransactionId":"` + transactionID + `"}`,
+			wantErr: false,
+		},
+		{
+			name:         "rollback without original transaction id",
+			userParam:    "5",
+			sourceHeader: string(model.SourceTypeGame),
+			body:         `{"state":"rollback","transactionId":"` + uuid.New().String() + `"}`,
+			wantErr:      true,
+		},
+		{
+			name:         "rollback referencing itself",
+			userParam:    "5",
+			sourceHeader: string(model.SourceTypeGame),
+			body: `{"state":"rollback","transactionId":"` + transactionID +
+				`","originalTransactionId":"` + transactionID + `"}`,
+			wantErr: true,
+		},
+		{
+			name:         "original transaction id on a win",
+			userParam:    "5",
+			sourceHeader: string(model.SourceTypeGame),
+			body: `{"state":"win","amount":"5.00","transactionId":"` + uuid.New().String() +
+				`","originalTransactionId":"` + transactionID + `"}`,
+			wantErr: true,
+		},
+		{
+			name:         "valid currency",
+			userParam:    "5",
+			sourceHeader: string(model.SourceTypeGame),
+			body:         `{"state":"win","amount":"5.00","currency":"USD","transactionId":"` + uuid.New().String() + `"}`,
+			wantErr:      false,
+		},
+		{
+			name:         "unsupported currency",
+			userParam:    "5",
+			sourceHeader: string(model.SourceTypeGame),
+			body:         `{"state":"win","amount":"5.00","currency":"JPY","transactionId":"` + uuid.New().String() + `"}`,
+			wantErr:      true,
+		},
 		{
 			name:         "missing transaction id",
 			userParam:    "5",
@@ -176,10 +558,46 @@ func TestValidateTransactionRequest(t *testing.T) {
 	}
 }
 
+func TestValidateTransactionRequestCurrency(t *testing.T) {
+	tests := []struct {
+		name           string
+		currencyHeader string
+		bodyCurrency   string
+		want           model.Currency
+	}{
+		{name: "none", want: ""},
+		{name: "header", currencyHeader: "GBP", want: model.CurrencyGBP},
+		{name: "body", bodyCurrency: "USD", want: model.CurrencyUSD},
+		{name: "body takes precedence", currencyHeader: "GBP", bodyCurrency: "USD", want: model.CurrencyUSD},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"state":"win","amount":"5.00","currency":%q,"transactionId":%q}`,
+				tt.bodyCurrency, uuid.New().String())
+			req := httptest.NewRequest(http.MethodPost, "/dummy", bytes.NewBufferString(body))
+			req.Header.Set(SourceTypeHeader, string(model.SourceTypeGame))
+			if tt.currencyHeader != "" {
+				req.Header.Set(CurrencyHeader, tt.currencyHeader)
+			}
+
+			ctx := chi.NewRouteContext()
+			ctx.URLParams.Add("userID", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+			got, err := validateTransactionRequest(req)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Currency)
+		})
+	}
+}
+
 func TestHandlerGetBalance(t *testing.T) {
 	tests := []struct {
 		name       string
 		userID     string
+		query      string
 		setupMock  func(m *MockTransactionService)
 		wantStatus int
 		wantBody   map[string]any
@@ -188,12 +606,43 @@ func TestHandlerGetBalance(t *testing.T) {
 			name:   "success",
 			userID: "1",
 			setupMock: func(m *MockTransactionService) {
-				m.On("GetBalance", 1).Return(decimal.RequireFromString("123.45"), nil)
+				m.On("GetBalance", 1, model.Currency("")).Return(&model.Wallet{
+					UserID:       1,
+					Currency:     model.CurrencyEUR,
+					Balance:      decimal.RequireFromString("123.45"),
+					BonusBalance: decimal.RequireFromString("10"),
+					HeldBalance:  decimal.RequireFromString("20"),
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody: map[string]any{
+				"userId":       float64(1),
+				"currency":     "EUR",
+				"balance":      "133.45",
+				"realBalance":  "123.45",
+				"bonusBalance": "10.00",
+				"heldBalance":  "20.00",
+			},
+		},
+		{
+			name:   "success - requested currency",
+			userID: "1",
+			query:  "?currency=USD",
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetBalance", 1, model.CurrencyUSD).Return(&model.Wallet{
+					UserID:   1,
+					Currency: model.CurrencyUSD,
+					Balance:  decimal.RequireFromString("5"),
+				}, nil)
 			},
 			wantStatus: http.StatusOK,
 			wantBody: map[string]any{
-				"userId":  float64(1),
-				"balance": "123.45",
+				"userId":       float64(1),
+				"currency":     "USD",
+				"balance":      "5.00",
+				"realBalance":  "5.00",
+				"bonusBalance": "0.00",
+				"heldBalance":  "0.00",
 			},
 		},
 		{
@@ -203,11 +652,38 @@ func TestHandlerGetBalance(t *testing.T) {
 			wantStatus: http.StatusBadRequest,
 			wantBody:   nil,
 		},
+		{
+			name:       "validation error - unsupported currency",
+			userID:     "1",
+			query:      "?currency=JPY",
+			setupMock:  func(_ *MockTransactionService) {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   nil,
+		},
 		{
 			name:   "service error - user not found",
 			userID: "1",
 			setupMock: func(m *MockTransactionService) {
-				m.On("GetBalance", 1).Return(decimal.Zero, errors.New("db error"))
+				m.On("GetBalance", 1, model.Currency("")).Return(nil, service.ErrUserNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   nil,
+		},
+		{
+			name:   "service error - wallet not found",
+			userID: "1",
+			query:  "?currency=GBP",
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetBalance", 1, model.CurrencyGBP).Return(nil, service.ErrWalletNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   nil,
+		},
+		{
+			name:   "service error - db error",
+			userID: "1",
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetBalance", 1, model.Currency("")).Return(nil, errors.New("db error"))
 			},
 			wantStatus: http.StatusInternalServerError,
 			wantBody:   nil,
@@ -216,12 +692,12 @@ func TestHandlerGetBalance(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := &MockTransactionService{}
-			tt.setupMock(service)
+			ts := &MockTransactionService{}
+			tt.setupMock(ts)
 
-			h := NewHandler(service)
+			h := NewHandler(Services{Transactions: ts})
 
-			req := httptest.NewRequest(http.MethodGet, "/user/"+tt.userID+"/balance", nil)
+			req := httptest.NewRequest(http.MethodGet, "/user/"+tt.userID+"/balance"+tt.query, nil)
 			ctx := chi.NewRouteContext()
 			ctx.URLParams.Add("userID", tt.userID)
 			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
@@ -234,15 +710,56 @@ func TestHandlerGetBalance(t *testing.T) {
 				assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
 				var body map[string]any
 				require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
-				assert.Equal(t, tt.wantBody["userId"], body["userId"])
-				assert.Equal(t, tt.wantBody["balance"], body["balance"])
+				assert.Equal(t, tt.wantBody, body)
 			}
 
-			service.AssertExpectations(t)
+			ts.AssertExpectations(t)
 		})
 	}
 }
 
+func TestHandlerListWallets(t *testing.T) {
+	ts := &MockTransactionService{}
+	ts.On("ListWallets", 1).Return([]model.Wallet{
+		{UserID: 1, Currency: model.CurrencyEUR, Balance: decimal.RequireFromString("100")},
+		{
+			UserID:       1,
+			Currency:     model.CurrencyUSD,
+			Balance:      decimal.RequireFromString("2.5"),
+			BonusBalance: decimal.RequireFromString("1"),
+			HeldBalance:  decimal.RequireFromString("4"),
+		},
+	}, nil)
+	ts.On("ListWallets", 9).Return(nil, service.ErrUserNotFound)
+
+	h := NewHandler(Services{Transactions: ts})
+
+	request := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user/"+userID+"/wallets", nil)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", userID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+		h.ListWallets(resp, req)
+
+		return resp
+	}
+
+	resp := request("1")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"userId":1,"wallets":[
+		{"currency":"EUR","balance":"100.00","realBalance":"100.00","bonusBalance":"0.00","heldBalance":"0.00"},
+		{"currency":"USD","balance":"3.50","realBalance":"2.50","bonusBalance":"1.00","heldBalance":"4.00"}
+	]}`, resp.Body.String())
+
+	resp = request("9")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, ProblemContentType, resp.Header().Get("Content-Type"))
+
+	ts.AssertExpectations(t)
+}
+
 func TestHandlerProcessTransaction(t *testing.T) {
 	transactionID := uuid.New().String()
 
@@ -254,6 +771,7 @@ func TestHandlerProcessTransaction(t *testing.T) {
 		setupMock     func(m *MockTransactionService)
 		wantStatus    int
 		wantProcessed bool
+		wantReplayed  bool
 	}{
 		{
 			name:        "success",
@@ -261,10 +779,41 @@ func TestHandlerProcessTransaction(t *testing.T) {
 			userID:      "1",
 			sourceType:  string(model.SourceTypeGame),
 			setupMock: func(m *MockTransactionService) {
-				m.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).Return(nil)
+				m.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).Return(nil, nil)
+			},
+			wantStatus:    http.StatusOK,
+			wantProcessed: true,
+		},
+		{
+			name:        "replayed duplicate",
+			requestBody: []byte(`{"state":"win","amount":"10.00","transactionId":"` + transactionID + `"}`),
+			userID:      "1",
+			sourceType:  string(model.SourceTypeGame),
+			setupMock: func(m *MockTransactionService) {
+				m.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).Return(&model.ProcessedTransaction{
+					TransactionID: uuid.MustParse(transactionID),
+					UserID:        1,
+					State:         model.TransactionStateWin,
+					Amount:        decimal.RequireFromString("10.00"),
+					Balance:       decimal.NewNullDecimal(decimal.RequireFromString("110.00")),
+					Replayed:      true,
+				}, nil)
 			},
 			wantStatus:    http.StatusOK,
 			wantProcessed: true,
+			wantReplayed:  true,
+		},
+		{
+			name:        "conflict - duplicate with different payload",
+			requestBody: []byte(`{"state":"lose","amount":"10.00","transactionId":"` + transactionID + `"}`),
+			userID:      "1",
+			sourceType:  string(model.SourceTypeGame),
+			setupMock: func(m *MockTransactionService) {
+				m.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).
+					Return(nil, service.ErrDuplicateTransaction)
+			},
+			wantStatus:    http.StatusConflict,
+			wantProcessed: false,
 		},
 		{
 			name:          "bad request - invalid body",
@@ -282,7 +831,7 @@ func TestHandlerProcessTransaction(t *testing.T) {
 			sourceType:  string(model.SourceTypePayment),
 			setupMock: func(m *MockTransactionService) {
 				m.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).
-					Return(errors.New("insert failed"))
+					Return(nil, errors.New("insert failed"))
 			},
 			wantStatus:    http.StatusInternalServerError,
 			wantProcessed: false,
@@ -291,9 +840,9 @@ func TestHandlerProcessTransaction(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := &MockTransactionService{}
-			tt.setupMock(service)
-			h := NewHandler(service)
+			ts := &MockTransactionService{}
+			tt.setupMock(ts)
+			h := NewHandler(Services{Transactions: ts})
 
 			req := httptest.NewRequest(
 				http.MethodPost,
@@ -312,13 +861,1329 @@ func TestHandlerProcessTransaction(t *testing.T) {
 
 			assert.Equal(t, tt.wantStatus, resp.Code)
 			if tt.wantProcessed {
-				require.Len(t, service.processed, 1)
-				assert.Equal(t, 1, service.processed[0].UserID)
+				require.Len(t, ts.processed, 1)
+				assert.Equal(t, 1, ts.processed[0].UserID)
+
+				var body map[string]any
+				require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+				assert.Equal(t, tt.wantReplayed, body["replayed"])
+				if tt.wantReplayed {
+					assert.Equal(t, "true", resp.Header().Get(ReplayedHeader))
+					assert.Equal(t, "110.00", body["balance"])
+				}
 			} else {
-				assert.Empty(t, service.processed)
+				assert.Empty(t, ts.processed)
+			}
+
+			ts.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandlerProcessTransactionProvider(t *testing.T) {
+	provider := &model.Provider{Name: "acme", SourceTypes: []model.SourceType{model.SourceTypeGame}}
+
+	process := func(ts *MockTransactionService, sourceType model.SourceType) *httptest.ResponseRecorder {
+		body := `{"state":"win","amount":"10.00","transactionId":"` + uuid.New().String() + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/1/transaction", bytes.NewReader([]byte(body)))
+		req.Header.Set(SourceTypeHeader, string(sourceType))
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", "1")
+		req = req.WithContext(WithProvider(context.WithValue(req.Context(), chi.RouteCtxKey, ctx), provider))
+
+		resp := httptest.NewRecorder()
+		NewHandler(Services{Transactions: ts}).ProcessTransaction(resp, req)
+
+		return resp
+	}
+
+	t.Run("provider is stored on the transaction", func(t *testing.T) {
+		ts := &MockTransactionService{}
+		ts.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).Return(nil, nil)
+
+		resp := process(ts, model.SourceTypeGame)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		require.Len(t, ts.processed, 1)
+		assert.Equal(t, "acme", ts.processed[0].Provider)
+	})
+
+	t.Run("source type of a single source type provider may be left out", func(t *testing.T) {
+		ts := &MockTransactionService{}
+		ts.On("ProcessTransaction", mock.AnythingOfType("*model.Transaction")).Return(nil, nil)
+
+		resp := process(ts, "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		require.Len(t, ts.processed, 1)
+		assert.Equal(t, model.SourceTypeGame, ts.processed[0].SourceType)
+	})
+
+	t.Run("source type of another provider is forbidden", func(t *testing.T) {
+		ts := &MockTransactionService{}
+
+		resp := process(ts, model.SourceTypePayment)
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Empty(t, ts.processed)
+	})
+}
+
+func TestValidateTransactionFilter(t *testing.T) {
+	cursor := model.TransactionCursor{CreatedAt: time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC), ID: uuid.New()}
+
+	tests := []struct {
+		name     string
+		query    string
+		provider string
+		want     model.TransactionFilter
+		wantErr  bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  model.TransactionFilter{UserID: 1, Limit: service.DefaultPageSize},
+		},
+		{
+			name: "all filters",
+			query: "?state=lose&sourceType=payment&minAmount=1.50&maxAmount=20&from=2025-10-01T00:00:00Z" +
+				"&to=2025-10-02T00:00:00Z&limit=10&cursor=" + cursor.Encode(),
+			want: model.TransactionFilter{
+				UserID:     1,
+				State:      model.TransactionStateLose,
+				SourceType: model.SourceTypePayment,
+				MinAmount:  decimal.NewNullDecimal(decimal.RequireFromString("1.50")),
+				MaxAmount:  decimal.NewNullDecimal(decimal.NewFromInt(20)),
+				From:       time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+				To:         time.Date(2025, 10, 2, 0, 0, 0, 0, time.UTC),
+				After:      &cursor,
+				Limit:      10,
+			},
+		},
+		{
+			name:     "provider",
+			query:    "",
+			provider: "acme",
+			want:     model.TransactionFilter{UserID: 1, Provider: "acme", Limit: service.DefaultPageSize},
+		},
+		{name: "invalid state", query: "?state=draw", wantErr: true},
+		{name: "invalid source type", query: "?sourceType=Casino!", wantErr: true},
+		{name: "negative amount", query: "?minAmount=-1", wantErr: true},
+		{name: "min above max", query: "?minAmount=10&maxAmount=5", wantErr: true},
+		{name: "invalid date", query: "?from=yesterday", wantErr: true},
+		{name: "from after to", query: "?from=2025-10-02T00:00:00Z&to=2025-10-01T00:00:00Z", wantErr: true},
+		{name: "limit too large", query: "?limit=1000", wantErr: true},
+		{name: "invalid cursor", query: "?cursor=not-a-cursor", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user/1/transactions"+tt.query, nil)
+			ctx := chi.NewRouteContext()
+			ctx.URLParams.Add("userID", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+			if tt.provider != "" {
+				req = req.WithContext(WithProvider(req.Context(), &model.Provider{Name: tt.provider}))
 			}
 
-			service.AssertExpectations(t)
+			got, err := validateTransactionFilter(req)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
+
+func TestHandlerListTransactions(t *testing.T) {
+	tx := model.Transaction{
+		ID:           uuid.New(),
+		UserID:       1,
+		State:        model.TransactionStateWin,
+		Amount:       decimal.NewFromInt(10),
+		Currency:     model.CurrencyEUR,
+		SourceType:   model.SourceTypeGame,
+		CreatedAt:    time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC),
+		BalanceAfter: decimal.NewNullDecimal(decimal.NewFromInt(110)),
+	}
+
+	ts := &MockTransactionService{}
+	ts.On("ListTransactions", model.TransactionFilter{UserID: 1, Limit: 1}).
+		Return(&model.TransactionPage{Transactions: []model.Transaction{tx}, NextCursor: "next"}, nil)
+	h := NewHandler(Services{Transactions: ts})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/1/transactions?limit=1", nil)
+	ctx := chi.NewRouteContext()
+	ctx.URLParams.Add("userID", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+	resp := httptest.NewRecorder()
+	h.ListTransactions(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{
+		"userId": 1,
+		"transactions": [{
+			"transactionId": "`+tx.ID.String()+`",
+			"userId": 1,
+			"state": "win",
+			"amount": "10.00",
+			"currency":   "EUR",
+			"sourceType": "game",
+			"createdAt": "2025-10-01T12:00:00Z",
+			"balanceAfter": "110.00"
+		}],
+		"nextCursor": "next"
+	}`, resp.Body.String())
+
+	ts.AssertExpectations(t)
+}
+
+func TestHandlerGetTransaction(t *testing.T) {
+	stored := &model.Transaction{
+		ID:           uuid.New(),
+		UserID:       2,
+		State:        model.TransactionStateLose,
+		Amount:       decimal.RequireFromString("5.5"),
+		Currency:     model.CurrencyEUR,
+		SourceType:   model.SourceTypePayment,
+		CreatedAt:    time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC),
+		BalanceAfter: decimal.NewNullDecimal(decimal.RequireFromString("194.50")),
+	}
+	unknownID := uuid.New()
+	sent := *stored
+	sent.Provider = "acme"
+
+	tests := []struct {
+		name          string
+		userID        string
+		transactionID string
+		provider      string
+		setupMock     func(m *MockTransactionService)
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:          "found",
+			transactionID: stored.ID.String(),
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetTransaction", stored.ID).Return(stored, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody: `{
+				"transactionId": "` + stored.ID.String() + `",
+				"userId": 2,
+				"state": "lose",
+				"amount": "5.50",
+				"currency":   "EUR",
+				"sourceType": "payment",
+				"createdAt": "2025-10-01T12:00:00Z",
+				"balanceAfter": "194.50"
+			}`,
+		},
+		{
+			name:          "found for user",
+			userID:        "2",
+			transactionID: stored.ID.String(),
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetUserTransaction", 2, stored.ID).Return(stored, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "found for its provider",
+			transactionID: stored.ID.String(),
+			provider:      "acme",
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetTransaction", stored.ID).Return(&sent, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "hidden from other providers",
+			userID:        "2",
+			transactionID: stored.ID.String(),
+			provider:      "games",
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetUserTransaction", 2, stored.ID).Return(&sent, nil)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:          "unknown transaction",
+			transactionID: unknownID.String(),
+			setupMock: func(m *MockTransactionService) {
+				m.On("GetTransaction", unknownID).Return(nil, service.ErrTransactionNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:          "invalid transaction id",
+			transactionID: "not-a-uuid",
+			setupMock:     func(_ *MockTransactionService) {},
+			wantStatus:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &MockTransactionService{}
+			tt.setupMock(ts)
+			h := NewHandler(Services{Transactions: ts})
+
+			req := httptest.NewRequest(http.MethodGet, "/transaction/"+tt.transactionID, nil)
+			ctx := chi.NewRouteContext()
+			ctx.URLParams.Add("transactionID", tt.transactionID)
+			if tt.userID != "" {
+				ctx.URLParams.Add("userID", tt.userID)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+			if tt.provider != "" {
+				req = req.WithContext(WithProvider(req.Context(), &model.Provider{Name: tt.provider}))
+			}
+
+			resp := httptest.NewRecorder()
+			if tt.userID != "" {
+				h.GetUserTransaction(resp, req)
+			} else {
+				h.GetTransaction(resp, req)
+			}
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, resp.Body.String())
+			}
+
+			ts.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandlerProcessBatch(t *testing.T) {
+	firstID := uuid.New()
+	secondID := uuid.New()
+
+	body := func(mode string) string {
+		return `{"mode":"` + mode + `","transactions":[
+			{"userId":1,"state":"win","amount":"10.00","transactionId":"` + firstID.String() + `"},
+			{"userId":2,"state":"win","amount":"-1","transactionId":"` + uuid.New().String() + `"},
+			{"userId":9,"sourceType":"payment","state":"lose","amount":"5.00","transactionId":"` +
+			secondID.String() + `"}
+		]}`
+	}
+
+	t.Run("independent mode reports per item results", func(t *testing.T) {
+		ts := &MockTransactionService{}
+		ts.On("ProcessBatch", mock.MatchedBy(func(txs []*model.Transaction) bool {
+			return len(txs) == 2 &&
+				txs[0].SourceType == model.SourceTypeGame &&
+				txs[1].SourceType == model.SourceTypePayment
+		}), model.BatchModeIndependent).Return([]model.BatchItemResult{
+			{Transaction: &model.ProcessedTransaction{
+				TransactionID: firstID,
+				UserID:        1,
+				State:         model.TransactionStateWin,
+				Amount:        decimal.NewFromInt(10),
+			}},
+			{Err: service.ErrUserNotFound},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodPost, "/transactions/batch", bytes.NewBufferString(body("independent")))
+		req.Header.Set(SourceTypeHeader, string(model.SourceTypeGame))
+		resp := httptest.NewRecorder()
+
+		NewHandler(Services{Transactions: ts}).ProcessBatch(resp, req)
+
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var got batchResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+		require.Len(t, got.Results, 3)
+		assert.Equal(t, http.StatusOK, got.Results[0].Status)
+		assert.Equal(t, firstID.String(), got.Results[0].Result.TransactionID)
+		assert.Equal(t, http.StatusBadRequest, got.Results[1].Status)
+		assert.Equal(t, CodeInvalidRequest, got.Results[1].Code)
+		assert.Equal(t, http.StatusNotFound, got.Results[2].Status)
+		assert.Equal(t, CodeUserNotFound, got.Results[2].Code)
+		assert.Equal(t, secondID.String(), got.Results[2].TransactionID)
+		ts.AssertExpectations(t)
+	})
+
+	t.Run("atomic mode rejects invalid items", func(t *testing.T) {
+		ts := &MockTransactionService{}
+
+		req := httptest.NewRequest(http.MethodPost, "/transactions/batch", bytes.NewBufferString(body("atomic")))
+		req.Header.Set(SourceTypeHeader, string(model.SourceTypeGame))
+		resp := httptest.NewRecorder()
+
+		NewHandler(Services{Transactions: ts}).ProcessBatch(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "transactions[1]")
+		ts.AssertExpectations(t)
+	})
+
+	t.Run("atomic mode reports the failing item", func(t *testing.T) {
+		ts := &MockTransactionService{}
+		ts.On("ProcessBatch", mock.Anything, model.BatchModeAtomic).
+			Return(nil, &service.BatchItemError{Index: 1, TransactionID: secondID, Err: service.ErrInsufficientFunds})
+
+		reqBody := `{"mode":"atomic","transactions":[
+			{"userId":1,"state":"win","amount":"10.00","transactionId":"` + firstID.String() + `"},
+			{"userId":2,"state":"lose","amount":"500.00","transactionId":"` + secondID.String() + `"}
+		]}`
+		req := httptest.NewRequest(http.MethodPost, "/transactions/batch", bytes.NewBufferString(reqBody))
+		req.Header.Set(SourceTypeHeader, string(model.SourceTypeGame))
+		resp := httptest.NewRecorder()
+
+		NewHandler(Services{Transactions: ts}).ProcessBatch(resp, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+		var got problem
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+		assert.Equal(t, CodeInsufficientFunds, got.Code)
+		require.NotNil(t, got.Index)
+		assert.Equal(t, 1, *got.Index)
+		assert.Equal(t, secondID.String(), got.TransactionID)
+		ts.AssertExpectations(t)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/transactions/batch", bytes.NewBufferString(body("eventual")))
+		resp := httptest.NewRecorder()
+
+		NewHandler(Services{Transactions: &MockTransactionService{}}).ProcessBatch(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{"invalid transaction", service.ErrInvalidTransaction, http.StatusBadRequest, CodeInvalidRequest},
+		{"invalid source type", service.ErrInvalidSourceType, http.StatusBadRequest, CodeInvalidRequest},
+		{"source type not found", service.ErrSourceTypeNotFound, http.StatusNotFound, CodeSourceTypeNotFound},
+		{"source type exists", service.ErrSourceTypeExists, http.StatusConflict, CodeSourceTypeExists},
+		{"limit not found", service.ErrUserLimitNotFound, http.StatusNotFound, CodeLimitNotFound},
+		{"loss limit exceeded", service.ErrLossLimitExceeded, http.StatusUnprocessableEntity, CodeLossLimitExceeded},
+		{
+			"rule violation",
+			&service.RuleViolation{Code: rules.CodeAmountTooLarge, Message: "amount must be at most 5000"},
+			http.StatusUnprocessableEntity,
+			ErrorCode(rules.CodeAmountTooLarge),
+		},
+		{"user not found", service.ErrUserNotFound, http.StatusNotFound, CodeUserNotFound},
+		{"user suspended", service.ErrUserSuspended, http.StatusForbidden, CodeUserSuspended},
+		{"user closed", service.ErrUserClosed, http.StatusForbidden, CodeUserClosed},
+		{"invalid adjustment", service.ErrInvalidAdjustment, http.StatusBadRequest, CodeInvalidRequest},
+		{"adjustment not found", service.ErrAdjustmentNotFound, http.StatusNotFound, CodeAdjustmentNotFound},
+		{"adjustment decided", service.ErrAdjustmentDecided, http.StatusConflict, CodeAdjustmentDecided},
+		{"self review", service.ErrSelfReview, http.StatusForbidden, CodeSelfReview},
+		{"invalid signature", service.ErrInvalidSignature, http.StatusUnauthorized, CodeInvalidSignature},
+		{
+			"source type forbidden",
+			service.ErrSourceTypeForbidden,
+			http.StatusForbidden,
+			CodeSourceTypeForbidden,
+		},
+		{"unauthenticated", service.ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthenticated},
+		{"insufficient scope", service.ErrInsufficientScope, http.StatusForbidden, CodeInsufficientScope},
+		{"invalid API key", service.ErrInvalidAPIKey, http.StatusBadRequest, CodeInvalidRequest},
+		{"provider not found", service.ErrProviderNotFound, http.StatusNotFound, CodeProviderNotFound},
+		{"API key not found", service.ErrAPIKeyNotFound, http.StatusNotFound, CodeAPIKeyNotFound},
+		{"API key revoked", service.ErrAPIKeyRevoked, http.StatusConflict, CodeAPIKeyRevoked},
+		{"rate limited", service.ErrRateLimited, http.StatusTooManyRequests, CodeRateLimited},
+		{"transaction not found", service.ErrTransactionNotFound, http.StatusNotFound, CodeTransactionNotFound},
+		{
+			"insufficient funds",
+			fmt.Errorf("failed to update user balance: %w", service.ErrInsufficientFunds),
+			http.StatusUnprocessableEntity,
+			CodeInsufficientFunds,
+		},
+		{"duplicate transaction", service.ErrDuplicateTransaction, http.StatusConflict, CodeDuplicateTransaction},
+		{"already rolled back", service.ErrAlreadyRolledBack, http.StatusConflict, CodeAlreadyRolledBack},
+		{"rolled back", service.ErrTransactionRolledBack, http.StatusConflict, CodeTransactionRolledBack},
+		{"constraint violation", service.ErrConstraintViolation, http.StatusConflict, CodeConstraintViolation},
+		{"unavailable", service.ErrUnavailable, http.StatusServiceUnavailable, CodeServiceUnavailable},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternalError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/user/1/transaction", nil)
+			resp := httptest.NewRecorder()
+
+			writeError(resp, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+			assert.Equal(t, ProblemContentType, resp.Header().Get("Content-Type"))
+
+			var body problem
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantStatus, body.Status)
+			assert.Equal(t, tt.wantCode, body.Code)
+			assert.Equal(t, "/user/1/transaction", body.Instance)
+			assert.NotContains(t, body.Detail, "boom", "internal error details must not leak")
+		})
+	}
+}
+
+func TestHandlerSourceTypes(t *testing.T) {
+	game := model.SourceTypeSettings{
+		Name:          model.SourceTypeGame,
+		DisplayName:   "Game",
+		Enabled:       true,
+		AllowedStates: []model.TransactionState{model.TransactionStateWin, model.TransactionStateLose},
+	}
+
+	request := func(h *Handler, method, name, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/source-types", bytes.NewBufferString(body))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("name", name)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+
+		switch method {
+		case http.MethodGet:
+			h.ListSourceTypes(resp, req)
+		case http.MethodPost:
+			h.CreateSourceType(resp, req)
+		case http.MethodPatch:
+			h.UpdateSourceType(resp, req)
+		}
+
+		return resp
+	}
+
+	t.Run("list", func(t *testing.T) {
+		sts := &MockSourceTypeService{}
+		sts.On("ListSourceTypes").Return([]model.SourceTypeSettings{game}, nil)
+
+		resp := request(NewHandler(Services{SourceTypes: sts}), http.MethodGet, "", "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"sourceTypes":[{"name":"game","displayName":"Game","enabled":true,
+			"allowedStates":["win","lose"],"createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z"}]}`,
+			resp.Body.String())
+		sts.AssertExpectations(t)
+	})
+
+	t.Run("create with defaults", func(t *testing.T) {
+		sts := &MockSourceTypeService{}
+		sts.On("CreateSourceType", &model.SourceTypeSettings{
+			Name:        "sportsbook",
+			DisplayName: "Sportsbook",
+			Enabled:     true,
+			AllowedStates: []model.TransactionState{
+				model.TransactionStateWin,
+				model.TransactionStateLose,
+				model.TransactionStateRollback,
+			},
+		}).Return(nil)
+
+		resp := request(NewHandler(Services{SourceTypes: sts}), http.MethodPost, "",
+			`{"name":"sportsbook","displayName":"Sportsbook"}`)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		sts.AssertExpectations(t)
+	})
+
+	t.Run("create rejects invalid input", func(t *testing.T) {
+		h := NewHandler(Services{SourceTypes: &MockSourceTypeService{}})
+
+		for _, body := range []string{
+			`{"name":"Sports Book","displayName":"Sportsbook"}`,
+			`{"name":"sportsbook","displayName":"Sportsbook","allowedStates":["draw"]}`,
+			`not json`,
+		} {
+			resp := request(h, http.MethodPost, "", body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+	})
+
+	t.Run("create existing", func(t *testing.T) {
+		sts := &MockSourceTypeService{}
+		sts.On("CreateSourceType", mock.Anything).Return(service.ErrSourceTypeExists)
+
+		h := NewHandler(Services{SourceTypes: sts})
+		resp := request(h, http.MethodPost, "", `{"name":"game","displayName":"Game"}`)
+
+		assert.Equal(t, http.StatusConflict, resp.Code)
+		sts.AssertExpectations(t)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		disabled := game
+		disabled.Enabled = false
+		enabled := false
+
+		sts := &MockSourceTypeService{}
+		sts.On("UpdateSourceType", model.SourceTypeGame, model.SourceTypeUpdate{Enabled: &enabled}).
+			Return(&disabled, nil)
+
+		resp := request(NewHandler(Services{SourceTypes: sts}), http.MethodPatch, "game",
+			`{"enabled":false}`)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"enabled":false`)
+		sts.AssertExpectations(t)
+	})
+
+	t.Run("update unknown", func(t *testing.T) {
+		sts := &MockSourceTypeService{}
+		sts.On("UpdateSourceType", model.SourceType("casino"), mock.Anything).
+			Return(nil, service.ErrSourceTypeNotFound)
+
+		h := NewHandler(Services{SourceTypes: sts})
+		resp := request(h, http.MethodPatch, "casino", `{"displayName":"Casino"}`)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		sts.AssertExpectations(t)
+	})
+}
+
+func TestHandlerLimits(t *testing.T) {
+	pendingFrom := time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC)
+	limit := &model.UserLimit{
+		UserID:        1,
+		Currency:      model.CurrencyEUR,
+		Period:        model.LimitPeriodDaily,
+		Amount:        decimal.NewFromInt(100),
+		PendingAmount: decimal.NewNullDecimal(decimal.NewFromInt(200)),
+		PendingFrom:   &pendingFrom,
+	}
+
+	request := func(h *Handler, method, query, period, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/user/1/limits/"+period+query, bytes.NewBufferString(body))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", "1")
+		ctx.URLParams.Add("period", period)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+
+		switch method {
+		case http.MethodGet:
+			h.ListLimits(resp, req)
+		case http.MethodPut:
+			h.SetLimit(resp, req)
+		case http.MethodDelete:
+			h.RemoveLimit(resp, req)
+		}
+
+		return resp
+	}
+
+	t.Run("list", func(t *testing.T) {
+		ls := &MockLimitService{}
+		ls.On("ListLimits", 1).Return([]model.UserLimit{*limit}, nil)
+
+		resp := request(NewHandler(Services{Limits: ls}), http.MethodGet, "", "", "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"userId":1,"limits":[{"currency":"EUR","period":"daily","amount":"100.00",
+			"pendingAmount":"200.00","pendingFrom":"2025-10-02T12:00:00Z"}]}`, resp.Body.String())
+		ls.AssertExpectations(t)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		ls := &MockLimitService{}
+		ls.On("SetLimit", 1, model.CurrencyEUR, model.LimitPeriodDaily, "200").Return(limit, nil)
+
+		h := NewHandler(Services{Limits: ls})
+		resp := request(h, http.MethodPut, "", "daily", `{"amount":"200","currency":"EUR"}`)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		ls.AssertExpectations(t)
+	})
+
+	t.Run("set rejects invalid input", func(t *testing.T) {
+		h := NewHandler(Services{Limits: &MockLimitService{}})
+
+		for period, body := range map[string]string{
+			"yearly": `{"amount":"100"}`,
+			"daily":  `{"amount":"-1"}`,
+			"weekly": `{"amount":"100","currency":"JPY"}`,
+		} {
+			resp := request(h, http.MethodPut, "", period, body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		ls := &MockLimitService{}
+		ls.On("RemoveLimit", 1, model.CurrencyUSD, model.LimitPeriodWeekly).Return(limit, nil)
+		ls.On("RemoveLimit", 1, model.Currency(""), model.LimitPeriodMonthly).Return(nil, service.ErrUserLimitNotFound)
+
+		h := NewHandler(Services{Limits: ls})
+
+		resp := request(h, http.MethodDelete, "?currency=USD", "weekly", "")
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+
+		resp = request(h, http.MethodDelete, "", "monthly", "")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		ls.AssertExpectations(t)
+	})
+}
+
+func TestHandlerBonuses(t *testing.T) {
+	createdAt := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	grantID := uuid.MustParse("6f1c2a4e-8d3b-4f5a-9c7e-1b2d3e4f5a6b")
+	grant := &model.BonusGrant{
+		ID:                  3,
+		GrantID:             grantID,
+		UserID:              1,
+		Currency:            model.CurrencyEUR,
+		Amount:              decimal.NewFromInt(20),
+		WageringRequirement: decimal.NewFromInt(200),
+		Wagered:             decimal.Zero,
+		Status:              model.BonusGrantActive,
+		CreatedAt:           createdAt,
+	}
+
+	request := func(h *Handler, method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/user/1/bonuses", bytes.NewBufferString(body))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+
+		if method == http.MethodGet {
+			h.ListBonusGrants(resp, req)
+		} else {
+			h.GrantBonus(resp, req)
+		}
+
+		return resp
+	}
+
+	t.Run("grant", func(t *testing.T) {
+		bs := &MockBonusService{}
+		bs.On("GrantBonus", grantID, 1, model.Currency(""), "20", "200").Return(grant, nil)
+
+		h := NewHandler(Services{Bonuses: bs})
+		resp := request(h, http.MethodPost,
+			`{"grantId":"6f1c2a4e-8d3b-4f5a-9c7e-1b2d3e4f5a6b","amount":"20","wageringRequirement":"200"}`)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.JSONEq(t, `{"id":3,"grantId":"6f1c2a4e-8d3b-4f5a-9c7e-1b2d3e4f5a6b","currency":"EUR","amount":"20.00",
+			"wageringRequirement":"200.00","wagered":"0.00","status":"active","createdAt":"2025-10-01T12:00:00Z"}`,
+			resp.Body.String())
+		bs.AssertExpectations(t)
+	})
+
+	t.Run("grant rejects invalid input", func(t *testing.T) {
+		h := NewHandler(Services{Bonuses: &MockBonusService{}})
+
+		for _, body := range []string{
+			`{"grantId":"6f1c2a4e-8d3b-4f5a-9c7e-1b2d3e4f5a6b","amount":"0","wageringRequirement":"100"}`,
+			`{"grantId":"6f1c2a4e-8d3b-4f5a-9c7e-1b2d3e4f5a6b","amount":"10"}`,
+			`{"grantId":"6f1c2a4e-8d3b-4f5a-9c7e-1b2d3e4f5a6b","amount":"10","wageringRequirement":"100","currency":"JPY"}`,
+			`{"amount":"10","wageringRequirement":"100"}`,
+		} {
+			resp := request(h, http.MethodPost, body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		converted := *grant
+		converted.GrantID = uuid.Nil // granted before grant IDs were required
+		completedAt := createdAt.Add(time.Hour)
+		converted.Wagered = converted.WageringRequirement
+		converted.Status = model.BonusGrantConverted
+		converted.ConvertedAmount = decimal.NewNullDecimal(decimal.NewFromInt(15))
+		converted.CompletedAt = &completedAt
+
+		bs := &MockBonusService{}
+		bs.On("ListBonusGrants", 1).Return([]model.BonusGrant{converted}, nil)
+
+		resp := request(NewHandler(Services{Bonuses: bs}), http.MethodGet, "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"userId":1,"bonuses":[{"id":3,"currency":"EUR","amount":"20.00",
+			"wageringRequirement":"200.00","wagered":"200.00","status":"converted","convertedAmount":"15.00",
+			"createdAt":"2025-10-01T12:00:00Z","completedAt":"2025-10-01T13:00:00Z"}]}`, resp.Body.String())
+		bs.AssertExpectations(t)
+	})
+}
+
+func TestHandlerReservations(t *testing.T) {
+	id := uuid.MustParse("7f1e1c1a-3b7e-4b8a-9a52-1f0b5e0f2c11")
+	createdAt := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	reservation := &model.Reservation{
+		ID:         id,
+		UserID:     1,
+		Currency:   model.CurrencyEUR,
+		SourceType: model.SourceTypeGame,
+		Amount:     decimal.NewFromInt(30),
+		Status:     model.ReservationHeld,
+		ExpiresAt:  createdAt.Add(15 * time.Minute),
+		CreatedAt:  createdAt,
+	}
+
+	request := func(handle http.HandlerFunc, transactionID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/user/1/reservations", bytes.NewBufferString(body))
+		req.Header.Set(SourceTypeHeader, "game")
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", "1")
+		ctx.URLParams.Add("transactionID", transactionID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+		handle(resp, req)
+
+		return resp
+	}
+
+	t.Run("reserve", func(t *testing.T) {
+		rs := &MockReservationService{}
+		rs.On("Reserve", mock.MatchedBy(func(r *model.Reservation) bool {
+			return r.ID == id && r.UserID == 1 && r.SourceType == model.SourceTypeGame &&
+				r.Amount.Equal(decimal.NewFromInt(30)) && r.Currency == ""
+		})).Return(reservation, nil)
+
+		h := NewHandler(Services{Reservations: rs})
+		resp := request(h.Reserve, "", `{"transactionId":"`+id.String()+`","amount":"30"}`)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"transactionId":"`+id.String()+`","userId":1,"currency":"EUR","sourceType":"game",
+			"amount":"30.00","status":"held","expiresAt":"2025-10-01T12:15:00Z","createdAt":"2025-10-01T12:00:00Z"}`,
+			resp.Body.String())
+		rs.AssertExpectations(t)
+	})
+
+	t.Run("reserve rejects invalid input", func(t *testing.T) {
+		h := NewHandler(Services{Reservations: &MockReservationService{}})
+
+		for _, body := range []string{
+			`{"transactionId":"` + id.String() + `","amount":"0"}`,
+			`{"transactionId":"not-a-uuid","amount":"10"}`,
+			`{"transactionId":"` + id.String() + `","amount":"10","currency":"JPY"}`,
+		} {
+			resp := request(h.Reserve, "", body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+	})
+
+	t.Run("commit replay", func(t *testing.T) {
+		rs := &MockReservationService{}
+		rs.On("Commit", 1, id, "").Return(&model.ProcessedTransaction{
+			TransactionID: id,
+			UserID:        1,
+			State:         model.TransactionStateLose,
+			Amount:        decimal.NewFromInt(30),
+			Currency:      model.CurrencyEUR,
+			Balance:       decimal.NewNullDecimal(decimal.NewFromInt(70)),
+			ProcessedAt:   createdAt,
+			Replayed:      true,
+		}, nil)
+
+		resp := request(NewHandler(Services{Reservations: rs}).CommitReservation, id.String(), "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "true", resp.Header().Get(ReplayedHeader))
+		assert.JSONEq(t, `{"transactionId":"`+id.String()+`","userId":1,"state":"lose","amount":"30.00",
+			"currency":"EUR","balance":"70.00","processedAt":"2025-10-01T12:00:00Z","replayed":true}`,
+			resp.Body.String())
+	})
+
+	t.Run("commit of another provider", func(t *testing.T) {
+		rs := &MockReservationService{}
+		rs.On("Commit", 1, id, "acme").Return(nil, fmt.Errorf("%w: reservation %s was placed by another provider",
+			service.ErrSourceTypeForbidden, id))
+
+		req := httptest.NewRequest(http.MethodPost, "/user/1/reservations/"+id.String()+"/commit", http.NoBody)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", "1")
+		ctx.URLParams.Add("transactionID", id.String())
+		req = req.WithContext(WithProvider(context.WithValue(req.Context(), chi.RouteCtxKey, ctx),
+			&model.Provider{Name: "acme"}))
+
+		resp := httptest.NewRecorder()
+		NewHandler(Services{Reservations: rs}).CommitReservation(resp, req)
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"source_type_forbidden"`)
+		rs.AssertExpectations(t)
+	})
+
+	t.Run("release of a committed reservation", func(t *testing.T) {
+		rs := &MockReservationService{}
+		rs.On("Release", 1, id, "").Return(nil, fmt.Errorf("%w: reservation %s was committed",
+			service.ErrReservationSettled, id))
+
+		resp := request(NewHandler(Services{Reservations: rs}).ReleaseReservation, id.String(), "")
+
+		assert.Equal(t, http.StatusConflict, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"reservation_settled"`)
+	})
+
+	t.Run("reservation of another provider", func(t *testing.T) {
+		placed := *reservation
+		placed.Provider = "acme"
+
+		rs := &MockReservationService{}
+		rs.On("GetReservation", 1, id).Return(&placed, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/user/1/reservations/"+id.String(), http.NoBody)
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", "1")
+		ctx.URLParams.Add("transactionID", id.String())
+		req = req.WithContext(WithProvider(context.WithValue(req.Context(), chi.RouteCtxKey, ctx),
+			&model.Provider{Name: "games"}))
+
+		resp := httptest.NewRecorder()
+		NewHandler(Services{Reservations: rs}).GetReservation(resp, req)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"reservation_not_found"`)
+	})
+
+	t.Run("unknown reservation", func(t *testing.T) {
+		rs := &MockReservationService{}
+		rs.On("GetReservation", 1, id).Return(nil, service.ErrReservationNotFound)
+
+		resp := request(NewHandler(Services{Reservations: rs}).GetReservation, id.String(), "")
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"reservation_not_found"`)
+	})
+}
+
+func TestHandlerUsers(t *testing.T) {
+	createdAt := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	user := &model.User{
+		ID:        5,
+		Status:    model.UserStatusActive,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Wallets:   []model.Wallet{{UserID: 5, Currency: model.CurrencyUSD}},
+	}
+
+	request := func(handle http.HandlerFunc, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/user", bytes.NewBufferString(body))
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("userID", userID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+		handle(resp, req)
+
+		return resp
+	}
+
+	t.Run("create", func(t *testing.T) {
+		us := &MockUserService{}
+		us.On("CreateUser", model.CurrencyUSD).Return(user, nil)
+
+		resp := request(NewHandler(Services{Users: us}).CreateUser, "", `{"currency":"USD"}`)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.JSONEq(t, `{"userId":5,"status":"active","createdAt":"2025-10-01T12:00:00Z",
+			"updatedAt":"2025-10-01T12:00:00Z","wallets":[{"currency":"USD","balance":"0.00",
+			"realBalance":"0.00","bonusBalance":"0.00","heldBalance":"0.00"}]}`, resp.Body.String())
+		us.AssertExpectations(t)
+	})
+
+	t.Run("create without body uses the default currency", func(t *testing.T) {
+		us := &MockUserService{}
+		us.On("CreateUser", model.Currency("")).Return(user, nil)
+
+		resp := request(NewHandler(Services{Users: us}).CreateUser, "", "")
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		us.AssertExpectations(t)
+	})
+
+	t.Run("set status", func(t *testing.T) {
+		suspended := *user
+		suspended.Status = model.UserStatusSuspended
+
+		us := &MockUserService{}
+		us.On("SetUserStatus", 5, model.UserStatusSuspended).Return(&suspended, nil)
+
+		resp := request(NewHandler(Services{Users: us}).SetUserStatus, "5", `{"status":"suspended"}`)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"status":"suspended"`)
+		us.AssertExpectations(t)
+	})
+
+	t.Run("set status rejects invalid input", func(t *testing.T) {
+		h := NewHandler(Services{Users: &MockUserService{}})
+
+		for _, body := range []string{`{"status":"deleted"}`, `{}`, `not json`} {
+			resp := request(h.SetUserStatus, "5", body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+	})
+
+	t.Run("reopen closed user", func(t *testing.T) {
+		us := &MockUserService{}
+		us.On("SetUserStatus", 5, model.UserStatusActive).Return(nil, service.ErrUserClosed)
+
+		resp := request(NewHandler(Services{Users: us}).SetUserStatus, "5", `{"status":"active"}`)
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"user_closed"`)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		us := &MockUserService{}
+		us.On("GetUser", 9).Return(nil, service.ErrUserNotFound)
+
+		resp := request(NewHandler(Services{Users: us}).GetUser, "9", "")
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"user_not_found"`)
+	})
+}
+
+func TestHandlerAdjustments(t *testing.T) {
+	createdAt := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e")
+
+	adjustment := func(status model.AdjustmentStatus) *model.ManualAdjustment {
+		return &model.ManualAdjustment{
+			ID:          id,
+			UserID:      1,
+			Currency:    model.CurrencyEUR,
+			Type:        model.AdjustmentCredit,
+			Amount:      decimal.NewFromInt(50),
+			ReasonCode:  model.AdjustmentReasonGoodwill,
+			Comment:     "outage",
+			RequestedBy: "alice",
+			Status:      status,
+			CreatedAt:   createdAt,
+		}
+	}
+
+	request := func(handle http.HandlerFunc, operator, transactionID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/adjustments", bytes.NewBufferString(body))
+		if operator != "" {
+			req.Header.Set(OperatorHeader, operator)
+		}
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("transactionID", transactionID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+		handle(resp, req)
+
+		return resp
+	}
+
+	body := `{"transactionId":"0f8fad5b-d9cb-469f-a165-70867728950e","userId":1,"type":"credit",
+		"amount":"50.00","reasonCode":"goodwill","comment":"outage"}`
+
+	t.Run("applied adjustment", func(t *testing.T) {
+		as := &MockAdjustmentService{}
+		as.On("RequestAdjustment", mock.MatchedBy(func(a *model.ManualAdjustment) bool {
+			return a.ID == id && a.RequestedBy == "alice" && a.Currency == ""
+		})).Return(adjustment(model.AdjustmentApplied), nil)
+
+		resp := request(NewHandler(Services{Adjustments: as}).RequestAdjustment, "alice", "", body)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.JSONEq(t, `{"transactionId":"0f8fad5b-d9cb-469f-a165-70867728950e","userId":1,"currency":"EUR",
+			"type":"credit","amount":"50.00","reasonCode":"goodwill","comment":"outage","status":"applied",
+			"requestedBy":"alice","createdAt":"2025-10-01T12:00:00Z"}`, resp.Body.String())
+		as.AssertExpectations(t)
+	})
+
+	t.Run("pending adjustment is accepted", func(t *testing.T) {
+		as := &MockAdjustmentService{}
+		as.On("RequestAdjustment", mock.Anything).Return(adjustment(model.AdjustmentPending), nil)
+
+		resp := request(NewHandler(Services{Adjustments: as}).RequestAdjustment, "alice", "", body)
+
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+	})
+
+	t.Run("request rejects invalid input", func(t *testing.T) {
+		h := NewHandler(Services{Adjustments: &MockAdjustmentService{}})
+
+		assert.Equal(t, http.StatusBadRequest, request(h.RequestAdjustment, "", "", body).Code,
+			"the operator is required")
+
+		for _, invalid := range []string{
+			`{"transactionId":"0f8fad5b-d9cb-469f-a165-70867728950e","userId":1,"type":"credit","amount":"50"}`,
+			`{"transactionId":"0f8fad5b-d9cb-469f-a165-70867728950e","userId":1,"type":"bonus","amount":"50",
+				"reasonCode":"goodwill","comment":"outage"}`,
+			`{"transactionId":"0f8fad5b-d9cb-469f-a165-70867728950e","userId":1,"type":"credit","amount":"-5",
+				"reasonCode":"goodwill","comment":"outage"}`,
+			`{"transactionId":"bad","userId":1,"type":"credit","amount":"50","reasonCode":"goodwill","comment":"x"}`,
+			`not json`,
+		} {
+			resp := request(h.RequestAdjustment, "alice", "", invalid)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, invalid)
+		}
+	})
+
+	t.Run("get includes the audit trail", func(t *testing.T) {
+		as := &MockAdjustmentService{}
+		as.On("GetAdjustment", id).Return(adjustment(model.AdjustmentPending), nil)
+		as.On("ListAuditEvents", id).Return([]model.AuditEvent{{
+			ID:          1,
+			Operator:    "alice",
+			Action:      model.AuditAdjustmentRequested,
+			SubjectType: "manual_adjustment",
+			SubjectID:   id.String(),
+			CreatedAt:   createdAt,
+		}}, nil)
+
+		resp := request(NewHandler(Services{Adjustments: as}).GetAdjustment, "", id.String(), "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"audit":[{"id":1,"operator":"alice","action":"adjustment_requested"`)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		approved := adjustment(model.AdjustmentApplied)
+		approved.ReviewedBy = "bob"
+
+		as := &MockAdjustmentService{}
+		as.On("ApproveAdjustment", id, model.Operator{Name: "bob"}, "checked").Return(approved, nil)
+
+		resp := request(NewHandler(Services{Adjustments: as}).ApproveAdjustment, "bob", id.String(),
+			`{"comment":"checked"}`)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"reviewedBy":"bob"`)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("operator is bound to the API key", func(t *testing.T) {
+		key := &model.APIKey{ID: uuid.New(), Provider: "backoffice"}
+
+		as := &MockAdjustmentService{}
+		as.On("ApproveAdjustment", id, model.Operator{Name: "bob", KeyID: key.ID}, "").
+			Return(adjustment(model.AdjustmentApplied), nil)
+
+		approve := func(w http.ResponseWriter, r *http.Request) {
+			NewHandler(Services{Adjustments: as}).ApproveAdjustment(w, r.WithContext(WithAPIKey(r.Context(), key)))
+		}
+
+		resp := request(approve, "bob", id.String(), "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		as.AssertExpectations(t)
+	})
+
+	t.Run("reject own adjustment", func(t *testing.T) {
+		as := &MockAdjustmentService{}
+		as.On("RejectAdjustment", id, model.Operator{Name: "alice"}, "").Return(nil, service.ErrSelfReview)
+
+		resp := request(NewHandler(Services{Adjustments: as}).RejectAdjustment, "alice", id.String(), "")
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"self_review"`)
+	})
+
+	t.Run("list by status", func(t *testing.T) {
+		as := &MockAdjustmentService{}
+		as.On("ListAdjustments", model.AdjustmentPending).
+			Return([]model.ManualAdjustment{*adjustment(model.AdjustmentPending)}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/adjustments?status=pending", nil)
+		resp := httptest.NewRecorder()
+		NewHandler(Services{Adjustments: as}).ListAdjustments(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"adjustments":[{"transactionId":"0f8fad5b-d9cb-469f-a165-70867728950e"`)
+		as.AssertExpectations(t)
+	})
+}
+
+func TestHandlerAPIKeys(t *testing.T) {
+	createdAt := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e")
+	apiKey := &model.APIKey{
+		ID:        id,
+		Provider:  "acme",
+		Prefix:    "wk_0123abcd",
+		Hash:      "secret-hash",
+		Scopes:    []model.APIKeyScope{model.ScopeBalanceRead},
+		CreatedAt: createdAt,
+	}
+
+	request := func(handle http.HandlerFunc, provider, keyID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/keys", bytes.NewBufferString(body))
+
+		ctx := chi.NewRouteContext()
+		ctx.URLParams.Add("provider", provider)
+		ctx.URLParams.Add("keyID", keyID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+
+		resp := httptest.NewRecorder()
+		handle(resp, req)
+
+		return resp
+	}
+
+	newHandler := func(ks *MockAPIKeyService) *Handler {
+		return NewHandler(Services{APIKeys: ks})
+	}
+
+	t.Run("issue shows the key once", func(t *testing.T) {
+		ks := &MockAPIKeyService{}
+		ks.On("IssueAPIKey", "acme", []model.APIKeyScope{model.ScopeBalanceRead}).Return(apiKey, "wk_0123abcdef", nil)
+
+		resp := request(newHandler(ks).IssueAPIKey, "acme", "", `{"scopes":["balance:read","balance:read"]}`)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.JSONEq(t, `{"keyId":"0f8fad5b-d9cb-469f-a165-70867728950e","provider":"acme","prefix":"wk_0123abcd",
+			"scopes":["balance:read"],"createdAt":"2025-10-01T12:00:00Z","key":"wk_0123abcdef"}`, resp.Body.String())
+		ks.AssertExpectations(t)
+	})
+
+	t.Run("issue rejects invalid scopes", func(t *testing.T) {
+		h := newHandler(&MockAPIKeyService{})
+
+		for _, invalid := range []string{`{"scopes":[]}`, `{"scopes":["root"]}`, `not json`} {
+			assert.Equal(t, http.StatusBadRequest, request(h.IssueAPIKey, "acme", "", invalid).Code, invalid)
+		}
+	})
+
+	t.Run("list hides the hash", func(t *testing.T) {
+		ks := &MockAPIKeyService{}
+		ks.On("ListAPIKeys", "acme").Return([]model.APIKey{*apiKey}, nil)
+
+		resp := request(newHandler(ks).ListAPIKeys, "acme", "", "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.NotContains(t, resp.Body.String(), "secret-hash")
+		assert.NotContains(t, resp.Body.String(), `"key"`)
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		ks := &MockAPIKeyService{}
+		ks.On("RotateAPIKey", id, "").Return(apiKey, "wk_0123abcdef", nil)
+
+		resp := request(newHandler(ks).RotateAPIKey, "", id.String(), "")
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"key":"wk_0123abcdef"`)
+	})
+
+	t.Run("revoke unknown key", func(t *testing.T) {
+		ks := &MockAPIKeyService{}
+		ks.On("RevokeAPIKey", id, "").Return(nil, service.ErrAPIKeyNotFound)
+
+		resp := request(newHandler(ks).RevokeAPIKey, "", id.String(), "")
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("keys of another provider", func(t *testing.T) {
+		asProvider := func(handle http.HandlerFunc, provider, keyID, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/admin/keys", bytes.NewBufferString(body))
+
+			ctx := chi.NewRouteContext()
+			ctx.URLParams.Add("provider", provider)
+			ctx.URLParams.Add("keyID", keyID)
+			req = req.WithContext(WithProvider(context.WithValue(req.Context(), chi.RouteCtxKey, ctx),
+				&model.Provider{Name: "games"}))
+
+			resp := httptest.NewRecorder()
+			handle(resp, req)
+
+			return resp
+		}
+
+		ks := &MockAPIKeyService{}
+		ks.On("RevokeAPIKey", id, "games").Return(nil, service.ErrAPIKeyNotFound)
+		h := newHandler(ks)
+
+		resp := asProvider(h.IssueAPIKey, "acme", "", `{"scopes":["admin"]}`)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"code":"insufficient_scope"`)
+
+		resp = asProvider(h.ListAPIKeys, "acme", "", "")
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		resp = asProvider(h.RevokeAPIKey, "", id.String(), "")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		ks.AssertExpectations(t)
+		ks.AssertNotCalled(t, "IssueAPIKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid key ID", func(t *testing.T) {
+		resp := request(newHandler(&MockAPIKeyService{}).RevokeAPIKey, "", "bad", "")
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
+
+func TestHandlerHealth(t *testing.T) {
+	type body struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Status    string  `json:"status"`
+			LatencyMs float64 `json:"latencyMs"`
+			Message   string  `json:"message"`
+		} `json:"checks"`
+	}
+
+	request := func(handle http.HandlerFunc) (*httptest.ResponseRecorder, body) {
+		resp := httptest.NewRecorder()
+		handle(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		var decoded body
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&decoded))
+
+		return resp, decoded
+	}
+
+	t.Run("live without checking dependencies", func(t *testing.T) {
+		hs := &MockHealthService{}
+
+		resp, decoded := request(NewHandler(Services{Health: hs}).Livez)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "pass", decoded.Status)
+		hs.AssertNotCalled(t, "Readiness")
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		hs := &MockHealthService{}
+		hs.On("Readiness").Return(&model.HealthReport{Checks: []model.HealthCheck{
+			{Name: "database", Status: model.HealthPass, Latency: 1500 * time.Microsecond},
+			{Name: "connection_pool", Status: model.HealthWarn, Message: "10 of 10 connections in use"},
+		}})
+
+		resp, decoded := request(NewHandler(Services{Health: hs}).Readyz)
+		assert.Equal(t, http.StatusOK, resp.Code, "warnings do not make the service unready")
+		assert.Equal(t, "warn", decoded.Status)
+		assert.InDelta(t, 1.5, decoded.Checks["database"].LatencyMs, 0)
+		assert.Equal(t, "10 of 10 connections in use", decoded.Checks["connection_pool"].Message)
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		hs := &MockHealthService{}
+		hs.On("Readiness").Return(&model.HealthReport{Checks: []model.HealthCheck{
+			{Name: "shutdown", Status: model.HealthFail, Message: "shutting down"},
+			{Name: "database", Status: model.HealthPass},
+		}})
+
+		resp, decoded := request(NewHandler(Services{Health: hs}).Readyz)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, "fail", decoded.Status)
+		assert.Equal(t, "fail", decoded.Checks["shutdown"].Status)
+	})
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+)
+
+type healthCheckView struct {
+	Status    model.HealthStatus `json:"status"`
+	LatencyMs float64            `json:"latencyMs"`
+	Message   string             `json:"message,omitempty"`
+}
+
+type healthView struct {
+	Status model.HealthStatus         `json:"status"`
+	Checks map[string]healthCheckView `json:"checks,omitempty"`
+}
+
+func newHealthView(report *model.HealthReport) healthView {
+	view := healthView{Status: report.Status(), Checks: make(map[string]healthCheckView, len(report.Checks))}
+
+	for _, check := range report.Checks {
+		view.Checks[check.Name] = healthCheckView{
+			Status:    check.Status,
+			LatencyMs: float64(check.Latency.Microseconds()) / 1000,
+			Message:   check.Message,
+		}
+	}
+
+	return view
+}
+
+// Livez answers as long as the process serves requests, whatever the state of its dependencies.
+func (h *Handler) Livez(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, healthView{Status: model.HealthPass})
+}
+
+// Readyz answers 200 if the service can take traffic and 503 otherwise, with the result of every
+// check.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.hs.Readiness(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, newHealthView(report))
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+)
+
+type setLimitRequestBody struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type limitView struct {
+	Currency      model.Currency    `json:"currency"`
+	Period        model.LimitPeriod `json:"period"`
+	Amount        string            `json:"amount"`
+	PendingAmount *string           `json:"pendingAmount,omitempty"`
+	// PendingFrom is set while an increase or removal is cooling off. Without
+	// PendingAmount the limit is removed at that time.
+	PendingFrom *time.Time `json:"pendingFrom,omitempty"`
+}
+
+type limitsResponse struct {
+	UserID int         `json:"userId"`
+	Limits []limitView `json:"limits"`
+}
+
+func newLimitView(limit *model.UserLimit) limitView {
+	view := limitView{
+		Currency:    limit.Currency,
+		Period:      limit.Period,
+		Amount:      limit.Amount.StringFixed(2),
+		PendingFrom: limit.PendingFrom,
+	}
+
+	if limit.PendingAmount.Valid {
+		pending := limit.PendingAmount.Decimal.StringFixed(2)
+		view.PendingAmount = &pending
+	}
+
+	return view
+}
+
+func validateLimitPeriod(r *http.Request) (model.LimitPeriod, error) {
+	return model.ToLimitPeriod(chi.URLParam(r, "period"))
+}
+
+func (h *Handler) ListLimits(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	limits, err := h.ls.ListLimits(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	response := limitsResponse{UserID: userID, Limits: make([]limitView, 0, len(limits))}
+	for i := range limits {
+		response.Limits = append(response.Limits, newLimitView(&limits[i]))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// SetLimit sets a loss limit. Lower limits apply immediately, higher ones after a cooling-off period.
+func (h *Handler) SetLimit(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	period, err := validateLimitPeriod(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	var reqBody setLimitRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	amount, err := decimal.NewFromString(reqBody.Amount)
+	if err != nil || amount.IsNegative() {
+		writeValidationError(w, r, errors.New("amount must be a non-negative number"))
+		return
+	}
+
+	var currency model.Currency
+	if reqBody.Currency != "" {
+		if currency, err = model.ToCurrency(reqBody.Currency); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	limit, err := h.ls.SetLimit(r.Context(), userID, currency, period, amount)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newLimitView(limit))
+}
+
+// RemoveLimit schedules the removal of a loss limit after the cooling-off period.
+func (h *Handler) RemoveLimit(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	period, err := validateLimitPeriod(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	currency, err := parseOptionalCurrency(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	limit, err := h.ls.RemoveLimit(r.Context(), userID, currency, period)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, newLimitView(limit))
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+)
+
+type providerContextKey struct{}
+
+// WithProvider returns a copy of ctx carrying the provider that was authenticated on the request,
+// by its API key or by its signature.
+func WithProvider(ctx context.Context, provider *model.Provider) context.Context {
+	return context.WithValue(ctx, providerContextKey{}, provider)
+}
+
+// ProviderFromContext returns the provider stored by WithProvider, if any.
+func ProviderFromContext(ctx context.Context) (*model.Provider, bool) {
+	provider, ok := ctx.Value(providerContextKey{}).(*model.Provider)
+
+	return provider, ok
+}
+
+// providerFor returns the name of the provider that sent r, or an error wrapping
+// ErrSourceTypeForbidden if it may not send transactions of sourceType. Requests without a
+// provider, which are only accepted with authentication disabled, may send any source type.
+func providerFor(r *http.Request, sourceType model.SourceType) (string, error) {
+	provider, ok := ProviderFromContext(r.Context())
+	if !ok {
+		return "", nil
+	}
+
+	if !provider.Allows(sourceType) {
+		return "", fmt.Errorf("%w: provider %s cannot send %s transactions",
+			service.ErrSourceTypeForbidden, provider.Name, sourceType)
+	}
+
+	return provider.Name, nil
+}
+
+// providerName returns the name of the provider that sent r, or "" for requests without a provider.
+func providerName(r *http.Request) string {
+	if provider, ok := ProviderFromContext(r.Context()); ok {
+		return provider.Name
+	}
+
+	return ""
+}
+
+// readable reports whether the transaction or reservation sent by provider may be read by r. Providers
+// read their own and those sent without a provider, like manual adjustments, but not those of other
+// providers.
+func readable(r *http.Request, provider string) bool {
+	caller := providerName(r)
+
+	return caller == "" || provider == "" || provider == caller
+}
+
+// sourceTypeHeader returns the Source-Type header of r. Providers of a single source type may leave
+// the header out.
+func sourceTypeHeader(r *http.Request) string {
+	value := r.Header.Get(SourceTypeHeader)
+	if value != "" {
+		return value
+	}
+
+	if provider, ok := ProviderFromContext(r.Context()); ok && len(provider.SourceTypes) == 1 {
+		return string(provider.SourceTypes[0])
+	}
+
+	return ""
+}
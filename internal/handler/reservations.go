@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type reserveRequestBody struct {
+	TransactionID string `json:"transactionId"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+type reservationView struct {
+	TransactionID string                  `json:"transactionId"`
+	UserID        int                     `json:"userId"`
+	Currency      model.Currency          `json:"currency"`
+	SourceType    model.SourceType        `json:"sourceType"`
+	Amount        string                  `json:"amount"`
+	Status        model.ReservationStatus `json:"status"`
+	ExpiresAt     time.Time               `json:"expiresAt"`
+	CreatedAt     time.Time               `json:"createdAt"`
+	SettledAt     *time.Time              `json:"settledAt,omitempty"`
+}
+
+func newReservationView(reservation *model.Reservation) reservationView {
+	return reservationView{
+		TransactionID: reservation.ID.String(),
+		UserID:        reservation.UserID,
+		Currency:      reservation.Currency,
+		SourceType:    reservation.SourceType,
+		Amount:        reservation.Amount.StringFixed(2),
+		Status:        reservation.Status,
+		ExpiresAt:     reservation.ExpiresAt,
+		CreatedAt:     reservation.CreatedAt,
+		SettledAt:     reservation.SettledAt,
+	}
+}
+
+func validateReserveRequest(r *http.Request) (*model.Reservation, error) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqBody reserveRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+
+	transactionID, err := uuid.Parse(reqBody.TransactionID)
+	if err != nil || transactionID == uuid.Nil {
+		return nil, errors.New("invalid transactionId format")
+	}
+
+	amount, err := decimal.NewFromString(reqBody.Amount)
+	if err != nil || !amount.IsPositive() {
+		return nil, errors.New("amount must be a positive number")
+	}
+
+	sourceType, err := model.ToSourceType(sourceTypeHeader(r))
+	if err != nil {
+		return nil, fmt.Errorf("invalid source type: %w", err)
+	}
+
+	reservation := &model.Reservation{
+		ID:         transactionID,
+		UserID:     userID,
+		SourceType: sourceType,
+		Amount:     amount,
+	}
+
+	// Like for transactions, the currency in the body takes precedence over the header.
+	if reqBody.Currency == "" {
+		reqBody.Currency = r.Header.Get(CurrencyHeader)
+	}
+
+	if reqBody.Currency != "" {
+		if reservation.Currency, err = model.ToCurrency(reqBody.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	return reservation, nil
+}
+
+// Reserve holds the stake of a bet until it is committed or released.
+func (h *Handler) Reserve(w http.ResponseWriter, r *http.Request) {
+	reservation, err := validateReserveRequest(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	if reservation.Provider, err = providerFor(r, reservation.SourceType); err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	reservation, err = h.rs.Reserve(r.Context(), reservation)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newReservationView(reservation))
+}
+
+func (h *Handler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	userID, transactionID, err := validateReservationPath(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	reservation, err := h.rs.GetReservation(r.Context(), userID, transactionID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	if !readable(r, reservation.Provider) {
+		writeError(w, r, service.ErrReservationNotFound)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newReservationView(reservation))
+}
+
+// CommitReservation settles a reservation as a lose transaction with the same transaction ID.
+func (h *Handler) CommitReservation(w http.ResponseWriter, r *http.Request) {
+	userID, transactionID, err := validateReservationPath(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	processed, err := h.rs.Commit(r.Context(), userID, transactionID, providerName(r))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	if processed.Replayed {
+		w.Header().Set(ReplayedHeader, "true")
+	}
+
+	writeJSON(w, http.StatusOK, newTransactionResponse(processed))
+}
+
+// ReleaseReservation gives the stake of a reservation back to the balance.
+func (h *Handler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	userID, transactionID, err := validateReservationPath(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	reservation, err := h.rs.Release(r.Context(), userID, transactionID, providerName(r))
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newReservationView(reservation))
+}
+
+func validateReservationPath(r *http.Request) (int, uuid.UUID, error) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+
+	transactionID, err := validateTransactionID(r)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+
+	return userID, transactionID, nil
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type createSourceTypeRequestBody struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	// Enabled defaults to true and AllowedStates to all states.
+	Enabled       *bool    `json:"enabled"`
+	AllowedStates []string `json:"allowedStates"`
+}
+
+type updateSourceTypeRequestBody struct {
+	DisplayName   *string  `json:"displayName"`
+	Enabled       *bool    `json:"enabled"`
+	AllowedStates []string `json:"allowedStates"`
+}
+
+type sourceTypesResponse struct {
+	SourceTypes []model.SourceTypeSettings `json:"sourceTypes"`
+}
+
+// parseStates converts the allowed states of a request. A missing list is returned as nil.
+func parseStates(values []string) ([]model.TransactionState, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	states := make([]model.TransactionState, len(values))
+	for i, value := range values {
+		state, err := model.ToTransactionState(value)
+		if err != nil {
+			return nil, err
+		}
+
+		states[i] = state
+	}
+
+	return states, nil
+}
+
+func (h *Handler) ListSourceTypes(w http.ResponseWriter, r *http.Request) {
+	sourceTypes, err := h.sts.ListSourceTypes(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sourceTypesResponse{SourceTypes: sourceTypes})
+}
+
+func (h *Handler) CreateSourceType(w http.ResponseWriter, r *http.Request) {
+	var reqBody createSourceTypeRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	sourceType, err := model.ToSourceType(reqBody.Name)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	states, err := parseStates(reqBody.AllowedStates)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	if states == nil {
+		states = []model.TransactionState{
+			model.TransactionStateWin,
+			model.TransactionStateLose,
+			model.TransactionStateRollback,
+		}
+	}
+
+	settings := model.SourceTypeSettings{
+		Name:          sourceType,
+		DisplayName:   reqBody.DisplayName,
+		Enabled:       reqBody.Enabled == nil || *reqBody.Enabled,
+		AllowedStates: states,
+	}
+
+	if err = h.sts.CreateSourceType(r.Context(), &settings); err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, settings)
+}
+
+// UpdateSourceType changes the fields present in the request body. Disabling a source type
+// rejects its further transactions while keeping the ones it already sent.
+func (h *Handler) UpdateSourceType(w http.ResponseWriter, r *http.Request) {
+	sourceType, err := model.ToSourceType(chi.URLParam(r, "name"))
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	var reqBody updateSourceTypeRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	update := model.SourceTypeUpdate{DisplayName: reqBody.DisplayName, Enabled: reqBody.Enabled}
+	if update.AllowedStates, err = parseStates(reqBody.AllowedStates); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	settings, err := h.sts.UpdateSourceType(r.Context(), sourceType, update)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
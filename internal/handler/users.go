@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+)
+
+type createUserRequestBody struct {
+	Currency string `json:"currency"`
+}
+
+type setUserStatusRequestBody struct {
+	Status string `json:"status"`
+}
+
+type userView struct {
+	UserID    int              `json:"userId"`
+	Status    model.UserStatus `json:"status"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+	Wallets   []walletView     `json:"wallets"`
+}
+
+func newUserView(user *model.User) userView {
+	view := userView{
+		UserID:    user.ID,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Wallets:   make([]walletView, 0, len(user.Wallets)),
+	}
+
+	for i := range user.Wallets {
+		view.Wallets = append(view.Wallets, newWalletView(&user.Wallets[i]))
+	}
+
+	return view
+}
+
+// CreateUser creates an active user with an empty wallet in the requested or the default currency.
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	// The body is optional.
+	var reqBody createUserRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil && !errors.Is(err, io.EOF) {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	var (
+		currency model.Currency
+		err      error
+	)
+
+	if reqBody.Currency != "" {
+		if currency, err = model.ToCurrency(reqBody.Currency); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	user, err := h.us.CreateUser(r.Context(), currency)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newUserView(user))
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.us.GetUser(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserView(user))
+}
+
+// SetUserStatus activates, suspends or closes a user. Closed users cannot be reopened.
+func (h *Handler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := validateUserID(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	var reqBody setUserStatusRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		writeValidationError(w, r, errors.New("invalid request body"))
+		return
+	}
+
+	status, err := model.ToUserStatus(reqBody.Status)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.us.SetUserStatus(r.Context(), userID, status)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserView(user))
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/handler"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+)
+
+// AuthorizationHeader carries the API key of a request as "Bearer <key>".
+const AuthorizationHeader = "Authorization"
+
+// Authenticator only lets requests through that carry an active API key granting the scope of the
+// route. The key and its provider are passed on in the request context.
+type Authenticator struct {
+	keys service.APIKeyService
+}
+
+// NewAuthenticator creates an authenticator checking keys against keys.
+func NewAuthenticator(keys service.APIKeyService) *Authenticator {
+	return &Authenticator{keys: keys}
+}
+
+// Require returns the middleware rejecting requests without a valid API key with 401
+// unauthenticated, and requests whose key does not grant scope with 403 insufficient_scope.
+func (a *Authenticator) Require(scope model.APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, provider, err := a.authenticate(r, scope)
+			if err != nil {
+				if errors.Is(err, service.ErrUnauthenticated) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="wallet"`)
+				}
+
+				handler.WriteError(w, r, err)
+
+				return
+			}
+
+			ctx := handler.WithAPIKey(handler.WithProvider(r.Context(), provider), apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (a *Authenticator) authenticate(
+	r *http.Request,
+	scope model.APIKeyScope,
+) (*model.APIKey, *model.Provider, error) {
+	key, ok := strings.CutPrefix(r.Header.Get(AuthorizationHeader), "Bearer ")
+	if !ok || strings.TrimSpace(key) == "" {
+		return nil, nil, fmt.Errorf("%w: the %s header must carry a bearer API key",
+			service.ErrUnauthenticated, AuthorizationHeader)
+	}
+
+	apiKey, provider, err := a.keys.Authenticate(r.Context(), strings.TrimSpace(key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !apiKey.HasScope(scope) {
+		return nil, nil, fmt.Errorf("%w: API key %s does not grant %s",
+			service.ErrInsufficientScope, apiKey.Prefix, scope)
+	}
+
+	return apiKey, provider, nil
+}
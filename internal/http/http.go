@@ -4,27 +4,122 @@ import (
 	"net/http"
 
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/handler"
-	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/metrics"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/tracing"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 )
 
-// NewRouter creates and configures the HTTP router.
-func NewRouter(transactionService service.TransactionService) chi.Router {
-	handler := handler.NewHandler(transactionService)
+// Middleware are the optional middleware of the router.
+type Middleware struct {
+	// Auth requires an API key granting the scope of the route.
+	Auth *Authenticator
+	// RateLimits limits the requests per provider and per user.
+	RateLimits *RateLimiter
+	// Signatures requires requests that move money to be signed by a provider.
+	Signatures *SignatureVerifier
+	// Metrics instruments requests and serves the metrics on /metrics.
+	Metrics *metrics.Metrics
+}
+
+// NewRouter creates and configures the HTTP router serving services. Every middleware is skipped
+// if it is nil. Requests are always traced, spans are dropped unless a tracer provider was set up
+// with tracing.Setup.
+func NewRouter(services handler.Services, middleware Middleware) chi.Router {
+	handler := handler.NewHandler(services)
+
+	requireScope := func(scope model.APIKeyScope) func(http.Handler) http.Handler {
+		if middleware.Auth == nil {
+			return func(next http.Handler) http.Handler { return next }
+		}
+
+		return middleware.Auth.Require(scope)
+	}
+
+	rateLimit := func(next http.Handler) http.Handler {
+		if middleware.RateLimits == nil {
+			return next
+		}
+
+		return middleware.RateLimits.Limit(next)
+	}
 
 	r := chi.NewRouter()
 
-	r.Use(middleware.Logger)
+	r.Use(tracing.Middleware)
+	r.Use(RequestID)
+	r.Use(AccessLog)
 
-	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	})
+	if middleware.Metrics != nil {
+		r.Use(middleware.Metrics.Instrument)
+		r.Method(http.MethodGet, "/metrics", middleware.Metrics.Handler())
+	}
+
+	r.Get("/livez", handler.Livez)
+	r.Get("/readyz", handler.Readyz)
+	r.Get("/health", handler.Livez)
 
+	// Users belong to no provider, their transactions and reservations are filtered by the provider of the key.
 	r.Group(func(r chi.Router) {
+		r.Use(requireScope(model.ScopeBalanceRead))
+		r.Use(rateLimit)
+
+		r.Get("/user/{userID}", handler.GetUser)
 		r.Get("/user/{userID}/balance", handler.GetBalance)
+		r.Get("/user/{userID}/wallets", handler.ListWallets)
+		r.Get("/user/{userID}/limits", handler.ListLimits)
+		r.Get("/user/{userID}/bonuses", handler.ListBonusGrants)
+		r.Get("/user/{userID}/transactions", handler.ListTransactions)
+		r.Get("/user/{userID}/transaction/{transactionID}", handler.GetUserTransaction)
+		r.Get("/user/{userID}/reservations/{transactionID}", handler.GetReservation)
+		r.Get("/transaction/{transactionID}", handler.GetTransaction)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requireScope(model.ScopeAdmin))
+		r.Use(rateLimit)
+
+		r.Post("/user", handler.CreateUser)
+		r.Patch("/user/{userID}/status", handler.SetUserStatus)
+		r.Put("/user/{userID}/limits/{period}", handler.SetLimit)
+		r.Delete("/user/{userID}/limits/{period}", handler.RemoveLimit)
+		r.Post("/user/{userID}/bonuses", handler.GrantBonus)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(requireScope(model.ScopeTransactionsWrite))
+
+		// The signature identifies the provider when API keys are disabled, so it is verified before
+		// the requests are limited per provider rather than per client address.
+		if middleware.Signatures != nil {
+			r.Use(middleware.Signatures.Verify)
+		}
+
+		r.Use(rateLimit)
+
 		r.Post("/user/{userID}/transaction", handler.ProcessTransaction)
+		r.Post("/user/{userID}/reservations", handler.Reserve)
+		r.Post("/user/{userID}/reservations/{transactionID}/commit", handler.CommitReservation)
+		r.Post("/user/{userID}/reservations/{transactionID}/release", handler.ReleaseReservation)
+		r.Post("/transactions/batch", handler.ProcessBatch)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(requireScope(model.ScopeAdmin))
+		r.Use(rateLimit)
+
+		r.Get("/source-types", handler.ListSourceTypes)
+		r.Post("/source-types", handler.CreateSourceType)
+		r.Patch("/source-types/{name}", handler.UpdateSourceType)
+		r.Get("/adjustments", handler.ListAdjustments)
+		r.Post("/adjustments", handler.RequestAdjustment)
+		r.Get("/adjustments/{transactionID}", handler.GetAdjustment)
+		r.Post("/adjustments/{transactionID}/approve", handler.ApproveAdjustment)
+		r.Post("/adjustments/{transactionID}/reject", handler.RejectAdjustment)
+		r.Get("/providers/{provider}/keys", handler.ListAPIKeys)
+		r.Post("/providers/{provider}/keys", handler.IssueAPIKey)
+		r.Post("/keys/{keyID}/rotate", handler.RotateAPIKey)
+		r.Delete("/keys/{keyID}", handler.RevokeAPIKey)
 	})
 
 	return r
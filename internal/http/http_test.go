@@ -0,0 +1,361 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/handler"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/logging"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// stubProviders knows a single enabled provider.
+type stubProviders struct {
+	service.ProviderService
+}
+
+func (stubProviders) GetProvider(_ context.Context, name string) (*model.Provider, error) {
+	if name != "acme" {
+		return nil, service.ErrProviderNotFound
+	}
+
+	return &model.Provider{Name: "acme", Secret: testSecret, Enabled: true}, nil
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"state":"win","amount":"10.00"}`)
+
+	nonces := service.NewLocalNonceService()
+	verifier := NewSignatureVerifier(stubProviders{}, nonces, DefaultSignatureMaxSkew)
+	verifier.now = func() time.Time { return now }
+
+	var received []byte
+
+	next := verifier.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// signed returns a request signed at signedAt, modify may tamper with it after signing.
+	signed := func(nonce string, signedAt time.Time, modify func(r *http.Request)) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/user/1/transaction", bytes.NewReader(body))
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+
+		req.Header.Set(ProviderHeader, "acme")
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set(SignatureHeader, Sign(testSecret, req.Method, req.URL.Path, timestamp, nonce, body))
+
+		if modify != nil {
+			modify(req)
+		}
+
+		return req
+	}
+
+	serve := func(req *http.Request) int {
+		resp := httptest.NewRecorder()
+		next.ServeHTTP(resp, req)
+
+		return resp.Code
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		received = nil
+
+		require.Equal(t, http.StatusOK, serve(signed("valid", now, nil)))
+		assert.Equal(t, body, received, "the body should be passed on")
+	})
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, serve(signed("replayed", now, nil)))
+		assert.Equal(t, http.StatusUnauthorized, serve(signed("replayed", now, nil)))
+	})
+
+	cases := []struct {
+		name     string
+		signedAt time.Time
+		modify   func(r *http.Request)
+	}{
+		{"missing signature", now, func(r *http.Request) { r.Header.Del(SignatureHeader) }},
+		{"unknown provider", now, func(r *http.Request) { r.Header.Set(ProviderHeader, "other") }},
+		{"tampered path", now, func(r *http.Request) { r.URL.Path = "/user/2/transaction" }},
+		{"malformed timestamp", now, func(r *http.Request) { r.Header.Set(TimestampHeader, "yesterday") }},
+		{"too old", now.Add(-DefaultSignatureMaxSkew - time.Second), nil},
+		{"too far ahead", now.Add(DefaultSignatureMaxSkew + time.Second), nil},
+		{
+			"tampered body",
+			now,
+			func(r *http.Request) { r.Body = io.NopCloser(bytes.NewReader([]byte(`{"state":"lose"}`))) },
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, http.StatusUnauthorized, serve(signed(tc.name, tc.signedAt, tc.modify)))
+		})
+	}
+
+	t.Run("signed by another provider than the API key", func(t *testing.T) {
+		req := signed("other key", now, nil)
+		req = req.WithContext(handler.WithProvider(req.Context(), &model.Provider{Name: "other"}))
+
+		assert.Equal(t, http.StatusUnauthorized, serve(req))
+	})
+
+	t.Run("nonce of a rejected request stays usable", func(t *testing.T) {
+		forged := signed("reused", now, func(r *http.Request) { r.Header.Set(SignatureHeader, "00") })
+
+		require.Equal(t, http.StatusUnauthorized, serve(forged))
+		assert.Equal(t, http.StatusOK, serve(signed("reused", now, nil)))
+	})
+
+	t.Run("replay against an instance sharing the nonces", func(t *testing.T) {
+		other := NewSignatureVerifier(stubProviders{}, nonces, DefaultSignatureMaxSkew)
+		other.now = verifier.now
+
+		require.Equal(t, http.StatusOK, serve(signed("shared", now, nil)))
+
+		resp := httptest.NewRecorder()
+		other.Verify(http.NotFoundHandler()).ServeHTTP(resp, signed("shared", now, nil))
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+}
+
+// stubKeys knows a single key granting balance:read.
+type stubKeys struct {
+	service.APIKeyService
+}
+
+func (stubKeys) Authenticate(_ context.Context, key string) (*model.APIKey, *model.Provider, error) {
+	if key != "wk_valid" {
+		return nil, nil, service.ErrUnauthenticated
+	}
+
+	return &model.APIKey{Provider: "acme", Scopes: []model.APIKeyScope{model.ScopeBalanceRead}},
+		&model.Provider{Name: "acme", Enabled: true}, nil
+}
+
+func TestAuthenticator(t *testing.T) {
+	auth := NewAuthenticator(stubKeys{})
+
+	var provider *model.Provider
+
+	serve := func(scope model.APIKeyScope, authorization string) *httptest.ResponseRecorder {
+		provider = nil
+
+		next := auth.Require(scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provider, _ = handler.ProviderFromContext(r.Context())
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/user/1/balance", nil)
+		if authorization != "" {
+			req.Header.Set(AuthorizationHeader, authorization)
+		}
+
+		resp := httptest.NewRecorder()
+		next.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	t.Run("valid key", func(t *testing.T) {
+		resp := serve(model.ScopeBalanceRead, "Bearer wk_valid")
+
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NotNil(t, provider, "the provider should be passed on")
+		assert.Equal(t, "acme", provider.Name)
+	})
+
+	t.Run("missing scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(model.ScopeAdmin, "Bearer wk_valid").Code)
+	})
+
+	for _, authorization := range []string{"", "wk_valid", "Basic d2s6dmFsaWQ=", "Bearer ", "Bearer wk_unknown"} {
+		t.Run("rejected "+authorization, func(t *testing.T) {
+			resp := serve(model.ScopeBalanceRead, authorization)
+
+			assert.Equal(t, http.StatusUnauthorized, resp.Code)
+			assert.NotEmpty(t, resp.Header().Get("WWW-Authenticate"))
+			assert.Nil(t, provider)
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limits := NewRateLimiter(
+		service.NewLocalRateLimitService(),
+		model.RateLimit{Rate: 1, Burst: 3},
+		model.RateLimit{Rate: 1, Burst: 2},
+	)
+
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(limits.Limit)
+		r.Get("/user/{userID}/balance", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	serve := func(userID, provider string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user/"+userID+"/balance", nil)
+		if provider != "" {
+			req = req.WithContext(handler.WithProvider(req.Context(), &model.Provider{Name: provider}))
+		}
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := serve("1", "acme")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get(RateLimitLimitHeader), "the user limit is closest to running out")
+	assert.Equal(t, "1", resp.Header().Get(RateLimitRemainingHeader))
+	assert.Equal(t, "1", resp.Header().Get(RateLimitResetHeader))
+
+	require.Equal(t, http.StatusOK, serve("01", "acme").Code, "user IDs are limited by their number")
+
+	resp = serve("1", "acme")
+	require.Equal(t, http.StatusTooManyRequests, resp.Code, "the user is over its limit")
+	assert.Equal(t, "1", resp.Header().Get(RetryAfterHeader))
+	assert.Equal(t, "0", resp.Header().Get(RateLimitRemainingHeader))
+
+	resp = serve("2", "acme")
+	require.Equal(t, http.StatusOK, resp.Code, "the rejected request took no token of the provider")
+	assert.Equal(t, "0", resp.Header().Get(RateLimitRemainingHeader))
+
+	resp = serve("3", "acme")
+	require.Equal(t, http.StatusTooManyRequests, resp.Code, "the provider is over its limit")
+	assert.Equal(t, "3", resp.Header().Get(RateLimitLimitHeader))
+
+	assert.Equal(t, http.StatusOK, serve("3", "other").Code, "other providers have their own bucket")
+	assert.Equal(t, http.StatusOK, serve("4", "").Code, "requests without a provider are limited per client")
+}
+
+func TestRouterLimitsSignedRequestsPerProvider(t *testing.T) {
+	router := NewRouter(handler.Services{}, Middleware{
+		RateLimits: NewRateLimiter(service.NewLocalRateLimitService(), model.RateLimit{Rate: 1, Burst: 1}, model.RateLimit{}),
+		Signatures: NewSignatureVerifier(stubProviders{}, service.NewLocalNonceService(), DefaultSignatureMaxSkew),
+	})
+
+	// serve sends a signed transaction from address. The body is invalid, so that requests let
+	// through by the middleware are rejected by the handler without reaching a service.
+	serve := func(address string) int {
+		body := []byte(`{"state":"win"}`)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := uuid.NewString()
+
+		req := httptest.NewRequest(http.MethodPost, "/user/1/transaction", bytes.NewReader(body))
+		req.RemoteAddr = address
+		req.Header.Set(ProviderHeader, "acme")
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set(SignatureHeader, Sign(testSecret, req.Method, req.URL.Path, timestamp, nonce, body))
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		return resp.Code
+	}
+
+	require.Equal(t, http.StatusBadRequest, serve("192.0.2.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("192.0.2.2:1234"),
+		"the provider is limited across its addresses")
+}
+
+func TestRequestLogging(t *testing.T) {
+	var logs bytes.Buffer
+
+	logger := logging.New(&logs, slog.LevelDebug)
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(logging.WithLogger(r.Context(), logger)))
+		})
+	})
+	router.Use(RequestID)
+	router.Use(AccessLog)
+	router.Get("/user/{userID}/balance", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).InfoContext(r.Context(), "balance read")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	records := func() []map[string]any {
+		var parsed []map[string]any
+
+		for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+			var record map[string]any
+			require.NoError(t, json.Unmarshal(line, &record))
+
+			parsed = append(parsed, record)
+		}
+
+		logs.Reset()
+
+		return parsed
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/1/balance", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	req.Header.Set(AuthorizationHeader, "Bearer secret-key")
+	req.Header.Set(SignatureHeader, "t=1,v1=abc")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, "req-42", resp.Header().Get(RequestIDHeader), "the ID of the client is kept")
+	assert.NotContains(t, logs.String(), "secret-key", "credentials are never logged")
+
+	logged := records()
+	require.Len(t, logged, 2)
+
+	assert.Equal(t, "balance read", logged[0]["msg"])
+	assert.Equal(t, "req-42", logged[0][logging.RequestIDKey], "handlers log with the request ID")
+
+	assert.Equal(t, "request served", logged[1]["msg"])
+	assert.Equal(t, "req-42", logged[1][logging.RequestIDKey])
+	assert.Equal(t, "/user/{userID}/balance", logged[1]["route"])
+	assert.InDelta(t, http.StatusTeapot, logged[1]["status"], 0)
+
+	headers, ok := logged[1]["headers"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, redacted, headers[AuthorizationHeader])
+	assert.Equal(t, redacted, headers[SignatureHeader])
+
+	for _, id := range []string{"", "with space", "new\nline", strings.Repeat("a", maxRequestIDLength+1)} {
+		req = httptest.NewRequest(http.MethodGet, "/user/1/balance", nil)
+		req.Header.Set(RequestIDHeader, id)
+
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		generated := resp.Header().Get(RequestIDHeader)
+		assert.NotEqual(t, id, generated, "invalid IDs are replaced")
+		assert.NoError(t, uuid.Validate(generated))
+
+		logged = records()
+		require.Len(t, logged, 2)
+		assert.Equal(t, generated, logged[1][logging.RequestIDKey])
+	}
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID of a request. An ID sent by the client is kept, otherwise one is
+// generated; either way it is returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of request IDs taken over from clients.
+const maxRequestIDLength = 128
+
+// redacted replaces the values of sensitive headers in the logs.
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders carry credentials and are never logged.
+var sensitiveHeaders = map[string]bool{
+	AuthorizationHeader:   true,
+	SignatureHeader:       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// RequestID assigns every request its ID and passes a logger on in the request context that adds
+// the ID, and the trace ID if the request is traced, to every record.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		args := []any{logging.RequestIDKey, id}
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			args = append(args, logging.TraceIDKey, span.TraceID().String())
+		}
+
+		next.ServeHTTP(w, r.WithContext(logging.With(r.Context(), args...)))
+	})
+}
+
+// validRequestID accepts IDs of printable ASCII characters without spaces, so that client IDs
+// cannot forge log records.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AccessLog logs every request once it was served, failed requests at error level. The request
+// headers are logged at debug level, without the values of sensitiveHeaders. It has to run after
+// RequestID to log the request ID.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+		}
+
+		logger := logging.FromContext(r.Context())
+		if logger.Enabled(r.Context(), slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("headers", redactHeaders(r.Header)))
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(r.Context(), level, "request served", attrs...)
+	})
+}
+
+// redactHeaders returns the headers of a request for the logs, with the values of
+// sensitiveHeaders replaced.
+func redactHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = redacted
+
+			continue
+		}
+
+		headers[name] = strings.Join(values, ", ")
+	}
+
+	return headers
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/handler"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// Headers of rate limited routes, following the IETF draft on RateLimit header fields.
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+)
+
+// RateLimiter limits the requests of every provider and the requests for every user with token
+// buckets. Without API keys requests have no provider and are limited per client address instead.
+type RateLimiter struct {
+	limits   service.RateLimitService
+	provider model.RateLimit
+	user     model.RateLimit
+}
+
+// NewRateLimiter creates a limiter keeping its buckets in limits. A disabled limit is not checked.
+func NewRateLimiter(limits service.RateLimitService, provider, user model.RateLimit) *RateLimiter {
+	return &RateLimiter{limits: limits, provider: provider, user: user}
+}
+
+// Sweep drops the buckets unused for longer than they take to refill and returns how many there
+// were.
+func (l *RateLimiter) Sweep(ctx context.Context) (int, error) {
+	return l.limits.Sweep(ctx, l.idle())
+}
+
+// idle is how long the buckets take to refill.
+func (l *RateLimiter) idle() time.Duration {
+	var idle time.Duration
+
+	for _, limit := range []model.RateLimit{l.provider, l.user} {
+		if limit.Enabled() {
+			idle = max(idle, time.Duration(float64(limit.Burst)/limit.Rate*float64(time.Second)))
+		}
+	}
+
+	return idle
+}
+
+// Limit is the middleware rejecting requests over a limit with 429 rate_limited. It has to run after
+// the routing of the user ID and after the authentication of the provider. Responses carry the
+// RateLimit headers of the limit closest to running out.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, err := l.take(r)
+		if decision != nil {
+			setRateLimitHeaders(w.Header(), decision)
+		}
+
+		if err != nil {
+			handler.WriteError(w, r, err)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey is a bucket a request takes a token from.
+type rateLimitKey struct {
+	key     string
+	subject string
+	limit   model.RateLimit
+}
+
+func (l *RateLimiter) keys(r *http.Request) []rateLimitKey {
+	var keys []rateLimitKey
+
+	if l.provider.Enabled() {
+		if provider, ok := handler.ProviderFromContext(r.Context()); ok {
+			keys = append(keys, rateLimitKey{"provider:" + provider.Name, "provider " + provider.Name, l.provider})
+		} else {
+			client := clientAddress(r)
+			keys = append(keys, rateLimitKey{"client:" + client, "client " + client, l.provider})
+		}
+	}
+
+	if l.user.Enabled() {
+		// Malformed user IDs are left to the handler to reject.
+		if userID, err := strconv.Atoi(chi.URLParam(r, "userID")); err == nil {
+			id := strconv.Itoa(userID)
+			keys = append(keys, rateLimitKey{"user:" + id, "user " + id, l.user})
+		}
+	}
+
+	return keys
+}
+
+// take takes a token from every bucket of r, or from none if one of them rejects r, and returns the
+// decision with the fewest tokens left, or the rejecting one.
+func (l *RateLimiter) take(r *http.Request) (*model.RateLimitDecision, error) {
+	keys := l.keys(r)
+
+	buckets := make([]model.RateLimitKey, len(keys))
+	for i, key := range keys {
+		buckets[i] = model.RateLimitKey{Key: key.key, Limit: key.limit}
+	}
+
+	decisions, err := l.limits.Take(r.Context(), buckets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take rate limit tokens: %w", err)
+	}
+
+	var tightest *model.RateLimitDecision
+
+	for i, key := range keys {
+		decision := &decisions[i]
+
+		if !decision.Allowed {
+			return decision, fmt.Errorf("%w: %s is over its limit of %d requests at %g per second",
+				service.ErrRateLimited, key.subject, key.limit.Burst, key.limit.Rate)
+		}
+
+		if tightest == nil || decision.Remaining < tightest.Remaining {
+			tightest = decision
+		}
+	}
+
+	return tightest, nil
+}
+
+func setRateLimitHeaders(header http.Header, decision *model.RateLimitDecision) {
+	header.Set(RateLimitLimitHeader, strconv.Itoa(decision.Limit))
+	header.Set(RateLimitRemainingHeader, strconv.Itoa(decision.Remaining))
+	header.Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(decision.Reset)))
+
+	if !decision.Allowed {
+		header.Set(RetryAfterHeader, strconv.Itoa(max(1, ceilSeconds(decision.RetryAfter))))
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, so that clients waiting that long are not early.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/handler"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+)
+
+// Headers of signed requests.
+const (
+	ProviderHeader  = "Provider-ID"
+	TimestampHeader = "Signature-Timestamp"
+	NonceHeader     = "Signature-Nonce"
+	SignatureHeader = "Signature"
+)
+
+const (
+	// DefaultSignatureMaxSkew is how far the timestamp of a signed request may be off the server clock.
+	DefaultSignatureMaxSkew = 5 * time.Minute
+	// maxSignedBodySize caps the body read to verify a signature, a full batch fits comfortably.
+	maxSignedBodySize = 4 << 20
+	maxNonceLength    = 128
+)
+
+// Sign returns the hex-encoded HMAC-SHA256 of a request under secret. The signed message is the
+// method, the path, the Unix timestamp in seconds and the nonce, each followed by a newline, and
+// then the raw body.
+func Sign(secret, method, path, timestamp, nonce string, body []byte) string {
+	return hex.EncodeToString(signature(secret, method, path, timestamp, nonce, body))
+}
+
+func signature(secret, method, path, timestamp, nonce string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", method, path, timestamp, nonce)
+	_, _ = mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+// SignatureVerifier only lets requests through that are signed by an enabled provider, were signed
+// recently and were not seen before. The verified provider is passed on in the request context.
+type SignatureVerifier struct {
+	providers service.ProviderService
+	maxSkew   time.Duration
+	nonces    service.NonceService
+	now       func() time.Time
+}
+
+// NewSignatureVerifier creates a verifier accepting timestamps at most maxSkew off the server clock
+// and remembering nonces in nonces. Replays are only caught across instances if they share nonces.
+func NewSignatureVerifier(
+	providers service.ProviderService,
+	nonces service.NonceService,
+	maxSkew time.Duration,
+) *SignatureVerifier {
+	return &SignatureVerifier{
+		providers: providers,
+		maxSkew:   maxSkew,
+		nonces:    nonces,
+		now:       time.Now,
+	}
+}
+
+// Sweep drops the nonces of requests too old to be accepted and returns how many there were.
+func (v *SignatureVerifier) Sweep(ctx context.Context) (int, error) {
+	return v.nonces.Sweep(ctx)
+}
+
+// Verify is the middleware rejecting requests without a valid signature with 401 invalid_signature.
+func (v *SignatureVerifier) Verify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider, err := v.verify(r)
+		if err != nil {
+			handler.WriteError(w, r, err)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(handler.WithProvider(r.Context(), provider)))
+	})
+}
+
+func (v *SignatureVerifier) verify(r *http.Request) (*model.Provider, error) {
+	name := r.Header.Get(ProviderHeader)
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+
+	if name == "" || timestamp == "" || nonce == "" || r.Header.Get(SignatureHeader) == "" {
+		return nil, fmt.Errorf("%w: the %s, %s, %s and %s headers are required",
+			service.ErrInvalidSignature, ProviderHeader, TimestampHeader, NonceHeader, SignatureHeader)
+	}
+
+	if len(nonce) > maxNonceLength {
+		return nil, fmt.Errorf("%w: nonce is longer than %d characters", service.ErrInvalidSignature, maxNonceLength)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp must be in Unix seconds", service.ErrInvalidSignature)
+	}
+
+	now := v.now()
+	signedAt := time.Unix(seconds, 0)
+
+	if skew := now.Sub(signedAt); skew > v.maxSkew || skew < -v.maxSkew {
+		return nil, fmt.Errorf("%w: timestamp is more than %s off the server clock",
+			service.ErrInvalidSignature, v.maxSkew)
+	}
+
+	// With API keys enabled the request must be signed by the provider of its key.
+	if authenticated, ok := handler.ProviderFromContext(r.Context()); ok && authenticated.Name != name {
+		return nil, fmt.Errorf("%w: request is signed by another provider than its API key belongs to",
+			service.ErrInvalidSignature)
+	}
+
+	provider, err := v.providers.GetProvider(r.Context(), name)
+	if errors.Is(err, service.ErrProviderNotFound) {
+		// Unknown providers get the same answer as wrong signatures, so that names cannot be probed.
+		return nil, fmt.Errorf("%w: signature does not match", service.ErrInvalidSignature)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load provider %s: %w", name, err)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read request body", service.ErrInvalidTransaction)
+	}
+
+	if len(body) > maxSignedBodySize {
+		return nil, fmt.Errorf("%w: request body is larger than %d bytes",
+			service.ErrInvalidTransaction, maxSignedBodySize)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := signature(provider.Secret, r.Method, r.URL.EscapedPath(), timestamp, nonce, body)
+
+	given, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil || !hmac.Equal(given, expected) {
+		return nil, fmt.Errorf("%w: signature does not match", service.ErrInvalidSignature)
+	}
+
+	// Only nonces of valid signatures are remembered, so that forged requests cannot use them up.
+	unused, err := v.nonces.Use(r.Context(), name+"\n"+nonce, signedAt.Add(v.maxSkew), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record nonce: %w", err)
+	} else if !unused {
+		return nil, fmt.Errorf("%w: nonce was already used", service.ErrInvalidSignature)
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,61 @@
+// Package logging creates the structured logger of the application and carries it in the context,
+// so that every layer logs with the request ID of the request it serves.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Keys of the attributes shared across layers.
+const (
+	RequestIDKey     = "request_id"
+	TraceIDKey       = "trace_id"
+	UserIDKey        = "user_id"
+	TransactionIDKey = "transaction_id"
+	ErrorKey         = "error"
+)
+
+type loggerKey struct{}
+
+// New creates a logger writing records of level and above to w as JSON lines.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return level, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", value)
+	}
+
+	return level, nil
+}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger adds args to every record.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// Error describes err for a record.
+func Error(err error) slog.Attr {
+	return slog.String(ErrorKey, err.Error())
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for value, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		" warn": slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		level, err := ParseLevel(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, level, value)
+	}
+
+	_, err := ParseLevel("verbose")
+	require.ErrorContains(t, err, "invalid log level")
+}
+
+func TestContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()),
+		"contexts without a logger use the default logger")
+
+	var logs bytes.Buffer
+
+	ctx := WithLogger(context.Background(), New(&logs, slog.LevelInfo))
+	ctx = With(ctx, RequestIDKey, "req-1")
+
+	FromContext(ctx).DebugContext(ctx, "dropped")
+	FromContext(ctx).WarnContext(ctx, "transaction rejected", Error(errors.New("insufficient funds")))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record), "only records of the level and above are written")
+
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "transaction rejected", record["msg"])
+	assert.Equal(t, "req-1", record[RequestIDKey])
+	assert.Equal(t, "insufficient funds", record[ErrorKey])
+}
@@ -0,0 +1,103 @@
+// Package metrics collects the metrics of the application and exposes them in the Prometheus text
+// format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the metrics of the application.
+const namespace = "wallet"
+
+// Outcomes of database transactions.
+const (
+	outcomeCommit   = "commit"
+	outcomeRollback = "rollback"
+)
+
+// Metrics holds the collectors of the application in a registry of its own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+
+	transactions          *prometheus.CounterVec
+	duplicateTransactions *prometheus.CounterVec
+	rejectedTransactions  *prometheus.CounterVec
+	transactionAmounts    *prometheus.CounterVec
+
+	dbTransactions *prometheus.CounterVec
+}
+
+// New creates the metrics and registers them together with the Go runtime and process metrics and,
+// unless db is nil, the connection pool statistics of db.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_processed_total",
+			Help:      "Transactions applied to a wallet by state and source type.",
+		}, []string{"state", "source_type"}),
+		duplicateTransactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_duplicate_total",
+			Help:      "Retries of processed transactions answered with the original outcome, by state and source type.",
+		}, []string{"state", "source_type"}),
+		rejectedTransactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_rejected_total",
+			Help:      "Transactions rejected by the service by the error code of the response.",
+		}, []string{"reason"}),
+		transactionAmounts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transaction_amount_total",
+			Help:      "Sum of the amounts of processed transactions by state, source type and currency.",
+		}, []string{"state", "source_type", "currency"}),
+		dbTransactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_transactions_total",
+			Help:      "Database transactions by outcome, commit or rollback.",
+		}, []string{"outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.transactions,
+		m.duplicateTransactions,
+		m.rejectedTransactions,
+		m.transactionAmounts,
+		m.dbTransactions,
+	)
+
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	m := New(nil)
+
+	router := chi.NewRouter()
+	router.Use(m.Instrument)
+	router.Get("/user/{userID}/balance", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	})
+	router.Post("/user/{userID}/transaction", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+
+	for _, target := range []string{"/user/1/balance", "/user/2/balance", "/unknown/1", "/unknown/2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/user/1/transaction", nil))
+
+	assert.InDelta(t, 2, testutil.ToFloat64(
+		m.httpRequests.WithLabelValues(http.MethodGet, "/user/{userID}/balance", "200")), 0,
+		"requests are labelled by their route")
+	assert.InDelta(t, 2, testutil.ToFloat64(
+		m.httpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(
+		m.httpRequests.WithLabelValues(http.MethodPost, "/user/{userID}/transaction", "422")), 0)
+	assert.Equal(t, 3, testutil.CollectAndCount(m.httpRequestDuration))
+}
+
+// stubTransactions answers every transaction with the outcome keyed by its amount.
+type stubTransactions struct {
+	service.TransactionService
+}
+
+func (stubTransactions) ProcessTransaction(
+	_ context.Context,
+	tx *model.Transaction,
+) (*model.ProcessedTransaction, error) {
+	processed := &model.ProcessedTransaction{
+		TransactionID: tx.ID,
+		State:         tx.State,
+		Amount:        tx.Amount,
+		Currency:      model.CurrencyEUR,
+	}
+
+	switch tx.Amount.String() {
+	case "1":
+		processed.Replayed = true
+	case "2":
+		return nil, service.ErrInsufficientFunds
+	}
+
+	return processed, nil
+}
+
+func (s stubTransactions) ProcessBatch(
+	ctx context.Context,
+	txs []*model.Transaction,
+	mode model.BatchMode,
+) ([]model.BatchItemResult, error) {
+	results := make([]model.BatchItemResult, len(txs))
+
+	for i, tx := range txs {
+		processed, err := s.ProcessTransaction(ctx, tx)
+		if err != nil && mode == model.BatchModeAtomic {
+			return nil, &service.BatchItemError{Index: i, TransactionID: tx.ID, Err: err}
+		}
+
+		results[i] = model.BatchItemResult{Transaction: processed, Err: err}
+	}
+
+	return results, nil
+}
+
+func TestTransactionService(t *testing.T) {
+	transaction := func(amount int64) *model.Transaction {
+		return &model.Transaction{
+			ID:         uuid.New(),
+			State:      model.TransactionStateWin,
+			Amount:     decimal.NewFromInt(amount),
+			SourceType: model.SourceTypeGame,
+		}
+	}
+
+	m := New(nil)
+	transactions := m.TransactionService(stubTransactions{}, func(err error) string {
+		if errors.Is(err, service.ErrInsufficientFunds) {
+			return "insufficient_funds"
+		}
+
+		return "internal_error"
+	})
+
+	_, err := transactions.ProcessTransaction(context.Background(), transaction(10))
+	require.NoError(t, err)
+
+	_, err = transactions.ProcessTransaction(context.Background(), transaction(1))
+	require.NoError(t, err)
+
+	_, err = transactions.ProcessTransaction(context.Background(), transaction(2))
+	require.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	_, err = transactions.ProcessBatch(context.Background(),
+		[]*model.Transaction{transaction(5), transaction(2)}, model.BatchModeIndependent)
+	require.NoError(t, err)
+
+	_, err = transactions.ProcessBatch(context.Background(),
+		[]*model.Transaction{transaction(5), transaction(2)}, model.BatchModeAtomic)
+	require.Error(t, err)
+
+	assert.InDelta(t, 2, testutil.ToFloat64(m.transactions.WithLabelValues("win", "game")), 0,
+		"transactions of a rejected atomic batch are not processed")
+	assert.InDelta(t, 15, testutil.ToFloat64(m.transactionAmounts.WithLabelValues("win", "game", "EUR")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.duplicateTransactions.WithLabelValues("win", "game")), 0)
+	assert.InDelta(t, 3, testutil.ToFloat64(m.rejectedTransactions.WithLabelValues("insufficient_funds")), 0)
+}
+
+// stubRepository runs transactions without a database.
+type stubRepository struct {
+	repository.Repository
+}
+
+func (r stubRepository) WithDBTransaction(
+	ctx context.Context,
+	fn func(context.Context, repository.Repository) error,
+) error {
+	return fn(ctx, r)
+}
+
+func TestRepository(t *testing.T) {
+	m := New(nil)
+	repo := m.Repository(stubRepository{})
+
+	noop := func(context.Context, repository.Repository) error { return nil }
+	fail := func(context.Context, repository.Repository) error { return errors.New("boom") }
+
+	require.NoError(t, repo.WithDBTransaction(context.Background(), noop))
+	require.NoError(t, repo.WithDBTransaction(context.Background(), noop))
+	require.Error(t, repo.WithDBTransaction(context.Background(), fail))
+
+	assert.InDelta(t, 2, testutil.ToFloat64(m.dbTransactions.WithLabelValues(outcomeCommit)), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.dbTransactions.WithLabelValues(outcomeRollback)), 0)
+
+	resp := httptest.NewRecorder()
+	m.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `wallet_db_transactions_total{outcome="commit"} 2`)
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+)
+
+// instrumentedRepository counts the database transactions of the repository it wraps.
+type instrumentedRepository struct {
+	repository.Repository
+
+	metrics *Metrics
+}
+
+// Repository wraps repo, counting its database transactions by outcome. Nested calls of
+// WithDBTransaction join the surrounding transaction and are not counted again.
+func (m *Metrics) Repository(repo repository.Repository) repository.Repository {
+	return &instrumentedRepository{Repository: repo, metrics: m}
+}
+
+// WithDBTransaction counts a transaction as committed if fn and the commit succeeded, and as rolled
+// back otherwise.
+func (r *instrumentedRepository) WithDBTransaction(
+	ctx context.Context,
+	fn func(context.Context, repository.Repository) error,
+) error {
+	err := r.Repository.WithDBTransaction(ctx, fn)
+
+	outcome := outcomeCommit
+	if err != nil {
+		outcome = outcomeRollback
+	}
+
+	r.metrics.dbTransactions.WithLabelValues(outcome).Inc()
+
+	return err
+}
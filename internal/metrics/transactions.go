@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+)
+
+// transactionService counts the transactions processed by the service it wraps.
+type transactionService struct {
+	service.TransactionService
+
+	metrics *Metrics
+	code    func(error) string
+}
+
+// TransactionService wraps transactions, counting processed, duplicate and rejected transactions
+// and summing the amounts of the processed ones. Rejected transactions are labelled with the error
+// code that code returns for their error.
+func (m *Metrics) TransactionService(
+	transactions service.TransactionService,
+	code func(error) string,
+) service.TransactionService {
+	return &transactionService{TransactionService: transactions, metrics: m, code: code}
+}
+
+func (s *transactionService) ProcessTransaction(
+	ctx context.Context,
+	tx *model.Transaction,
+) (*model.ProcessedTransaction, error) {
+	processed, err := s.TransactionService.ProcessTransaction(ctx, tx)
+	s.observeTransaction(tx, processed, err)
+
+	return processed, err
+}
+
+func (s *transactionService) ProcessBatch(
+	ctx context.Context,
+	txs []*model.Transaction,
+	mode model.BatchMode,
+) ([]model.BatchItemResult, error) {
+	results, err := s.TransactionService.ProcessBatch(ctx, txs, mode)
+	if err != nil {
+		// An atomic batch is rejected as a whole for its failing transaction, nothing was applied.
+		var itemErr *service.BatchItemError
+		if errors.As(err, &itemErr) {
+			s.metrics.rejectedTransactions.WithLabelValues(s.code(itemErr.Err)).Inc()
+		}
+
+		return results, err
+	}
+
+	for i := range results {
+		s.observeTransaction(txs[i], results[i].Transaction, results[i].Err)
+	}
+
+	return results, nil
+}
+
+// observeTransaction records the outcome of processing tx.
+func (s *transactionService) observeTransaction(
+	tx *model.Transaction,
+	processed *model.ProcessedTransaction,
+	err error,
+) {
+	m := s.metrics
+
+	if err != nil {
+		m.rejectedTransactions.WithLabelValues(s.code(err)).Inc()
+
+		return
+	}
+
+	state, sourceType := string(processed.State), string(tx.SourceType)
+
+	if processed.Replayed {
+		m.duplicateTransactions.WithLabelValues(state, sourceType).Inc()
+
+		return
+	}
+
+	m.transactions.WithLabelValues(state, sourceType).Inc()
+	m.transactionAmounts.WithLabelValues(state, sourceType, string(processed.Currency)).
+		Add(processed.Amount.InexactFloat64())
+}
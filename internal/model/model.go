@@ -1,7 +1,11 @@
 package model
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,8 +13,235 @@ import (
 )
 
 type User struct {
-	ID      int             `json:"id"`
+	ID        int        `json:"id"`
+	Status    UserStatus `json:"status"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	Wallets   []Wallet   `json:"wallets"`
+}
+
+// UserStatus is the lifecycle state of a user account.
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	// UserStatusClosed is final, a closed account cannot be reopened.
+	UserStatusClosed UserStatus = "closed"
+)
+
+func ToUserStatus(s string) (UserStatus, error) {
+	switch s {
+	case "active":
+		return UserStatusActive, nil
+	case "suspended":
+		return UserStatusSuspended, nil
+	case "closed":
+		return UserStatusClosed, nil
+	default:
+		return "", fmt.Errorf("invalid user status: %s", s)
+	}
+}
+
+// CanChangeTo reports whether an account in status s may be moved to next.
+func (s UserStatus) CanChangeTo(next UserStatus) bool {
+	return s != UserStatusClosed || next == UserStatusClosed
+}
+
+// UserStatusPolicy lists the transaction states accepted for users that are not active.
+// Active users may send transactions of every state, statuses missing from the policy none.
+type UserStatusPolicy map[UserStatus][]TransactionState
+
+// Allows reports whether a user in status may send a transaction in state.
+func (p UserStatusPolicy) Allows(status UserStatus, state TransactionState) bool {
+	return status == UserStatusActive || slices.Contains(p[status], state)
+}
+
+// Currency is an ISO 4217 code of a currency balances are held in.
+type Currency string
+
+const (
+	CurrencyEUR Currency = "EUR"
+	CurrencyUSD Currency = "USD"
+	CurrencyGBP Currency = "GBP"
+)
+
+func ToCurrency(s string) (Currency, error) {
+	switch s {
+	case "EUR":
+		return CurrencyEUR, nil
+	case "USD":
+		return CurrencyUSD, nil
+	case "GBP":
+		return CurrencyGBP, nil
+	default:
+		return "", fmt.Errorf("invalid currency: %s", s)
+	}
+}
+
+// Wallet holds the balances of a user in one currency.
+type Wallet struct {
+	UserID   int      `json:"userId"`
+	Currency Currency `json:"currency"`
+	// Balance is the real, withdrawable money.
 	Balance decimal.Decimal `json:"balance"`
+	// BonusBalance is bonus money that becomes real once its wagering requirement is met.
+	BonusBalance decimal.Decimal `json:"bonusBalance"`
+	// HeldBalance is real money reserved for bets that are not settled yet. It is not part of Balance.
+	HeldBalance decimal.Decimal `json:"heldBalance"`
+}
+
+// Total returns the money the user can play with, real and bonus. Held money is not included.
+func (w *Wallet) Total() decimal.Decimal {
+	return w.Balance.Add(w.BonusBalance)
+}
+
+// Balances returns the balances of the wallet.
+func (w *Wallet) Balances() Balances {
+	return Balances{Real: w.Balance, Bonus: w.BonusBalance, Held: w.HeldBalance}
+}
+
+// BonusSpendOrder decides which balance a lose is paid from first.
+type BonusSpendOrder string
+
+const (
+	BonusSpendOrderRealFirst  BonusSpendOrder = "real_first"
+	BonusSpendOrderBonusFirst BonusSpendOrder = "bonus_first"
+)
+
+func ToBonusSpendOrder(s string) (BonusSpendOrder, error) {
+	switch s {
+	case "real_first":
+		return BonusSpendOrderRealFirst, nil
+	case "bonus_first":
+		return BonusSpendOrderBonusFirst, nil
+	default:
+		return "", fmt.Errorf("invalid bonus spend order: %s", s)
+	}
+}
+
+// Split divides amount into the parts paid from the real and the bonus balance of wallet.
+// Whatever both balances cannot cover is charged to the real balance, which then
+// fails as insufficient funds.
+func (o BonusSpendOrder) Split(amount decimal.Decimal, wallet *Wallet) (realPart, bonusPart decimal.Decimal) {
+	available := decimal.Max(wallet.BonusBalance, decimal.Zero)
+
+	if o == BonusSpendOrderBonusFirst {
+		bonusPart = decimal.Min(amount, available)
+	} else {
+		realPart = decimal.Min(amount, decimal.Max(wallet.Balance, decimal.Zero))
+		bonusPart = decimal.Min(amount.Sub(realPart), available)
+	}
+
+	return amount.Sub(bonusPart), bonusPart
+}
+
+// BonusGrantStatus is the stage of a bonus grant.
+type BonusGrantStatus string
+
+const (
+	// BonusGrantActive grants are wagered by lose transactions.
+	BonusGrantActive BonusGrantStatus = "active"
+	// BonusGrantConverted grants met their wagering requirement and were moved to the real balance.
+	BonusGrantConverted BonusGrantStatus = "converted"
+	// BonusGrantForfeited grants were lost before their wagering requirement was met.
+	BonusGrantForfeited BonusGrantStatus = "forfeited"
+)
+
+// BonusGrant is bonus money granted to a wallet, to be wagered before it becomes real money.
+type BonusGrant struct {
+	ID int64
+	// GrantID is chosen by the caller, a grant retried with the same GrantID is only credited once.
+	// It is nil for grants made before grant IDs were required.
+	GrantID  uuid.UUID
+	UserID   int
+	Currency Currency
+	Amount   decimal.Decimal
+	// WageringRequirement is the amount the user has to stake before the grant is converted.
+	WageringRequirement decimal.Decimal
+	Wagered             decimal.Decimal
+	Status              BonusGrantStatus
+	// ConvertedAmount is the bonus money moved to the real balance on conversion. It can be less
+	// than Amount if part of the bonus was lost in the meantime.
+	ConvertedAmount decimal.NullDecimal
+	CreatedAt       time.Time
+	CompletedAt     *time.Time
+}
+
+// SamePayload reports whether other requests the same grant, so that it is a retry of g.
+func (g *BonusGrant) SamePayload(other *BonusGrant) bool {
+	return g.GrantID == other.GrantID &&
+		g.UserID == other.UserID &&
+		g.Currency == other.Currency &&
+		g.Amount.Equal(other.Amount) &&
+		g.WageringRequirement.Equal(other.WageringRequirement)
+}
+
+// Wager adds the stake amount to the progress of the grant and returns the part of amount
+// that exceeds the remaining requirement.
+func (g *BonusGrant) Wager(amount decimal.Decimal) decimal.Decimal {
+	step := decimal.Min(amount, g.WageringRequirement.Sub(g.Wagered))
+	g.Wagered = g.Wagered.Add(step)
+
+	return amount.Sub(step)
+}
+
+// Complete reports whether the wagering requirement of the grant is met.
+func (g *BonusGrant) Complete() bool {
+	return g.Wagered.GreaterThanOrEqual(g.WageringRequirement)
+}
+
+// ReservationStatus is the stage of a reservation.
+type ReservationStatus string
+
+const (
+	// ReservationHeld reservations keep their amount out of the available balance.
+	ReservationHeld ReservationStatus = "held"
+	// ReservationCommitted reservations were settled as a lose transaction with the same ID.
+	ReservationCommitted ReservationStatus = "committed"
+	// ReservationReleased reservations gave their amount back to the balance.
+	ReservationReleased ReservationStatus = "released"
+	// ReservationExpired reservations were released by the sweeper after their expiry.
+	ReservationExpired ReservationStatus = "expired"
+)
+
+// Reservation holds real money of a wallet for a bet until it is committed or released.
+// Its ID is the transaction ID of the bet, so a commit stores a lose transaction with the same ID.
+type Reservation struct {
+	ID         uuid.UUID
+	UserID     int
+	Currency   Currency
+	SourceType SourceType
+	Amount     decimal.Decimal
+	Status     ReservationStatus
+	// ExpiresAt is when a held reservation is released unless it was settled before.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	SettledAt *time.Time
+	// Provider is the provider that placed the reservation. Its commit is recorded for it too.
+	Provider string
+}
+
+// SamePayload reports whether other is a retry of the reservation r rather than a reuse of its ID.
+func (r *Reservation) SamePayload(other *Reservation) bool {
+	return r.ID == other.ID &&
+		r.UserID == other.UserID &&
+		r.Currency == other.Currency &&
+		r.SourceType == other.SourceType &&
+		r.Amount.Equal(other.Amount)
+}
+
+// Transaction returns the lose transaction the reservation is settled with on commit.
+func (r *Reservation) Transaction() *Transaction {
+	return &Transaction{
+		ID:         r.ID,
+		UserID:     r.UserID,
+		State:      TransactionStateLose,
+		Amount:     r.Amount,
+		Currency:   r.Currency,
+		SourceType: r.SourceType,
+		Provider:   r.Provider,
+	}
 }
 
 type TransactionState string
@@ -18,6 +249,9 @@ type TransactionState string
 const (
 	TransactionStateWin  TransactionState = "win"
 	TransactionStateLose TransactionState = "lose"
+	// TransactionStateRollback reverses the balance effect of the transaction
+	// referenced by OriginalTransactionID.
+	TransactionStateRollback TransactionState = "rollback"
 )
 
 func ToTransactionState(s string) (TransactionState, error) {
@@ -26,30 +260,295 @@ func ToTransactionState(s string) (TransactionState, error) {
 		return TransactionStateWin, nil
 	case "lose":
 		return TransactionStateLose, nil
+	case "rollback":
+		return TransactionStateRollback, nil
 	default:
 		return "", fmt.Errorf("invalid transaction state: %s", s)
 	}
 }
 
+// ToTransactionStates parses a comma-separated list of transaction states. An empty list is valid.
+func ToTransactionStates(s string) ([]TransactionState, error) {
+	states := []TransactionState{}
+
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		state, err := ToTransactionState(name)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// SourceType names the origin of a transaction. Source types are registered in the database,
+// the constants name the ones that are always available.
 type SourceType string
 
 const (
 	SourceTypeGame    SourceType = "game"
 	SourceTypeServer  SourceType = "server"
 	SourceTypePayment SourceType = "payment"
+	// SourceTypeManual is reserved for the transactions of operator adjustments.
+	SourceTypeManual SourceType = "manual"
 )
 
+const maxSourceTypeLength = 20
+
+// ToSourceType checks that s is a well-formed source type name: up to 20 lower-case letters,
+// digits, underscores or hyphens, starting with a letter. Whether the source type is registered
+// is up to the source type registry.
 func ToSourceType(s string) (SourceType, error) {
-	switch s {
-	case "game":
-		return SourceTypeGame, nil
-	case "server":
-		return SourceTypeServer, nil
-	case "payment":
-		return SourceTypePayment, nil
-	default:
+	if s == "" || len(s) > maxSourceTypeLength || s[0] < 'a' || s[0] > 'z' {
 		return "", fmt.Errorf("invalid source type: %s", s)
 	}
+
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return "", fmt.Errorf("invalid source type: %s", s)
+		}
+	}
+
+	return SourceType(s), nil
+}
+
+// SourceTypeSettings is the registry entry of a source type.
+type SourceTypeSettings struct {
+	Name        SourceType `json:"name"`
+	DisplayName string     `json:"displayName"`
+	// Enabled source types accept transactions. Disabled ones are kept for their history.
+	Enabled bool `json:"enabled"`
+	// AllowedStates are the transaction states the source type may send.
+	AllowedStates []TransactionState `json:"allowedStates"`
+	CreatedAt     time.Time          `json:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt"`
+}
+
+// Allows reports whether transactions in state may be sent by the source type.
+func (s *SourceTypeSettings) Allows(state TransactionState) bool {
+	return slices.Contains(s.AllowedStates, state)
+}
+
+// SourceTypeUpdate changes the registry entry of a source type. Nil fields are left unchanged.
+type SourceTypeUpdate struct {
+	DisplayName   *string
+	Enabled       *bool
+	AllowedStates []TransactionState
+}
+
+// Validate checks the settings before they are stored.
+func (s *SourceTypeSettings) Validate() error {
+	if _, err := ToSourceType(string(s.Name)); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(s.DisplayName) == "" {
+		return errors.New("display name is required")
+	}
+
+	if len(s.AllowedStates) == 0 {
+		return errors.New("at least one allowed state is required")
+	}
+
+	for _, state := range s.AllowedStates {
+		if _, err := ToTransactionState(string(state)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Provider is an integration partner that sends transactions signed with its shared secret.
+type Provider struct {
+	Name string `json:"name"`
+	// Secret is the key of the HMAC-SHA256 signatures of the requests of the provider.
+	Secret string `json:"secret"`
+	// SourceTypes are the source types the provider may send transactions of.
+	SourceTypes []SourceType `json:"sourceTypes"`
+	// Enabled providers are accepted. Disabled ones are kept for the transactions they sent.
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Allows reports whether the provider may send transactions of sourceType.
+func (p *Provider) Allows(sourceType SourceType) bool {
+	return slices.Contains(p.SourceTypes, sourceType)
+}
+
+// MinProviderSecretLength is the minimal length of provider secrets.
+const MinProviderSecretLength = 32
+
+// Validate checks the provider before it is stored. Provider names follow the rules of source type names.
+func (p *Provider) Validate() error {
+	if _, err := ToSourceType(p.Name); err != nil {
+		return fmt.Errorf("invalid provider name: %s", p.Name)
+	}
+
+	if len(p.Secret) < MinProviderSecretLength {
+		return fmt.Errorf("secret must have at least %d characters", MinProviderSecretLength)
+	}
+
+	if len(p.SourceTypes) == 0 {
+		return errors.New("at least one source type is required")
+	}
+
+	for _, sourceType := range p.SourceTypes {
+		if _, err := ToSourceType(string(sourceType)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// APIKeyScope is a permission of an API key.
+type APIKeyScope string
+
+const (
+	// ScopeBalanceRead allows reading users, balances, transactions and reservations. Users belong to
+	// no provider, while transactions and reservations are only read by the provider that sent them.
+	ScopeBalanceRead APIKeyScope = "balance:read"
+	// ScopeTransactionsWrite allows sending transactions and reservations.
+	ScopeTransactionsWrite APIKeyScope = "transactions:write"
+	// ScopeAdmin allows managing users, limits, bonuses and the admin API.
+	ScopeAdmin APIKeyScope = "admin"
+)
+
+func ToAPIKeyScope(s string) (APIKeyScope, error) {
+	switch scope := APIKeyScope(s); scope {
+	case ScopeBalanceRead, ScopeTransactionsWrite, ScopeAdmin:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("invalid scope: %s", s)
+	}
+}
+
+// ToAPIKeyScopes parses a list of scopes, dropping duplicates.
+func ToAPIKeyScopes(values []string) ([]APIKeyScope, error) {
+	scopes := make([]APIKeyScope, 0, len(values))
+
+	for _, value := range values {
+		scope, err := ToAPIKeyScope(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	return scopes, nil
+}
+
+// APIKey is a bearer key of a provider. The key itself is only shown when it is issued.
+type APIKey struct {
+	ID       uuid.UUID
+	Provider string
+	// Prefix is the start of the key, to tell keys apart without revealing them.
+	Prefix string
+	// Hash is the hex-encoded SHA-256 of the key.
+	Hash       string
+	Scopes     []APIKeyScope
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Revoked reports whether the key was revoked and is no longer accepted.
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// RateLimit allows Burst requests at once, refilled at Rate requests per second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit applies. A zero rate or burst disables it.
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// RateLimitKey is a bucket a request takes a token from and the limit the bucket is kept at.
+type RateLimitKey struct {
+	Key   string
+	Limit RateLimit
+}
+
+// RateLimitBucket is the token bucket of a rate limit key: the tokens left at UpdatedAt.
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// RateLimitDecision is the outcome of taking a token from a bucket.
+type RateLimitDecision struct {
+	Allowed bool
+	// Limit is the burst of the limit and Remaining the whole tokens left in the bucket.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token when the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// Take refills the bucket for the time passed since UpdatedAt and takes a token from it if one is
+// left. A new bucket starts full. Time running backwards, as between the clocks of two instances,
+// refills nothing.
+func (b *RateLimitBucket) Take(limit RateLimit, now time.Time) RateLimitDecision {
+	burst := float64(limit.Burst)
+
+	tokens := burst
+	if !b.UpdatedAt.IsZero() {
+		tokens = min(burst, b.Tokens+max(0, now.Sub(b.UpdatedAt).Seconds())*limit.Rate)
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	b.Tokens = tokens
+	if now.After(b.UpdatedAt) {
+		b.UpdatedAt = now
+	}
+
+	decision := RateLimitDecision{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(tokens),
+		Reset:     seconds((burst - tokens) / limit.Rate),
+	}
+
+	if !allowed {
+		decision.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+
+	return decision
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
 
 type Transaction struct {
@@ -57,12 +556,599 @@ type Transaction struct {
 	UserID     int              `json:"userId"`
 	State      TransactionState `json:"state"`
 	Amount     decimal.Decimal  `json:"amount"`
+	Currency   Currency         `json:"currency"`
 	SourceType SourceType       `json:"sourceType"`
 	CreatedAt  time.Time        `json:"createdAt"`
+	// BalanceAfter is the total wallet balance, real and bonus, right after the transaction was applied.
+	// It is not set for transactions stored before the column was introduced.
+	BalanceAfter decimal.NullDecimal `json:"balanceAfter"`
+	// OriginalTransactionID is the transaction reversed by a rollback.
+	OriginalTransactionID *uuid.UUID `json:"originalTransactionId,omitempty"`
+	// BonusAmount is the part of a lose paid from the bonus balance, and of a rollback
+	// given back to it.
+	BonusAmount decimal.Decimal `json:"bonusAmount"`
+	// Provider is the provider that sent the transaction. It is empty for transactions of
+	// unsigned requests and for manual adjustments.
+	Provider string `json:"provider,omitempty"`
+}
+
+// SamePayload reports whether other carries the same business payload as t,
+// i.e. whether it is a legitimate retry of t rather than a reuse of its ID.
+// The amount and currency of a rollback are taken from its original, so they are not compared.
+func (t *Transaction) SamePayload(other *Transaction) bool {
+	if t.ID != other.ID ||
+		t.UserID != other.UserID ||
+		t.State != other.State ||
+		t.SourceType != other.SourceType {
+		return false
+	}
+
+	if t.State == TransactionStateRollback {
+		return t.OriginalTransactionID != nil && other.OriginalTransactionID != nil &&
+			*t.OriginalTransactionID == *other.OriginalTransactionID
+	}
+
+	return t.Currency == other.Currency && t.Amount.Equal(other.Amount)
+}
+
+// BalanceDelta returns the change a win or lose transaction applies to the user balance.
+func (t *Transaction) BalanceDelta() (decimal.Decimal, error) {
+	switch t.State {
+	case TransactionStateWin:
+		return t.Amount, nil
+	case TransactionStateLose:
+		return t.Amount.Neg(), nil
+	case TransactionStateRollback:
+		return decimal.Zero, errors.New("balance delta of a rollback depends on its original transaction")
+	default:
+		return decimal.Zero, fmt.Errorf("unsupported transaction state: %s", t.State)
+	}
 }
 
 type ProcessedTransaction struct {
-	TransactionID uuid.UUID `json:"transactionId"`
-	UserID        int       `json:"userId"`
-	ProcessedAt   time.Time `json:"processedAt"`
+	TransactionID uuid.UUID           `json:"transactionId"`
+	UserID        int                 `json:"userId"`
+	State         TransactionState    `json:"state"`
+	Amount        decimal.Decimal     `json:"amount"`
+	Currency      Currency            `json:"currency"`
+	Balance       decimal.NullDecimal `json:"balance"`
+	ProcessedAt   time.Time           `json:"processedAt"`
+	// OriginalTransactionID is the transaction reversed by a rollback.
+	OriginalTransactionID *uuid.UUID `json:"originalTransactionId,omitempty"`
+	// Replayed is set when the transaction had already been processed and the
+	// original outcome is returned instead of applying it again.
+	Replayed bool `json:"replayed"`
+}
+
+const cursorSeparator = "|"
+
+// TransactionCursor identifies the position of a transaction in the history of a user,
+// which is ordered from the newest to the oldest transaction.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode returns the opaque string form of the cursor handed out to clients.
+func (c TransactionCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + cursorSeparator + c.ID.String()
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeTransactionCursor parses a cursor previously produced by TransactionCursor.Encode.
+func DecodeTransactionCursor(s string) (TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), cursorSeparator)
+	if !found {
+		return TransactionCursor{}, errors.New("invalid cursor: malformed value")
+	}
+
+	var cursor TransactionCursor
+
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	if cursor.ID, err = uuid.Parse(id); err != nil {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return cursor, nil
+}
+
+// TransactionFilter selects a page of the transaction history of a user.
+// Zero values of the optional fields leave the corresponding criterion out.
+type TransactionFilter struct {
+	UserID     int
+	State      TransactionState
+	SourceType SourceType
+	Currency   Currency
+	MinAmount  decimal.NullDecimal
+	MaxAmount  decimal.NullDecimal
+	// Provider leaves out the transactions of other providers. Transactions without a provider, like
+	// manual adjustments, are kept.
+	Provider string
+	// From and To bound the creation time, From inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+	// After continues the listing right after the given position.
+	After *TransactionCursor
+	Limit int
+}
+
+// LimitPeriod is the rolling window a loss limit applies to.
+type LimitPeriod string
+
+const (
+	LimitPeriodDaily   LimitPeriod = "daily"
+	LimitPeriodWeekly  LimitPeriod = "weekly"
+	LimitPeriodMonthly LimitPeriod = "monthly"
+)
+
+func ToLimitPeriod(s string) (LimitPeriod, error) {
+	switch s {
+	case "daily":
+		return LimitPeriodDaily, nil
+	case "weekly":
+		return LimitPeriodWeekly, nil
+	case "monthly":
+		return LimitPeriodMonthly, nil
+	default:
+		return "", fmt.Errorf("invalid limit period: %s", s)
+	}
+}
+
+// Window returns the length of the rolling window ending at the current transaction.
+// A month is counted as 30 days.
+func (p LimitPeriod) Window() time.Duration {
+	const day = 24 * time.Hour
+
+	switch p {
+	case LimitPeriodWeekly:
+		return 7 * day
+	case LimitPeriodMonthly:
+		return 30 * day
+	default:
+		return day
+	}
+}
+
+// UserLimit caps the net loss, lose minus win amounts, of a user in one currency within a period.
+type UserLimit struct {
+	UserID   int
+	Currency Currency
+	Period   LimitPeriod
+	Amount   decimal.Decimal
+	// PendingAmount replaces Amount from PendingFrom on. A pending change without amount removes the limit.
+	PendingAmount decimal.NullDecimal
+	PendingFrom   *time.Time
+	UpdatedAt     time.Time
+}
+
+// At returns the limit in force at now, with a pending change applied once it is due.
+// It returns false if the limit has been removed by then.
+func (l UserLimit) At(now time.Time) (UserLimit, bool) {
+	if l.PendingFrom == nil || now.Before(*l.PendingFrom) {
+		return l, true
+	}
+
+	if !l.PendingAmount.Valid {
+		return UserLimit{}, false
+	}
+
+	l.Amount = l.PendingAmount.Decimal
+	l.PendingAmount = decimal.NullDecimal{}
+	l.PendingFrom = nil
+
+	return l, true
+}
+
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	// NextCursor is set when more transactions are available.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// LedgerAccountType classifies the accounts of the double-entry ledger.
+type LedgerAccountType string
+
+const (
+	// LedgerAccountWallet holds the money of a user in one currency. The wallet balance
+	// is a projection of its postings.
+	LedgerAccountWallet LedgerAccountType = "wallet"
+	// LedgerAccountHouse is the counter-account of a source type, e.g. the game provider.
+	LedgerAccountHouse LedgerAccountType = "house"
+	// LedgerAccountEquity holds the balances that predate the ledger and the corrections of the
+	// reconcile command.
+	LedgerAccountEquity LedgerAccountType = "equity"
+	// LedgerAccountBonus holds the bonus money of a user in one currency, a projection
+	// like the wallet account.
+	LedgerAccountBonus LedgerAccountType = "bonus"
+	// LedgerAccountPromotion funds the bonus money granted to users.
+	LedgerAccountPromotion LedgerAccountType = "promotion"
+	// LedgerAccountHeld holds the money of a user reserved for unsettled bets, a projection
+	// like the wallet account.
+	LedgerAccountHeld LedgerAccountType = "held"
+)
+
+// LedgerAccount identifies an account of the ledger by its owner and currency.
+type LedgerAccount struct {
+	Type LedgerAccountType
+	// UserID is only set for wallet, bonus and held accounts.
+	UserID int
+	// SourceType is only set for house accounts.
+	SourceType SourceType
+	Currency   Currency
+}
+
+// WalletAccount returns the ledger account of the wallet of userID in currency.
+func WalletAccount(userID int, currency Currency) LedgerAccount {
+	return LedgerAccount{Type: LedgerAccountWallet, UserID: userID, Currency: currency}
+}
+
+// BonusAccount returns the ledger account of the bonus balance of userID in currency.
+func BonusAccount(userID int, currency Currency) LedgerAccount {
+	return LedgerAccount{Type: LedgerAccountBonus, UserID: userID, Currency: currency}
+}
+
+// HeldAccount returns the ledger account of the money of userID in currency held by reservations.
+func HeldAccount(userID int, currency Currency) LedgerAccount {
+	return LedgerAccount{Type: LedgerAccountHeld, UserID: userID, Currency: currency}
+}
+
+// PromotionAccount returns the ledger account bonus money in currency is granted from.
+func PromotionAccount(currency Currency) LedgerAccount {
+	return LedgerAccount{Type: LedgerAccountPromotion, Currency: currency}
+}
+
+// EquityAccount returns the equity account of currency.
+func EquityAccount(currency Currency) LedgerAccount {
+	return LedgerAccount{Type: LedgerAccountEquity, Currency: currency}
+}
+
+// HouseAccount returns the ledger account of sourceType in currency.
+func HouseAccount(sourceType SourceType, currency Currency) LedgerAccount {
+	return LedgerAccount{Type: LedgerAccountHouse, SourceType: sourceType, Currency: currency}
+}
+
+// Posting moves Amount into Account, or out of it if Amount is negative.
+type Posting struct {
+	Account LedgerAccount
+	Amount  decimal.Decimal
+}
+
+// JournalEntry records one movement of money as a set of postings that sum to zero.
+type JournalEntry struct {
+	ID int64
+	// TransactionID is the transaction the entry books, if any.
+	TransactionID *uuid.UUID
+	Description   string
+	Postings      []Posting
+	CreatedAt     time.Time
+}
+
+// Validate checks that the entry is balanced, i.e. that the postings of every currency sum to zero.
+func (e *JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return errors.New("journal entry needs at least two postings")
+	}
+
+	sums := make(map[Currency]decimal.Decimal)
+
+	for _, posting := range e.Postings {
+		if posting.Amount.IsZero() {
+			return errors.New("journal entry contains a zero posting")
+		}
+
+		sums[posting.Account.Currency] = sums[posting.Account.Currency].Add(posting.Amount)
+	}
+
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("journal entry is unbalanced by %s %s", sum.StringFixed(2), currency)
+		}
+	}
+
+	return nil
+}
+
+// BalanceType names one of the balances of a wallet.
+type BalanceType string
+
+const (
+	BalanceReal  BalanceType = "real"
+	BalanceBonus BalanceType = "bonus"
+	BalanceHeld  BalanceType = "held"
+)
+
+// Balances are the real, bonus and held balance of a wallet.
+type Balances struct {
+	Real  decimal.Decimal `json:"real"`
+	Bonus decimal.Decimal `json:"bonus"`
+	Held  decimal.Decimal `json:"held"`
+}
+
+// Equal reports whether all balances of b and other are equal.
+func (b Balances) Equal(other Balances) bool {
+	return b.Real.Equal(other.Real) && b.Bonus.Equal(other.Bonus) && b.Held.Equal(other.Held)
+}
+
+// Sub returns the differences of the balances of b and other.
+func (b Balances) Sub(other Balances) Balances {
+	return Balances{Real: b.Real.Sub(other.Real), Bonus: b.Bonus.Sub(other.Bonus), Held: b.Held.Sub(other.Held)}
+}
+
+// BalanceDrift reports a wallet whose balances differ from the balances they are expected to have.
+type BalanceDrift struct {
+	UserID   int      `json:"userId"`
+	Currency Currency `json:"currency"`
+	Actual   Balances `json:"actual"`
+	Expected Balances `json:"expected"`
+	// Difference is Actual minus Expected.
+	Difference Balances `json:"difference"`
+	// Adjusted is set when the balances were corrected to the expected balances.
+	Adjusted bool `json:"adjusted"`
+	// Error describes why the correction failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ReconciliationReport is the outcome of checking all wallet balances. Drifts are the wallets whose
+// balances differ from their opening balances plus the transaction history, LedgerDrifts those
+// whose balances differ from the sums of the postings on their ledger accounts.
+type ReconciliationReport struct {
+	CheckedAt    time.Time      `json:"checkedAt"`
+	Drifts       []BalanceDrift `json:"drifts"`
+	LedgerDrifts []BalanceDrift `json:"ledgerDrifts"`
+}
+
+// Drifted reports whether any wallet drifted from its history or from the ledger.
+func (r *ReconciliationReport) Drifted() bool {
+	return len(r.Drifts) > 0 || len(r.LedgerDrifts) > 0
+}
+
+// BalanceAdjustment records the correction of one drifted balance of a wallet.
+type BalanceAdjustment struct {
+	ID              int64
+	UserID          int
+	Currency        Currency
+	BalanceType     BalanceType
+	PreviousBalance decimal.Decimal
+	NewBalance      decimal.Decimal
+	Reason          string
+	CreatedAt       time.Time
+}
+
+// AdjustmentType tells whether a manual adjustment credits or debits the wallet.
+type AdjustmentType string
+
+const (
+	AdjustmentCredit AdjustmentType = "credit"
+	AdjustmentDebit  AdjustmentType = "debit"
+)
+
+func ToAdjustmentType(s string) (AdjustmentType, error) {
+	switch s {
+	case "credit":
+		return AdjustmentCredit, nil
+	case "debit":
+		return AdjustmentDebit, nil
+	default:
+		return "", fmt.Errorf("invalid adjustment type: %s", s)
+	}
+}
+
+// AdjustmentReason is the reason code an operator gives for a manual adjustment.
+type AdjustmentReason string
+
+const (
+	AdjustmentReasonGoodwill   AdjustmentReason = "goodwill"
+	AdjustmentReasonCorrection AdjustmentReason = "correction"
+	AdjustmentReasonChargeback AdjustmentReason = "chargeback"
+	AdjustmentReasonFraud      AdjustmentReason = "fraud"
+	AdjustmentReasonOther      AdjustmentReason = "other"
+)
+
+func ToAdjustmentReason(s string) (AdjustmentReason, error) {
+	switch reason := AdjustmentReason(s); reason {
+	case AdjustmentReasonGoodwill, AdjustmentReasonCorrection, AdjustmentReasonChargeback,
+		AdjustmentReasonFraud, AdjustmentReasonOther:
+		return reason, nil
+	default:
+		return "", fmt.Errorf("invalid reason code: %s", s)
+	}
+}
+
+// AdjustmentStatus is the stage of a manual adjustment.
+type AdjustmentStatus string
+
+const (
+	// AdjustmentPending adjustments wait for the approval of a second operator.
+	AdjustmentPending  AdjustmentStatus = "pending"
+	AdjustmentApplied  AdjustmentStatus = "applied"
+	AdjustmentRejected AdjustmentStatus = "rejected"
+)
+
+func ToAdjustmentStatus(s string) (AdjustmentStatus, error) {
+	switch s {
+	case "pending":
+		return AdjustmentPending, nil
+	case "applied":
+		return AdjustmentApplied, nil
+	case "rejected":
+		return AdjustmentRejected, nil
+	default:
+		return "", fmt.Errorf("invalid adjustment status: %s", s)
+	}
+}
+
+// ManualAdjustment is a credit or debit of a wallet made by an operator. Once applied it is stored
+// as a transaction of the manual source type with the same ID.
+type ManualAdjustment struct {
+	ID          uuid.UUID
+	UserID      int
+	Currency    Currency
+	Type        AdjustmentType
+	Amount      decimal.Decimal
+	ReasonCode  AdjustmentReason
+	Comment     string
+	RequestedBy string
+	// RequestedByKey is the API key the adjustment was requested with, nil if API keys are not required.
+	RequestedByKey uuid.UUID
+	Status         AdjustmentStatus
+	// ReviewedBy is the second operator who approved or rejected a pending adjustment.
+	ReviewedBy    string
+	ReviewedByKey uuid.UUID
+	ReviewComment string
+	CreatedAt     time.Time
+	DecidedAt     *time.Time
+}
+
+// Requester returns the operator who requested the adjustment.
+func (a *ManualAdjustment) Requester() Operator {
+	return Operator{Name: a.RequestedBy, KeyID: a.RequestedByKey}
+}
+
+// SamePayload reports whether other requests the same adjustment, so that it is a retry of a.
+func (a *ManualAdjustment) SamePayload(other *ManualAdjustment) bool {
+	return a.ID == other.ID &&
+		a.UserID == other.UserID &&
+		a.Currency == other.Currency &&
+		a.Type == other.Type &&
+		a.Amount.Equal(other.Amount) &&
+		a.ReasonCode == other.ReasonCode &&
+		a.Comment == other.Comment &&
+		a.RequestedBy == other.RequestedBy
+}
+
+// Transaction returns the transaction the adjustment is applied with: a win for a credit and
+// a lose for a debit.
+func (a *ManualAdjustment) Transaction() *Transaction {
+	state := TransactionStateWin
+	if a.Type == AdjustmentDebit {
+		state = TransactionStateLose
+	}
+
+	return &Transaction{
+		ID:         a.ID,
+		UserID:     a.UserID,
+		State:      state,
+		Amount:     a.Amount,
+		Currency:   a.Currency,
+		SourceType: SourceTypeManual,
+	}
+}
+
+// AuditAction names an operator action recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditAdjustmentRequested AuditAction = "adjustment_requested"
+	AuditAdjustmentApplied   AuditAction = "adjustment_applied"
+	AuditAdjustmentRejected  AuditAction = "adjustment_rejected"
+)
+
+// Operator is the support operator on whose behalf an admin request is made.
+type Operator struct {
+	// Name is the operator named by the request.
+	Name string
+	// KeyID is the API key the request was authenticated with. It is nil if API keys are not
+	// required, the name alone identifies the operator then.
+	KeyID uuid.UUID
+}
+
+// Same reports whether o and other are the same operator: they have the same name or act with
+// the same API key, whatever name they give.
+func (o Operator) Same(other Operator) bool {
+	return o.Name == other.Name || (o.KeyID != uuid.Nil && o.KeyID == other.KeyID)
+}
+
+// AuditEvent records an action of an operator on a subject, such as a manual adjustment.
+type AuditEvent struct {
+	ID          int64             `json:"id"`
+	Operator    string            `json:"operator"`
+	Action      AuditAction       `json:"action"`
+	SubjectType string            `json:"subjectType"`
+	SubjectID   string            `json:"subjectId"`
+	Details     map[string]string `json:"details"`
+	CreatedAt   time.Time         `json:"createdAt"`
+}
+
+// BatchMode controls how a batch of transactions is processed.
+type BatchMode string
+
+const (
+	// BatchModeAtomic processes all transactions of a batch in one database transaction,
+	// so either all of them are applied or none.
+	BatchModeAtomic BatchMode = "atomic"
+	// BatchModeIndependent processes every transaction on its own and reports a result per item.
+	BatchModeIndependent BatchMode = "independent"
+)
+
+func ToBatchMode(s string) (BatchMode, error) {
+	switch s {
+	case "atomic":
+		return BatchModeAtomic, nil
+	case "independent":
+		return BatchModeIndependent, nil
+	default:
+		return "", fmt.Errorf("invalid batch mode: %s", s)
+	}
+}
+
+// BatchItemResult is the outcome of one transaction of a batch: either the processed
+// transaction or the error it was rejected with.
+type BatchItemResult struct {
+	Transaction *ProcessedTransaction `json:"transaction"`
+	Err         error                 `json:"-"`
+}
+
+// HealthStatus is the result of a readiness check.
+type HealthStatus string
+
+const (
+	HealthPass HealthStatus = "pass"
+	// HealthWarn reports a degraded dependency that does not make the service unready.
+	HealthWarn HealthStatus = "warn"
+	HealthFail HealthStatus = "fail"
+)
+
+// HealthCheck is the result of checking one dependency.
+type HealthCheck struct {
+	Name    string
+	Status  HealthStatus
+	Latency time.Duration
+	// Message explains the status, for instance the error a check failed with.
+	Message string
+}
+
+// HealthReport is the result of all readiness checks.
+type HealthReport struct {
+	Checks []HealthCheck
+}
+
+// Status is fail if any check failed, warn if any check warned and pass otherwise.
+func (r *HealthReport) Status() HealthStatus {
+	status := HealthPass
+
+	for _, check := range r.Checks {
+		switch check.Status {
+		case HealthFail:
+			return HealthFail
+		case HealthWarn:
+			status = HealthWarn
+		case HealthPass:
+		}
+	}
+
+	return status
+}
+
+// Ready reports whether the service can take traffic: warnings do not make it unready.
+func (r *HealthReport) Ready() bool {
+	return r.Status() != HealthFail
 }
@@ -2,7 +2,10 @@ package model
 
 import (
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -16,6 +19,7 @@ func TestToTransactionState(t *testing.T) {
 	}{
 		{"win", "win", TransactionStateWin, false},
 		{"lose", "lose", TransactionStateLose, false},
+		{"rollback", "rollback", TransactionStateRollback, false},
 		{"invalid", "draw", "", true},
 	}
 
@@ -44,7 +48,12 @@ func TestToSourceType(t *testing.T) {
 		{"game", "game", SourceTypeGame, false},
 		{"server", "server", SourceTypeServer, false},
 		{"payment", "payment", SourceTypePayment, false},
-		{"invalid", "unknown", "", true},
+		{"unregistered but well-formed", "sportsbook_v2", SourceType("sportsbook_v2"), false},
+		{"empty", "", "", true},
+		{"upper case", "Game", "", true},
+		{"leading digit", "1game", "", true},
+		{"whitespace", "game server", "", true},
+		{"too long", "abcdefghijklmnopqrstu", "", true},
 	}
 
 	for _, tc := range cases {
@@ -61,3 +70,447 @@ func TestToSourceType(t *testing.T) {
 		})
 	}
 }
+
+func TestToCurrency(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected Currency
+		wantErr  bool
+	}{
+		{"EUR", "EUR", CurrencyEUR, false},
+		{"USD", "USD", CurrencyUSD, false},
+		{"GBP", "GBP", CurrencyGBP, false},
+		{"lowercase", "eur", "", true},
+		{"unsupported", "JPY", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			currency, err := ToCurrency(tc.input)
+
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, currency)
+		})
+	}
+}
+
+func TestTransactionSamePayload(t *testing.T) {
+	base := Transaction{
+		ID:         uuid.New(),
+		UserID:     1,
+		State:      TransactionStateWin,
+		Amount:     decimal.RequireFromString("10.00"),
+		Currency:   CurrencyEUR,
+		SourceType: SourceTypeGame,
+	}
+
+	cases := []struct {
+		name   string
+		modify func(tx *Transaction)
+		want   bool
+	}{
+		{"identical", func(_ *Transaction) {}, true},
+		{"equal amount with different scale", func(tx *Transaction) { tx.Amount = decimal.NewFromInt(10) }, true},
+		{"different user", func(tx *Transaction) { tx.UserID = 2 }, false},
+		{"different state", func(tx *Transaction) { tx.State = TransactionStateLose }, false},
+		{"different amount", func(tx *Transaction) { tx.Amount = decimal.RequireFromString("10.01") }, false},
+		{"different currency", func(tx *Transaction) { tx.Currency = CurrencyUSD }, false},
+		{"different source type", func(tx *Transaction) { tx.SourceType = SourceTypePayment }, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			other := base
+			tc.modify(&other)
+
+			assert.Equal(t, tc.want, base.SamePayload(&other))
+		})
+	}
+}
+
+func TestTransactionCursor(t *testing.T) {
+	cursor := TransactionCursor{
+		CreatedAt: time.Date(2025, 10, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	decoded, err := DecodeTransactionCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+
+	for _, invalid := range []string{"", "!!!", "bm90LWEtY3Vyc29y"} {
+		_, err = DecodeTransactionCursor(invalid)
+		assert.Error(t, err, "cursor %q should be rejected", invalid)
+	}
+}
+
+func TestRollbackSamePayload(t *testing.T) {
+	originalID := uuid.New()
+	otherID := uuid.New()
+
+	rollback := Transaction{
+		ID:                    uuid.New(),
+		UserID:                1,
+		State:                 TransactionStateRollback,
+		Amount:                decimal.NewFromInt(10),
+		SourceType:            SourceTypeGame,
+		OriginalTransactionID: &originalID,
+	}
+
+	retry := rollback
+	retry.Amount = decimal.Zero
+	assert.True(t, rollback.SamePayload(&retry), "amount of a rollback is derived and not compared")
+
+	retry.OriginalTransactionID = &otherID
+	assert.False(t, rollback.SamePayload(&retry), "rollback of another transaction is a conflict")
+}
+
+func TestBalanceDelta(t *testing.T) {
+	amount := decimal.RequireFromString("12.34")
+
+	delta, err := (&Transaction{State: TransactionStateWin, Amount: amount}).BalanceDelta()
+	require.NoError(t, err)
+	assert.True(t, amount.Equal(delta))
+
+	delta, err = (&Transaction{State: TransactionStateLose, Amount: amount}).BalanceDelta()
+	require.NoError(t, err)
+	assert.True(t, amount.Neg().Equal(delta))
+
+	_, err = (&Transaction{State: TransactionStateRollback, Amount: amount}).BalanceDelta()
+	require.Error(t, err)
+}
+
+func TestToBatchMode(t *testing.T) {
+	mode, err := ToBatchMode("atomic")
+	require.NoError(t, err)
+	assert.Equal(t, BatchModeAtomic, mode)
+
+	mode, err = ToBatchMode("independent")
+	require.NoError(t, err)
+	assert.Equal(t, BatchModeIndependent, mode)
+
+	_, err = ToBatchMode("")
+	require.Error(t, err)
+}
+
+func TestJournalEntryValidate(t *testing.T) {
+	wallet := WalletAccount(1, CurrencyEUR)
+	house := HouseAccount(SourceTypeGame, CurrencyEUR)
+
+	cases := []struct {
+		name     string
+		postings []Posting
+		wantErr  bool
+	}{
+		{
+			name: "balanced",
+			postings: []Posting{
+				{Account: wallet, Amount: decimal.RequireFromString("10.00")},
+				{Account: house, Amount: decimal.RequireFromString("-10.00")},
+			},
+		},
+		{
+			name: "unbalanced",
+			postings: []Posting{
+				{Account: wallet, Amount: decimal.RequireFromString("10.00")},
+				{Account: house, Amount: decimal.RequireFromString("-9.99")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "balanced across currencies only",
+			postings: []Posting{
+				{Account: wallet, Amount: decimal.RequireFromString("10.00")},
+				{Account: HouseAccount(SourceTypeGame, CurrencyUSD), Amount: decimal.RequireFromString("-10.00")},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "single posting",
+			postings: []Posting{{Account: wallet, Amount: decimal.Zero}},
+			wantErr:  true,
+		},
+		{
+			name: "zero posting",
+			postings: []Posting{
+				{Account: wallet, Amount: decimal.Zero},
+				{Account: house, Amount: decimal.Zero},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entry := JournalEntry{Postings: tc.postings}
+
+			if tc.wantErr {
+				require.Error(t, entry.Validate())
+				return
+			}
+
+			require.NoError(t, entry.Validate())
+		})
+	}
+}
+
+func TestSourceTypeSettingsValidate(t *testing.T) {
+	valid := SourceTypeSettings{
+		Name:          "sportsbook",
+		DisplayName:   "Sportsbook",
+		AllowedStates: []TransactionState{TransactionStateWin, TransactionStateLose},
+	}
+
+	cases := []struct {
+		name    string
+		modify  func(s *SourceTypeSettings)
+		wantErr bool
+	}{
+		{"valid", func(_ *SourceTypeSettings) {}, false},
+		{"invalid name", func(s *SourceTypeSettings) { s.Name = "Sports Book" }, true},
+		{"missing display name", func(s *SourceTypeSettings) { s.DisplayName = " " }, true},
+		{"no allowed states", func(s *SourceTypeSettings) { s.AllowedStates = nil }, true},
+		{"unknown state", func(s *SourceTypeSettings) { s.AllowedStates = []TransactionState{"draw"} }, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := valid
+			tc.modify(&settings)
+
+			if tc.wantErr {
+				require.Error(t, settings.Validate())
+				return
+			}
+
+			require.NoError(t, settings.Validate())
+			assert.True(t, settings.Allows(TransactionStateWin))
+			assert.False(t, settings.Allows(TransactionStateRollback))
+		})
+	}
+}
+
+func TestProviderValidate(t *testing.T) {
+	valid := Provider{
+		Name:        "acme",
+		Secret:      "0123456789abcdef0123456789abcdef",
+		SourceTypes: []SourceType{SourceTypeGame},
+	}
+
+	cases := []struct {
+		name    string
+		modify  func(p *Provider)
+		wantErr bool
+	}{
+		{"valid", func(_ *Provider) {}, false},
+		{"invalid name", func(p *Provider) { p.Name = "Acme Games" }, true},
+		{"short secret", func(p *Provider) { p.Secret = "secret" }, true},
+		{"no source types", func(p *Provider) { p.SourceTypes = nil }, true},
+		{"invalid source type", func(p *Provider) { p.SourceTypes = []SourceType{"Game"} }, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := valid
+			tc.modify(&provider)
+
+			if tc.wantErr {
+				require.Error(t, provider.Validate())
+				return
+			}
+
+			require.NoError(t, provider.Validate())
+			assert.True(t, provider.Allows(SourceTypeGame))
+			assert.False(t, provider.Allows(SourceTypePayment))
+		})
+	}
+}
+
+func TestToAPIKeyScopes(t *testing.T) {
+	scopes, err := ToAPIKeyScopes([]string{"balance:read", "admin", "balance:read"})
+	require.NoError(t, err)
+	assert.Equal(t, []APIKeyScope{ScopeBalanceRead, ScopeAdmin}, scopes, "duplicates should be dropped")
+
+	_, err = ToAPIKeyScopes([]string{"balance:read", "root"})
+	require.Error(t, err)
+
+	_, err = ToAPIKeyScopes(nil)
+	require.Error(t, err, "at least one scope is required")
+
+	key := APIKey{Scopes: scopes}
+	assert.True(t, key.HasScope(ScopeAdmin))
+	assert.False(t, key.HasScope(ScopeTransactionsWrite))
+	assert.False(t, key.Revoked())
+}
+
+func TestRateLimitBucketTake(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	limit := RateLimit{Rate: 2, Burst: 3}
+	bucket := RateLimitBucket{Key: "user:1"}
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		decision := bucket.Take(limit, now)
+		require.True(t, decision.Allowed, "a new bucket starts full")
+		assert.Equal(t, 3, decision.Limit)
+		assert.Equal(t, remaining, decision.Remaining)
+	}
+
+	decision := bucket.Take(limit, now)
+	require.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter, "a token is refilled every half second")
+	assert.Equal(t, 1500*time.Millisecond, decision.Reset)
+
+	decision = bucket.Take(limit, now.Add(-time.Minute))
+	assert.False(t, decision.Allowed, "time running backwards refills nothing")
+	assert.Equal(t, now, bucket.UpdatedAt)
+
+	decision = bucket.Take(limit, now.Add(500*time.Millisecond))
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+
+	decision = bucket.Take(limit, now.Add(time.Hour))
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 2, decision.Remaining, "the bucket does not fill beyond its burst")
+
+	assert.False(t, RateLimit{Rate: 1}.Enabled(), "a zero burst disables the limit")
+}
+
+func TestUserLimitAt(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	from := now.Add(time.Hour)
+	limit := UserLimit{
+		Period:        LimitPeriodDaily,
+		Amount:        decimal.NewFromInt(100),
+		PendingAmount: decimal.NewNullDecimal(decimal.NewFromInt(200)),
+		PendingFrom:   &from,
+	}
+
+	current, ok := limit.At(now)
+	require.True(t, ok)
+	assert.True(t, current.Amount.Equal(decimal.NewFromInt(100)), "pending increase is not due yet")
+
+	current, ok = limit.At(from)
+	require.True(t, ok)
+	assert.True(t, current.Amount.Equal(decimal.NewFromInt(200)), "pending increase is due")
+	assert.Nil(t, current.PendingFrom)
+
+	limit.PendingAmount = decimal.NullDecimal{}
+	_, ok = limit.At(from)
+	assert.False(t, ok, "pending removal is due")
+}
+
+func TestBonusSpendOrderSplit(t *testing.T) {
+	wallet := &Wallet{Balance: decimal.NewFromInt(30), BonusBalance: decimal.NewFromInt(20)}
+
+	cases := []struct {
+		name      string
+		order     BonusSpendOrder
+		amount    int64
+		wantReal  int64
+		wantBonus int64
+	}{
+		{"real first within real balance", BonusSpendOrderRealFirst, 10, 10, 0},
+		{"real first spills into bonus", BonusSpendOrderRealFirst, 40, 30, 10},
+		{"bonus first within bonus balance", BonusSpendOrderBonusFirst, 10, 0, 10},
+		{"bonus first spills into real", BonusSpendOrderBonusFirst, 40, 20, 20},
+		{"shortfall is charged to real", BonusSpendOrderRealFirst, 60, 40, 20},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			realPart, bonusPart := tc.order.Split(decimal.NewFromInt(tc.amount), wallet)
+
+			assert.True(t, realPart.Equal(decimal.NewFromInt(tc.wantReal)), "real part %s", realPart)
+			assert.True(t, bonusPart.Equal(decimal.NewFromInt(tc.wantBonus)), "bonus part %s", bonusPart)
+		})
+	}
+}
+
+func TestBonusGrantWager(t *testing.T) {
+	grant := BonusGrant{WageringRequirement: decimal.NewFromInt(100), Wagered: decimal.NewFromInt(70)}
+
+	rest := grant.Wager(decimal.NewFromInt(20))
+	assert.True(t, rest.IsZero())
+	assert.False(t, grant.Complete())
+
+	rest = grant.Wager(decimal.NewFromInt(25))
+	assert.True(t, rest.Equal(decimal.NewFromInt(15)), "stake beyond the requirement is returned")
+	assert.True(t, grant.Wagered.Equal(decimal.NewFromInt(100)))
+	assert.True(t, grant.Complete())
+}
+
+func TestToTransactionStates(t *testing.T) {
+	states, err := ToTransactionStates(" win, rollback ")
+	require.NoError(t, err)
+	assert.Equal(t, []TransactionState{TransactionStateWin, TransactionStateRollback}, states)
+
+	states, err = ToTransactionStates("")
+	require.NoError(t, err)
+	assert.Empty(t, states)
+
+	_, err = ToTransactionStates("win,refund")
+	assert.Error(t, err)
+}
+
+func TestUserStatusPolicy(t *testing.T) {
+	policy := UserStatusPolicy{UserStatusSuspended: {TransactionStateWin}}
+
+	assert.True(t, policy.Allows(UserStatusActive, TransactionStateLose))
+	assert.True(t, policy.Allows(UserStatusSuspended, TransactionStateWin))
+	assert.False(t, policy.Allows(UserStatusSuspended, TransactionStateLose))
+	assert.False(t, policy.Allows(UserStatusClosed, TransactionStateWin))
+
+	assert.True(t, UserStatusSuspended.CanChangeTo(UserStatusActive))
+	assert.True(t, UserStatusActive.CanChangeTo(UserStatusClosed))
+	assert.False(t, UserStatusClosed.CanChangeTo(UserStatusActive))
+}
+
+func TestToAdjustmentFields(t *testing.T) {
+	adjustmentType, err := ToAdjustmentType("debit")
+	require.NoError(t, err)
+	assert.Equal(t, AdjustmentDebit, adjustmentType)
+
+	_, err = ToAdjustmentType("refund")
+	require.Error(t, err)
+
+	reason, err := ToAdjustmentReason("chargeback")
+	require.NoError(t, err)
+	assert.Equal(t, AdjustmentReasonChargeback, reason)
+
+	_, err = ToAdjustmentReason("")
+	require.Error(t, err)
+
+	status, err := ToAdjustmentStatus("pending")
+	require.NoError(t, err)
+	assert.Equal(t, AdjustmentPending, status)
+
+	_, err = ToAdjustmentStatus("approved")
+	require.Error(t, err)
+}
+
+func TestManualAdjustmentTransaction(t *testing.T) {
+	adjustment := &ManualAdjustment{
+		ID:       uuid.New(),
+		UserID:   1,
+		Currency: CurrencyEUR,
+		Type:     AdjustmentCredit,
+		Amount:   decimal.NewFromInt(25),
+	}
+
+	tx := adjustment.Transaction()
+	assert.Equal(t, adjustment.ID, tx.ID)
+	assert.Equal(t, TransactionStateWin, tx.State)
+	assert.Equal(t, SourceTypeManual, tx.SourceType)
+
+	adjustment.Type = AdjustmentDebit
+	delta, err := adjustment.Transaction().BalanceDelta()
+	require.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(-25).Equal(delta), "a debit should take money from the wallet")
+}
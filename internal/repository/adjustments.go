@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+)
+
+// AuditRepository stores the audit log of operator actions.
+type AuditRepository interface {
+	// InsertAuditEvent appends event to the audit log and fills in its ID and CreatedAt.
+	InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error
+	// ListAuditEvents returns the audit events of a subject, oldest first.
+	ListAuditEvents(ctx context.Context, subjectType, subjectID string) ([]model.AuditEvent, error)
+}
+
+// AdjustmentRepository stores the manual balance adjustments.
+type AdjustmentRepository interface {
+	// GetAdjustment returns the manual adjustment with the given ID, or ErrAdjustmentNotFound.
+	GetAdjustment(ctx context.Context, id uuid.UUID) (*model.ManualAdjustment, error)
+	// LockAdjustment is like GetAdjustment but locks the adjustment until the surrounding transaction ends.
+	LockAdjustment(ctx context.Context, id uuid.UUID) (*model.ManualAdjustment, error)
+	// InsertAdjustment stores adjustment as pending and fills in its Status and CreatedAt.
+	// It returns ErrDuplicateTransaction if an adjustment with the same ID already exists.
+	InsertAdjustment(ctx context.Context, adjustment *model.ManualAdjustment) error
+	// UpdateAdjustment stores the decision on adjustment, or returns ErrAdjustmentNotFound.
+	UpdateAdjustment(ctx context.Context, adjustment *model.ManualAdjustment) error
+	// ListAdjustments returns up to limit adjustments in status, or in any status if it is empty, newest first.
+	ListAdjustments(ctx context.Context, status model.AdjustmentStatus, limit int) ([]model.ManualAdjustment, error)
+}
+
+// adjustmentColumns lists the columns read by scanAdjustment, in order.
+const adjustmentColumns = `id, user_id, currency, type, amount, reason_code, comment, requested_by,
+requested_by_key, status, reviewed_by, reviewed_by_key, review_comment, created_at, decided_at`
+
+// auditEventColumns lists the columns read by scanAuditEvent, in order.
+const auditEventColumns = `id, operator, action, subject_type, subject_id, details, created_at`
+
+func (r *Postgresql) GetAdjustment(ctx context.Context, id uuid.UUID) (*model.ManualAdjustment, error) {
+	return r.getAdjustment(ctx, "SELECT "+adjustmentColumns+" FROM manual_adjustments WHERE id = $1", id)
+}
+
+func (r *Postgresql) LockAdjustment(ctx context.Context, id uuid.UUID) (*model.ManualAdjustment, error) {
+	return r.getAdjustment(ctx, "SELECT "+adjustmentColumns+" FROM manual_adjustments WHERE id = $1 FOR UPDATE", id)
+}
+
+func (r *Postgresql) getAdjustment(ctx context.Context, query string, id uuid.UUID) (*model.ManualAdjustment, error) {
+	adjustment, err := scanAdjustment(r.queryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAdjustmentNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get adjustment %s: %w", id, classifyError(err))
+	}
+
+	return adjustment, nil
+}
+
+func (r *Postgresql) InsertAdjustment(ctx context.Context, adjustment *model.ManualAdjustment) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO manual_adjustments (id, user_id, currency, type, amount, reason_code, comment, requested_by,
+requested_by_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING status, created_at`,
+		adjustment.ID,
+		adjustment.UserID,
+		adjustment.Currency,
+		adjustment.Type,
+		adjustment.Amount,
+		adjustment.ReasonCode,
+		adjustment.Comment,
+		adjustment.RequestedBy,
+		nullUUID(adjustment.RequestedByKey),
+	).Scan(&adjustment.Status, &adjustment.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert adjustment %s: %w", adjustment.ID, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) UpdateAdjustment(ctx context.Context, adjustment *model.ManualAdjustment) error {
+	result, err := r.exec(ctx, `
+UPDATE manual_adjustments
+SET status = $2, reviewed_by = $3, reviewed_by_key = $4, review_comment = $5, decided_at = $6
+WHERE id = $1`,
+		adjustment.ID,
+		adjustment.Status,
+		sql.NullString{String: adjustment.ReviewedBy, Valid: adjustment.ReviewedBy != ""},
+		nullUUID(adjustment.ReviewedByKey),
+		sql.NullString{String: adjustment.ReviewComment, Valid: adjustment.ReviewComment != ""},
+		adjustment.DecidedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update adjustment %s: %w", adjustment.ID, classifyError(err))
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrAdjustmentNotFound
+	}
+
+	return nil
+}
+
+func (r *Postgresql) ListAdjustments(
+	ctx context.Context,
+	status model.AdjustmentStatus,
+	limit int,
+) ([]model.ManualAdjustment, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT `+adjustmentColumns+`
+FROM manual_adjustments
+WHERE $1 = '' OR status = $1
+ORDER BY created_at DESC, id
+LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list adjustments: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	adjustments := []model.ManualAdjustment{}
+
+	for rows.Next() {
+		adjustment, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan adjustment: %w", err)
+		}
+
+		adjustments = append(adjustments, *adjustment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list adjustments: %w", classifyError(err))
+	}
+
+	return adjustments, nil
+}
+
+func (r *Postgresql) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	if err = r.queryRowContext(ctx, `
+INSERT INTO audit_log (operator, action, subject_type, subject_id, details)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at`,
+		event.Operator,
+		event.Action,
+		event.SubjectType,
+		event.SubjectID,
+		details,
+	).Scan(&event.ID, &event.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) ListAuditEvents(ctx context.Context, subjectType, subjectID string) ([]model.AuditEvent, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT `+auditEventColumns+`
+FROM audit_log
+WHERE subject_type = $1 AND subject_id = $2
+ORDER BY id`, subjectType, subjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	events := []model.AuditEvent{}
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+
+		events = append(events, *event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", classifyError(err))
+	}
+
+	return events, nil
+}
+
+// scanAdjustment reads a manual adjustment selected with adjustmentColumns.
+func scanAdjustment(row rowScanner) (*model.ManualAdjustment, error) {
+	var (
+		adjustment                    model.ManualAdjustment
+		reviewedBy, reviewComment     sql.NullString
+		requestedByKey, reviewedByKey uuid.NullUUID
+		decidedAt                     sql.NullTime
+	)
+
+	if err := row.Scan(
+		&adjustment.ID,
+		&adjustment.UserID,
+		&adjustment.Currency,
+		&adjustment.Type,
+		&adjustment.Amount,
+		&adjustment.ReasonCode,
+		&adjustment.Comment,
+		&adjustment.RequestedBy,
+		&requestedByKey,
+		&adjustment.Status,
+		&reviewedBy,
+		&reviewedByKey,
+		&reviewComment,
+		&adjustment.CreatedAt,
+		&decidedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	adjustment.RequestedByKey = requestedByKey.UUID
+	adjustment.ReviewedBy = reviewedBy.String
+	adjustment.ReviewedByKey = reviewedByKey.UUID
+	adjustment.ReviewComment = reviewComment.String
+
+	if decidedAt.Valid {
+		adjustment.DecidedAt = &decidedAt.Time
+	}
+
+	return &adjustment, nil
+}
+
+// nullUUID stores the nil UUID as NULL.
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+// scanAuditEvent reads an audit event selected with auditEventColumns.
+func scanAuditEvent(row rowScanner) (*model.AuditEvent, error) {
+	var (
+		event   model.AuditEvent
+		details []byte
+	)
+
+	if err := row.Scan(
+		&event.ID,
+		&event.Operator,
+		&event.Action,
+		&event.SubjectType,
+		&event.SubjectID,
+		&details,
+		&event.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(details, &event.Details); err != nil {
+		return nil, fmt.Errorf("failed to decode audit details: %w", err)
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// APIKeyRepository stores the API keys of the providers.
+type APIKeyRepository interface {
+	// GetAPIKeyByHash returns the API key with the given hash, or ErrAPIKeyNotFound.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	// LockAPIKey returns the API key with the given ID, or ErrAPIKeyNotFound, and locks it until the
+	// surrounding transaction ends.
+	LockAPIKey(ctx context.Context, id uuid.UUID) (*model.APIKey, error)
+	// ListAPIKeys returns the API keys of provider, newest first.
+	ListAPIKeys(ctx context.Context, provider string) ([]model.APIKey, error)
+	// InsertAPIKey stores key and fills in its CreatedAt.
+	// It returns ErrProviderNotFound if the provider of key is not registered.
+	InsertAPIKey(ctx context.Context, key *model.APIKey) error
+	// RevokeAPIKey stores the RevokedAt of key, or returns ErrAPIKeyNotFound.
+	RevokeAPIKey(ctx context.Context, key *model.APIKey) error
+	// TouchAPIKey records that the API key id was used at.
+	TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// apiKeyColumns lists the columns read by scanAPIKey, in order.
+const apiKeyColumns = `id, provider, prefix, key_hash, scopes, created_at, last_used_at, revoked_at`
+
+func (r *Postgresql) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.queryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get API key: %w", classifyError(err))
+	}
+
+	return key, nil
+}
+
+func (r *Postgresql) LockAPIKey(ctx context.Context, id uuid.UUID) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.queryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+
+		return nil, fmt.Errorf("failed to lock API key %s: %w", id, classifyError(err))
+	}
+
+	return key, nil
+}
+
+func (r *Postgresql) ListAPIKeys(ctx context.Context, provider string) ([]model.APIKey, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT `+apiKeyColumns+`
+FROM api_keys
+WHERE provider = $1
+ORDER BY created_at DESC, id`, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys of provider %s: %w", provider, classifyError(err))
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+
+		keys = append(keys, *key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list API keys of provider %s: %w", provider, classifyError(err))
+	}
+
+	return keys, nil
+}
+
+func (r *Postgresql) InsertAPIKey(ctx context.Context, key *model.APIKey) error {
+	scopes := make(pq.StringArray, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	if err := r.queryRowContext(ctx, `
+INSERT INTO api_keys (id, provider, prefix, key_hash, scopes)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING created_at`,
+		key.ID,
+		key.Provider,
+		key.Prefix,
+		key.Hash,
+		scopes,
+	).Scan(&key.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert API key of provider %s: %w", key.Provider, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) RevokeAPIKey(ctx context.Context, key *model.APIKey) error {
+	result, err := r.exec(ctx, "UPDATE api_keys SET revoked_at = $2 WHERE id = $1", key.ID, key.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key %s: %w", key.ID, classifyError(err))
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *Postgresql) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if _, err := r.exec(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", id, at); err != nil {
+		return fmt.Errorf("failed to record use of API key %s: %w", id, classifyError(err))
+	}
+
+	return nil
+}
+
+// scanAPIKey reads an API key selected with apiKeyColumns.
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var (
+		key                 model.APIKey
+		scopes              pq.StringArray
+		lastUsed, revokedAt sql.NullTime
+	)
+
+	if err := row.Scan(
+		&key.ID,
+		&key.Provider,
+		&key.Prefix,
+		&key.Hash,
+		&scopes,
+		&key.CreatedAt,
+		&lastUsed,
+		&revokedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	key.Scopes = make([]model.APIKeyScope, len(scopes))
+	for i, scope := range scopes {
+		key.Scopes[i] = model.APIKeyScope(scope)
+	}
+
+	if lastUsed.Valid {
+		key.LastUsedAt = &lastUsed.Time
+	}
+
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
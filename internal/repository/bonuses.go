@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+)
+
+// BonusRepository stores the bonus grants and their wagering progress.
+type BonusRepository interface {
+	// GetBonusGrant returns the bonus grant with the caller chosen grantID, or ErrBonusGrantNotFound.
+	GetBonusGrant(ctx context.Context, grantID uuid.UUID) (*model.BonusGrant, error)
+	// ListBonusGrants returns all bonus grants of userID, newest first.
+	ListBonusGrants(ctx context.Context, userID int) ([]model.BonusGrant, error)
+	// LockActiveBonusGrants returns the active bonus grants of the wallet of userID in currency,
+	// oldest first, and locks them until the surrounding transaction ends.
+	LockActiveBonusGrants(ctx context.Context, userID int, currency model.Currency) ([]model.BonusGrant, error)
+	// InsertBonusGrant stores grant and fills in its ID, Status and CreatedAt. It returns
+	// ErrDuplicateTransaction if a grant with the same GrantID exists.
+	InsertBonusGrant(ctx context.Context, grant *model.BonusGrant) error
+	// UpdateBonusGrant stores the wagering progress and completion of grant, or returns ErrBonusGrantNotFound.
+	UpdateBonusGrant(ctx context.Context, grant *model.BonusGrant) error
+}
+
+// bonusGrantColumns lists the columns read by scanBonusGrant, in order.
+const bonusGrantColumns = `id, grant_id, user_id, currency, amount, wagering_requirement, wagered, status,
+converted_amount, created_at, completed_at`
+
+func (r *Postgresql) GetBonusGrant(ctx context.Context, grantID uuid.UUID) (*model.BonusGrant, error) {
+	grant, err := scanBonusGrant(r.queryRowContext(ctx, `
+SELECT `+bonusGrantColumns+`
+FROM bonus_grants
+WHERE grant_id = $1`, grantID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBonusGrantNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get bonus grant %s: %w", grantID, classifyError(err))
+	}
+
+	return grant, nil
+}
+
+func (r *Postgresql) ListBonusGrants(ctx context.Context, userID int) ([]model.BonusGrant, error) {
+	return r.queryBonusGrants(ctx, `
+SELECT `+bonusGrantColumns+`
+FROM bonus_grants
+WHERE user_id = $1
+ORDER BY id DESC`, userID)
+}
+
+func (r *Postgresql) LockActiveBonusGrants(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+) ([]model.BonusGrant, error) {
+	return r.queryBonusGrants(ctx, `
+SELECT `+bonusGrantColumns+`
+FROM bonus_grants
+WHERE user_id = $1 AND currency = $2 AND status = $3
+ORDER BY id
+FOR UPDATE`, userID, currency, model.BonusGrantActive)
+}
+
+func (r *Postgresql) queryBonusGrants(ctx context.Context, query string, args ...any) ([]model.BonusGrant, error) {
+	rows, err := r.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bonus grants: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	grants := []model.BonusGrant{}
+
+	for rows.Next() {
+		grant, err := scanBonusGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bonus grant: %w", err)
+		}
+
+		grants = append(grants, *grant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list bonus grants: %w", classifyError(err))
+	}
+
+	return grants, nil
+}
+
+func (r *Postgresql) InsertBonusGrant(ctx context.Context, grant *model.BonusGrant) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO bonus_grants (grant_id, user_id, currency, amount, wagering_requirement)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, wagered, status, created_at`,
+		grant.GrantID,
+		grant.UserID,
+		grant.Currency,
+		grant.Amount,
+		grant.WageringRequirement,
+	).Scan(&grant.ID, &grant.Wagered, &grant.Status, &grant.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert bonus grant of user %d: %w", grant.UserID, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) UpdateBonusGrant(ctx context.Context, grant *model.BonusGrant) error {
+	result, err := r.exec(ctx, `
+UPDATE bonus_grants
+SET wagered = $2, status = $3, converted_amount = $4, completed_at = $5
+WHERE id = $1`, grant.ID, grant.Wagered, grant.Status, grant.ConvertedAmount, grant.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update bonus grant %d: %w", grant.ID, classifyError(err))
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrBonusGrantNotFound
+	}
+
+	return nil
+}
+
+// scanBonusGrant reads a bonus grant selected with bonusGrantColumns.
+func scanBonusGrant(row rowScanner) (*model.BonusGrant, error) {
+	var (
+		grant       model.BonusGrant
+		grantID     uuid.NullUUID
+		completedAt sql.NullTime
+	)
+
+	if err := row.Scan(
+		&grant.ID,
+		&grantID,
+		&grant.UserID,
+		&grant.Currency,
+		&grant.Amount,
+		&grant.WageringRequirement,
+		&grant.Wagered,
+		&grant.Status,
+		&grant.ConvertedAmount,
+		&grant.CreatedAt,
+		&completedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	grant.GrantID = grantID.UUID
+
+	if completedAt.Valid {
+		grant.CompletedAt = &completedAt.Time
+	}
+
+	return &grant, nil
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// HealthRepository reports the state of the database.
+type HealthRepository interface {
+	// Ping checks that the database can be reached.
+	Ping(ctx context.Context) error
+	// SchemaVersion returns the version of the last applied migration and whether it failed halfway.
+	SchemaVersion(ctx context.Context) (version uint, dirty bool, err error)
+	// PoolStats returns the statistics of the connection pool.
+	PoolStats() sql.DBStats
+}
+
+func (r *Postgresql) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	var (
+		version uint
+		dirty   bool
+	)
+
+	err := r.queryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get schema version: %w", classifyError(err))
+	}
+
+	return version, dirty, nil
+}
+
+func (r *Postgresql) PoolStats() sql.DBStats {
+	return r.db.Stats()
+}
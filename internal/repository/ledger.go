@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+)
+
+// LedgerRepository stores the double-entry ledger.
+type LedgerRepository interface {
+	// PostJournalEntry stores entry with its postings and fills in its ID and CreatedAt.
+	// Accounts are created on first use. The database rejects unbalanced entries on commit.
+	PostJournalEntry(ctx context.Context, entry *model.JournalEntry) error
+}
+
+func (r *Postgresql) PostJournalEntry(ctx context.Context, entry *model.JournalEntry) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO journal_entries (transaction_id, description)
+VALUES ($1, $2)
+RETURNING id, created_at`, entry.TransactionID, entry.Description).Scan(&entry.ID, &entry.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert journal entry: %w", classifyError(err))
+	}
+
+	for _, posting := range entry.Postings {
+		accountID, err := r.ledgerAccountID(ctx, posting.Account)
+		if err != nil {
+			return err
+		}
+
+		if _, err = r.exec(ctx, `
+INSERT INTO postings (journal_entry_id, account_id, amount)
+VALUES ($1, $2, $3)`, entry.ID, accountID, posting.Amount); err != nil {
+			return fmt.Errorf("failed to insert posting: %w", classifyError(err))
+		}
+	}
+
+	return nil
+}
+
+// ledgerAccountID returns the ID of account, creating the account if it does not exist yet.
+func (r *Postgresql) ledgerAccountID(ctx context.Context, account model.LedgerAccount) (int64, error) {
+	userID := sql.NullInt64{Int64: int64(account.UserID), Valid: account.UserID != 0}
+	sourceType := sql.NullString{String: string(account.SourceType), Valid: account.SourceType != ""}
+
+	selectID := func() (int64, error) {
+		var id int64
+
+		err := r.queryRowContext(ctx, `
+SELECT id
+FROM ledger_accounts
+WHERE type = $1
+AND user_id IS NOT DISTINCT FROM $2
+AND source_type IS NOT DISTINCT FROM $3
+AND currency = $4`, account.Type, userID, sourceType, account.Currency).Scan(&id)
+
+		return id, err
+	}
+
+	id, err := selectID()
+	if err == nil {
+		return id, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to find %s ledger account: %w", account.Type, classifyError(err))
+	}
+
+	// Another transaction may create the account concurrently, so look it up again afterwards.
+	if _, err = r.exec(ctx, `
+INSERT INTO ledger_accounts (type, user_id, source_type, currency)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT ON CONSTRAINT `+ledgerAccountsOwnerKey+` DO NOTHING`,
+		account.Type, userID, sourceType, account.Currency); err != nil {
+		return 0, fmt.Errorf("failed to create %s ledger account: %w", account.Type, classifyError(err))
+	}
+
+	if id, err = selectID(); err != nil {
+		return 0, fmt.Errorf("failed to find %s ledger account: %w", account.Type, classifyError(err))
+	}
+
+	return id, nil
+}
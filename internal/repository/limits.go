@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// UserLimitRepository stores the loss limits of the users.
+type UserLimitRepository interface {
+	// ListUserLimits returns the limits of userID as stored, ordered by currency and period.
+	ListUserLimits(ctx context.Context, userID int) ([]model.UserLimit, error)
+	// LockUserLimit returns the limit of userID in currency for period and locks it until the
+	// surrounding transaction ends. It returns ErrUserLimitNotFound if there is none.
+	LockUserLimit(
+		ctx context.Context,
+		userID int,
+		currency model.Currency,
+		period model.LimitPeriod,
+	) (*model.UserLimit, error)
+	// SaveUserLimit creates or replaces limit and fills in its UpdatedAt.
+	SaveUserLimit(ctx context.Context, limit *model.UserLimit) error
+	// GetNetLoss returns the lose minus the win amounts of userID in currency since the given time.
+	// Rollbacks cancel the transactions they reverse, manual adjustments are left out.
+	GetNetLoss(ctx context.Context, userID int, currency model.Currency, since time.Time) (decimal.Decimal, error)
+}
+
+// userLimitColumns lists the columns read by scanUserLimit, in order.
+const userLimitColumns = `user_id, currency, period, amount, pending_amount, pending_from, updated_at`
+
+func (r *Postgresql) ListUserLimits(ctx context.Context, userID int) ([]model.UserLimit, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT `+userLimitColumns+`
+FROM user_limits
+WHERE user_id = $1
+ORDER BY currency, period`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list limits of user %d: %w", userID, classifyError(err))
+	}
+	defer rows.Close()
+
+	limits := []model.UserLimit{}
+
+	for rows.Next() {
+		limit, err := scanUserLimit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user limit: %w", err)
+		}
+
+		limits = append(limits, *limit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list limits of user %d: %w", userID, classifyError(err))
+	}
+
+	return limits, nil
+}
+
+func (r *Postgresql) LockUserLimit(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+) (*model.UserLimit, error) {
+	limit, err := scanUserLimit(r.queryRowContext(ctx, `
+SELECT `+userLimitColumns+`
+FROM user_limits
+WHERE user_id = $1 AND currency = $2 AND period = $3
+FOR UPDATE`, userID, currency, period))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserLimitNotFound
+		}
+
+		return nil, fmt.Errorf("failed to lock %s limit of user %d: %w", period, userID, classifyError(err))
+	}
+
+	return limit, nil
+}
+
+func (r *Postgresql) SaveUserLimit(ctx context.Context, limit *model.UserLimit) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO user_limits (user_id, currency, period, amount, pending_amount, pending_from)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, currency, period) DO UPDATE
+SET amount = EXCLUDED.amount,
+    pending_amount = EXCLUDED.pending_amount,
+    pending_from = EXCLUDED.pending_from,
+    updated_at = NOW()
+RETURNING updated_at`,
+		limit.UserID,
+		limit.Currency,
+		limit.Period,
+		limit.Amount,
+		limit.PendingAmount,
+		limit.PendingFrom,
+	).Scan(&limit.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save %s limit of user %d: %w", limit.Period, limit.UserID, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) GetNetLoss(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	since time.Time,
+) (decimal.Decimal, error) {
+	var netLoss decimal.Decimal
+
+	// A rollback counts against the state of its original; tombstones have a zero amount.
+	// Manual adjustments by operators are not losses of the user.
+	if err := r.queryRowContext(ctx, `
+SELECT COALESCE(SUM(
+    CASE COALESCE(o.state, t.state)
+        WHEN $4 THEN t.amount
+        WHEN $5 THEN -t.amount
+    END * CASE WHEN t.state = $6 THEN -1 ELSE 1 END
+), 0)
+FROM transactions t
+LEFT JOIN transactions o ON o.id = t.original_transaction_id
+WHERE t.user_id = $1 AND t.currency = $2 AND t.created_at >= $3 AND t.source_type <> $7`,
+		userID, currency, since,
+		model.TransactionStateLose, model.TransactionStateWin, model.TransactionStateRollback,
+		model.SourceTypeManual,
+	).Scan(&netLoss); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get net loss of user %d: %w", userID, classifyError(err))
+	}
+
+	return netLoss, nil
+}
+
+// scanUserLimit reads a user limit selected with userLimitColumns.
+func scanUserLimit(row rowScanner) (*model.UserLimit, error) {
+	var (
+		limit       model.UserLimit
+		pendingFrom sql.NullTime
+	)
+
+	if err := row.Scan(
+		&limit.UserID,
+		&limit.Currency,
+		&limit.Period,
+		&limit.Amount,
+		&limit.PendingAmount,
+		&pendingFrom,
+		&limit.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if pendingFrom.Valid {
+		limit.PendingFrom = &pendingFrom.Time
+	}
+
+	return &limit, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NonceRepository stores the nonces of signed requests shared by all instances.
+type NonceRepository interface {
+	// InsertNonce records key until expiresAt and reports whether it was not recorded yet. A nonce
+	// expired by now is recorded again.
+	InsertNonce(ctx context.Context, key string, expiresAt, now time.Time) (bool, error)
+	// DeleteNonces deletes the nonces expired before and returns how many there were.
+	DeleteNonces(ctx context.Context, before time.Time) (int, error)
+}
+
+func (r *Postgresql) InsertNonce(ctx context.Context, key string, expiresAt, now time.Time) (bool, error) {
+	var inserted bool
+
+	if err := r.queryRowContext(ctx, `
+INSERT INTO signature_nonces (key, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE SET expires_at = EXCLUDED.expires_at
+WHERE signature_nonces.expires_at <= $3
+RETURNING TRUE`,
+		key,
+		expiresAt,
+		now,
+	).Scan(&inserted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) { // the nonce is recorded and has not expired
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to insert nonce: %w", classifyError(err))
+	}
+
+	return inserted, nil
+}
+
+func (r *Postgresql) DeleteNonces(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.exec(ctx, "DELETE FROM signature_nonces WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired nonces: %w", classifyError(err))
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired nonces: %w", err)
+	}
+
+	return int(deleted), nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/lib/pq"
+)
+
+// ProviderRepository stores the registered providers.
+type ProviderRepository interface {
+	// GetProvider returns the provider with the given name, or ErrProviderNotFound.
+	GetProvider(ctx context.Context, name string) (*model.Provider, error)
+	// InsertProvider registers provider and fills in its Enabled and CreatedAt.
+	// It returns ErrProviderExists if a provider with the same name is registered.
+	InsertProvider(ctx context.Context, provider *model.Provider) error
+}
+
+// providerColumns lists the columns read by scanProvider, in order.
+const providerColumns = `name, secret, source_types, enabled, created_at`
+
+func (r *Postgresql) GetProvider(ctx context.Context, name string) (*model.Provider, error) {
+	provider, err := scanProvider(r.queryRowContext(ctx,
+		"SELECT "+providerColumns+" FROM providers WHERE name = $1", name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProviderNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get provider %s: %w", name, classifyError(err))
+	}
+
+	return provider, nil
+}
+
+func (r *Postgresql) InsertProvider(ctx context.Context, provider *model.Provider) error {
+	sourceTypes := make(pq.StringArray, len(provider.SourceTypes))
+	for i, sourceType := range provider.SourceTypes {
+		sourceTypes[i] = string(sourceType)
+	}
+
+	if err := r.queryRowContext(ctx, `
+INSERT INTO providers (name, secret, source_types)
+VALUES ($1, $2, $3)
+RETURNING enabled, created_at`,
+		provider.Name,
+		provider.Secret,
+		sourceTypes,
+	).Scan(&provider.Enabled, &provider.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert provider %s: %w", provider.Name, classifyError(err))
+	}
+
+	return nil
+}
+
+// scanProvider reads a provider selected with providerColumns.
+func scanProvider(row rowScanner) (*model.Provider, error) {
+	var (
+		provider    model.Provider
+		sourceTypes pq.StringArray
+	)
+
+	if err := row.Scan(
+		&provider.Name,
+		&provider.Secret,
+		&sourceTypes,
+		&provider.Enabled,
+		&provider.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	provider.SourceTypes = make([]model.SourceType, len(sourceTypes))
+	for i, sourceType := range sourceTypes {
+		provider.SourceTypes[i] = model.SourceType(sourceType)
+	}
+
+	return &provider, nil
+}
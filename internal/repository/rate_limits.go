@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+)
+
+// RateLimitRepository stores the rate limit buckets shared by all instances.
+type RateLimitRepository interface {
+	// LockRateLimitBucket returns the bucket key, or ErrRateLimitBucketNotFound, and locks it until
+	// the surrounding transaction ends.
+	LockRateLimitBucket(ctx context.Context, key string) (*model.RateLimitBucket, error)
+	// SaveRateLimitBucket stores bucket, creating it if it does not exist yet.
+	SaveRateLimitBucket(ctx context.Context, bucket *model.RateLimitBucket) error
+	// DeleteRateLimitBuckets deletes the buckets last updated before and returns how many there were.
+	DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int, error)
+}
+
+func (r *Postgresql) LockRateLimitBucket(ctx context.Context, key string) (*model.RateLimitBucket, error) {
+	bucket := &model.RateLimitBucket{Key: key}
+
+	if err := r.queryRowContext(ctx,
+		"SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE", key,
+	).Scan(&bucket.Tokens, &bucket.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRateLimitBucketNotFound
+		}
+
+		return nil, fmt.Errorf("failed to lock rate limit bucket %s: %w", key, classifyError(err))
+	}
+
+	return bucket, nil
+}
+
+func (r *Postgresql) SaveRateLimitBucket(ctx context.Context, bucket *model.RateLimitBucket) error {
+	if _, err := r.exec(ctx, `
+INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at`,
+		bucket.Key,
+		bucket.Tokens,
+		bucket.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to save rate limit bucket %s: %w", bucket.Key, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) DeleteRateLimitBuckets(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.exec(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idle rate limit buckets: %w", classifyError(err))
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idle rate limit buckets: %w", err)
+	}
+
+	return int(deleted), nil
+}
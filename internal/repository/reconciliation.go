@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+)
+
+// ReconciliationRepository recomputes the balances of the wallets for the reconcile command.
+type ReconciliationRepository interface {
+	// FindBalanceDrifts returns the wallets whose balances differ from their expected balances,
+	// the opening balances plus the effects of all transactions, bonus grants and reservations.
+	FindBalanceDrifts(ctx context.Context) ([]model.BalanceDrift, error)
+	// FindLedgerDrifts returns the wallets whose balances differ from the sums of the postings on
+	// their wallet, bonus and held ledger accounts. The ledger balances are reported as expected.
+	FindLedgerDrifts(ctx context.Context) ([]model.BalanceDrift, error)
+	// GetExpectedBalances returns the expected balances of the wallet of userID in currency, as
+	// FindBalanceDrifts computes them.
+	GetExpectedBalances(ctx context.Context, userID int, currency model.Currency) (model.Balances, error)
+	// GetLedgerBalances returns the ledger balances of the wallet of userID in currency, as
+	// FindLedgerDrifts computes them.
+	GetLedgerBalances(ctx context.Context, userID int, currency model.Currency) (model.Balances, error)
+	// InsertBalanceAdjustment records the correction of a drifted balance.
+	InsertBalanceAdjustment(ctx context.Context, adjustment *model.BalanceAdjustment) error
+}
+
+// expectedBalances selects the balances every wallet is expected to have from its history:
+//   - the opening balance;
+//   - wins credit and loses debit the real balance, the bonus part of a lose the bonus balance;
+//   - a rollback reverses its original, a tombstone has no amount;
+//   - a bonus grant credits the bonus balance, its conversion moves the converted amount to the
+//     real balance;
+//   - a held reservation moves its amount from the real to the held balance. A committed
+//     reservation is paid by its lose transaction, a released or expired one moves nothing.
+//
+// Manual adjustments are stored as transactions and need no term of their own.
+const expectedBalances = `
+SELECT user_id, currency,
+    SUM(real_balance) AS real_balance, SUM(bonus_balance) AS bonus_balance, SUM(held_balance) AS held_balance
+FROM (
+    SELECT user_id, currency, balance AS real_balance, 0 AS bonus_balance, 0 AS held_balance
+    FROM opening_balances
+    UNION ALL
+    SELECT t.user_id, t.currency,
+        CASE
+            WHEN t.state = 'win' THEN t.amount
+            WHEN t.state = 'lose' THEN t.bonus_amount - t.amount
+            WHEN o.state = 'win' THEN -t.amount
+            WHEN o.state = 'lose' THEN t.amount - t.bonus_amount
+            ELSE 0
+        END,
+        CASE
+            WHEN t.state = 'lose' THEN -t.bonus_amount
+            WHEN t.state = 'rollback' AND o.state = 'lose' THEN t.bonus_amount
+            ELSE 0
+        END,
+        0
+    FROM transactions t
+    LEFT JOIN transactions o ON o.id = t.original_transaction_id
+    UNION ALL
+    SELECT user_id, currency, COALESCE(converted_amount, 0), amount - COALESCE(converted_amount, 0), 0
+    FROM bonus_grants
+    UNION ALL
+    SELECT user_id, currency, -amount, 0, amount
+    FROM reservations
+    WHERE status = 'held'
+) movements
+GROUP BY user_id, currency`
+
+// ledgerBalances selects the sums of the postings on the wallet, bonus and held accounts of every
+// wallet.
+const ledgerBalances = `
+SELECT a.user_id, a.currency,
+    SUM(p.amount) FILTER (WHERE a.type = 'wallet') AS real_balance,
+    SUM(p.amount) FILTER (WHERE a.type = 'bonus') AS bonus_balance,
+    SUM(p.amount) FILTER (WHERE a.type = 'held') AS held_balance
+FROM ledger_accounts a
+JOIN postings p ON p.account_id = a.id
+WHERE a.type IN ('wallet', 'bonus', 'held')
+GROUP BY a.user_id, a.currency`
+
+func (r *Postgresql) FindBalanceDrifts(ctx context.Context) ([]model.BalanceDrift, error) {
+	return r.findDrifts(ctx, expectedBalances)
+}
+
+func (r *Postgresql) FindLedgerDrifts(ctx context.Context) ([]model.BalanceDrift, error) {
+	return r.findDrifts(ctx, ledgerBalances)
+}
+
+// findDrifts compares the balances of all wallets with the balances selected by expected.
+// Wallets missing from expected are expected to be empty.
+func (r *Postgresql) findDrifts(ctx context.Context, expected string) ([]model.BalanceDrift, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT w.user_id, w.currency, w.balance, w.bonus_balance, w.held_balance,
+    COALESCE(e.real_balance, 0), COALESCE(e.bonus_balance, 0), COALESCE(e.held_balance, 0)
+FROM wallets w
+LEFT JOIN (`+expected+`
+) e ON e.user_id = w.user_id AND e.currency = w.currency
+WHERE (w.balance, w.bonus_balance, w.held_balance) IS DISTINCT FROM
+    (COALESCE(e.real_balance, 0), COALESCE(e.bonus_balance, 0), COALESCE(e.held_balance, 0))
+ORDER BY w.user_id, w.currency`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find balance drifts: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	drifts := []model.BalanceDrift{}
+
+	for rows.Next() {
+		var drift model.BalanceDrift
+		if err = rows.Scan(
+			&drift.UserID,
+			&drift.Currency,
+			&drift.Actual.Real,
+			&drift.Actual.Bonus,
+			&drift.Actual.Held,
+			&drift.Expected.Real,
+			&drift.Expected.Bonus,
+			&drift.Expected.Held,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan balance drift: %w", err)
+		}
+
+		drift.Difference = drift.Actual.Sub(drift.Expected)
+		drifts = append(drifts, drift)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find balance drifts: %w", classifyError(err))
+	}
+
+	return drifts, nil
+}
+
+func (r *Postgresql) GetExpectedBalances(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+) (model.Balances, error) {
+	var balances model.Balances
+
+	err := r.queryRowContext(ctx, `
+SELECT e.real_balance, e.bonus_balance, e.held_balance
+FROM (`+expectedBalances+`
+) e
+WHERE e.user_id = $1 AND e.currency = $2`, userID, currency).Scan(&balances.Real, &balances.Bonus, &balances.Held)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Balances{}, nil
+	}
+
+	if err != nil {
+		return model.Balances{}, fmt.Errorf(
+			"failed to get expected balances of %s wallet of user %d: %w", currency, userID, classifyError(err))
+	}
+
+	return balances, nil
+}
+
+func (r *Postgresql) GetLedgerBalances(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+) (model.Balances, error) {
+	var balances model.Balances
+
+	err := r.queryRowContext(ctx, `
+SELECT COALESCE(l.real_balance, 0), COALESCE(l.bonus_balance, 0), COALESCE(l.held_balance, 0)
+FROM (`+ledgerBalances+`
+) l
+WHERE l.user_id = $1 AND l.currency = $2`, userID, currency).Scan(&balances.Real, &balances.Bonus, &balances.Held)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Balances{}, nil
+	}
+
+	if err != nil {
+		return model.Balances{}, fmt.Errorf(
+			"failed to get ledger balances of %s wallet of user %d: %w", currency, userID, classifyError(err))
+	}
+
+	return balances, nil
+}
+
+func (r *Postgresql) InsertBalanceAdjustment(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO reconciliation_adjustments (user_id, currency, balance_type, previous_balance, new_balance, reason)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at`,
+		adjustment.UserID,
+		adjustment.Currency,
+		adjustment.BalanceType,
+		adjustment.PreviousBalance,
+		adjustment.NewBalance,
+		adjustment.Reason,
+	).Scan(&adjustment.ID, &adjustment.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert balance adjustment: %w", classifyError(err))
+	}
+
+	return nil
+}
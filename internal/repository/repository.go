@@ -3,27 +3,85 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"net"
 
-	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
-	"github.com/google/uuid"
-	"github.com/shopspring/decimal"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/logging"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/tracing"
+	"github.com/lib/pq"
 )
 
-var ErrTransactionNotFound = errors.New("transaction not found")
+var (
+	ErrTransactionNotFound     = errors.New("transaction not found")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrWalletNotFound          = errors.New("wallet not found")
+	ErrDuplicateTransaction    = errors.New("duplicate transaction")
+	ErrInsufficientFunds       = errors.New("insufficient funds")
+	ErrAlreadyRolledBack       = errors.New("transaction already rolled back")
+	ErrConstraintViolation     = errors.New("constraint violation")
+	ErrUnavailable             = errors.New("database unavailable")
+	ErrSourceTypeNotFound      = errors.New("source type not found")
+	ErrSourceTypeExists        = errors.New("source type already exists")
+	ErrUserLimitNotFound       = errors.New("user limit not found")
+	ErrBonusGrantNotFound      = errors.New("bonus grant not found")
+	ErrReservationNotFound     = errors.New("reservation not found")
+	ErrAdjustmentNotFound      = errors.New("adjustment not found")
+	ErrProviderNotFound        = errors.New("provider not found")
+	ErrProviderExists          = errors.New("provider already exists")
+	ErrAPIKeyNotFound          = errors.New("API key not found")
+	ErrRateLimitBucketNotFound = errors.New("rate limit bucket not found")
+)
+
+// PostgreSQL error codes and constraint names translated by classifyError.
+const (
+	foreignKeyViolation pq.ErrorCode = "23503"
+	uniqueViolation     pq.ErrorCode = "23505"
+	checkViolation      pq.ErrorCode = "23514"
+	lockNotAvailable    pq.ErrorCode = "55P03"
+
+	integrityConstraintViolationClass pq.ErrorClass = "23"
+	transactionRollbackClass          pq.ErrorClass = "40"
+	connectionExceptionClass          pq.ErrorClass = "08"
+	insufficientResourcesClass        pq.ErrorClass = "53"
+	operatorInterventionClass         pq.ErrorClass = "57"
+
+	walletsBalanceNonNegativeConstraint = "wallets_balance_non_negative"
+	walletsBonusNonNegativeConstraint   = "wallets_bonus_balance_non_negative"
+	walletsUserForeignKey               = "wallets_user_id_fkey"
+	transactionsPrimaryKeyConstraint    = "transactions_pkey"
+	transactionsUserForeignKey          = "transactions_user_id_fkey"
+	transactionsOriginalIDUniqueIndex   = "transactions_original_transaction_id_key"
+	ledgerAccountsOwnerKey              = "ledger_accounts_owner_key"
+	sourceTypesPrimaryKeyConstraint     = "source_types_pkey"
+	reservationsPrimaryKeyConstraint    = "reservations_pkey"
+	adjustmentsPrimaryKeyConstraint     = "manual_adjustments_pkey"
+	bonusGrantsGrantIDKey               = "bonus_grants_grant_id_key"
+	providersPrimaryKeyConstraint       = "providers_pkey"
+	apiKeysProviderForeignKey           = "api_keys_provider_fkey"
+)
 
 type Repository interface {
 	// WithDBTransaction wraps the repository operations in a transaction
 	WithDBTransaction(ctx context.Context, fn func(context.Context, Repository) error) error
 
-	// Balance Repository
-	GetBalanceByID(ctx context.Context, userID int) (decimal.Decimal, error)
-	UpdateUserBalance(ctx context.Context, userID int, delta decimal.Decimal) error
-
-	// Transaction Repository
-	GetTransactionByID(ctx context.Context, txID uuid.UUID) (*model.Transaction, error)
-	InsertTransaction(ctx context.Context, tx *model.Transaction) error
+	UserRepository
+	WalletRepository
+	TransactionRepository
+	LedgerRepository
+	ReconciliationRepository
+	UserLimitRepository
+	BonusRepository
+	ReservationRepository
+	AdjustmentRepository
+	AuditRepository
+	SourceTypeRepository
+	ProviderRepository
+	APIKeyRepository
+	RateLimitRepository
+	NonceRepository
+	HealthRepository
 }
 
 type Postgresql struct {
@@ -40,9 +98,17 @@ func (r *Postgresql) WithDBTransaction(ctx context.Context, fn func(context.Cont
 		return fn(ctx, r)
 	}
 
+	ctx, span := tracing.Start(ctx, "Postgresql.WithDBTransaction")
+	err := r.withDBTransaction(ctx, fn)
+	tracing.End(span, tracing.DBTransactionOutcome(err), err)
+
+	return err
+}
+
+func (r *Postgresql) withDBTransaction(ctx context.Context, fn func(context.Context, Repository) error) error {
 	sqlTx, beginErr := r.db.BeginTx(ctx, nil)
 	if beginErr != nil {
-		return fmt.Errorf("failed to begin transaction: %w", beginErr)
+		return fmt.Errorf("failed to begin transaction: %w", classifyError(beginErr))
 	}
 
 	txRepo := &Postgresql{db: r.db, tx: sqlTx}
@@ -55,13 +121,16 @@ func (r *Postgresql) WithDBTransaction(ctx context.Context, fn func(context.Cont
 		}
 
 		if fnErr != nil {
-			_ = sqlTx.Rollback()
+			if rollbackErr := sqlTx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logging.FromContext(ctx).WarnContext(ctx, "failed to roll back transaction", logging.Error(rollbackErr))
+			}
 
 			return
 		}
 
 		if commitErr := sqlTx.Commit(); commitErr != nil {
-			fnErr = fmt.Errorf("failed to commit transaction: %w", commitErr)
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to commit transaction", logging.Error(commitErr))
+			fnErr = fmt.Errorf("failed to commit transaction: %w", classifyError(commitErr))
 		}
 	}()
 
@@ -70,68 +139,87 @@ func (r *Postgresql) WithDBTransaction(ctx context.Context, fn func(context.Cont
 	return fnErr
 }
 
-func (r *Postgresql) GetBalanceByID(ctx context.Context, userID int) (decimal.Decimal, error) {
-	var balance decimal.Decimal
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	err := r.queryRowContext(ctx, "SELECT balance FROM users WHERE id = $1", userID).Scan(&balance)
-	if err != nil {
-		return decimal.Zero, fmt.Errorf("failed to get balance for user %d: %w", userID, err)
-	}
+// classifyError wraps driver level errors with the matching repository sentinel error,
+// keeping the original error in the chain for diagnostics.
+func classifyError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == checkViolation && (pqErr.Constraint == walletsBalanceNonNegativeConstraint ||
+			pqErr.Constraint == walletsBonusNonNegativeConstraint):
+			return fmt.Errorf("%w: %w", ErrInsufficientFunds, err)
+		case pqErr.Code == uniqueViolation && (pqErr.Constraint == transactionsPrimaryKeyConstraint ||
+			pqErr.Constraint == reservationsPrimaryKeyConstraint ||
+			pqErr.Constraint == adjustmentsPrimaryKeyConstraint):
+			return fmt.Errorf("%w: %w", ErrDuplicateTransaction, err)
+		case pqErr.Code == uniqueViolation && pqErr.Constraint == transactionsOriginalIDUniqueIndex:
+			return fmt.Errorf("%w: %w", ErrAlreadyRolledBack, err)
+		case pqErr.Code == uniqueViolation && pqErr.Constraint == sourceTypesPrimaryKeyConstraint:
+			return fmt.Errorf("%w: %w", ErrSourceTypeExists, err)
+		case pqErr.Code == uniqueViolation && pqErr.Constraint == providersPrimaryKeyConstraint:
+			return fmt.Errorf("%w: %w", ErrProviderExists, err)
+		case pqErr.Code == foreignKeyViolation && pqErr.Constraint == apiKeysProviderForeignKey:
+			return fmt.Errorf("%w: %w", ErrProviderNotFound, err)
+		case pqErr.Code == foreignKeyViolation &&
+			(pqErr.Constraint == transactionsUserForeignKey || pqErr.Constraint == walletsUserForeignKey):
+			return fmt.Errorf("%w: %w", ErrUserNotFound, err)
+		case pqErr.Code.Class() == integrityConstraintViolationClass:
+			return fmt.Errorf("%w: %w", ErrConstraintViolation, err)
+		case pqErr.Code.Class() == transactionRollbackClass, // serialization failures and deadlocks can be retried
+			pqErr.Code.Class() == connectionExceptionClass,
+			pqErr.Code.Class() == insufficientResourcesClass,
+			pqErr.Code.Class() == operatorInterventionClass, // includes statement_timeout cancellations
+			pqErr.Code == lockNotAvailable:                  // lock_timeout waiting for a row of another transaction
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
 
-	return balance, nil
-}
+		return err
+	}
 
-func (r *Postgresql) UpdateUserBalance(ctx context.Context, userID int, delta decimal.Decimal) error {
-	if _, err := r.exec(ctx, `
-UPDATE users
-SET balance = balance + $1
-WHERE id = $2`, delta, userID); err != nil {
-		return fmt.Errorf("failed to update user balance: %w", err)
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
 	}
 
-	return nil
+	return err
 }
 
-func (r *Postgresql) GetTransactionByID(ctx context.Context, txID uuid.UUID) (*model.Transaction, error) {
-	var tx model.Transaction
-
-	err := r.queryRowContext(ctx,
-		`
-SELECT id, user_id, state, amount, source_type, created_at
-FROM transactions
-WHERE id = $1`, txID).Scan(&tx.ID, &tx.UserID, &tx.State, &tx.Amount, &tx.SourceType, &tx.CreatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrTransactionNotFound
-		}
+// exec, queryContext and queryRowContext run a statement in the transaction of r, if any, and trace
+// it. The span of a query ends once the query was sent, before its rows are read.
+func (r *Postgresql) exec(ctx context.Context, query string, args ...any) (result sql.Result, err error) {
+	ctx, span := tracing.StartStatement(ctx, query)
+	defer func() { tracing.EndStatement(span, err) }()
 
-		return nil, fmt.Errorf("failed to find transaction by ID: %w", err)
+	if r.tx != nil {
+		return r.tx.ExecContext(ctx, query, args...)
 	}
 
-	return &tx, nil
+	return r.db.ExecContext(ctx, query, args...)
 }
 
-func (r *Postgresql) InsertTransaction(ctx context.Context, tx *model.Transaction) error {
-	if _, err := r.exec(ctx, `
-INSERT INTO transactions
-(id, user_id, state, amount, source_type)
-VALUES ($1, $2, $3, $4, $5)`,
-		tx.ID, tx.UserID, tx.State, tx.Amount, tx.SourceType); err != nil {
-		return fmt.Errorf("failed to insert transaction: %w", err)
-	}
+func (r *Postgresql) queryContext(ctx context.Context, query string, args ...any) (rows *sql.Rows, err error) {
+	ctx, span := tracing.StartStatement(ctx, query)
+	defer func() { tracing.EndStatement(span, err) }()
 
-	return nil
-}
-
-func (r *Postgresql) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
 	if r.tx != nil {
-		return r.tx.ExecContext(ctx, query, args...)
+		return r.tx.QueryContext(ctx, query, args...)
 	}
 
-	return r.db.ExecContext(ctx, query, args...)
+	return r.db.QueryContext(ctx, query, args...)
 }
 
-func (r *Postgresql) queryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+func (r *Postgresql) queryRowContext(ctx context.Context, query string, args ...any) (row *sql.Row) {
+	ctx, span := tracing.StartStatement(ctx, query)
+	defer func() { tracing.EndStatement(span, row.Err()) }()
+
 	if r.tx != nil {
 		return r.tx.QueryRowContext(ctx, query, args...)
 	}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+)
+
+// ReservationRepository stores the held stakes of two-phase bets.
+type ReservationRepository interface {
+	// GetReservation returns the reservation with the given ID, or ErrReservationNotFound.
+	GetReservation(ctx context.Context, id uuid.UUID) (*model.Reservation, error)
+	// LockReservation is like GetReservation but locks the reservation until the surrounding transaction ends.
+	LockReservation(ctx context.Context, id uuid.UUID) (*model.Reservation, error)
+	// InsertReservation stores reservation and fills in its Status and CreatedAt.
+	// It returns ErrDuplicateTransaction if a reservation with the same ID already exists.
+	InsertReservation(ctx context.Context, reservation *model.Reservation) error
+	// UpdateReservation stores the settlement of reservation, or returns ErrReservationNotFound.
+	UpdateReservation(ctx context.Context, reservation *model.Reservation) error
+	// ListExpiredReservations returns up to limit held reservations that expired before now, oldest first.
+	ListExpiredReservations(ctx context.Context, now time.Time, limit int) ([]model.Reservation, error)
+}
+
+// reservationColumns lists the columns read by scanReservation, in order.
+const reservationColumns = `id, user_id, currency, source_type, amount, status, expires_at, created_at, settled_at,
+provider`
+
+func (r *Postgresql) GetReservation(ctx context.Context, id uuid.UUID) (*model.Reservation, error) {
+	return r.getReservation(ctx, "SELECT "+reservationColumns+" FROM reservations WHERE id = $1", id)
+}
+
+func (r *Postgresql) LockReservation(ctx context.Context, id uuid.UUID) (*model.Reservation, error) {
+	return r.getReservation(ctx, "SELECT "+reservationColumns+" FROM reservations WHERE id = $1 FOR UPDATE", id)
+}
+
+func (r *Postgresql) getReservation(ctx context.Context, query string, id uuid.UUID) (*model.Reservation, error) {
+	reservation, err := scanReservation(r.queryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReservationNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get reservation %s: %w", id, classifyError(err))
+	}
+
+	return reservation, nil
+}
+
+func (r *Postgresql) InsertReservation(ctx context.Context, reservation *model.Reservation) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO reservations (id, user_id, currency, source_type, amount, expires_at, provider)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING status, created_at`,
+		reservation.ID,
+		reservation.UserID,
+		reservation.Currency,
+		reservation.SourceType,
+		reservation.Amount,
+		reservation.ExpiresAt,
+		sql.NullString{String: reservation.Provider, Valid: reservation.Provider != ""},
+	).Scan(&reservation.Status, &reservation.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert reservation %s: %w", reservation.ID, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) UpdateReservation(ctx context.Context, reservation *model.Reservation) error {
+	result, err := r.exec(ctx, `
+UPDATE reservations
+SET status = $2, settled_at = $3
+WHERE id = $1`, reservation.ID, reservation.Status, reservation.SettledAt)
+	if err != nil {
+		return fmt.Errorf("failed to update reservation %s: %w", reservation.ID, classifyError(err))
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrReservationNotFound
+	}
+
+	return nil
+}
+
+func (r *Postgresql) ListExpiredReservations(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) ([]model.Reservation, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT `+reservationColumns+`
+FROM reservations
+WHERE status = $1 AND expires_at <= $2
+ORDER BY expires_at
+LIMIT $3`, model.ReservationHeld, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired reservations: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	reservations := []model.Reservation{}
+
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reservation: %w", err)
+		}
+
+		reservations = append(reservations, *reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list expired reservations: %w", classifyError(err))
+	}
+
+	return reservations, nil
+}
+
+// scanReservation reads a reservation selected with reservationColumns.
+func scanReservation(row rowScanner) (*model.Reservation, error) {
+	var (
+		reservation model.Reservation
+		settledAt   sql.NullTime
+		provider    sql.NullString
+	)
+
+	if err := row.Scan(
+		&reservation.ID,
+		&reservation.UserID,
+		&reservation.Currency,
+		&reservation.SourceType,
+		&reservation.Amount,
+		&reservation.Status,
+		&reservation.ExpiresAt,
+		&reservation.CreatedAt,
+		&settledAt,
+		&provider,
+	); err != nil {
+		return nil, err
+	}
+
+	if settledAt.Valid {
+		reservation.SettledAt = &settledAt.Time
+	}
+
+	reservation.Provider = provider.String
+
+	return &reservation, nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/lib/pq"
+)
+
+// SourceTypeRepository stores the registry of source types.
+type SourceTypeRepository interface {
+	// ListSourceTypes returns all registered source types, ordered by name.
+	ListSourceTypes(ctx context.Context) ([]model.SourceTypeSettings, error)
+	// InsertSourceType registers settings and fills in its timestamps.
+	// It returns ErrSourceTypeExists if a source type with the same name is registered.
+	InsertSourceType(ctx context.Context, settings *model.SourceTypeSettings) error
+	// UpdateSourceType applies update to the source type name and returns the updated settings,
+	// or ErrSourceTypeNotFound.
+	UpdateSourceType(
+		ctx context.Context,
+		name model.SourceType,
+		update model.SourceTypeUpdate,
+	) (*model.SourceTypeSettings, error)
+}
+
+// sourceTypeColumns lists the columns read by scanSourceType, in order.
+const sourceTypeColumns = `name, display_name, enabled, allowed_states, created_at, updated_at`
+
+func (r *Postgresql) ListSourceTypes(ctx context.Context) ([]model.SourceTypeSettings, error) {
+	rows, err := r.queryContext(ctx, "SELECT "+sourceTypeColumns+" FROM source_types ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source types: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	sourceTypes := []model.SourceTypeSettings{}
+
+	for rows.Next() {
+		settings, err := scanSourceType(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan source type: %w", err)
+		}
+
+		sourceTypes = append(sourceTypes, *settings)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list source types: %w", classifyError(err))
+	}
+
+	return sourceTypes, nil
+}
+
+func (r *Postgresql) InsertSourceType(ctx context.Context, settings *model.SourceTypeSettings) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO source_types (name, display_name, enabled, allowed_states)
+VALUES ($1, $2, $3, $4)
+RETURNING created_at, updated_at`,
+		settings.Name,
+		settings.DisplayName,
+		settings.Enabled,
+		stateArray(settings.AllowedStates),
+	).Scan(&settings.CreatedAt, &settings.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert source type %s: %w", settings.Name, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) UpdateSourceType(
+	ctx context.Context,
+	name model.SourceType,
+	update model.SourceTypeUpdate,
+) (*model.SourceTypeSettings, error) {
+	settings, err := scanSourceType(r.queryRowContext(ctx, `
+UPDATE source_types
+SET display_name = COALESCE($2, display_name),
+    enabled = COALESCE($3, enabled),
+    allowed_states = COALESCE($4, allowed_states),
+    updated_at = NOW()
+WHERE name = $1
+RETURNING `+sourceTypeColumns,
+		name,
+		update.DisplayName,
+		update.Enabled,
+		stateArray(update.AllowedStates),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSourceTypeNotFound
+		}
+
+		return nil, fmt.Errorf("failed to update source type %s: %w", name, classifyError(err))
+	}
+
+	return settings, nil
+}
+
+// scanSourceType reads a source type selected with sourceTypeColumns.
+func scanSourceType(row rowScanner) (*model.SourceTypeSettings, error) {
+	var (
+		settings model.SourceTypeSettings
+		states   pq.StringArray
+	)
+
+	if err := row.Scan(
+		&settings.Name,
+		&settings.DisplayName,
+		&settings.Enabled,
+		&states,
+		&settings.CreatedAt,
+		&settings.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	settings.AllowedStates = make([]model.TransactionState, len(states))
+	for i, state := range states {
+		settings.AllowedStates[i] = model.TransactionState(state)
+	}
+
+	return &settings, nil
+}
+
+// stateArray converts states into a TEXT[] parameter. A nil slice is passed as NULL.
+func stateArray(states []model.TransactionState) pq.StringArray {
+	if states == nil {
+		return nil
+	}
+
+	array := make(pq.StringArray, len(states))
+	for i, state := range states {
+		array[i] = string(state)
+	}
+
+	return array
+}
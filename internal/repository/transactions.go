@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/google/uuid"
+)
+
+// TransactionRepository stores the processed transactions.
+type TransactionRepository interface {
+	GetTransactionByID(ctx context.Context, txID uuid.UUID) (*model.Transaction, error)
+	// GetRollbackByOriginalID returns the rollback referencing originalID, or ErrTransactionNotFound.
+	GetRollbackByOriginalID(ctx context.Context, originalID uuid.UUID) (*model.Transaction, error)
+	// InsertTransaction stores tx and fills in its CreatedAt.
+	// It returns ErrDuplicateTransaction if a transaction with the same ID already exists
+	// and ErrAlreadyRolledBack if another rollback references the same original transaction.
+	InsertTransaction(ctx context.Context, tx *model.Transaction) error
+	// ListTransactionsByUser returns up to filter.Limit transactions matching filter,
+	// newest first, using keyset pagination on (created_at, id).
+	ListTransactionsByUser(ctx context.Context, filter model.TransactionFilter) ([]model.Transaction, error)
+}
+
+// transactionColumns lists the columns read by scanTransaction, in order.
+const transactionColumns = `id, user_id, state, amount, currency, source_type, created_at, balance_after,
+original_transaction_id, bonus_amount, provider`
+
+func (r *Postgresql) GetTransactionByID(ctx context.Context, txID uuid.UUID) (*model.Transaction, error) {
+	tx, err := scanTransaction(r.queryRowContext(ctx,
+		`SELECT `+transactionColumns+`
+FROM transactions
+WHERE id = $1`, txID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTransactionNotFound
+		}
+
+		return nil, fmt.Errorf("failed to find transaction by ID: %w", classifyError(err))
+	}
+
+	return tx, nil
+}
+
+func (r *Postgresql) GetRollbackByOriginalID(ctx context.Context, originalID uuid.UUID) (*model.Transaction, error) {
+	tx, err := scanTransaction(r.queryRowContext(ctx,
+		`SELECT `+transactionColumns+`
+FROM transactions
+WHERE original_transaction_id = $1`, originalID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTransactionNotFound
+		}
+
+		return nil, fmt.Errorf("failed to find rollback of transaction %s: %w", originalID, classifyError(err))
+	}
+
+	return tx, nil
+}
+
+func (r *Postgresql) InsertTransaction(ctx context.Context, tx *model.Transaction) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO transactions
+(id, user_id, state, amount, currency, source_type, balance_after, original_transaction_id, bonus_amount, provider)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING created_at`,
+		tx.ID,
+		tx.UserID,
+		tx.State,
+		tx.Amount,
+		tx.Currency,
+		tx.SourceType,
+		tx.BalanceAfter,
+		tx.OriginalTransactionID,
+		tx.BonusAmount,
+		sql.NullString{String: tx.Provider, Valid: tx.Provider != ""},
+	).Scan(&tx.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert transaction: %w", classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) ListTransactionsByUser(
+	ctx context.Context,
+	filter model.TransactionFilter,
+) ([]model.Transaction, error) {
+	args := []any{filter.UserID}
+	conditions := []string{"user_id = $1"}
+
+	addCondition := func(column, operator string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, column+" "+operator+" $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.State != "" {
+		addCondition("state", "=", filter.State)
+	}
+
+	if filter.SourceType != "" {
+		addCondition("source_type", "=", filter.SourceType)
+	}
+
+	if filter.Currency != "" {
+		addCondition("currency", "=", filter.Currency)
+	}
+
+	if filter.Provider != "" {
+		args = append(args, filter.Provider)
+		conditions = append(conditions, fmt.Sprintf("(provider = $%d OR provider IS NULL)", len(args)))
+	}
+
+	if filter.MinAmount.Valid {
+		addCondition("amount", ">=", filter.MinAmount.Decimal)
+	}
+
+	if filter.MaxAmount.Valid {
+		addCondition("amount", "<=", filter.MaxAmount.Decimal)
+	}
+
+	if !filter.From.IsZero() {
+		addCondition("created_at", ">=", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		addCondition("created_at", "<", filter.To)
+	}
+
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	args = append(args, filter.Limit)
+
+	query := `
+SELECT ` + transactionColumns + `
+FROM transactions
+WHERE ` + strings.Join(conditions, " AND ") + `
+ORDER BY created_at DESC, id DESC
+LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions for user %d: %w", filter.UserID, classifyError(err))
+	}
+	defer rows.Close()
+
+	transactions := make([]model.Transaction, 0, filter.Limit)
+
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		transactions = append(transactions, *tx)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list transactions for user %d: %w", filter.UserID, classifyError(err))
+	}
+
+	return transactions, nil
+}
+
+// scanTransaction reads a transaction selected with transactionColumns.
+func scanTransaction(row rowScanner) (*model.Transaction, error) {
+	var (
+		tx       model.Transaction
+		provider sql.NullString
+	)
+
+	if err := row.Scan(
+		&tx.ID,
+		&tx.UserID,
+		&tx.State,
+		&tx.Amount,
+		&tx.Currency,
+		&tx.SourceType,
+		&tx.CreatedAt,
+		&tx.BalanceAfter,
+		&tx.OriginalTransactionID,
+		&tx.BonusAmount,
+		&provider,
+	); err != nil {
+		return nil, err
+	}
+
+	tx.Provider = provider.String
+
+	return &tx, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// UserRepository stores the users and their account status.
+type UserRepository interface {
+	// GetUser returns the user with all of its wallets, ordered by currency.
+	GetUser(ctx context.Context, userID int) (*model.User, error)
+	// InsertUser stores a new active user and fills in its ID, Status and timestamps.
+	InsertUser(ctx context.Context, user *model.User) error
+	// LockUser returns the user without its wallets and locks it until the surrounding transaction ends.
+	LockUser(ctx context.Context, userID int) (*model.User, error)
+	// LockUserStatus returns the status of userID and keeps it from changing until the surrounding
+	// transaction ends. Unlike LockUser it does not block other transactions of the user.
+	LockUserStatus(ctx context.Context, userID int) (model.UserStatus, error)
+	// UpdateUserStatus stores the status of user and fills in its UpdatedAt, or returns ErrUserNotFound.
+	UpdateUserStatus(ctx context.Context, user *model.User) error
+}
+
+// userColumns lists the columns read by scanUser, in order.
+const userColumns = `id, status, created_at, updated_at`
+
+func (r *Postgresql) GetUser(ctx context.Context, userID int) (*model.User, error) {
+	rows, err := r.queryContext(ctx, `
+SELECT u.status, u.created_at, u.updated_at, w.currency, w.balance, w.bonus_balance, w.held_balance
+FROM users u
+LEFT JOIN wallets w ON w.user_id = u.id
+WHERE u.id = $1
+ORDER BY w.currency`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, classifyError(err))
+	}
+	defer rows.Close()
+
+	user := &model.User{ID: userID, Wallets: []model.Wallet{}}
+	found := false
+
+	for rows.Next() {
+		var (
+			currency                           sql.NullString
+			balance, bonusBalance, heldBalance decimal.NullDecimal
+		)
+
+		if err = rows.Scan(&user.Status, &user.CreatedAt, &user.UpdatedAt,
+			&currency, &balance, &bonusBalance, &heldBalance); err != nil {
+			return nil, fmt.Errorf("failed to scan wallet: %w", err)
+		}
+
+		found = true
+
+		// A user without wallets is returned as a single row of NULLs.
+		if currency.Valid {
+			user.Wallets = append(user.Wallets, model.Wallet{
+				UserID:       userID,
+				Currency:     model.Currency(currency.String),
+				Balance:      balance.Decimal,
+				BonusBalance: bonusBalance.Decimal,
+				HeldBalance:  heldBalance.Decimal,
+			})
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get user %d: %w", userID, classifyError(err))
+	}
+
+	if !found {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *Postgresql) InsertUser(ctx context.Context, user *model.User) error {
+	if err := r.queryRowContext(ctx, `
+INSERT INTO users DEFAULT VALUES
+RETURNING `+userColumns).Scan(&user.ID, &user.Status, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert user: %w", classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) LockUser(ctx context.Context, userID int) (*model.User, error) {
+	user, err := scanUser(r.queryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 FOR UPDATE", userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("failed to lock user %d: %w", userID, classifyError(err))
+	}
+
+	return user, nil
+}
+
+func (r *Postgresql) LockUserStatus(ctx context.Context, userID int) (model.UserStatus, error) {
+	var status model.UserStatus
+
+	err := r.queryRowContext(ctx, "SELECT status FROM users WHERE id = $1 FOR SHARE", userID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+
+		return "", fmt.Errorf("failed to lock status of user %d: %w", userID, classifyError(err))
+	}
+
+	return status, nil
+}
+
+func (r *Postgresql) UpdateUserStatus(ctx context.Context, user *model.User) error {
+	err := r.queryRowContext(ctx, `
+UPDATE users
+SET status = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING updated_at`, user.Status, user.ID).Scan(&user.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+
+		return fmt.Errorf("failed to update status of user %d: %w", user.ID, classifyError(err))
+	}
+
+	return nil
+}
+
+// scanUser reads a user without wallets selected with userColumns.
+func scanUser(row rowScanner) (*model.User, error) {
+	var user model.User
+
+	if err := row.Scan(&user.ID, &user.Status, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// WalletRepository stores the balances of the wallets of the users.
+type WalletRepository interface {
+	// GetWallet returns the wallet of userID in currency. It returns ErrUserNotFound for an
+	// unknown user and ErrWalletNotFound if the user has no wallet in that currency.
+	GetWallet(ctx context.Context, userID int, currency model.Currency) (*model.Wallet, error)
+	// CreateWallet creates an empty wallet of userID in currency unless it already exists.
+	CreateWallet(ctx context.Context, userID int, currency model.Currency) error
+	// LockWallet returns the wallet and locks its row until the surrounding transaction ends,
+	// serializing concurrent operations on the same wallet.
+	LockWallet(ctx context.Context, userID int, currency model.Currency) (*model.Wallet, error)
+	// UpdateWalletBalance applies delta to the real balance and returns the resulting wallet
+	UpdateWalletBalance(
+		ctx context.Context,
+		userID int,
+		currency model.Currency,
+		delta decimal.Decimal,
+	) (*model.Wallet, error)
+	// UpdateWalletBonusBalance applies delta to the bonus balance and returns the resulting wallet.
+	// Like UpdateWalletBalance it returns ErrInsufficientFunds if the balance would become negative.
+	UpdateWalletBonusBalance(
+		ctx context.Context,
+		userID int,
+		currency model.Currency,
+		delta decimal.Decimal,
+	) (*model.Wallet, error)
+
+	// UpdateWalletHeldBalance applies delta to the held balance and returns the resulting wallet.
+	UpdateWalletHeldBalance(
+		ctx context.Context,
+		userID int,
+		currency model.Currency,
+		delta decimal.Decimal,
+	) (*model.Wallet, error)
+}
+
+// walletColumns lists the columns read by scanWallet, in order.
+const walletColumns = `user_id, currency, balance, bonus_balance, held_balance`
+
+func (r *Postgresql) GetWallet(ctx context.Context, userID int, currency model.Currency) (*model.Wallet, error) {
+	wallet, err := scanWallet(r.queryRowContext(ctx,
+		"SELECT "+walletColumns+" FROM wallets WHERE user_id = $1 AND currency = $2", userID, currency,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.walletNotFound(ctx, userID)
+		}
+
+		return nil, fmt.Errorf("failed to get %s wallet of user %d: %w", currency, userID, classifyError(err))
+	}
+
+	return wallet, nil
+}
+
+func (r *Postgresql) CreateWallet(ctx context.Context, userID int, currency model.Currency) error {
+	if _, err := r.exec(ctx, `
+INSERT INTO wallets (user_id, currency)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING`, userID, currency); err != nil {
+		return fmt.Errorf("failed to create %s wallet of user %d: %w", currency, userID, classifyError(err))
+	}
+
+	return nil
+}
+
+func (r *Postgresql) LockWallet(ctx context.Context, userID int, currency model.Currency) (*model.Wallet, error) {
+	wallet, err := scanWallet(r.queryRowContext(ctx,
+		"SELECT "+walletColumns+" FROM wallets WHERE user_id = $1 AND currency = $2 FOR UPDATE", userID, currency,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.walletNotFound(ctx, userID)
+		}
+
+		return nil, fmt.Errorf("failed to lock %s wallet of user %d: %w", currency, userID, classifyError(err))
+	}
+
+	return wallet, nil
+}
+
+func (r *Postgresql) UpdateWalletBalance(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	wallet, err := scanWallet(r.queryRowContext(ctx, `
+UPDATE wallets
+SET balance = balance + $1
+WHERE user_id = $2 AND currency = $3
+RETURNING `+walletColumns, delta, userID, currency))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.walletNotFound(ctx, userID)
+		}
+
+		return nil, fmt.Errorf("failed to update wallet balance: %w", classifyError(err))
+	}
+
+	return wallet, nil
+}
+
+func (r *Postgresql) UpdateWalletBonusBalance(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	wallet, err := scanWallet(r.queryRowContext(ctx, `
+UPDATE wallets
+SET bonus_balance = bonus_balance + $1
+WHERE user_id = $2 AND currency = $3
+RETURNING `+walletColumns, delta, userID, currency))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.walletNotFound(ctx, userID)
+		}
+
+		return nil, fmt.Errorf("failed to update wallet bonus balance: %w", classifyError(err))
+	}
+
+	return wallet, nil
+}
+
+func (r *Postgresql) UpdateWalletHeldBalance(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	wallet, err := scanWallet(r.queryRowContext(ctx, `
+UPDATE wallets
+SET held_balance = held_balance + $1
+WHERE user_id = $2 AND currency = $3
+RETURNING `+walletColumns, delta, userID, currency))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.walletNotFound(ctx, userID)
+		}
+
+		return nil, fmt.Errorf("failed to update wallet held balance: %w", classifyError(err))
+	}
+
+	return wallet, nil
+}
+
+// walletNotFound tells apart a missing wallet from a missing user.
+func (r *Postgresql) walletNotFound(ctx context.Context, userID int) error {
+	var exists bool
+
+	err := r.queryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check existence of user %d: %w", userID, classifyError(err))
+	}
+
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	return ErrWalletNotFound
+}
+
+// scanWallet reads a wallet selected with walletColumns.
+func scanWallet(row rowScanner) (*model.Wallet, error) {
+	var wallet model.Wallet
+
+	if err := row.Scan(
+		&wallet.UserID,
+		&wallet.Currency,
+		&wallet.Balance,
+		&wallet.BonusBalance,
+		&wallet.HeldBalance,
+	); err != nil {
+		return nil, err
+	}
+
+	return &wallet, nil
+}
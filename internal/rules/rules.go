@@ -0,0 +1,189 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/shopspring/decimal"
+)
+
+// Code identifies the rule a transaction violated. Clients can branch on it.
+type Code string
+
+const (
+	CodeStateNotAllowed      Code = "state_not_allowed"
+	CodeAmountTooSmall       Code = "amount_too_small"
+	CodeAmountTooLarge       Code = "amount_too_large"
+	CodeTooManyDecimalPlaces Code = "too_many_decimal_places"
+)
+
+// MaxDecimalPlaces is the precision amounts are stored with. It always applies, rules can only tighten it.
+const MaxDecimalPlaces = 2
+
+// Violation is returned for a transaction that breaks a rule.
+type Violation struct {
+	Code    Code
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Rule restricts the transactions of a source type in a state. An empty SourceType or State
+// matches all source types or states, so a rule without both applies to every transaction.
+type Rule struct {
+	SourceType model.SourceType       `json:"sourceType"`
+	State      model.TransactionState `json:"state"`
+	// Reject rejects all matching transactions.
+	Reject           bool                `json:"reject"`
+	MinAmount        decimal.NullDecimal `json:"minAmount"`
+	MaxAmount        decimal.NullDecimal `json:"maxAmount"`
+	MaxDecimalPlaces *int32              `json:"maxDecimalPlaces"`
+}
+
+func (r *Rule) matches(tx *model.Transaction) bool {
+	return (r.SourceType == "" || r.SourceType == tx.SourceType) && (r.State == "" || r.State == tx.State)
+}
+
+// describe names the transactions the rule applies to, for violation messages.
+func (r *Rule) describe() string {
+	parts := make([]string, 0, 3)
+	if r.SourceType != "" {
+		parts = append(parts, string(r.SourceType))
+	}
+
+	if r.State != "" {
+		parts = append(parts, string(r.State))
+	}
+
+	return strings.Join(append(parts, "transactions"), " ")
+}
+
+func (r *Rule) validate() error {
+	if r.SourceType != "" {
+		if _, err := model.ToSourceType(string(r.SourceType)); err != nil {
+			return err
+		}
+	}
+
+	if r.State != "" {
+		if _, err := model.ToTransactionState(string(r.State)); err != nil {
+			return err
+		}
+	}
+
+	if r.MinAmount.Valid && r.MaxAmount.Valid && r.MinAmount.Decimal.GreaterThan(r.MaxAmount.Decimal) {
+		return errors.New("minAmount is above maxAmount")
+	}
+
+	if r.MaxDecimalPlaces != nil && (*r.MaxDecimalPlaces < 0 || *r.MaxDecimalPlaces > MaxDecimalPlaces) {
+		return fmt.Errorf("maxDecimalPlaces must be between 0 and %d", MaxDecimalPlaces)
+	}
+
+	return nil
+}
+
+// check returns the violation of the rule by tx, or nil. The amount of a rollback is taken from
+// its original transaction, so rollbacks are only subject to Reject.
+func (r *Rule) check(tx *model.Transaction) *Violation {
+	if r.Reject {
+		return &Violation{CodeStateNotAllowed, r.describe() + " are not allowed"}
+	}
+
+	if tx.State == model.TransactionStateRollback {
+		return nil
+	}
+
+	if r.MaxDecimalPlaces != nil && !hasDecimalPlaces(tx.Amount, *r.MaxDecimalPlaces) {
+		return &Violation{
+			CodeTooManyDecimalPlaces,
+			fmt.Sprintf("amount of %s must have at most %d decimal places", r.describe(), *r.MaxDecimalPlaces),
+		}
+	}
+
+	if r.MinAmount.Valid && tx.Amount.LessThan(r.MinAmount.Decimal) {
+		return &Violation{
+			CodeAmountTooSmall,
+			fmt.Sprintf("amount of %s must be at least %s", r.describe(), r.MinAmount.Decimal),
+		}
+	}
+
+	if r.MaxAmount.Valid && tx.Amount.GreaterThan(r.MaxAmount.Decimal) {
+		return &Violation{
+			CodeAmountTooLarge,
+			fmt.Sprintf("amount of %s must be at most %s", r.describe(), r.MaxAmount.Decimal),
+		}
+	}
+
+	return nil
+}
+
+func hasDecimalPlaces(amount decimal.Decimal, places int32) bool {
+	return amount.Equal(amount.Truncate(places))
+}
+
+// Engine evaluates transactions against a fixed set of rules.
+// The zero Engine has no rules and only enforces MaxDecimalPlaces.
+type Engine struct {
+	rules []Rule
+}
+
+// New creates an engine evaluating rules in order. An engine without rules only enforces MaxDecimalPlaces.
+func New(rules []Rule) (*Engine, error) {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %w", i, err)
+		}
+	}
+
+	return &Engine{rules: rules}, nil
+}
+
+// Load creates an engine from a JSON file of the form {"rules": [...]}.
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var file struct {
+		Rules []Rule `json:"rules"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err = decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+
+	return New(file.Rules)
+}
+
+// Evaluate returns the first violation of tx, or nil if tx breaks no rule.
+func (e *Engine) Evaluate(tx *model.Transaction) error {
+	if tx.State != model.TransactionStateRollback && !hasDecimalPlaces(tx.Amount, MaxDecimalPlaces) {
+		return &Violation{
+			CodeTooManyDecimalPlaces,
+			fmt.Sprintf("amount must have at most %d decimal places", MaxDecimalPlaces),
+		}
+	}
+
+	for i := range e.rules {
+		if !e.rules[i].matches(tx) {
+			continue
+		}
+
+		if violation := e.rules[i].check(tx); violation != nil {
+			return violation
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"rules": [
+			{"sourceType": "payment", "maxAmount": "5000.00"},
+			{"sourceType": "server", "state": "lose", "reject": true},
+			{"sourceType": "game", "state": "lose", "minAmount": "0.10"},
+			{"sourceType": "payment", "maxDecimalPlaces": 0}
+		]
+	}`), 0o600))
+
+	engine, err := Load(path)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		sourceType model.SourceType
+		state      model.TransactionState
+		amount     string
+		wantCode   Code
+	}{
+		{"within limits", model.SourceTypePayment, model.TransactionStateWin, "5000", ""},
+		{"above maximum", model.SourceTypePayment, model.TransactionStateWin, "5001", CodeAmountTooLarge},
+		{"rejected state", model.SourceTypeServer, model.TransactionStateLose, "1", CodeStateNotAllowed},
+		{"other state of rejected source", model.SourceTypeServer, model.TransactionStateWin, "1", ""},
+		{"below minimum", model.SourceTypeGame, model.TransactionStateLose, "0.09", CodeAmountTooSmall},
+		{"minimum of other state", model.SourceTypeGame, model.TransactionStateWin, "0.09", ""},
+		{"beyond stored precision", model.SourceTypeGame, model.TransactionStateWin, "1.001", CodeTooManyDecimalPlaces},
+		{"trailing zeros", model.SourceTypeGame, model.TransactionStateWin, "1.100", ""},
+		{"beyond rule precision", model.SourceTypePayment, model.TransactionStateWin, "1.50", CodeTooManyDecimalPlaces},
+		{"rollback amounts are not checked", model.SourceTypeGame, model.TransactionStateRollback, "0", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := engine.Evaluate(&model.Transaction{
+				SourceType: tc.sourceType,
+				State:      tc.state,
+				Amount:     decimal.RequireFromString(tc.amount),
+			})
+
+			if tc.wantCode == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var violation *Violation
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, tc.wantCode, violation.Code)
+		})
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	places := int32(3)
+
+	for name, rule := range map[string]Rule{
+		"unknown state":  {State: "draw"},
+		"invalid source": {SourceType: "Game"},
+		"min above max": {
+			MinAmount: decimal.NewNullDecimal(decimal.NewFromInt(2)),
+			MaxAmount: decimal.NewNullDecimal(decimal.NewFromInt(1)),
+		},
+		"excess precision": {MaxDecimalPlaces: &places},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New([]Rule{rule})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"sourceType": "game", "max": "10"}]}`), 0o600))
+
+	_, err := Load(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrInvalidAdjustment is returned for manual adjustments with missing or invalid fields.
+	ErrInvalidAdjustment  = errors.New("invalid adjustment")
+	ErrAdjustmentNotFound = repository.ErrAdjustmentNotFound
+	// ErrAdjustmentDecided is returned for a decision on an adjustment that was already decided otherwise.
+	ErrAdjustmentDecided = errors.New("adjustment already decided")
+	// ErrSelfReview is returned when operators approve or reject their own adjustment.
+	ErrSelfReview = errors.New("operators cannot review their own adjustments")
+)
+
+const (
+	// adjustmentSubject is the audit log subject type of manual adjustments.
+	adjustmentSubject = "manual_adjustment"
+	// adjustmentPageSize is the number of adjustments listed.
+	adjustmentPageSize = 100
+)
+
+// AdjustmentService lets operators credit and debit wallets by hand. Every adjustment and every
+// decision on it is recorded in the audit log.
+type AdjustmentService interface {
+	// RequestAdjustment stores adjustment and applies it, unless its amount is above the approval
+	// threshold; then it stays pending until a second operator decides on it. Retries of an
+	// adjustment return it as stored, while reusing its ID with a different payload returns
+	// ErrDuplicateTransaction.
+	RequestAdjustment(ctx context.Context, adjustment *model.ManualAdjustment) (*model.ManualAdjustment, error)
+	// GetAdjustment returns the adjustment with the given ID.
+	GetAdjustment(ctx context.Context, id uuid.UUID) (*model.ManualAdjustment, error)
+	// ListAdjustments returns the latest adjustments in status, or in any status if it is empty.
+	ListAdjustments(ctx context.Context, status model.AdjustmentStatus) ([]model.ManualAdjustment, error)
+	// ListAuditEvents returns the audit trail of the adjustment with the given ID, oldest first.
+	ListAuditEvents(ctx context.Context, id uuid.UUID) ([]model.AuditEvent, error)
+	// ApproveAdjustment applies the pending adjustment id on behalf of reviewer, who must not be
+	// the requester by name or by API key.
+	ApproveAdjustment(
+		ctx context.Context,
+		id uuid.UUID,
+		reviewer model.Operator,
+		comment string,
+	) (*model.ManualAdjustment, error)
+	// RejectAdjustment discards the pending adjustment id on behalf of reviewer, who must not be
+	// the requester by name or by API key.
+	RejectAdjustment(
+		ctx context.Context,
+		id uuid.UUID,
+		reviewer model.Operator,
+		comment string,
+	) (*model.ManualAdjustment, error)
+}
+
+type AdjustmentServiceImpl struct {
+	repo            repository.Repository
+	defaultCurrency model.Currency
+	// approvalThreshold is the amount above which adjustments need a second operator. Zero disables approvals.
+	approvalThreshold decimal.Decimal
+	now               func() time.Time
+}
+
+// NewAdjustmentService creates a service that applies adjustments of up to approvalThreshold
+// immediately and holds larger ones for approval. A zero threshold applies all adjustments immediately.
+func NewAdjustmentService(
+	repo repository.Repository,
+	defaultCurrency model.Currency,
+	approvalThreshold decimal.Decimal,
+) *AdjustmentServiceImpl {
+	return &AdjustmentServiceImpl{
+		repo:              repo,
+		defaultCurrency:   defaultCurrency,
+		approvalThreshold: approvalThreshold,
+		now:               time.Now,
+	}
+}
+
+func (s *AdjustmentServiceImpl) RequestAdjustment(
+	ctx context.Context,
+	adjustment *model.ManualAdjustment,
+) (*model.ManualAdjustment, error) {
+	if adjustment.Currency == "" {
+		adjustment.Currency = s.defaultCurrency
+	}
+
+	if err := validateAdjustment(adjustment); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetAdjustment(ctx, adjustment.ID)
+	if err == nil {
+		return replayAdjustment(existing, adjustment)
+	}
+
+	if !errors.Is(err, ErrAdjustmentNotFound) {
+		return nil, fmt.Errorf("failed to check existence of adjustment %s: %w", adjustment.ID, err)
+	}
+
+	err = s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		return s.request(ctx, tr, adjustment)
+	})
+	if errors.Is(err, ErrDuplicateTransaction) {
+		// A concurrent request with the same ID may have committed first, answer with its outcome.
+		if existing, getErr := s.repo.GetAdjustment(ctx, adjustment.ID); getErr == nil {
+			return replayAdjustment(existing, adjustment)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return adjustment, nil
+}
+
+// request stores adjustment and applies it right away if it does not need approval.
+func (s *AdjustmentServiceImpl) request(
+	ctx context.Context,
+	tr repository.Repository,
+	adjustment *model.ManualAdjustment,
+) error {
+	// Report a missing user or wallet instead of the failing foreign key.
+	if _, err := tr.GetWallet(ctx, adjustment.UserID, adjustment.Currency); err != nil {
+		return err
+	}
+
+	if _, err := tr.GetTransactionByID(ctx, adjustment.ID); err == nil {
+		return fmt.Errorf("%w: transaction %s was already processed", ErrDuplicateTransaction, adjustment.ID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to check existence of transaction %s: %w", adjustment.ID, err)
+	}
+
+	if err := tr.InsertAdjustment(ctx, adjustment); err != nil {
+		return err
+	}
+
+	err := auditAdjustment(ctx, tr, adjustment, adjustment.Requester(), model.AuditAdjustmentRequested, map[string]string{
+		"userId":     fmt.Sprint(adjustment.UserID),
+		"currency":   string(adjustment.Currency),
+		"type":       string(adjustment.Type),
+		"amount":     adjustment.Amount.StringFixed(2),
+		"reasonCode": string(adjustment.ReasonCode),
+		"comment":    adjustment.Comment,
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.approvalThreshold.IsPositive() && adjustment.Amount.GreaterThan(s.approvalThreshold) {
+		return nil
+	}
+
+	return s.apply(ctx, tr, adjustment, adjustment.Requester())
+}
+
+func (s *AdjustmentServiceImpl) GetAdjustment(ctx context.Context, id uuid.UUID) (*model.ManualAdjustment, error) {
+	return s.repo.GetAdjustment(ctx, id)
+}
+
+func (s *AdjustmentServiceImpl) ListAdjustments(
+	ctx context.Context,
+	status model.AdjustmentStatus,
+) ([]model.ManualAdjustment, error) {
+	return s.repo.ListAdjustments(ctx, status, adjustmentPageSize)
+}
+
+func (s *AdjustmentServiceImpl) ListAuditEvents(ctx context.Context, id uuid.UUID) ([]model.AuditEvent, error) {
+	return s.repo.ListAuditEvents(ctx, adjustmentSubject, id.String())
+}
+
+func (s *AdjustmentServiceImpl) ApproveAdjustment(
+	ctx context.Context,
+	id uuid.UUID,
+	reviewer model.Operator,
+	comment string,
+) (*model.ManualAdjustment, error) {
+	return s.decide(ctx, id, reviewer, comment, model.AdjustmentApplied)
+}
+
+func (s *AdjustmentServiceImpl) RejectAdjustment(
+	ctx context.Context,
+	id uuid.UUID,
+	reviewer model.Operator,
+	comment string,
+) (*model.ManualAdjustment, error) {
+	return s.decide(ctx, id, reviewer, comment, model.AdjustmentRejected)
+}
+
+// decide applies or rejects the pending adjustment id on behalf of reviewer. Repeating the
+// decision returns the adjustment unchanged.
+func (s *AdjustmentServiceImpl) decide(
+	ctx context.Context,
+	id uuid.UUID,
+	reviewer model.Operator,
+	comment string,
+	status model.AdjustmentStatus,
+) (*model.ManualAdjustment, error) {
+	if strings.TrimSpace(reviewer.Name) == "" {
+		return nil, fmt.Errorf("%w: operator is required", ErrInvalidAdjustment)
+	}
+
+	var adjustment *model.ManualAdjustment
+
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		var err error
+		if adjustment, err = tr.LockAdjustment(ctx, id); err != nil {
+			return err
+		}
+
+		switch {
+		case adjustment.Status == status:
+			return nil
+		case adjustment.Status != model.AdjustmentPending:
+			return fmt.Errorf("%w: adjustment %s was %s", ErrAdjustmentDecided, id, adjustment.Status)
+		case adjustment.Requester().Same(reviewer):
+			return fmt.Errorf("%w: adjustment %s was requested by %s with the same name or API key",
+				ErrSelfReview, id, adjustment.RequestedBy)
+		}
+
+		adjustment.ReviewedBy = reviewer.Name
+		adjustment.ReviewedByKey = reviewer.KeyID
+		adjustment.ReviewComment = comment
+
+		if status == model.AdjustmentApplied {
+			return s.apply(ctx, tr, adjustment, reviewer)
+		}
+
+		now := s.now()
+		adjustment.Status = model.AdjustmentRejected
+		adjustment.DecidedAt = &now
+
+		if err = tr.UpdateAdjustment(ctx, adjustment); err != nil {
+			return err
+		}
+
+		return auditAdjustment(ctx, tr, adjustment, reviewer, model.AuditAdjustmentRejected,
+			map[string]string{"comment": comment})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adjustment, nil
+}
+
+// apply books adjustment as a transaction of the manual source type. It moves real money only
+// and is subject to the same balance invariants as any other transaction, but not to the loss
+// limits, the bonus wagering or the status of the user.
+func (s *AdjustmentServiceImpl) apply(
+	ctx context.Context,
+	tr repository.Repository,
+	adjustment *model.ManualAdjustment,
+	operator model.Operator,
+) error {
+	tx := adjustment.Transaction()
+
+	delta, err := tx.BalanceDelta()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAdjustment, err)
+	}
+
+	wallet, err := tr.UpdateWalletBalance(ctx, tx.UserID, tx.Currency, delta)
+	if err != nil {
+		return fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+
+	// The balance update locks the wallet, so a rollback sent for the same ID is visible here.
+	if _, err = tr.GetRollbackByOriginalID(ctx, tx.ID); err == nil {
+		return fmt.Errorf("%w: transaction %s", ErrTransactionRolledBack, tx.ID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to check rollback of transaction %s: %w", tx.ID, err)
+	}
+
+	tx.BalanceAfter = decimal.NewNullDecimal(wallet.Total())
+
+	if err = tr.InsertTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	if err = postTransactionEntry(ctx, tr, tx, tx.SourceType, delta, decimal.Zero,
+		fmt.Sprintf("manual %s: %s", adjustment.Type, adjustment.ReasonCode)); err != nil {
+		return err
+	}
+
+	now := s.now()
+	adjustment.Status = model.AdjustmentApplied
+	adjustment.DecidedAt = &now
+
+	if err = tr.UpdateAdjustment(ctx, adjustment); err != nil {
+		return err
+	}
+
+	details := map[string]string{"balanceAfter": wallet.Balance.StringFixed(2)}
+	if adjustment.ReviewComment != "" {
+		details["comment"] = adjustment.ReviewComment
+	}
+
+	return auditAdjustment(ctx, tr, adjustment, operator, model.AuditAdjustmentApplied, details)
+}
+
+// validateAdjustment checks the fields of a requested adjustment that the model types do not guarantee.
+func validateAdjustment(adjustment *model.ManualAdjustment) error {
+	switch {
+	case adjustment.ID == uuid.Nil:
+		return fmt.Errorf("%w: transaction ID cannot be nil", ErrInvalidAdjustment)
+	case !adjustment.Amount.IsPositive() || !adjustment.Amount.Equal(adjustment.Amount.Truncate(rules.MaxDecimalPlaces)):
+		return fmt.Errorf("%w: amount must be positive with at most %d decimal places",
+			ErrInvalidAdjustment, rules.MaxDecimalPlaces)
+	case strings.TrimSpace(adjustment.Comment) == "":
+		return fmt.Errorf("%w: comment is required", ErrInvalidAdjustment)
+	case strings.TrimSpace(adjustment.RequestedBy) == "":
+		return fmt.Errorf("%w: operator is required", ErrInvalidAdjustment)
+	}
+
+	return nil
+}
+
+// replayAdjustment returns the already stored adjustment existing if adjustment is a retry
+// of it, and an ErrDuplicateTransaction otherwise.
+func replayAdjustment(existing, adjustment *model.ManualAdjustment) (*model.ManualAdjustment, error) {
+	if !existing.SamePayload(adjustment) {
+		return nil, fmt.Errorf(
+			"%w: adjustment %s was already requested with a different payload",
+			ErrDuplicateTransaction,
+			adjustment.ID,
+		)
+	}
+
+	return existing, nil
+}
+
+// auditAdjustment records action of operator on adjustment in the audit log, together with the
+// API key the operator acted with.
+func auditAdjustment(
+	ctx context.Context,
+	tr repository.Repository,
+	adjustment *model.ManualAdjustment,
+	operator model.Operator,
+	action model.AuditAction,
+	details map[string]string,
+) error {
+	if operator.KeyID != uuid.Nil {
+		details["apiKeyId"] = operator.KeyID.String()
+	}
+
+	event := &model.AuditEvent{
+		Operator:    operator.Name,
+		Action:      action,
+		SubjectType: adjustmentSubject,
+		SubjectID:   adjustment.ID.String(),
+		Details:     details,
+	}
+
+	if err := tr.InsertAuditEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Errors returned by APIKeyService and the API key checks.
+var (
+	ErrAPIKeyNotFound = repository.ErrAPIKeyNotFound
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	// ErrAPIKeyRevoked is returned when a revoked key is rotated.
+	ErrAPIKeyRevoked = errors.New("API key revoked")
+	// ErrUnauthenticated is returned for requests without an active API key of an enabled provider.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInsufficientScope is returned for requests whose API key does not grant the required scope.
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+const (
+	// DefaultAPIKeyCacheTTL is how long an API key is cached before it is read again. Revoking a key
+	// takes effect at once on the instance that revoked it and after at most this long on the others.
+	DefaultAPIKeyCacheTTL = 30 * time.Second
+	// apiKeyBytes is the number of random bytes of a generated key.
+	apiKeyBytes = 32
+	// apiKeyPrefix starts every key, so that leaked keys are easy to find.
+	apiKeyPrefix = "wk_"
+	// apiKeyVisiblePrefixLength is the number of characters of a key kept as its prefix.
+	apiKeyVisiblePrefixLength = len(apiKeyPrefix) + 8
+	// lastUsedResolution is how often the last use of a key is written at most.
+	lastUsedResolution = time.Minute
+)
+
+// APIKeyService issues the bearer API keys of providers and authenticates requests with them.
+type APIKeyService interface {
+	// Authenticate returns the active API key matching key together with its enabled provider, or
+	// ErrUnauthenticated, and records the use of the key.
+	Authenticate(ctx context.Context, key string) (*model.APIKey, *model.Provider, error)
+	// IssueAPIKey creates a key of provider granting scopes. The returned string is the key itself,
+	// which is not stored and cannot be shown again.
+	IssueAPIKey(ctx context.Context, provider string, scopes []model.APIKeyScope) (*model.APIKey, string, error)
+	// RotateAPIKey revokes the key id and issues a new key of the same provider and scopes. Keys of
+	// providers other than provider are not found, unless provider is empty.
+	RotateAPIKey(ctx context.Context, id uuid.UUID, provider string) (*model.APIKey, string, error)
+	// RevokeAPIKey revokes the key id like RotateAPIKey. Revoking a revoked key returns it unchanged.
+	RevokeAPIKey(ctx context.Context, id uuid.UUID, provider string) (*model.APIKey, error)
+	// ListAPIKeys returns the keys of provider, newest first.
+	ListAPIKeys(ctx context.Context, provider string) ([]model.APIKey, error)
+}
+
+// APIKeyServiceImpl caches keys in memory by their hash. Unknown keys are not cached, so that new
+// keys are accepted right away.
+type APIKeyServiceImpl struct {
+	repo      repository.Repository
+	providers ProviderService
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	key      *model.APIKey
+	loadedAt time.Time
+}
+
+// NewAPIKeyService creates a service caching keys for ttl. A zero TTL disables caching.
+func NewAPIKeyService(repo repository.Repository, providers ProviderService, ttl time.Duration) *APIKeyServiceImpl {
+	return &APIKeyServiceImpl{
+		repo:      repo,
+		providers: providers,
+		ttl:       ttl,
+		now:       time.Now,
+		cache:     map[string]cachedAPIKey{},
+	}
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 of key. Keys are random enough that a fast hash
+// cannot be brute-forced.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *APIKeyServiceImpl) Authenticate(ctx context.Context, key string) (*model.APIKey, *model.Provider, error) {
+	hash := hashAPIKey(key)
+	now := s.now()
+
+	s.mu.Lock()
+	cached, ok := s.cache[hash]
+	s.mu.Unlock()
+
+	if !ok || now.Sub(cached.loadedAt) >= s.ttl {
+		apiKey, err := s.repo.GetAPIKeyByHash(ctx, hash)
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, nil, fmt.Errorf("%w: unknown API key", ErrUnauthenticated)
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		cached = cachedAPIKey{key: apiKey, loadedAt: now}
+	}
+
+	apiKey := cached.key
+	if apiKey.Revoked() {
+		return nil, nil, fmt.Errorf("%w: API key was revoked", ErrUnauthenticated)
+	}
+
+	provider, err := s.providers.GetProvider(ctx, apiKey.Provider)
+	if errors.Is(err, ErrProviderNotFound) {
+		return nil, nil, fmt.Errorf("%w: provider %s is disabled", ErrUnauthenticated, apiKey.Provider)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		// The last use is informational, failing to record it must not fail the request.
+		if err = s.repo.TouchAPIKey(ctx, apiKey.ID, now); err == nil {
+			touched := *apiKey
+			touched.LastUsedAt = &now
+			cached.key = &touched
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[hash] = cached
+	s.mu.Unlock()
+
+	return apiKey, provider, nil
+}
+
+func (s *APIKeyServiceImpl) IssueAPIKey(
+	ctx context.Context,
+	provider string,
+	scopes []model.APIKeyScope,
+) (*model.APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+
+	for _, scope := range scopes {
+		if _, err := model.ToAPIKeyScope(string(scope)); err != nil {
+			return nil, "", fmt.Errorf("%w: %w", ErrInvalidAPIKey, err)
+		}
+	}
+
+	return s.issue(ctx, s.repo, provider, scopes)
+}
+
+// issue generates and stores a new key of provider.
+func (s *APIKeyServiceImpl) issue(
+	ctx context.Context,
+	repo repository.Repository,
+	provider string,
+	scopes []model.APIKeyScope,
+) (*model.APIKey, string, error) {
+	random := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key := apiKeyPrefix + hex.EncodeToString(random)
+	apiKey := &model.APIKey{
+		ID:       uuid.New(),
+		Provider: provider,
+		Prefix:   key[:apiKeyVisiblePrefixLength],
+		Hash:     hashAPIKey(key),
+		Scopes:   scopes,
+	}
+
+	if err := repo.InsertAPIKey(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+func (s *APIKeyServiceImpl) RotateAPIKey(
+	ctx context.Context,
+	id uuid.UUID,
+	provider string,
+) (*model.APIKey, string, error) {
+	var (
+		rotated *model.APIKey
+		key     string
+	)
+
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, repo repository.Repository) error {
+		old, err := s.revoke(ctx, repo, id, provider)
+		if err != nil {
+			return err
+		}
+
+		rotated, key, err = s.issue(ctx, repo, old.Provider, old.Scopes)
+
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.forget(id)
+
+	return rotated, key, nil
+}
+
+func (s *APIKeyServiceImpl) RevokeAPIKey(ctx context.Context, id uuid.UUID, provider string) (*model.APIKey, error) {
+	var revoked *model.APIKey
+
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, repo repository.Repository) error {
+		var err error
+		if revoked, err = s.revoke(ctx, repo, id, provider); errors.Is(err, ErrAPIKeyRevoked) {
+			return nil
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.forget(id)
+
+	return revoked, nil
+}
+
+// revoke revokes the key id of provider, or of any provider if provider is empty. It returns the
+// key together with ErrAPIKeyRevoked if the key was revoked before.
+func (s *APIKeyServiceImpl) revoke(
+	ctx context.Context,
+	repo repository.Repository,
+	id uuid.UUID,
+	provider string,
+) (*model.APIKey, error) {
+	apiKey, err := repo.LockAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not reveal keys of other providers.
+	if provider != "" && apiKey.Provider != provider {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	if apiKey.Revoked() {
+		return apiKey, fmt.Errorf("%w: API key %s was revoked at %s", ErrAPIKeyRevoked, id, apiKey.RevokedAt)
+	}
+
+	now := s.now()
+	apiKey.RevokedAt = &now
+
+	if err = repo.RevokeAPIKey(ctx, apiKey); err != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+// forget drops the key id from the cache, so that its revocation takes effect at once.
+func (s *APIKeyServiceImpl) forget(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, cached := range s.cache {
+		if cached.key.ID == id {
+			delete(s.cache, hash)
+		}
+	}
+}
+
+func (s *APIKeyServiceImpl) ListAPIKeys(ctx context.Context, provider string) ([]model.APIKey, error) {
+	if _, err := s.repo.GetProvider(ctx, provider); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListAPIKeys(ctx, provider)
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrInvalidBonus is returned for a bonus grant with an invalid amount or wagering requirement.
+	ErrInvalidBonus       = errors.New("invalid bonus")
+	ErrBonusGrantNotFound = repository.ErrBonusGrantNotFound
+)
+
+// BonusService grants bonus money to users.
+type BonusService interface {
+	// GrantBonus credits the amount of grant to the bonus balance of its user in its currency, or in
+	// the default currency if it is empty. The bonus becomes real money once the user staked its
+	// wagering requirement in lose transactions of that currency. A grant retried with the same
+	// GrantID returns the stored grant, a different payload under that GrantID ErrDuplicateTransaction.
+	GrantBonus(ctx context.Context, grant *model.BonusGrant) (*model.BonusGrant, error)
+	// ListBonusGrants returns all bonus grants of userID with their wagering progress, newest first.
+	ListBonusGrants(ctx context.Context, userID int) ([]model.BonusGrant, error)
+}
+
+type BonusServiceImpl struct {
+	repo            repository.Repository
+	defaultCurrency model.Currency
+}
+
+func NewBonusService(repo repository.Repository, defaultCurrency model.Currency) *BonusServiceImpl {
+	return &BonusServiceImpl{repo: repo, defaultCurrency: defaultCurrency}
+}
+
+func (s *BonusServiceImpl) GrantBonus(ctx context.Context, grant *model.BonusGrant) (*model.BonusGrant, error) {
+	if grant.GrantID == uuid.Nil {
+		return nil, fmt.Errorf("%w: grant ID is required", ErrInvalidBonus)
+	}
+
+	if !grant.Amount.IsPositive() || !grant.Amount.Equal(grant.Amount.Truncate(rules.MaxDecimalPlaces)) {
+		return nil, fmt.Errorf("%w: amount must be positive with at most %d decimal places",
+			ErrInvalidBonus, rules.MaxDecimalPlaces)
+	}
+
+	if !grant.WageringRequirement.IsPositive() ||
+		!grant.WageringRequirement.Equal(grant.WageringRequirement.Truncate(rules.MaxDecimalPlaces)) {
+		return nil, fmt.Errorf("%w: wagering requirement must be positive with at most %d decimal places",
+			ErrInvalidBonus, rules.MaxDecimalPlaces)
+	}
+
+	if grant.Currency == "" {
+		grant.Currency = s.defaultCurrency
+	}
+
+	existing, err := s.repo.GetBonusGrant(ctx, grant.GrantID)
+	if err == nil {
+		return replayBonusGrant(existing, grant)
+	}
+
+	if !errors.Is(err, ErrBonusGrantNotFound) {
+		return nil, fmt.Errorf("failed to check existence of bonus grant %s: %w", grant.GrantID, err)
+	}
+
+	err = s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		return grantBonus(ctx, tr, grant)
+	})
+	if errors.Is(err, ErrDuplicateTransaction) {
+		// A concurrent request with the same grant ID may have committed first, answer with its outcome.
+		if existing, getErr := s.repo.GetBonusGrant(ctx, grant.GrantID); getErr == nil {
+			return replayBonusGrant(existing, grant)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// grantBonus credits grant to the bonus balance of its user, who has to be active.
+func grantBonus(ctx context.Context, tr repository.Repository, grant *model.BonusGrant) error {
+	status, err := tr.LockUserStatus(ctx, grant.UserID)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case model.UserStatusSuspended:
+		return fmt.Errorf("%w: user %d cannot be granted bonuses", ErrUserSuspended, grant.UserID)
+	case model.UserStatusClosed:
+		return fmt.Errorf("%w: user %d cannot be granted bonuses", ErrUserClosed, grant.UserID)
+	}
+
+	if _, err = tr.UpdateWalletBonusBalance(ctx, grant.UserID, grant.Currency, grant.Amount); err != nil {
+		return err
+	}
+
+	if err = tr.InsertBonusGrant(ctx, grant); err != nil {
+		return err
+	}
+
+	return postBonusEntry(ctx, tr, grant, model.PromotionAccount(grant.Currency), grant.Amount,
+		fmt.Sprintf("bonus grant %d", grant.ID))
+}
+
+// replayBonusGrant answers a retry of the existing grant, or rejects a reuse of its grant ID.
+func replayBonusGrant(existing, grant *model.BonusGrant) (*model.BonusGrant, error) {
+	if !existing.SamePayload(grant) {
+		return nil, fmt.Errorf(
+			"%w: bonus grant %s was already made with a different payload",
+			ErrDuplicateTransaction,
+			grant.GrantID,
+		)
+	}
+
+	return existing, nil
+}
+
+func (s *BonusServiceImpl) ListBonusGrants(ctx context.Context, userID int) ([]model.BonusGrant, error) {
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListBonusGrants(ctx, userID)
+}
+
+// wagerBonusGrants counts the stake of the lose transaction tx towards the active bonus grants of
+// its wallet, oldest first, and converts the grants whose requirement is met to real money. Once the
+// bonus balance is used up, the remaining grants are forfeited. wallet is the wallet after tx was
+// paid; the wallet after the conversions is returned.
+func wagerBonusGrants(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+	wallet *model.Wallet,
+	now time.Time,
+) (*model.Wallet, error) {
+	// Without bonus money before tx there is nothing to wager for.
+	if wallet.BonusBalance.IsZero() && tx.BonusAmount.IsZero() {
+		return wallet, nil
+	}
+
+	grants, err := tr.LockActiveBonusGrants(ctx, tx.UserID, tx.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bonus grants: %w", err)
+	}
+
+	stake := tx.Amount
+
+	for i := range grants {
+		grant := &grants[i]
+		wagered := grant.Wagered
+		stake = grant.Wager(stake)
+
+		switch {
+		case grant.Complete():
+			converted := decimal.Min(grant.Amount, wallet.BonusBalance)
+			if converted.IsPositive() {
+				if wallet, err = convertBonus(ctx, tr, grant, converted); err != nil {
+					return nil, err
+				}
+			}
+
+			grant.Status = model.BonusGrantConverted
+			grant.ConvertedAmount = decimal.NewNullDecimal(converted)
+			grant.CompletedAt = &now
+		case wallet.BonusBalance.IsZero():
+			grant.Status = model.BonusGrantForfeited
+			grant.CompletedAt = &now
+		case grant.Wagered.Equal(wagered):
+			continue
+		}
+
+		if err = tr.UpdateBonusGrant(ctx, grant); err != nil {
+			return nil, err
+		}
+	}
+
+	return wallet, nil
+}
+
+// convertBonus moves amount of the bonus balance of the wallet of grant to its real balance.
+func convertBonus(
+	ctx context.Context,
+	tr repository.Repository,
+	grant *model.BonusGrant,
+	amount decimal.Decimal,
+) (*model.Wallet, error) {
+	if _, err := tr.UpdateWalletBonusBalance(ctx, grant.UserID, grant.Currency, amount.Neg()); err != nil {
+		return nil, fmt.Errorf("failed to convert bonus grant %d: %w", grant.ID, err)
+	}
+
+	wallet, err := tr.UpdateWalletBalance(ctx, grant.UserID, grant.Currency, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert bonus grant %d: %w", grant.ID, err)
+	}
+
+	account := model.WalletAccount(grant.UserID, grant.Currency)
+	if err = postBonusEntry(ctx, tr, grant, account, amount.Neg(),
+		fmt.Sprintf("conversion of bonus grant %d", grant.ID)); err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// postBonusEntry books delta on the bonus account of the wallet of grant against counterAccount.
+func postBonusEntry(
+	ctx context.Context,
+	tr repository.Repository,
+	grant *model.BonusGrant,
+	counterAccount model.LedgerAccount,
+	delta decimal.Decimal,
+	description string,
+) error {
+	entry := &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{Account: model.BonusAccount(grant.UserID, grant.Currency), Amount: delta},
+			{Account: counterAccount, Amount: delta.Neg()},
+		},
+	}
+
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBonus, err)
+	}
+
+	if err := tr.PostJournalEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to post journal entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+)
+
+// Names of the readiness checks.
+const (
+	HealthCheckShutdown   = "shutdown"
+	HealthCheckDatabase   = "database"
+	HealthCheckMigrations = "migrations"
+	HealthCheckPool       = "connection_pool"
+)
+
+// DefaultHealthCheckTimeout bounds the database checks of a readiness probe.
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// HealthService tells whether the service can take traffic.
+type HealthService interface {
+	// Readiness checks the database, the schema version and the connection pool. Once Drain was
+	// called the report fails, whatever the state of the dependencies.
+	Readiness(ctx context.Context) *model.HealthReport
+	// Drain marks the service as shutting down, so that load balancers stop sending traffic.
+	Drain()
+}
+
+type HealthServiceImpl struct {
+	repo          repository.Repository
+	schemaVersion uint
+	timeout       time.Duration
+	now           func() time.Time
+
+	draining atomic.Bool
+}
+
+// NewHealthService creates a health service expecting the database at schemaVersion, the version of
+// the last migration shipped with the binary. Database checks time out after timeout.
+func NewHealthService(repo repository.Repository, schemaVersion uint, timeout time.Duration) *HealthServiceImpl {
+	return &HealthServiceImpl{
+		repo:          repo,
+		schemaVersion: schemaVersion,
+		timeout:       timeout,
+		now:           time.Now,
+	}
+}
+
+func (s *HealthServiceImpl) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *HealthServiceImpl) Readiness(ctx context.Context) *model.HealthReport {
+	report := &model.HealthReport{}
+
+	if s.draining.Load() {
+		report.Checks = append(report.Checks, model.HealthCheck{
+			Name:    HealthCheckShutdown,
+			Status:  model.HealthFail,
+			Message: "shutting down",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	database := s.check(HealthCheckDatabase, func() (model.HealthStatus, string) {
+		if err := s.repo.Ping(ctx); err != nil {
+			return model.HealthFail, err.Error()
+		}
+
+		return model.HealthPass, ""
+	})
+	report.Checks = append(report.Checks, database)
+
+	if database.Status == model.HealthFail {
+		report.Checks = append(report.Checks, model.HealthCheck{
+			Name:    HealthCheckMigrations,
+			Status:  model.HealthFail,
+			Message: "database unreachable",
+		})
+	} else {
+		report.Checks = append(report.Checks, s.check(HealthCheckMigrations, func() (model.HealthStatus, string) {
+			return s.checkSchemaVersion(ctx)
+		}))
+	}
+
+	report.Checks = append(report.Checks, s.check(HealthCheckPool, s.checkPool))
+
+	return report
+}
+
+// check runs fn and times it.
+func (s *HealthServiceImpl) check(name string, fn func() (model.HealthStatus, string)) model.HealthCheck {
+	start := s.now()
+	status, message := fn()
+
+	return model.HealthCheck{Name: name, Status: status, Latency: s.now().Sub(start), Message: message}
+}
+
+// checkSchemaVersion fails unless the last migration shipped with the binary was applied completely.
+// A newer schema only warns: during a rolling deployment instances of the previous release keep
+// serving after the new release migrated the database, and migrations are kept backwards compatible
+// for that.
+func (s *HealthServiceImpl) checkSchemaVersion(ctx context.Context) (model.HealthStatus, string) {
+	version, dirty, err := s.repo.SchemaVersion(ctx)
+	if err != nil {
+		return model.HealthFail, err.Error()
+	}
+
+	switch {
+	case dirty:
+		return model.HealthFail, fmt.Sprintf("migration %d failed halfway", version)
+	case version < s.schemaVersion:
+		return model.HealthFail, fmt.Sprintf("schema version %d, expected %d", version, s.schemaVersion)
+	case version > s.schemaVersion:
+		return model.HealthWarn, fmt.Sprintf("schema version %d is newer than %d", version, s.schemaVersion)
+	default:
+		return model.HealthPass, fmt.Sprintf("schema version %d", version)
+	}
+}
+
+// checkPool warns once every connection of a bounded pool is in use, requests wait for a connection
+// then.
+func (s *HealthServiceImpl) checkPool() (model.HealthStatus, string) {
+	stats := s.repo.PoolStats()
+
+	if stats.MaxOpenConnections <= 0 {
+		return model.HealthPass, fmt.Sprintf("%d connections in use, %d idle, unbounded", stats.InUse, stats.Idle)
+	}
+
+	message := fmt.Sprintf("%d of %d connections in use, %d idle, %d waits so far",
+		stats.InUse, stats.MaxOpenConnections, stats.Idle, stats.WaitCount)
+
+	if stats.InUse >= stats.MaxOpenConnections {
+		return model.HealthWarn, message
+	}
+
+	return model.HealthPass, message
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+// Errors returned for user limits.
+var (
+	ErrUserLimitNotFound = repository.ErrUserLimitNotFound
+	ErrInvalidLimit      = errors.New("invalid limit")
+	// ErrLossLimitExceeded is returned for a lose transaction that would exceed a loss limit of the user.
+	ErrLossLimitExceeded = errors.New("loss limit exceeded")
+)
+
+// LimitCoolingOff is how long an increase or removal of a limit is deferred. Decreases apply immediately.
+const LimitCoolingOff = 24 * time.Hour
+
+// LimitService manages the responsible gaming loss limits of users.
+type LimitService interface {
+	// ListLimits returns the limits in force for userID, with their pending changes.
+	ListLimits(ctx context.Context, userID int) ([]model.UserLimit, error)
+	// SetLimit sets the limit of userID in currency, or in the default currency if it is empty.
+	// A new or lower limit applies immediately, a higher one after LimitCoolingOff.
+	SetLimit(
+		ctx context.Context,
+		userID int,
+		currency model.Currency,
+		period model.LimitPeriod,
+		amount decimal.Decimal,
+	) (*model.UserLimit, error)
+	// RemoveLimit removes the limit after LimitCoolingOff and returns it with the pending removal.
+	// It returns ErrUserLimitNotFound if there is no limit in force.
+	RemoveLimit(
+		ctx context.Context,
+		userID int,
+		currency model.Currency,
+		period model.LimitPeriod,
+	) (*model.UserLimit, error)
+}
+
+type LimitServiceImpl struct {
+	repo            repository.Repository
+	defaultCurrency model.Currency
+	now             func() time.Time
+}
+
+func NewLimitService(repo repository.Repository, defaultCurrency model.Currency) *LimitServiceImpl {
+	return &LimitServiceImpl{repo: repo, defaultCurrency: defaultCurrency, now: time.Now}
+}
+
+func (s *LimitServiceImpl) ListLimits(ctx context.Context, userID int) ([]model.UserLimit, error) {
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.ListUserLimits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	limits := make([]model.UserLimit, 0, len(stored))
+
+	for _, limit := range stored {
+		if limit, ok := limit.At(now); ok {
+			limits = append(limits, limit)
+		}
+	}
+
+	return limits, nil
+}
+
+func (s *LimitServiceImpl) SetLimit(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+	amount decimal.Decimal,
+) (*model.UserLimit, error) {
+	if amount.IsNegative() {
+		return nil, fmt.Errorf("%w: amount must not be negative", ErrInvalidLimit)
+	}
+
+	return s.changeLimit(ctx, userID, currency, period, decimal.NewNullDecimal(amount))
+}
+
+func (s *LimitServiceImpl) RemoveLimit(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+) (*model.UserLimit, error) {
+	return s.changeLimit(ctx, userID, currency, period, decimal.NullDecimal{})
+}
+
+// changeLimit changes the limit to amount, or removes it if amount is not valid. Changes that
+// loosen the limit are stored as pending until the cooling-off period has passed.
+func (s *LimitServiceImpl) changeLimit(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+	amount decimal.NullDecimal,
+) (*model.UserLimit, error) {
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	var limit *model.UserLimit
+
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		if _, err := tr.GetWallet(ctx, userID, currency); err != nil {
+			return err
+		}
+
+		stored, err := tr.LockUserLimit(ctx, userID, currency, period)
+		if err != nil && !errors.Is(err, ErrUserLimitNotFound) {
+			return err
+		}
+
+		now := s.now()
+
+		var inForce *model.UserLimit
+		if stored != nil {
+			if current, ok := stored.At(now); ok {
+				inForce = &current
+			}
+		}
+
+		switch {
+		case inForce == nil && !amount.Valid:
+			return ErrUserLimitNotFound
+		case inForce == nil || (amount.Valid && amount.Decimal.LessThanOrEqual(inForce.Amount)):
+			// Tightening a limit also cancels a pending increase.
+			limit = &model.UserLimit{UserID: userID, Currency: currency, Period: period, Amount: amount.Decimal}
+		default:
+			from := now.Add(LimitCoolingOff)
+			limit = inForce
+			limit.PendingAmount = amount
+			limit.PendingFrom = &from
+		}
+
+		return tr.SaveUserLimit(ctx, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return limit, nil
+}
+
+// checkLossLimits rejects the lose transaction tx if the net loss of its user would exceed a limit.
+// held is the money of the wallet held by open reservations, which counts as lost until they are
+// released. It must be called while the wallet of tx is locked, so that concurrent transactions of
+// the user are counted one after another.
+func checkLossLimits(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+	held decimal.Decimal,
+	now time.Time,
+) error {
+	limits, err := tr.ListUserLimits(ctx, tx.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load limits: %w", err)
+	}
+
+	for _, limit := range limits {
+		if limit.Currency != tx.Currency {
+			continue
+		}
+
+		limit, ok := limit.At(now)
+		if !ok {
+			continue
+		}
+
+		netLoss, err := tr.GetNetLoss(ctx, tx.UserID, tx.Currency, now.Add(-limit.Period.Window()))
+		if err != nil {
+			return fmt.Errorf("failed to get net loss: %w", err)
+		}
+
+		if netLoss.Add(held).Add(tx.Amount).GreaterThan(limit.Amount) {
+			return fmt.Errorf("%w: %s limit of %s %s", ErrLossLimitExceeded, limit.Period,
+				limit.Amount.StringFixed(2), limit.Currency)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+)
+
+// NonceService remembers the nonces of verified requests until their timestamp leaves the accepted
+// window; a replay after that is rejected for its age.
+type NonceService interface {
+	// Use records key until expiresAt and reports whether it was not recorded yet, or has expired by
+	// now.
+	Use(ctx context.Context, key string, expiresAt, now time.Time) (bool, error)
+	// Sweep drops the expired nonces and returns how many there were.
+	Sweep(ctx context.Context) (int, error)
+}
+
+// LocalNonceService keeps the nonces in memory. Every instance only knows the nonces it has seen
+// itself, so with more than one instance a request can be replayed once against every other
+// instance within the accepted window. Use NonceServiceImpl for more than one instance.
+type LocalNonceService struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	expiries map[string]time.Time
+}
+
+func NewLocalNonceService() *LocalNonceService {
+	return &LocalNonceService{now: time.Now, expiries: map[string]time.Time{}}
+}
+
+func (s *LocalNonceService) Use(_ context.Context, key string, expiresAt, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expiry, ok := s.expiries[key]; ok && expiry.After(now) {
+		return false, nil
+	}
+
+	s.expiries[key] = expiresAt
+
+	return true, nil
+}
+
+func (s *LocalNonceService) Sweep(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	swept := 0
+
+	for key, expiry := range s.expiries {
+		if !expiry.After(now) {
+			delete(s.expiries, key)
+			swept++
+		}
+	}
+
+	return swept, nil
+}
+
+// NonceServiceImpl keeps the nonces in the database, so that a request is accepted by one instance
+// at most, at the cost of a database write per signed request.
+type NonceServiceImpl struct {
+	repo repository.Repository
+	now  func() time.Time
+}
+
+func NewNonceService(repo repository.Repository) *NonceServiceImpl {
+	return &NonceServiceImpl{repo: repo, now: time.Now}
+}
+
+func (s *NonceServiceImpl) Use(ctx context.Context, key string, expiresAt, now time.Time) (bool, error) {
+	return s.repo.InsertNonce(ctx, key, expiresAt, now)
+}
+
+func (s *NonceServiceImpl) Sweep(ctx context.Context) (int, error) {
+	return s.repo.DeleteNonces(ctx, s.now())
+}
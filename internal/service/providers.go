@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+)
+
+// Errors returned by ProviderService and the request signature checks.
+var (
+	ErrProviderNotFound = repository.ErrProviderNotFound
+	ErrProviderExists   = repository.ErrProviderExists
+	ErrInvalidProvider  = errors.New("invalid provider")
+	// ErrInvalidSignature is returned for requests that are not signed by an enabled provider,
+	// are signed with a wrong key, are too old or replay an earlier request.
+	ErrInvalidSignature = errors.New("invalid request signature")
+	// ErrSourceTypeForbidden is returned for transactions of a source type their provider is not registered for.
+	ErrSourceTypeForbidden = errors.New("source type not allowed for provider")
+)
+
+// DefaultProviderCacheTTL is how long a provider is cached before it is read again. Disabling a
+// provider takes effect after at most this long.
+const DefaultProviderCacheTTL = 30 * time.Second
+
+// providerSecretBytes is the number of random bytes of a generated secret.
+const providerSecretBytes = 32
+
+// ProviderService manages the providers that send signed transactions.
+type ProviderService interface {
+	// GetProvider returns the enabled provider name. Unknown and disabled providers are reported
+	// as ErrProviderNotFound.
+	GetProvider(ctx context.Context, name string) (*model.Provider, error)
+	// CreateProvider registers a provider of the given source types with a new random secret.
+	CreateProvider(ctx context.Context, name string, sourceTypes []model.SourceType) (*model.Provider, error)
+}
+
+// ProviderServiceImpl caches providers in memory. Unknown providers are not cached, so that
+// newly registered providers are accepted right away.
+type ProviderServiceImpl struct {
+	repo    repository.Repository
+	ttl     time.Duration
+	secrets *SecretCipher
+
+	mu    sync.RWMutex
+	cache map[string]cachedProvider
+}
+
+type cachedProvider struct {
+	provider *model.Provider
+	loadedAt time.Time
+}
+
+// NewProviderService creates a service caching providers for ttl. A zero TTL disables caching.
+// Secrets are encrypted with secrets before they are stored, a nil cipher stores them in plaintext.
+func NewProviderService(repo repository.Repository, ttl time.Duration, secrets *SecretCipher) *ProviderServiceImpl {
+	return &ProviderServiceImpl{repo: repo, ttl: ttl, secrets: secrets, cache: map[string]cachedProvider{}}
+}
+
+func (s *ProviderServiceImpl) GetProvider(ctx context.Context, name string) (*model.Provider, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[name]
+	s.mu.RUnlock()
+
+	provider := cached.provider
+
+	if !ok || time.Since(cached.loadedAt) >= s.ttl {
+		var err error
+		if provider, err = s.repo.GetProvider(ctx, name); err != nil {
+			return nil, err
+		}
+
+		if provider.Secret, err = s.secrets.Open(name, provider.Secret); err != nil {
+			return nil, fmt.Errorf("failed to read secret of provider %s: %w", name, err)
+		}
+
+		s.mu.Lock()
+		s.cache[name] = cachedProvider{provider: provider, loadedAt: time.Now()}
+		s.mu.Unlock()
+	}
+
+	if !provider.Enabled {
+		return nil, fmt.Errorf("%w: provider %s is disabled", ErrProviderNotFound, name)
+	}
+
+	return provider, nil
+}
+
+func (s *ProviderServiceImpl) CreateProvider(
+	ctx context.Context,
+	name string,
+	sourceTypes []model.SourceType,
+) (*model.Provider, error) {
+	secret := make([]byte, providerSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	provider := &model.Provider{Name: name, Secret: hex.EncodeToString(secret), SourceTypes: sourceTypes}
+	if err := provider.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProvider, err)
+	}
+
+	registered, err := s.repo.ListSourceTypes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source types: %w", err)
+	}
+
+	known := make(map[model.SourceType]bool, len(registered))
+	for _, settings := range registered {
+		known[settings.Name] = true
+	}
+
+	for _, sourceType := range sourceTypes {
+		switch {
+		case sourceType == model.SourceTypeManual:
+			return nil, fmt.Errorf("%w: source type %s is reserved for operator adjustments",
+				ErrInvalidProvider, sourceType)
+		case !known[sourceType]:
+			return nil, fmt.Errorf("%w: unknown source type: %s", ErrInvalidProvider, sourceType)
+		}
+	}
+
+	stored := *provider
+	if stored.Secret, err = s.secrets.Seal(name, provider.Secret); err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	if err = s.repo.InsertProvider(ctx, &stored); err != nil {
+		return nil, err
+	}
+
+	provider.Enabled, provider.CreatedAt = stored.Enabled, stored.CreatedAt
+
+	return provider, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+)
+
+// ErrRateLimited is returned for requests over the rate limit of their provider or user.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitService keeps the token buckets of the rate limits.
+type RateLimitService interface {
+	// Take takes a token from every bucket of keys, whose limits are enabled, if each of them has one
+	// left, and returns the decisions in the order of keys. A request rejected by one bucket takes no
+	// token from the others.
+	Take(ctx context.Context, keys []model.RateLimitKey) ([]model.RateLimitDecision, error)
+	// Sweep drops the buckets unused for idle and returns how many there were. A bucket unused for
+	// longer than it takes to refill is full, so dropping it changes no decision.
+	Sweep(ctx context.Context, idle time.Duration) (int, error)
+}
+
+// LocalRateLimitService keeps the buckets in memory, so the limits hold per instance.
+type LocalRateLimitService struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*model.RateLimitBucket
+}
+
+func NewLocalRateLimitService() *LocalRateLimitService {
+	return &LocalRateLimitService{
+		now:     time.Now,
+		buckets: map[string]*model.RateLimitBucket{},
+	}
+}
+
+func (s *LocalRateLimitService) Take(
+	_ context.Context,
+	keys []model.RateLimitKey,
+) ([]model.RateLimitDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]*model.RateLimitBucket, len(keys))
+
+	for i, key := range keys {
+		bucket, ok := s.buckets[key.Key]
+		if !ok {
+			bucket = &model.RateLimitBucket{Key: key.Key}
+		}
+
+		buckets[i] = bucket
+	}
+
+	decisions, allowed := takeAll(buckets, keys, s.now())
+	if allowed {
+		for _, bucket := range buckets {
+			s.buckets[bucket.Key] = bucket
+		}
+	}
+
+	return decisions, nil
+}
+
+func (s *LocalRateLimitService) Sweep(_ context.Context, idle time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := s.now().Add(-idle)
+	swept := 0
+
+	for key, bucket := range s.buckets {
+		if bucket.UpdatedAt.Before(before) {
+			delete(s.buckets, key)
+			swept++
+		}
+	}
+
+	return swept, nil
+}
+
+// RateLimitServiceImpl keeps the buckets in the database, so that the limits hold across all
+// instances at the cost of a database transaction per request.
+type RateLimitServiceImpl struct {
+	repo repository.Repository
+	now  func() time.Time
+}
+
+func NewRateLimitService(repo repository.Repository) *RateLimitServiceImpl {
+	return &RateLimitServiceImpl{repo: repo, now: time.Now}
+}
+
+func (s *RateLimitServiceImpl) Take(
+	ctx context.Context,
+	keys []model.RateLimitKey,
+) ([]model.RateLimitDecision, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	// Buckets are locked in the order of their keys, so that requests sharing buckets cannot deadlock.
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+
+	slices.SortFunc(order, func(a, b int) int { return strings.Compare(keys[a].Key, keys[b].Key) })
+
+	var decisions []model.RateLimitDecision
+
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, repo repository.Repository) error {
+		buckets := make([]*model.RateLimitBucket, len(keys))
+
+		for _, i := range order {
+			bucket, err := repo.LockRateLimitBucket(ctx, keys[i].Key)
+			if errors.Is(err, repository.ErrRateLimitBucketNotFound) {
+				// Instances creating the same bucket at once both start it full and the last one saved
+				// wins, which lets at most one request per instance through on top of the burst.
+				bucket = &model.RateLimitBucket{Key: keys[i].Key}
+			} else if err != nil {
+				return err
+			}
+
+			buckets[i] = bucket
+		}
+
+		var allowed bool
+		if decisions, allowed = takeAll(buckets, keys, s.now()); !allowed {
+			return nil
+		}
+
+		for _, i := range order {
+			if err := repo.SaveRateLimitBucket(ctx, buckets[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
+
+// takeAll takes a token from each of buckets at the limit of the key at the same index, and reports
+// whether all of them allowed the request. The buckets are left unchanged unless they all did.
+func takeAll(
+	buckets []*model.RateLimitBucket,
+	keys []model.RateLimitKey,
+	now time.Time,
+) ([]model.RateLimitDecision, bool) {
+	taken := make([]model.RateLimitBucket, len(buckets))
+	decisions := make([]model.RateLimitDecision, len(buckets))
+	allowed := true
+
+	for i, bucket := range buckets {
+		taken[i] = *bucket
+		decisions[i] = taken[i].Take(keys[i].Limit, now)
+		allowed = allowed && decisions[i].Allowed
+	}
+
+	if allowed {
+		for i, bucket := range buckets {
+			*bucket = taken[i]
+		}
+	}
+
+	return decisions, allowed
+}
+
+func (s *RateLimitServiceImpl) Sweep(ctx context.Context, idle time.Duration) (int, error) {
+	return s.repo.DeleteRateLimitBuckets(ctx, s.now().Add(-idle))
+}
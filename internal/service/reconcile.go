@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+// ErrMissingReason is returned when drifted balances are to be corrected without an audit reason.
+var ErrMissingReason = errors.New("a reason is required to adjust balances")
+
+// Reconciler compares wallet balances with the balances they are expected to have. The expected
+// balances are recomputed from the opening balances and the history of transactions, bonus grants
+// and reservations, so a bug that books the same wrong amount on a wallet and in the ledger is
+// still found. The ledger is checked separately against the wallets.
+type Reconciler struct {
+	repo repository.Repository
+}
+
+func NewReconciler(repo repository.Repository) *Reconciler {
+	return &Reconciler{repo: repo}
+}
+
+// Reconcile reports all wallets whose balances drifted from their history or from the ledger. If
+// fix is set, the balances that drifted from the history are corrected to it, every correction is
+// recorded with reason and booked in the ledger. Failed corrections are reported per wallet. Drift
+// of the other wallets from the ledger is only reported, as their history does not tell whether
+// the wallet or the ledger is wrong.
+func (r *Reconciler) Reconcile(ctx context.Context, fix bool, reason string) (*model.ReconciliationReport, error) {
+	if fix && reason == "" {
+		return nil, ErrMissingReason
+	}
+
+	report := &model.ReconciliationReport{CheckedAt: time.Now().UTC()}
+
+	drifts, err := r.repo.FindBalanceDrifts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if report.LedgerDrifts, err = r.repo.FindLedgerDrifts(ctx); err != nil {
+		return nil, err
+	}
+
+	report.Drifts = drifts
+
+	if !fix {
+		return report, nil
+	}
+
+	for i := range report.Drifts {
+		drift := &report.Drifts[i]
+
+		if err = r.adjust(ctx, drift, reason); err != nil {
+			drift.Error = err.Error()
+			continue
+		}
+
+		drift.Adjusted = true
+	}
+
+	return report, nil
+}
+
+// adjust sets the balances of the wallet of drift and of its ledger accounts to its expected
+// balances. All of them are read again under the wallet lock, so a correction never races with a
+// transaction on the same wallet.
+func (r *Reconciler) adjust(ctx context.Context, drift *model.BalanceDrift, reason string) error {
+	return r.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		wallet, err := tr.LockWallet(ctx, drift.UserID, drift.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to lock wallet: %w", err)
+		}
+
+		actual := wallet.Balances()
+
+		expected, err := tr.GetExpectedBalances(ctx, drift.UserID, drift.Currency)
+		if err != nil {
+			return err
+		}
+
+		for _, balance := range []struct {
+			balanceType      model.BalanceType
+			actual, expected decimal.Decimal
+			update           func(context.Context, int, model.Currency, decimal.Decimal) (*model.Wallet, error)
+		}{
+			{model.BalanceReal, actual.Real, expected.Real, tr.UpdateWalletBalance},
+			{model.BalanceBonus, actual.Bonus, expected.Bonus, tr.UpdateWalletBonusBalance},
+			{model.BalanceHeld, actual.Held, expected.Held, tr.UpdateWalletHeldBalance},
+		} {
+			if balance.actual.Equal(balance.expected) {
+				continue
+			}
+
+			if _, err = balance.update(ctx, drift.UserID, drift.Currency, balance.expected.Sub(balance.actual)); err != nil {
+				return fmt.Errorf("failed to update wallet %s balance: %w", balance.balanceType, err)
+			}
+
+			if err = tr.InsertBalanceAdjustment(ctx, &model.BalanceAdjustment{
+				UserID:          drift.UserID,
+				Currency:        drift.Currency,
+				BalanceType:     balance.balanceType,
+				PreviousBalance: balance.actual,
+				NewBalance:      balance.expected,
+				Reason:          reason,
+			}); err != nil {
+				return err
+			}
+		}
+
+		ledger, err := tr.GetLedgerBalances(ctx, drift.UserID, drift.Currency)
+		if err != nil {
+			return err
+		}
+
+		return postCorrection(ctx, tr, drift.UserID, drift.Currency, expected.Sub(ledger), reason)
+	})
+}
+
+// postCorrection books the corrections of the ledger accounts of the wallet of userID in currency
+// against the equity account. The ledger may have booked a drift along with the wallet or not at
+// all, so the corrections bring the accounts to the expected balances rather than repeat the
+// corrections of the wallet.
+func postCorrection(
+	ctx context.Context,
+	tr repository.Repository,
+	userID int,
+	currency model.Currency,
+	correction model.Balances,
+	reason string,
+) error {
+	entry := &model.JournalEntry{Description: "reconciliation: " + reason}
+	total := decimal.Zero
+
+	for _, posting := range []model.Posting{
+		{Account: model.WalletAccount(userID, currency), Amount: correction.Real},
+		{Account: model.BonusAccount(userID, currency), Amount: correction.Bonus},
+		{Account: model.HeldAccount(userID, currency), Amount: correction.Held},
+	} {
+		if !posting.Amount.IsZero() {
+			entry.Postings = append(entry.Postings, posting)
+			total = total.Add(posting.Amount)
+		}
+	}
+
+	if len(entry.Postings) == 0 {
+		return nil
+	}
+
+	if !total.IsZero() {
+		entry.Postings = append(entry.Postings, model.Posting{Account: model.EquityAccount(currency), Amount: total.Neg()})
+	}
+
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("invalid correction entry: %w", err)
+	}
+
+	if err := tr.PostJournalEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to post journal entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,497 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Errors returned for reservations.
+var (
+	ErrReservationNotFound = repository.ErrReservationNotFound
+	// ErrReservationSettled is returned when a reservation is committed after it was released or
+	// expired, or released after it was committed.
+	ErrReservationSettled = errors.New("reservation already settled")
+	// ErrTransactionReserved is returned for a win or lose transaction sent with the ID of a reservation,
+	// which is settled under that ID by committing it.
+	ErrTransactionReserved = errors.New("transaction ID belongs to a reservation")
+)
+
+const (
+	// DefaultReservationTTL is how long a reservation is held unless configured otherwise.
+	DefaultReservationTTL = 15 * time.Minute
+	// expiryBatchSize caps the number of reservations released by one call of ExpireReservations.
+	expiryBatchSize = 100
+)
+
+// ReservationService places bets in two phases: a reservation holds the stake and is later
+// committed as a lose transaction or released back to the balance.
+type ReservationService interface {
+	// Reserve moves reservation.Amount from the real balance to the held balance of the wallet of
+	// the reservation, in the default currency if it has none. Retries return the stored
+	// reservation, while reusing its ID with a different payload returns ErrDuplicateTransaction.
+	Reserve(ctx context.Context, reservation *model.Reservation) (*model.Reservation, error)
+	// GetReservation returns the reservation with the given ID of userID.
+	GetReservation(ctx context.Context, userID int, id uuid.UUID) (*model.Reservation, error)
+	// Commit settles the held reservation as a lose transaction with the same ID. Retries return
+	// the stored transaction with Replayed set. Only provider, which placed the reservation, may
+	// commit it, and only before it expires.
+	Commit(ctx context.Context, userID int, id uuid.UUID, provider string) (*model.ProcessedTransaction, error)
+	// Release gives the held amount of the reservation back to the real balance. Releasing a
+	// released or expired reservation returns it unchanged. Only provider, which placed the
+	// reservation, may release it.
+	Release(ctx context.Context, userID int, id uuid.UUID, provider string) (*model.Reservation, error)
+	// ExpireReservations releases held reservations past their expiry and returns how many it released.
+	ExpireReservations(ctx context.Context) (int, error)
+}
+
+type ReservationServiceImpl struct {
+	repo            repository.Repository
+	sourceTypes     SourceTypeService
+	rules           *rules.Engine
+	defaultCurrency model.Currency
+	ttl             time.Duration
+	userStatuses    model.UserStatusPolicy
+	now             func() time.Time
+}
+
+// NewReservationService creates a service whose reservations expire after ttl, or after
+// DefaultReservationTTL if ttl is not positive. Reservations are checked against sourceTypes and
+// engine like the lose transactions they are committed as, and only accepted from users whose
+// status userStatuses allows to lose.
+func NewReservationService(
+	repo repository.Repository,
+	sourceTypes SourceTypeService,
+	engine *rules.Engine,
+	defaultCurrency model.Currency,
+	ttl time.Duration,
+	userStatuses model.UserStatusPolicy,
+) *ReservationServiceImpl {
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	return &ReservationServiceImpl{
+		repo:            repo,
+		sourceTypes:     sourceTypes,
+		rules:           engine,
+		defaultCurrency: defaultCurrency,
+		ttl:             ttl,
+		userStatuses:    userStatuses,
+		now:             time.Now,
+	}
+}
+
+func (s *ReservationServiceImpl) Reserve(
+	ctx context.Context,
+	reservation *model.Reservation,
+) (*model.Reservation, error) {
+	if reservation.Currency == "" {
+		reservation.Currency = s.defaultCurrency
+	}
+
+	if reservation.ID == uuid.Nil {
+		return nil, fmt.Errorf("%w: transaction ID cannot be nil", ErrInvalidTransaction)
+	}
+
+	if !reservation.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidTransaction)
+	}
+
+	tx := reservation.Transaction()
+	if err := s.sourceTypes.Check(ctx, tx.SourceType, tx.State); err != nil {
+		return nil, err
+	}
+
+	if err := s.rules.Evaluate(tx); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetReservation(ctx, reservation.ID)
+	if err == nil {
+		return replayReservation(existing, reservation)
+	}
+
+	if !errors.Is(err, ErrReservationNotFound) {
+		return nil, fmt.Errorf("failed to check existence of reservation %s: %w", reservation.ID, err)
+	}
+
+	err = s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		return s.hold(ctx, tr, reservation)
+	})
+	if errors.Is(err, ErrDuplicateTransaction) {
+		// A concurrent request with the same ID may have committed first, answer with its outcome.
+		if existing, getErr := s.repo.GetReservation(ctx, reservation.ID); getErr == nil {
+			return replayReservation(existing, reservation)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// hold moves the amount of reservation to the held balance of its wallet and stores it.
+// Held money counts towards the loss limits, so that open bets cannot exceed them together.
+func (s *ReservationServiceImpl) hold(
+	ctx context.Context,
+	tr repository.Repository,
+	reservation *model.Reservation,
+) error {
+	err := checkUserStatus(ctx, tr, s.userStatuses, reservation.UserID, model.TransactionStateLose)
+	if err != nil {
+		return err
+	}
+
+	wallet, err := tr.LockWallet(ctx, reservation.UserID, reservation.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	if _, err = tr.GetTransactionByID(ctx, reservation.ID); err == nil {
+		return fmt.Errorf("%w: transaction %s was already processed", ErrDuplicateTransaction, reservation.ID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to check existence of transaction %s: %w", reservation.ID, err)
+	}
+
+	if _, err = tr.GetRollbackByOriginalID(ctx, reservation.ID); err == nil {
+		return fmt.Errorf("%w: transaction %s", ErrTransactionRolledBack, reservation.ID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to check rollback of transaction %s: %w", reservation.ID, err)
+	}
+
+	now := s.now()
+
+	if err = checkLossLimits(ctx, tr, reservation.Transaction(), wallet.HeldBalance, now); err != nil {
+		return err
+	}
+
+	if _, err = tr.UpdateWalletBalance(ctx, reservation.UserID, reservation.Currency,
+		reservation.Amount.Neg()); err != nil {
+		return fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+
+	if _, err = tr.UpdateWalletHeldBalance(ctx, reservation.UserID, reservation.Currency,
+		reservation.Amount); err != nil {
+		return fmt.Errorf("failed to update wallet held balance: %w", err)
+	}
+
+	reservation.ExpiresAt = now.Add(s.ttl)
+
+	if err = tr.InsertReservation(ctx, reservation); err != nil {
+		return err
+	}
+
+	return postReservationEntry(ctx, tr, reservation, nil,
+		model.WalletAccount(reservation.UserID, reservation.Currency), reservation.Amount,
+		fmt.Sprintf("reservation %s", reservation.ID))
+}
+
+func (s *ReservationServiceImpl) GetReservation(
+	ctx context.Context,
+	userID int,
+	id uuid.UUID,
+) (*model.Reservation, error) {
+	reservation, err := s.repo.GetReservation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not reveal reservations of other users.
+	if reservation.UserID != userID {
+		return nil, ErrReservationNotFound
+	}
+
+	return reservation, nil
+}
+
+func (s *ReservationServiceImpl) Commit(
+	ctx context.Context,
+	userID int,
+	id uuid.UUID,
+	provider string,
+) (*model.ProcessedTransaction, error) {
+	reservation, err := s.providerReservation(ctx, userID, id, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	var processed *model.ProcessedTransaction
+
+	err = s.settle(ctx, reservation, func(ctx context.Context, tr repository.Repository, locked *model.Reservation) error {
+		switch locked.Status {
+		case model.ReservationHeld:
+			// A reservation past its expiry is released by the sweep and can no longer be committed.
+			if !s.now().Before(locked.ExpiresAt) {
+				return fmt.Errorf("%w: reservation %s expired at %s", ErrReservationSettled, id,
+					locked.ExpiresAt.Format(time.RFC3339))
+			}
+
+			tx, err := s.commit(ctx, tr, locked)
+			if err != nil {
+				return err
+			}
+
+			processed = newProcessedTransaction(tx, false)
+
+			return nil
+		case model.ReservationCommitted:
+			tx, err := tr.GetTransactionByID(ctx, id)
+			if err != nil {
+				return fmt.Errorf("failed to load transaction of reservation %s: %w", id, err)
+			}
+
+			processed = newProcessedTransaction(tx, true)
+
+			return nil
+		default:
+			return fmt.Errorf("%w: reservation %s was %s", ErrReservationSettled, id, locked.Status)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return processed, nil
+}
+
+// providerReservation returns the reservation with the given ID of userID, or an error wrapping
+// ErrSourceTypeForbidden if it was placed by a provider other than provider.
+func (s *ReservationServiceImpl) providerReservation(
+	ctx context.Context,
+	userID int,
+	id uuid.UUID,
+	provider string,
+) (*model.Reservation, error) {
+	reservation, err := s.GetReservation(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if reservation.Provider != provider {
+		return nil, fmt.Errorf("%w: reservation %s was placed by another provider", ErrSourceTypeForbidden, id)
+	}
+
+	return reservation, nil
+}
+
+// commit stores the lose transaction of the held reservation and takes its amount from the held balance.
+// The stake counts towards the wagering requirements of bonus grants like any lose.
+func (s *ReservationServiceImpl) commit(
+	ctx context.Context,
+	tr repository.Repository,
+	reservation *model.Reservation,
+) (*model.Transaction, error) {
+	tx := reservation.Transaction()
+
+	wallet, err := tr.UpdateWalletHeldBalance(ctx, tx.UserID, tx.Currency, tx.Amount.Neg())
+	if err != nil {
+		return nil, fmt.Errorf("failed to update wallet held balance: %w", err)
+	}
+
+	if _, err = tr.GetRollbackByOriginalID(ctx, tx.ID); err == nil {
+		return nil, fmt.Errorf("%w: transaction %s", ErrTransactionRolledBack, tx.ID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return nil, fmt.Errorf("failed to check rollback of transaction %s: %w", tx.ID, err)
+	}
+
+	now := s.now()
+
+	if wallet, err = wagerBonusGrants(ctx, tr, tx, wallet, now); err != nil {
+		return nil, err
+	}
+
+	tx.BalanceAfter = decimal.NewNullDecimal(wallet.Total())
+
+	if err = tr.InsertTransaction(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	reservation.Status = model.ReservationCommitted
+	reservation.SettledAt = &now
+
+	if err = tr.UpdateReservation(ctx, reservation); err != nil {
+		return nil, err
+	}
+
+	transactionID := tx.ID
+	if err = postReservationEntry(ctx, tr, reservation, &transactionID,
+		model.HouseAccount(tx.SourceType, tx.Currency), tx.Amount.Neg(),
+		fmt.Sprintf("%s %s", tx.SourceType, tx.State)); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (s *ReservationServiceImpl) Release(
+	ctx context.Context,
+	userID int,
+	id uuid.UUID,
+	provider string,
+) (*model.Reservation, error) {
+	reservation, err := s.providerReservation(ctx, userID, id, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.settle(ctx, reservation, func(ctx context.Context, tr repository.Repository, locked *model.Reservation) error {
+		reservation = locked
+
+		switch locked.Status {
+		case model.ReservationHeld:
+			return s.release(ctx, tr, locked, model.ReservationReleased)
+		case model.ReservationReleased, model.ReservationExpired:
+			return nil
+		default:
+			return fmt.Errorf("%w: reservation %s was %s", ErrReservationSettled, id, locked.Status)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func (s *ReservationServiceImpl) ExpireReservations(ctx context.Context) (int, error) {
+	reservations, err := s.repo.ListExpiredReservations(ctx, s.now(), expiryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+
+	var errs []error
+
+	for i := range reservations {
+		released := false
+
+		err = s.settle(ctx, &reservations[i], func(
+			ctx context.Context,
+			tr repository.Repository,
+			locked *model.Reservation,
+		) error {
+			// The reservation may have been settled since it was listed.
+			if locked.Status != model.ReservationHeld {
+				return nil
+			}
+
+			released = true
+
+			return s.release(ctx, tr, locked, model.ReservationExpired)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to expire reservation %s: %w", reservations[i].ID, err))
+		} else if released {
+			expired++
+		}
+	}
+
+	return expired, errors.Join(errs...)
+}
+
+// settle runs fn on the locked reservation within a database transaction. The wallet of the
+// reservation is locked first, in the same order transactions lock it.
+func (s *ReservationServiceImpl) settle(
+	ctx context.Context,
+	reservation *model.Reservation,
+	fn func(context.Context, repository.Repository, *model.Reservation) error,
+) error {
+	return s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		if _, err := tr.LockWallet(ctx, reservation.UserID, reservation.Currency); err != nil {
+			return fmt.Errorf("failed to lock wallet: %w", err)
+		}
+
+		locked, err := tr.LockReservation(ctx, reservation.ID)
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx, tr, locked)
+	})
+}
+
+// release gives the amount of the held reservation back to the real balance and marks it with status.
+func (s *ReservationServiceImpl) release(
+	ctx context.Context,
+	tr repository.Repository,
+	reservation *model.Reservation,
+	status model.ReservationStatus,
+) error {
+	if _, err := tr.UpdateWalletHeldBalance(ctx, reservation.UserID, reservation.Currency,
+		reservation.Amount.Neg()); err != nil {
+		return fmt.Errorf("failed to update wallet held balance: %w", err)
+	}
+
+	if _, err := tr.UpdateWalletBalance(ctx, reservation.UserID, reservation.Currency,
+		reservation.Amount); err != nil {
+		return fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+
+	now := s.now()
+	reservation.Status = status
+	reservation.SettledAt = &now
+
+	if err := tr.UpdateReservation(ctx, reservation); err != nil {
+		return err
+	}
+
+	return postReservationEntry(ctx, tr, reservation, nil,
+		model.WalletAccount(reservation.UserID, reservation.Currency), reservation.Amount.Neg(),
+		fmt.Sprintf("release of reservation %s", reservation.ID))
+}
+
+// replayReservation returns the already stored reservation existing if reservation is a retry
+// of it, and an ErrDuplicateTransaction otherwise.
+func replayReservation(existing, reservation *model.Reservation) (*model.Reservation, error) {
+	if !existing.SamePayload(reservation) {
+		return nil, fmt.Errorf(
+			"%w: reservation %s was already made with a different payload",
+			ErrDuplicateTransaction,
+			reservation.ID,
+		)
+	}
+
+	return existing, nil
+}
+
+// postReservationEntry books delta on the held account of the wallet of reservation against
+// counterAccount. transactionID is only set for the entry of a commit.
+func postReservationEntry(
+	ctx context.Context,
+	tr repository.Repository,
+	reservation *model.Reservation,
+	transactionID *uuid.UUID,
+	counterAccount model.LedgerAccount,
+	delta decimal.Decimal,
+	description string,
+) error {
+	entry := &model.JournalEntry{
+		TransactionID: transactionID,
+		Description:   description,
+		Postings: []model.Posting{
+			{Account: model.HeldAccount(reservation.UserID, reservation.Currency), Amount: delta},
+			{Account: counterAccount, Amount: delta.Neg()},
+		},
+	}
+
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+	}
+
+	if err := tr.PostJournalEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to post journal entry: %w", err)
+	}
+
+	return nil
+}
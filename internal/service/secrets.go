@@ -0,0 +1,92 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SecretKeySize is the size in bytes of the key provider secrets are encrypted with, AES-256.
+const SecretKeySize = 32
+
+// sealedSecretPrefix marks a secret encrypted by SecretCipher. The version leaves room for a new
+// scheme or key while secrets of the old one remain readable.
+const sealedSecretPrefix = "enc:v1:"
+
+// ErrSecretKeyMissing is returned for encrypted secrets read without the key they were sealed with.
+var ErrSecretKeyMissing = errors.New("provider secret is encrypted but no secret key is configured")
+
+// SecretCipher encrypts the provider secrets stored in the database with AES-GCM, so that a copy of
+// the database alone does not allow signing requests. The provider name is authenticated along with
+// the secret, so an encrypted secret cannot be copied to another provider.
+//
+// A nil SecretCipher stores secrets in plaintext. Secrets stored in plaintext are read as they are
+// in either case, which keeps providers registered before the key was configured working.
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewSecretCipher creates a cipher with a key of SecretKeySize bytes.
+func NewSecretCipher(key []byte) (*SecretCipher, error) {
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("secret key must have %d bytes, got %d", SecretKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return &SecretCipher{aead: aead}, nil
+}
+
+// Seal returns the form of the secret of provider name that is stored.
+func (c *SecretCipher) Seal(name, secret string) (string, error) {
+	if c == nil {
+		return secret, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), []byte(name))
+
+	return sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open returns the secret of provider name from its stored form.
+func (c *SecretCipher) Open(name, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedSecretPrefix)
+	if !ok {
+		return stored, nil
+	}
+
+	if c == nil {
+		return "", ErrSecretKeyMissing
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+
+	secret, err := c.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	return string(secret), nil
+}
@@ -1,63 +1,726 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/logging"
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/tracing"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Errors returned by TransactionService. Repository failures are passed through
+// wrapped, so callers can match them against these values with errors.Is.
+var (
+	ErrInvalidTransaction   = errors.New("invalid transaction")
+	ErrTransactionNotFound  = repository.ErrTransactionNotFound
+	ErrUserNotFound         = repository.ErrUserNotFound
+	ErrWalletNotFound       = repository.ErrWalletNotFound
+	ErrDuplicateTransaction = repository.ErrDuplicateTransaction
+	ErrInsufficientFunds    = repository.ErrInsufficientFunds
+	ErrAlreadyRolledBack    = repository.ErrAlreadyRolledBack
+	ErrConstraintViolation  = repository.ErrConstraintViolation
+	ErrUnavailable          = repository.ErrUnavailable
+
+	// ErrTransactionRolledBack is returned when a transaction arrives after its rollback.
+	ErrTransactionRolledBack = errors.New("transaction was rolled back")
+)
+
+// RuleViolation is returned for transactions rejected by the transaction rules.
+type RuleViolation = rules.Violation
+
+// BatchItemError reports the transaction that made an atomic batch fail.
+type BatchItemError struct {
+	Index         int
+	TransactionID uuid.UUID
+	Err           error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("batch item %d (transaction %s): %v", e.Index, e.TransactionID, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// DefaultPageSize is the number of transactions listed when no limit is requested.
+	DefaultPageSize = 50
+	// DefaultCurrency is the currency used when a request does not name one, unless configured otherwise.
+	DefaultCurrency = model.CurrencyEUR
 )
 
 type TransactionService interface {
-	GetBalance(ctx context.Context, userID int) (decimal.Decimal, error)
-	ProcessTransaction(ctx context.Context, tx *model.Transaction) error
+	// GetBalance returns the wallet of userID in currency, or in the default currency if it is empty.
+	GetBalance(ctx context.Context, userID int, currency model.Currency) (*model.Wallet, error)
+	// ListWallets returns all wallets of userID.
+	ListWallets(ctx context.Context, userID int) ([]model.Wallet, error)
+	// ProcessTransaction applies tx exactly once. Retries of an already processed
+	// transaction return the original outcome with Replayed set, while reusing its ID
+	// with a different payload returns ErrDuplicateTransaction.
+	ProcessTransaction(ctx context.Context, tx *model.Transaction) (*model.ProcessedTransaction, error)
+	// ProcessBatch processes txs in the given mode and returns one result per transaction, in order.
+	// In atomic mode the first failing transaction aborts the batch with a *BatchItemError.
+	ProcessBatch(ctx context.Context, txs []*model.Transaction, mode model.BatchMode) ([]model.BatchItemResult, error)
+	// GetTransaction returns the stored transaction with the given ID.
+	GetTransaction(ctx context.Context, txID uuid.UUID) (*model.Transaction, error)
+	// GetUserTransaction is like GetTransaction but only finds transactions of userID.
+	GetUserTransaction(ctx context.Context, userID int, txID uuid.UUID) (*model.Transaction, error)
+	// ListTransactions returns a page of the transaction history of filter.UserID.
+	ListTransactions(ctx context.Context, filter model.TransactionFilter) (*model.TransactionPage, error)
 }
 
 type TransactionServiceImpl struct {
-	repo repository.Repository
+	repo              repository.Repository
+	sourceTypes       SourceTypeService
+	rules             *rules.Engine
+	defaultCurrency   model.Currency
+	autoCreateWallets bool
+	bonusSpendOrder   model.BonusSpendOrder
+	userStatuses      model.UserStatusPolicy
+}
+
+// Option configures a TransactionServiceImpl.
+type Option func(*TransactionServiceImpl)
+
+// WithDefaultCurrency sets the currency of transactions and balance requests that do not name one.
+func WithDefaultCurrency(currency model.Currency) Option {
+	return func(s *TransactionServiceImpl) {
+		s.defaultCurrency = currency
+	}
 }
 
-func NewTransactionService(repo repository.Repository) TransactionService {
-	return &TransactionServiceImpl{repo: repo}
+// WithWalletAutoCreate controls whether a transaction in a currency the user has no wallet for
+// creates the wallet. Otherwise such transactions are rejected with ErrWalletNotFound.
+func WithWalletAutoCreate(enabled bool) Option {
+	return func(s *TransactionServiceImpl) {
+		s.autoCreateWallets = enabled
+	}
 }
 
-func (s *TransactionServiceImpl) GetBalance(ctx context.Context, userID int) (decimal.Decimal, error) {
-	return s.repo.GetBalanceByID(ctx, userID)
+// WithSourceTypes sets the registry transactions are checked against. By default the service
+// reads the registry through its own repository; share the instance that is administered
+// so that changes take effect immediately.
+func WithSourceTypes(sourceTypes SourceTypeService) Option {
+	return func(s *TransactionServiceImpl) {
+		s.sourceTypes = sourceTypes
+	}
 }
 
-func (s *TransactionServiceImpl) ProcessTransaction(ctx context.Context, tx *model.Transaction) error {
-	_, err := s.repo.GetTransactionByID(ctx, tx.ID)
-	if !errors.Is(err, repository.ErrTransactionNotFound) {
-		return fmt.Errorf("transaction with ID %s already exists or failed to check existence: %w", tx.ID, err)
+// WithRules sets the rules transactions are evaluated against before they are applied.
+// Without rules only the precision of amounts is checked.
+func WithRules(engine *rules.Engine) Option {
+	return func(s *TransactionServiceImpl) {
+		s.rules = engine
 	}
+}
 
-	var balanceDelta decimal.Decimal
+// WithBonusSpendOrder sets which balance lose transactions are paid from first.
+// By default the real balance is spent before the bonus balance.
+func WithBonusSpendOrder(order model.BonusSpendOrder) Option {
+	return func(s *TransactionServiceImpl) {
+		s.bonusSpendOrder = order
+	}
+}
 
-	switch tx.State {
-	case model.TransactionStateWin:
-		balanceDelta = tx.Amount
-	case model.TransactionStateLose:
-		balanceDelta = tx.Amount.Neg()
+// WithUserStatusPolicy sets the transaction states accepted for users that are not active.
+// By default DefaultUserStatusPolicy applies.
+func WithUserStatusPolicy(policy model.UserStatusPolicy) Option {
+	return func(s *TransactionServiceImpl) {
+		s.userStatuses = policy
+	}
+}
+
+func NewTransactionService(repo repository.Repository, opts ...Option) TransactionService {
+	s := &TransactionServiceImpl{
+		repo:            repo,
+		rules:           &rules.Engine{},
+		defaultCurrency: DefaultCurrency,
+		bonusSpendOrder: model.BonusSpendOrderRealFirst,
+		userStatuses:    DefaultUserStatusPolicy(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.sourceTypes == nil {
+		s.sourceTypes = NewSourceTypeService(repo)
+	}
+
+	return s
+}
+
+func (s *TransactionServiceImpl) GetBalance(
+	ctx context.Context,
+	userID int,
+	currency model.Currency,
+) (*model.Wallet, error) {
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	return s.repo.GetWallet(ctx, userID, currency)
+}
+
+func (s *TransactionServiceImpl) ListWallets(ctx context.Context, userID int) ([]model.Wallet, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Wallets, nil
+}
+
+func (s *TransactionServiceImpl) ProcessTransaction(
+	ctx context.Context,
+	tx *model.Transaction,
+) (processed *model.ProcessedTransaction, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionServiceImpl.ProcessTransaction",
+		trace.WithAttributes(tracing.TransactionAttributes(tx)...))
+	defer func() {
+		outcome := tracing.TransactionOutcome(processed, err)
+		tracing.End(span, outcome, err)
+		logTransaction(ctx, tx, outcome, err)
+	}()
+
+	return s.processTransaction(ctx, tx)
+}
+
+// logTransaction logs the decision taken on tx with the logger of ctx. Rejections are warnings, as
+// they are expected from providers, for instance for insufficient funds.
+func logTransaction(ctx context.Context, tx *model.Transaction, outcome string, err error) {
+	logger := logging.FromContext(ctx).With(
+		logging.TransactionIDKey, tx.ID,
+		logging.UserIDKey, tx.UserID,
+		"state", tx.State,
+		"source_type", tx.SourceType,
+	)
+
+	switch outcome {
+	case tracing.OutcomeReplayed:
+		logger.InfoContext(ctx, "duplicate transaction replayed")
+	case tracing.OutcomeRejected:
+		logger.WarnContext(ctx, "transaction rejected", logging.Error(err))
 	default:
-		return fmt.Errorf("unsupported transaction state: %s", tx.State)
+		logger.InfoContext(ctx, "transaction processed", "amount", tx.Amount, "currency", tx.Currency)
+	}
+}
+
+func (s *TransactionServiceImpl) processTransaction(
+	ctx context.Context,
+	tx *model.Transaction,
+) (*model.ProcessedTransaction, error) {
+	if err := s.prepareTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetTransactionByID(ctx, tx.ID)
+	if err == nil {
+		return replayTransaction(existing, tx)
+	}
+
+	if !errors.Is(err, ErrTransactionNotFound) {
+		return nil, fmt.Errorf("failed to check existence of transaction %s: %w", tx.ID, err)
+	}
+
+	err = s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		return s.apply(ctx, tr, tx)
+	})
+	if errors.Is(err, ErrDuplicateTransaction) {
+		// A concurrent request with the same ID committed first, answer with its outcome.
+		if existing, err = s.repo.GetTransactionByID(ctx, tx.ID); err != nil {
+			return nil, fmt.Errorf("failed to load duplicate transaction %s: %w", tx.ID, err)
+		}
+
+		return replayTransaction(existing, tx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newProcessedTransaction(tx, false), nil
+}
+
+func (s *TransactionServiceImpl) ProcessBatch(
+	ctx context.Context,
+	txs []*model.Transaction,
+	mode model.BatchMode,
+) ([]model.BatchItemResult, error) {
+	results := make([]model.BatchItemResult, len(txs))
+
+	switch mode {
+	case model.BatchModeIndependent:
+		for i, tx := range txs {
+			results[i].Transaction, results[i].Err = s.ProcessTransaction(ctx, tx)
+		}
+
+		return results, nil
+	case model.BatchModeAtomic:
+		// Lock users in a consistent order so that concurrent batches cannot deadlock.
+		// The stable sort keeps the order of transactions of the same user.
+		order := make([]int, len(txs))
+		for i := range order {
+			order[i] = i
+		}
+
+		slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(txs[a].UserID, txs[b].UserID) })
+
+		// Check all transactions before the database transaction is opened, as the source type
+		// registry may have to be read from the database.
+		for i, tx := range txs {
+			if err := s.prepareTransaction(ctx, tx); err != nil {
+				return nil, &BatchItemError{Index: i, TransactionID: tx.ID, Err: err}
+			}
+		}
+
+		err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+			for _, i := range order {
+				processed, err := s.processInTransaction(ctx, tr, txs[i])
+				if err != nil {
+					return &BatchItemError{Index: i, TransactionID: txs[i].ID, Err: err}
+				}
+
+				results[i].Transaction = processed
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return results, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported batch mode: %s", ErrInvalidTransaction, mode)
+	}
+}
+
+// processInTransaction processes the prepared tx within the already open database transaction tr.
+// Unlike ProcessTransaction it detects retries inside tr, so transactions repeated
+// within the same atomic batch are replayed as well.
+func (s *TransactionServiceImpl) processInTransaction(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+) (*model.ProcessedTransaction, error) {
+	existing, err := tr.GetTransactionByID(ctx, tx.ID)
+	if err == nil {
+		return replayTransaction(existing, tx)
+	}
+
+	if !errors.Is(err, ErrTransactionNotFound) {
+		return nil, fmt.Errorf("failed to check existence of transaction %s: %w", tx.ID, err)
+	}
+
+	if err = s.apply(ctx, tr, tx); err != nil {
+		return nil, err
+	}
+
+	return newProcessedTransaction(tx, false), nil
+}
+
+// prepareTransaction fills in the defaults of tx and checks the invariants that do not depend on
+// stored transactions, including that its source type may send it and that it obeys the rules.
+func (s *TransactionServiceImpl) prepareTransaction(ctx context.Context, tx *model.Transaction) error {
+	if tx.Currency == "" {
+		tx.Currency = s.defaultCurrency
 	}
 
 	if tx.ID == uuid.Nil {
-		return errors.New("transaction ID cannot be nil")
+		return fmt.Errorf("%w: transaction ID cannot be nil", ErrInvalidTransaction)
 	}
 
-	return s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
-		if err = tr.InsertTransaction(ctx, tx); err != nil {
-			return fmt.Errorf("failed to insert transaction: %w", err)
+	switch tx.State {
+	case model.TransactionStateWin, model.TransactionStateLose:
+		if tx.OriginalTransactionID != nil {
+			return fmt.Errorf("%w: only rollbacks reference an original transaction", ErrInvalidTransaction)
+		}
+	case model.TransactionStateRollback:
+		if tx.OriginalTransactionID == nil || *tx.OriginalTransactionID == tx.ID {
+			return fmt.Errorf("%w: rollback must reference another transaction", ErrInvalidTransaction)
 		}
+	default:
+		return fmt.Errorf("%w: unsupported transaction state: %s", ErrInvalidTransaction, tx.State)
+	}
 
-		if err = tr.UpdateUserBalance(ctx, tx.UserID, balanceDelta); err != nil {
-			return fmt.Errorf("failed to update user balance: %w", err)
+	if err := s.sourceTypes.Check(ctx, tx.SourceType, tx.State); err != nil {
+		return err
+	}
+
+	return s.rules.Evaluate(tx)
+}
+
+// apply applies tx to the wallet balance and stores it, if the status of its user allows it.
+func (s *TransactionServiceImpl) apply(ctx context.Context, tr repository.Repository, tx *model.Transaction) error {
+	if err := checkUserStatus(ctx, tr, s.userStatuses, tx.UserID, tx.State); err != nil {
+		return err
+	}
+
+	if tx.State == model.TransactionStateRollback {
+		return s.applyRollback(ctx, tr, tx)
+	}
+
+	return s.applyTransaction(ctx, tr, tx)
+}
+
+// applyTransaction applies a win or lose transaction to the wallet balances and stores it.
+// Wins are credited to the real balance, loses are paid from both balances in the
+// configured order and count towards the wagering requirements of bonus grants.
+func (s *TransactionServiceImpl) applyTransaction(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+) error {
+	balanceDelta, err := tx.BalanceDelta()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+	}
+
+	// Updating the balance locks the wallet row, so a concurrent rollback of this
+	// transaction is either visible below or waits until it is stored.
+	var wallet *model.Wallet
+	if tx.State == model.TransactionStateLose {
+		wallet, err = s.spend(ctx, tr, tx)
+	} else {
+		wallet, err = s.updateWalletBalance(ctx, tr, tx.UserID, tx.Currency, balanceDelta)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+
+	if tx.State == model.TransactionStateLose {
+		now := time.Now()
+
+		if err = checkLossLimits(ctx, tr, tx, wallet.HeldBalance, now); err != nil {
+			return err
 		}
 
+		if wallet, err = wagerBonusGrants(ctx, tr, tx, wallet, now); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tr.GetRollbackByOriginalID(ctx, tx.ID); err == nil {
+		return fmt.Errorf("%w: transaction %s", ErrTransactionRolledBack, tx.ID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to check rollback of transaction %s: %w", tx.ID, err)
+	}
+
+	// A reservation is held under the wallet lock as well, so it is either visible here or
+	// sees this transaction when it checks its ID.
+	if _, err = tr.GetReservation(ctx, tx.ID); err == nil {
+		return fmt.Errorf("%w: transaction %s", ErrTransactionReserved, tx.ID)
+	} else if !errors.Is(err, ErrReservationNotFound) {
+		return fmt.Errorf("failed to check reservation %s: %w", tx.ID, err)
+	}
+
+	tx.BalanceAfter = decimal.NewNullDecimal(wallet.Total())
+
+	if err = tr.InsertTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	return postTransactionEntry(ctx, tr, tx, tx.SourceType, balanceDelta.Add(tx.BonusAmount), tx.BonusAmount.Neg(),
+		fmt.Sprintf("%s %s", tx.SourceType, tx.State))
+}
+
+// spend pays the lose transaction tx from the balances of its wallet and records the part
+// paid from the bonus balance in tx.BonusAmount.
+func (s *TransactionServiceImpl) spend(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+) (*model.Wallet, error) {
+	wallet, err := s.lockWallet(ctx, tr, tx.UserID, tx.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	realPart, bonusPart := s.bonusSpendOrder.Split(tx.Amount, wallet)
+	tx.BonusAmount = bonusPart
+
+	return updateBalances(ctx, tr, tx.UserID, tx.Currency, realPart.Neg(), bonusPart.Neg())
+}
+
+// applyRollback reverses the balance effect of the original transaction and stores the rollback.
+// If the original has not been processed yet, the rollback is stored as a zero-amount tombstone
+// that makes applyTransaction reject the original when it arrives.
+func (s *TransactionServiceImpl) applyRollback(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+) error {
+	originalID := *tx.OriginalTransactionID
+
+	// A rollback is applied to the wallet of its original. A tombstone uses the requested currency.
+	original, err := tr.GetTransactionByID(ctx, originalID)
+	if err == nil {
+		tx.Currency = original.Currency
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to load original transaction %s: %w", originalID, err)
+	}
+
+	wallet, err := s.lockWallet(ctx, tr, tx.UserID, tx.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	if _, err = tr.GetRollbackByOriginalID(ctx, originalID); err == nil {
+		return fmt.Errorf("%w: transaction %s", ErrAlreadyRolledBack, originalID)
+	} else if !errors.Is(err, ErrTransactionNotFound) {
+		return fmt.Errorf("failed to check rollback of transaction %s: %w", originalID, err)
+	}
+
+	if original == nil {
+		// The original may have been stored while waiting for the wallet lock.
+		original, err = tr.GetTransactionByID(ctx, originalID)
+		if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+			return fmt.Errorf("failed to load original transaction %s: %w", originalID, err)
+		}
+	}
+
+	var reversal decimal.Decimal
+
+	switch {
+	case original == nil:
+		tx.Amount = decimal.Zero
+	case original.UserID != tx.UserID:
+		return fmt.Errorf("%w: transaction %s belongs to another user", ErrInvalidTransaction, originalID)
+	case original.State == model.TransactionStateRollback:
+		return fmt.Errorf("%w: transaction %s is itself a rollback", ErrInvalidTransaction, originalID)
+	case original.SourceType == model.SourceTypeManual:
+		return fmt.Errorf("%w: transaction %s is a manual adjustment, request an opposite adjustment instead",
+			ErrInvalidTransaction, originalID)
+	case original.SourceType != tx.SourceType || original.Provider != tx.Provider:
+		// Only the sender of a transaction may reverse it, the reversal is booked on its house account.
+		return fmt.Errorf("%w: transaction %s was sent by another source type or provider",
+			ErrSourceTypeForbidden, originalID)
+	default:
+		originalDelta, err := original.BalanceDelta()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+		}
+
+		// The bonus part of a lose goes back to the bonus balance. Wagering is not undone.
+		reversal = originalDelta.Add(original.BonusAmount).Neg()
+
+		wallet, err = updateBalances(ctx, tr, tx.UserID, original.Currency, reversal, original.BonusAmount)
+		if err != nil {
+			return fmt.Errorf("failed to update wallet balance: %w", err)
+		}
+
+		tx.Amount = original.Amount
+		tx.Currency = original.Currency
+		tx.BonusAmount = original.BonusAmount
+	}
+
+	tx.BalanceAfter = decimal.NewNullDecimal(wallet.Total())
+
+	if err = tr.InsertTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("failed to insert rollback: %w", err)
+	}
+
+	// A tombstone moves no money, so there is nothing to book.
+	if original == nil {
 		return nil
-	})
+	}
+
+	return postTransactionEntry(ctx, tr, tx, original.SourceType, reversal, tx.BonusAmount,
+		fmt.Sprintf("rollback of %s", original.ID))
+}
+
+// postTransactionEntry books the changes realDelta and bonusDelta of the balances of tx
+// against the house account of sourceType.
+func postTransactionEntry(
+	ctx context.Context,
+	tr repository.Repository,
+	tx *model.Transaction,
+	sourceType model.SourceType,
+	realDelta decimal.Decimal,
+	bonusDelta decimal.Decimal,
+	description string,
+) error {
+	postings := make([]model.Posting, 0, 3)
+	if !realDelta.IsZero() {
+		postings = append(postings, model.Posting{Account: model.WalletAccount(tx.UserID, tx.Currency), Amount: realDelta})
+	}
+
+	if !bonusDelta.IsZero() {
+		postings = append(postings, model.Posting{Account: model.BonusAccount(tx.UserID, tx.Currency), Amount: bonusDelta})
+	}
+
+	transactionID := tx.ID
+	entry := &model.JournalEntry{
+		TransactionID: &transactionID,
+		Description:   description,
+		Postings: append(postings, model.Posting{
+			Account: model.HouseAccount(sourceType, tx.Currency),
+			Amount:  realDelta.Add(bonusDelta).Neg(),
+		}),
+	}
+
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+	}
+
+	if err := tr.PostJournalEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to post journal entry: %w", err)
+	}
+
+	return nil
+}
+
+// updateWalletBalance applies delta to the real balance of the wallet of userID in currency,
+// creating the wallet first if it is missing and auto-creation is enabled.
+func (s *TransactionServiceImpl) updateWalletBalance(
+	ctx context.Context,
+	tr repository.Repository,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	wallet, err := tr.UpdateWalletBalance(ctx, userID, currency, delta)
+	if !errors.Is(err, ErrWalletNotFound) || !s.autoCreateWallets {
+		return wallet, err
+	}
+
+	if err = tr.CreateWallet(ctx, userID, currency); err != nil {
+		return nil, err
+	}
+
+	return tr.UpdateWalletBalance(ctx, userID, currency, delta)
+}
+
+// lockWallet locks the wallet of userID in currency like updateWalletBalance updates it.
+func (s *TransactionServiceImpl) lockWallet(
+	ctx context.Context,
+	tr repository.Repository,
+	userID int,
+	currency model.Currency,
+) (*model.Wallet, error) {
+	wallet, err := tr.LockWallet(ctx, userID, currency)
+	if !errors.Is(err, ErrWalletNotFound) || !s.autoCreateWallets {
+		return wallet, err
+	}
+
+	if err = tr.CreateWallet(ctx, userID, currency); err != nil {
+		return nil, err
+	}
+
+	return tr.LockWallet(ctx, userID, currency)
+}
+
+// updateBalances applies realDelta and bonusDelta to the already locked wallet of userID in currency.
+// Without a bonus delta the real balance is updated even by zero, so that the wallet is returned.
+func updateBalances(
+	ctx context.Context,
+	tr repository.Repository,
+	userID int,
+	currency model.Currency,
+	realDelta decimal.Decimal,
+	bonusDelta decimal.Decimal,
+) (*model.Wallet, error) {
+	if !bonusDelta.IsZero() {
+		wallet, err := tr.UpdateWalletBonusBalance(ctx, userID, currency, bonusDelta)
+		if err != nil || realDelta.IsZero() {
+			return wallet, err
+		}
+	}
+
+	return tr.UpdateWalletBalance(ctx, userID, currency, realDelta)
+}
+
+func (s *TransactionServiceImpl) GetTransaction(ctx context.Context, txID uuid.UUID) (*model.Transaction, error) {
+	return s.repo.GetTransactionByID(ctx, txID)
+}
+
+func (s *TransactionServiceImpl) GetUserTransaction(
+	ctx context.Context,
+	userID int,
+	txID uuid.UUID,
+) (*model.Transaction, error) {
+	tx, err := s.repo.GetTransactionByID(ctx, txID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not reveal transactions of other users.
+	if tx.UserID != userID {
+		return nil, ErrTransactionNotFound
+	}
+
+	return tx, nil
+}
+
+func (s *TransactionServiceImpl) ListTransactions(
+	ctx context.Context,
+	filter model.TransactionFilter,
+) (*model.TransactionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageSize
+	}
+
+	// Distinguish an unknown user from a user without matching transactions.
+	if _, err := s.repo.GetUser(ctx, filter.UserID); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to find out whether another page follows.
+	pageSize := filter.Limit
+	filter.Limit++
+
+	transactions, err := s.repo.ListTransactionsByUser(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.TransactionPage{Transactions: transactions}
+
+	if len(transactions) > pageSize {
+		page.Transactions = transactions[:pageSize]
+		last := page.Transactions[pageSize-1]
+		page.NextCursor = model.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// replayTransaction returns the outcome of the already stored transaction existing
+// if tx is a retry of it, and an ErrDuplicateTransaction otherwise.
+func replayTransaction(existing, tx *model.Transaction) (*model.ProcessedTransaction, error) {
+	if !existing.SamePayload(tx) {
+		return nil, fmt.Errorf(
+			"%w: transaction %s was already processed with a different payload",
+			ErrDuplicateTransaction,
+			tx.ID,
+		)
+	}
+
+	return newProcessedTransaction(existing, true), nil
+}
+
+func newProcessedTransaction(tx *model.Transaction, replayed bool) *model.ProcessedTransaction {
+	return &model.ProcessedTransaction{
+		TransactionID:         tx.ID,
+		UserID:                tx.UserID,
+		State:                 tx.State,
+		Amount:                tx.Amount,
+		Currency:              tx.Currency,
+		Balance:               tx.BalanceAfter,
+		ProcessedAt:           tx.CreatedAt,
+		OriginalTransactionID: tx.OriginalTransactionID,
+		Replayed:              replayed,
+	}
 }
@@ -2,11 +2,15 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -18,9 +22,14 @@ type MockRepository struct {
 	mock.Mock
 
 	balanceUpdates []struct {
-		userID int
-		delta  decimal.Decimal
+		userID   int
+		currency model.Currency
+		delta    decimal.Decimal
 	}
+	journalEntries []*model.JournalEntry
+	auditEvents    []*model.AuditEvent
+	// userStatuses are returned by LockUserStatus, users missing from it are active.
+	userStatuses map[int]model.UserStatus
 }
 
 func (m *MockRepository) WithDBTransaction(
@@ -41,31 +50,434 @@ func (m *MockRepository) WithDBTransaction(
 	return fn(ctx, m)
 }
 
-func (m *MockRepository) GetBalanceByID(_ context.Context, userID int) (decimal.Decimal, error) {
+func (m *MockRepository) GetUser(_ context.Context, userID int) (*model.User, error) {
 	args := m.Called(userID)
-	return args.Get(0).(decimal.Decimal), args.Error(1)
+	user, _ := args.Get(0).(*model.User)
+	return user, args.Error(1)
 }
 
-func (m *MockRepository) UpdateUserBalance(_ context.Context, userID int, delta decimal.Decimal) error {
-	m.balanceUpdates = append(m.balanceUpdates, struct {
-		userID int
-		delta  decimal.Decimal
-	}{userID: userID, delta: delta})
-	args := m.Called(userID, delta)
+func (m *MockRepository) InsertUser(_ context.Context, user *model.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockRepository) LockUser(_ context.Context, userID int) (*model.User, error) {
+	args := m.Called(userID)
+	user, _ := args.Get(0).(*model.User)
+	return user, args.Error(1)
+}
+
+func (m *MockRepository) LockUserStatus(_ context.Context, userID int) (model.UserStatus, error) {
+	if status, ok := m.userStatuses[userID]; ok {
+		return status, nil
+	}
+
+	return model.UserStatusActive, nil
+}
+
+func (m *MockRepository) UpdateUserStatus(_ context.Context, user *model.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetWallet(_ context.Context, userID int, currency model.Currency) (*model.Wallet, error) {
+	args := m.Called(userID, currency)
+	wallet, _ := args.Get(0).(*model.Wallet)
+	return wallet, args.Error(1)
+}
+
+func (m *MockRepository) CreateWallet(_ context.Context, userID int, currency model.Currency) error {
+	args := m.Called(userID, currency)
 	return args.Error(0)
 }
 
+func (m *MockRepository) UpdateWalletBalance(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	m.balanceUpdates = append(m.balanceUpdates, struct {
+		userID   int
+		currency model.Currency
+		delta    decimal.Decimal
+	}{userID: userID, currency: currency, delta: delta})
+	args := m.Called(userID, currency, delta)
+	return walletResult(args, userID, currency), args.Error(1)
+}
+
+func (m *MockRepository) UpdateWalletBonusBalance(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	args := m.Called(userID, currency, delta)
+	wallet, _ := args.Get(0).(*model.Wallet)
+	return wallet, args.Error(1)
+}
+
+func (m *MockRepository) UpdateWalletHeldBalance(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	delta decimal.Decimal,
+) (*model.Wallet, error) {
+	args := m.Called(userID, currency, delta)
+	wallet, _ := args.Get(0).(*model.Wallet)
+	return wallet, args.Error(1)
+}
+
 func (m *MockRepository) GetTransactionByID(_ context.Context, id uuid.UUID) (*model.Transaction, error) {
 	args := m.Called(id)
 	tx, _ := args.Get(0).(*model.Transaction)
 	return tx, args.Error(1)
 }
 
+func (m *MockRepository) LockWallet(_ context.Context, userID int, currency model.Currency) (*model.Wallet, error) {
+	args := m.Called(userID, currency)
+	return walletResult(args, userID, currency), args.Error(1)
+}
+
+// walletResult returns the wallet a mocked wallet method was set up to return. Tests
+// without bonus money may give just the real balance.
+func walletResult(args mock.Arguments, userID int, currency model.Currency) *model.Wallet {
+	switch result := args.Get(0).(type) {
+	case *model.Wallet:
+		return result
+	case decimal.Decimal:
+		return &model.Wallet{UserID: userID, Currency: currency, Balance: result}
+	default:
+		return nil
+	}
+}
+
+func (m *MockRepository) GetRollbackByOriginalID(_ context.Context, originalID uuid.UUID) (*model.Transaction, error) {
+	args := m.Called(originalID)
+	tx, _ := args.Get(0).(*model.Transaction)
+	return tx, args.Error(1)
+}
+
 func (m *MockRepository) InsertTransaction(_ context.Context, tx *model.Transaction) error {
 	args := m.Called(tx)
 	return args.Error(0)
 }
 
+func (m *MockRepository) PostJournalEntry(_ context.Context, entry *model.JournalEntry) error {
+	m.journalEntries = append(m.journalEntries, entry)
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetExpectedBalances(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+) (model.Balances, error) {
+	args := m.Called(userID, currency)
+	return args.Get(0).(model.Balances), args.Error(1)
+}
+
+func (m *MockRepository) FindBalanceDrifts(_ context.Context) ([]model.BalanceDrift, error) {
+	args := m.Called()
+	drifts, _ := args.Get(0).([]model.BalanceDrift)
+	return drifts, args.Error(1)
+}
+
+func (m *MockRepository) FindLedgerDrifts(_ context.Context) ([]model.BalanceDrift, error) {
+	args := m.Called()
+	drifts, _ := args.Get(0).([]model.BalanceDrift)
+	return drifts, args.Error(1)
+}
+
+func (m *MockRepository) GetLedgerBalances(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+) (model.Balances, error) {
+	args := m.Called(userID, currency)
+	return args.Get(0).(model.Balances), args.Error(1)
+}
+
+func (m *MockRepository) InsertBalanceAdjustment(_ context.Context, adjustment *model.BalanceAdjustment) error {
+	args := m.Called(adjustment)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListTransactionsByUser(
+	_ context.Context,
+	filter model.TransactionFilter,
+) ([]model.Transaction, error) {
+	args := m.Called(filter)
+	transactions, _ := args.Get(0).([]model.Transaction)
+	return transactions, args.Error(1)
+}
+
+func (m *MockRepository) ListUserLimits(_ context.Context, userID int) ([]model.UserLimit, error) {
+	args := m.Called(userID)
+	limits, _ := args.Get(0).([]model.UserLimit)
+	return limits, args.Error(1)
+}
+
+func (m *MockRepository) LockUserLimit(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	period model.LimitPeriod,
+) (*model.UserLimit, error) {
+	args := m.Called(userID, currency, period)
+	limit, _ := args.Get(0).(*model.UserLimit)
+	return limit, args.Error(1)
+}
+
+func (m *MockRepository) SaveUserLimit(_ context.Context, limit *model.UserLimit) error {
+	args := m.Called(limit)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetNetLoss(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+	since time.Time,
+) (decimal.Decimal, error) {
+	args := m.Called(userID, currency, since)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockRepository) GetBonusGrant(_ context.Context, grantID uuid.UUID) (*model.BonusGrant, error) {
+	args := m.Called(grantID)
+	grant, _ := args.Get(0).(*model.BonusGrant)
+	return grant, args.Error(1)
+}
+
+func (m *MockRepository) ListBonusGrants(_ context.Context, userID int) ([]model.BonusGrant, error) {
+	args := m.Called(userID)
+	grants, _ := args.Get(0).([]model.BonusGrant)
+	return grants, args.Error(1)
+}
+
+func (m *MockRepository) LockActiveBonusGrants(
+	_ context.Context,
+	userID int,
+	currency model.Currency,
+) ([]model.BonusGrant, error) {
+	args := m.Called(userID, currency)
+	grants, _ := args.Get(0).([]model.BonusGrant)
+	return grants, args.Error(1)
+}
+
+func (m *MockRepository) InsertBonusGrant(_ context.Context, grant *model.BonusGrant) error {
+	args := m.Called(grant)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdateBonusGrant(_ context.Context, grant *model.BonusGrant) error {
+	args := m.Called(grant)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetReservation(_ context.Context, id uuid.UUID) (*model.Reservation, error) {
+	args := m.Called(id)
+	reservation, _ := args.Get(0).(*model.Reservation)
+	return reservation, args.Error(1)
+}
+
+func (m *MockRepository) LockReservation(_ context.Context, id uuid.UUID) (*model.Reservation, error) {
+	args := m.Called(id)
+	reservation, _ := args.Get(0).(*model.Reservation)
+	return reservation, args.Error(1)
+}
+
+func (m *MockRepository) InsertReservation(_ context.Context, reservation *model.Reservation) error {
+	args := m.Called(reservation)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdateReservation(_ context.Context, reservation *model.Reservation) error {
+	args := m.Called(reservation)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListExpiredReservations(
+	_ context.Context,
+	now time.Time,
+	limit int,
+) ([]model.Reservation, error) {
+	args := m.Called(now, limit)
+	reservations, _ := args.Get(0).([]model.Reservation)
+	return reservations, args.Error(1)
+}
+
+func (m *MockRepository) GetAdjustment(_ context.Context, id uuid.UUID) (*model.ManualAdjustment, error) {
+	args := m.Called(id)
+	adjustment, _ := args.Get(0).(*model.ManualAdjustment)
+	return adjustment, args.Error(1)
+}
+
+func (m *MockRepository) LockAdjustment(_ context.Context, id uuid.UUID) (*model.ManualAdjustment, error) {
+	args := m.Called(id)
+	adjustment, _ := args.Get(0).(*model.ManualAdjustment)
+	return adjustment, args.Error(1)
+}
+
+func (m *MockRepository) InsertAdjustment(_ context.Context, adjustment *model.ManualAdjustment) error {
+	args := m.Called(adjustment)
+	adjustment.Status = model.AdjustmentPending
+
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdateAdjustment(_ context.Context, adjustment *model.ManualAdjustment) error {
+	args := m.Called(adjustment)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListAdjustments(
+	_ context.Context,
+	status model.AdjustmentStatus,
+	limit int,
+) ([]model.ManualAdjustment, error) {
+	args := m.Called(status, limit)
+	adjustments, _ := args.Get(0).([]model.ManualAdjustment)
+	return adjustments, args.Error(1)
+}
+
+func (m *MockRepository) InsertAuditEvent(_ context.Context, event *model.AuditEvent) error {
+	m.auditEvents = append(m.auditEvents, event)
+	return nil
+}
+
+func (m *MockRepository) ListAuditEvents(
+	_ context.Context,
+	subjectType string,
+	subjectID string,
+) ([]model.AuditEvent, error) {
+	args := m.Called(subjectType, subjectID)
+	events, _ := args.Get(0).([]model.AuditEvent)
+	return events, args.Error(1)
+}
+
+func (m *MockRepository) ListSourceTypes(_ context.Context) ([]model.SourceTypeSettings, error) {
+	args := m.Called()
+	sourceTypes, _ := args.Get(0).([]model.SourceTypeSettings)
+	return sourceTypes, args.Error(1)
+}
+
+func (m *MockRepository) InsertSourceType(_ context.Context, settings *model.SourceTypeSettings) error {
+	args := m.Called(settings)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdateSourceType(
+	_ context.Context,
+	name model.SourceType,
+	update model.SourceTypeUpdate,
+) (*model.SourceTypeSettings, error) {
+	args := m.Called(name, update)
+	settings, _ := args.Get(0).(*model.SourceTypeSettings)
+	return settings, args.Error(1)
+}
+
+func (m *MockRepository) GetProvider(_ context.Context, name string) (*model.Provider, error) {
+	args := m.Called(name)
+	provider, _ := args.Get(0).(*model.Provider)
+	return provider, args.Error(1)
+}
+
+func (m *MockRepository) InsertProvider(_ context.Context, provider *model.Provider) error {
+	args := m.Called(provider)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetAPIKeyByHash(_ context.Context, hash string) (*model.APIKey, error) {
+	args := m.Called(hash)
+	key, _ := args.Get(0).(*model.APIKey)
+	return key, args.Error(1)
+}
+
+func (m *MockRepository) LockAPIKey(_ context.Context, id uuid.UUID) (*model.APIKey, error) {
+	args := m.Called(id)
+	key, _ := args.Get(0).(*model.APIKey)
+	return key, args.Error(1)
+}
+
+func (m *MockRepository) ListAPIKeys(_ context.Context, provider string) ([]model.APIKey, error) {
+	args := m.Called(provider)
+	keys, _ := args.Get(0).([]model.APIKey)
+	return keys, args.Error(1)
+}
+
+func (m *MockRepository) InsertAPIKey(_ context.Context, key *model.APIKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RevokeAPIKey(_ context.Context, key *model.APIKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockRepository) TouchAPIKey(_ context.Context, id uuid.UUID, at time.Time) error {
+	args := m.Called(id, at)
+	return args.Error(0)
+}
+
+func (m *MockRepository) LockRateLimitBucket(_ context.Context, key string) (*model.RateLimitBucket, error) {
+	args := m.Called(key)
+	bucket, _ := args.Get(0).(*model.RateLimitBucket)
+	return bucket, args.Error(1)
+}
+
+func (m *MockRepository) SaveRateLimitBucket(_ context.Context, bucket *model.RateLimitBucket) error {
+	args := m.Called(bucket)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteRateLimitBuckets(_ context.Context, before time.Time) (int, error) {
+	args := m.Called(before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) InsertNonce(_ context.Context, key string, expiresAt, now time.Time) (bool, error) {
+	args := m.Called(key, expiresAt, now)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) DeleteNonces(_ context.Context, before time.Time) (int, error) {
+	args := m.Called(before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) Ping(_ context.Context) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockRepository) SchemaVersion(_ context.Context) (uint, bool, error) {
+	args := m.Called()
+	return args.Get(0).(uint), args.Bool(1), args.Error(2)
+}
+
+func (m *MockRepository) PoolStats() sql.DBStats {
+	args := m.Called()
+	return args.Get(0).(sql.DBStats)
+}
+
+// allowAllSourceTypes is a source type registry accepting every transaction.
+type allowAllSourceTypes struct {
+	SourceTypeService
+}
+
+func (allowAllSourceTypes) Check(context.Context, model.SourceType, model.TransactionState) error {
+	return nil
+}
+
+// newTestService creates a service whose source type registry does not touch repo.
+func newTestService(repo *MockRepository, opts ...Option) TransactionService {
+	return NewTransactionService(repo, append([]Option{WithSourceTypes(allowAllSourceTypes{})}, opts...)...)
+}
+
 func TestProcessTransaction(t *testing.T) {
 	winID := uuid.New()
 	loseID := uuid.New()
@@ -90,7 +502,10 @@ func TestProcessTransaction(t *testing.T) {
 				m.On("WithDBTransaction", mock.Anything).Return(nil)
 				m.On("GetTransactionByID", winID).Return(nil, repository.ErrTransactionNotFound)
 				m.On("InsertTransaction", mock.Anything).Return(nil)
-				m.On("UpdateUserBalance", 1, decimal.NewFromInt(100)).Return(nil)
+				m.On("PostJournalEntry", mock.Anything).Return(nil)
+				m.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(100)).Return(decimal.NewFromInt(200), nil)
+				m.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
 			},
 			wantErr:   false,
 			wantDelta: decimal.NewFromInt(100),
@@ -107,13 +522,65 @@ func TestProcessTransaction(t *testing.T) {
 				m.On("WithDBTransaction", mock.Anything).Return(nil)
 				m.On("GetTransactionByID", loseID).Return(nil, repository.ErrTransactionNotFound)
 				m.On("InsertTransaction", mock.Anything).Return(nil)
-				m.On("UpdateUserBalance", 2, decimal.NewFromInt(50).Neg()).Return(nil)
+				m.On("PostJournalEntry", mock.Anything).Return(nil)
+				m.On("LockWallet", 2, model.CurrencyEUR).Return(decimal.NewFromInt(200), nil)
+				m.On("UpdateWalletBalance", 2, model.CurrencyEUR, decimal.NewFromInt(50).Neg()).Return(decimal.NewFromInt(150), nil)
+				m.On("ListUserLimits", 2).Return(nil, nil)
+				m.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+			},
+			wantErr:   false,
+			wantDelta: decimal.NewFromInt(50).Neg(),
+		},
+		{
+			name: "lose within loss limit",
+			tx: &model.Transaction{
+				ID:     uuid.New(),
+				UserID: 2,
+				State:  model.TransactionStateLose,
+				Amount: decimal.NewFromInt(50),
+			},
+			setupMock: func(m *MockRepository) {
+				m.On("WithDBTransaction", mock.Anything).Return(nil)
+				m.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("InsertTransaction", mock.Anything).Return(nil)
+				m.On("PostJournalEntry", mock.Anything).Return(nil)
+				m.On("LockWallet", 2, model.CurrencyEUR).Return(decimal.NewFromInt(200), nil)
+				m.On("UpdateWalletBalance", 2, model.CurrencyEUR, decimal.NewFromInt(50).Neg()).Return(decimal.NewFromInt(150), nil)
+				m.On("ListUserLimits", 2).Return([]model.UserLimit{
+					{UserID: 2, Currency: model.CurrencyEUR, Period: model.LimitPeriodDaily, Amount: decimal.NewFromInt(100)},
+					// Limits in other currencies do not apply.
+					{UserID: 2, Currency: model.CurrencyUSD, Period: model.LimitPeriodDaily, Amount: decimal.Zero},
+				}, nil)
+				m.On("GetNetLoss", 2, model.CurrencyEUR, mock.Anything).Return(decimal.NewFromInt(50), nil)
+				m.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
 			},
 			wantErr:   false,
 			wantDelta: decimal.NewFromInt(50).Neg(),
 		},
 		{
-			name: "duplicate",
+			name: "lose exceeding loss limit",
+			tx: &model.Transaction{
+				ID:     uuid.New(),
+				UserID: 2,
+				State:  model.TransactionStateLose,
+				Amount: decimal.NewFromInt(50),
+			},
+			setupMock: func(m *MockRepository) {
+				m.On("WithDBTransaction", mock.Anything).Return(nil)
+				m.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("LockWallet", 2, model.CurrencyEUR).Return(decimal.NewFromInt(200), nil)
+				m.On("UpdateWalletBalance", 2, model.CurrencyEUR, decimal.NewFromInt(50).Neg()).Return(decimal.NewFromInt(150), nil)
+				m.On("ListUserLimits", 2).Return([]model.UserLimit{
+					{UserID: 2, Currency: model.CurrencyEUR, Period: model.LimitPeriodWeekly, Amount: decimal.NewFromInt(100)},
+				}, nil)
+				m.On("GetNetLoss", 2, model.CurrencyEUR, mock.Anything).Return(decimal.RequireFromString("50.01"), nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate with different payload",
 			tx: &model.Transaction{
 				ID:     duplicateID,
 				UserID: 1,
@@ -136,6 +603,9 @@ func TestProcessTransaction(t *testing.T) {
 			setupMock: func(m *MockRepository) {
 				m.On("WithDBTransaction", mock.Anything).Return(nil)
 				m.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(10)).Return(decimal.NewFromInt(110), nil)
+				m.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
 				m.On("InsertTransaction", mock.Anything).Return(errors.New("insert failed"))
 			},
 			wantErr: true,
@@ -151,8 +621,9 @@ func TestProcessTransaction(t *testing.T) {
 			setupMock: func(m *MockRepository) {
 				m.On("WithDBTransaction", mock.Anything).Return(nil)
 				m.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
-				m.On("InsertTransaction", mock.Anything).Return(nil)
-				m.On("UpdateUserBalance", 1, decimal.NewFromInt(5).Neg()).Return(errors.New("update failed"))
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(5), nil)
+				m.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(5).Neg()).
+					Return(decimal.Zero, errors.New("update failed"))
 			},
 			wantErr: true,
 		},
@@ -171,12 +642,10 @@ func TestProcessTransaction(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "nil transaction id",
-			tx:   &model.Transaction{UserID: 1, State: model.TransactionStateWin, Amount: decimal.NewFromInt(5)},
-			setupMock: func(m *MockRepository) {
-				m.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
-			},
-			wantErr: true,
+			name:      "nil transaction id",
+			tx:        &model.Transaction{UserID: 1, State: model.TransactionStateWin, Amount: decimal.NewFromInt(5)},
+			setupMock: func(_ *MockRepository) {},
+			wantErr:   true,
 		},
 	}
 
@@ -186,8 +655,8 @@ func TestProcessTransaction(t *testing.T) {
 
 			repo := &MockRepository{}
 			tt.setupMock(repo)
-			svc := NewTransactionService(repo)
-			err := svc.ProcessTransaction(ctx, tt.tx)
+			svc := newTestService(repo)
+			_, err := svc.ProcessTransaction(ctx, tt.tx)
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -195,56 +664,2515 @@ func TestProcessTransaction(t *testing.T) {
 				require.NoError(t, err)
 				require.Len(t, repo.balanceUpdates, 1)
 				assert.True(t, repo.balanceUpdates[0].delta.Equal(tt.wantDelta))
+
+				require.Len(t, repo.journalEntries, 1)
+				entry := repo.journalEntries[0]
+				require.NoError(t, entry.Validate(), "journal entry should be balanced")
+				assert.Equal(t, &tt.tx.ID, entry.TransactionID)
+				assert.Equal(t, model.WalletAccount(tt.tx.UserID, model.CurrencyEUR), entry.Postings[0].Account)
+				assert.True(t, entry.Postings[0].Amount.Equal(tt.wantDelta))
+				assert.Equal(t, model.LedgerAccountHouse, entry.Postings[1].Account.Type)
 			}
 			repo.AssertExpectations(t)
 		})
 	}
 }
 
-func TestGetBalance(t *testing.T) {
+func TestProcessTransactionIdempotency(t *testing.T) {
+	txID := uuid.New()
+	createdAt := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	stored := &model.Transaction{
+		ID:           txID,
+		UserID:       1,
+		State:        model.TransactionStateWin,
+		Amount:       decimal.NewFromInt(10),
+		Currency:     model.CurrencyEUR,
+		SourceType:   model.SourceTypeGame,
+		CreatedAt:    createdAt,
+		BalanceAfter: decimal.NewNullDecimal(decimal.NewFromInt(110)),
+	}
+
+	retry := func() *model.Transaction {
+		return &model.Transaction{
+			ID:         txID,
+			UserID:     1,
+			State:      model.TransactionStateWin,
+			Amount:     decimal.RequireFromString("10.00"),
+			SourceType: model.SourceTypeGame,
+		}
+	}
+
 	tests := []struct {
 		name      string
-		userID    int
+		tx        *model.Transaction
 		setupMock func(m *MockRepository)
-		wantErr   bool
-		wantValue decimal.Decimal
+		wantErr   error
 	}{
 		{
-			name:   "success",
-			userID: 1,
+			name: "retry with same payload is replayed",
+			tx:   retry(),
 			setupMock: func(m *MockRepository) {
-				m.On("GetBalanceByID", 1).Return(decimal.RequireFromString("42.50"), nil)
+				m.On("GetTransactionByID", txID).Return(stored, nil)
 			},
-			wantErr:   false,
-			wantValue: decimal.RequireFromString("42.50"),
 		},
 		{
-			name:   "repo error",
-			userID: 2,
+			name: "same ID with different amount conflicts",
+			tx: func() *model.Transaction {
+				tx := retry()
+				tx.Amount = decimal.NewFromInt(11)
+				return tx
+			}(),
 			setupMock: func(m *MockRepository) {
-				m.On("GetBalanceByID", 2).Return(decimal.Zero, errors.New("db error"))
+				m.On("GetTransactionByID", txID).Return(stored, nil)
+			},
+			wantErr: repository.ErrDuplicateTransaction,
+		},
+		{
+			name: "same ID with different currency conflicts",
+			tx: func() *model.Transaction {
+				tx := retry()
+				tx.Currency = model.CurrencyUSD
+				return tx
+			}(),
+			setupMock: func(m *MockRepository) {
+				m.On("GetTransactionByID", txID).Return(stored, nil)
+			},
+			wantErr: repository.ErrDuplicateTransaction,
+		},
+		{
+			name: "same ID with different user conflicts",
+			tx: func() *model.Transaction {
+				tx := retry()
+				tx.UserID = 2
+				return tx
+			}(),
+			setupMock: func(m *MockRepository) {
+				m.On("GetTransactionByID", txID).Return(stored, nil)
+			},
+			wantErr: repository.ErrDuplicateTransaction,
+		},
+		{
+			name: "concurrent duplicate detected on insert is replayed",
+			tx:   retry(),
+			setupMock: func(m *MockRepository) {
+				m.On("GetTransactionByID", txID).Return(nil, repository.ErrTransactionNotFound).Once()
+				m.On("WithDBTransaction", mock.Anything).Return(nil)
+				m.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.RequireFromString("10.00")).
+					Return(decimal.NewFromInt(120), nil)
+				m.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+				m.On("InsertTransaction", mock.Anything).Return(repository.ErrDuplicateTransaction)
+				m.On("GetTransactionByID", txID).Return(stored, nil).Once()
 			},
-			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
-
 			repo := &MockRepository{}
 			tt.setupMock(repo)
-			svc := NewTransactionService(repo)
-			balance, err := svc.GetBalance(ctx, tt.userID)
+			svc := newTestService(repo)
 
-			if tt.wantErr {
-				require.Error(t, err)
+			processed, err := svc.ProcessTransaction(context.Background(), tt.tx)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
 			} else {
 				require.NoError(t, err)
-				assert.True(t, tt.wantValue.Equal(balance))
+				assert.True(t, processed.Replayed)
+				assert.Equal(t, txID, processed.TransactionID)
+				assert.Equal(t, createdAt, processed.ProcessedAt)
+				assert.True(t, processed.Balance.Decimal.Equal(decimal.NewFromInt(110)))
 			}
 
 			repo.AssertExpectations(t)
 		})
 	}
 }
+
+func TestProcessRollback(t *testing.T) {
+	rollbackID := uuid.New()
+	originalID := uuid.New()
+
+	original := &model.Transaction{
+		ID:         originalID,
+		UserID:     1,
+		State:      model.TransactionStateWin,
+		Amount:     decimal.NewFromInt(10),
+		Currency:   model.CurrencyEUR,
+		SourceType: model.SourceTypeGame,
+	}
+
+	rollback := func() *model.Transaction {
+		return &model.Transaction{
+			ID:                    rollbackID,
+			UserID:                1,
+			State:                 model.TransactionStateRollback,
+			SourceType:            model.SourceTypeGame,
+			OriginalTransactionID: &originalID,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		setupMock   func(m *MockRepository)
+		wantErr     error
+		wantAmount  decimal.Decimal
+		wantBalance decimal.Decimal
+	}{
+		{
+			name: "reverses original win",
+			setupMock: func(m *MockRepository) {
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(110), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(original, nil)
+				m.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(-10)).Return(decimal.NewFromInt(100), nil)
+				m.On("InsertTransaction", mock.Anything).Return(nil)
+				m.On("PostJournalEntry", mock.Anything).Return(nil)
+			},
+			wantAmount:  decimal.NewFromInt(10),
+			wantBalance: decimal.NewFromInt(100),
+		},
+		{
+			name: "reverses original in its currency",
+			setupMock: func(m *MockRepository) {
+				usdOriginal := *original
+				usdOriginal.Currency = model.CurrencyUSD
+
+				m.On("GetTransactionByID", originalID).Return(&usdOriginal, nil)
+				m.On("LockWallet", 1, model.CurrencyUSD).Return(decimal.NewFromInt(30), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("UpdateWalletBalance", 1, model.CurrencyUSD, decimal.NewFromInt(-10)).
+					Return(decimal.NewFromInt(20), nil)
+				m.On("InsertTransaction", mock.Anything).Return(nil)
+				m.On("PostJournalEntry", mock.Anything).Return(nil)
+			},
+			wantAmount:  decimal.NewFromInt(10),
+			wantBalance: decimal.NewFromInt(20),
+		},
+		{
+			name: "stores tombstone when original is unknown",
+			setupMock: func(m *MockRepository) {
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(100), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("InsertTransaction", mock.Anything).Return(nil)
+			},
+			wantAmount:  decimal.Zero,
+			wantBalance: decimal.NewFromInt(100),
+		},
+		{
+			name: "refuses to roll back twice",
+			setupMock: func(m *MockRepository) {
+				m.On("GetTransactionByID", originalID).Return(original, nil)
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(100), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(&model.Transaction{ID: uuid.New()}, nil)
+			},
+			wantErr: ErrAlreadyRolledBack,
+		},
+		{
+			name: "refuses original of another user",
+			setupMock: func(m *MockRepository) {
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(100), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(&model.Transaction{
+					ID:       originalID,
+					UserID:   2,
+					State:    model.TransactionStateWin,
+					Amount:   decimal.NewFromInt(10),
+					Currency: model.CurrencyEUR,
+				}, nil)
+			},
+			wantErr: ErrInvalidTransaction,
+		},
+		{
+			name: "refuses original of another source type",
+			setupMock: func(m *MockRepository) {
+				payment := *original
+				payment.SourceType = model.SourceTypePayment
+
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(110), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(&payment, nil)
+			},
+			wantErr: ErrSourceTypeForbidden,
+		},
+		{
+			name: "refuses original of another provider",
+			setupMock: func(m *MockRepository) {
+				other := *original
+				other.Provider = "other"
+
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(110), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(&other, nil)
+			},
+			wantErr: ErrSourceTypeForbidden,
+		},
+		{
+			name: "refuses to roll back a rollback",
+			setupMock: func(m *MockRepository) {
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(100), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(&model.Transaction{
+					ID:       originalID,
+					UserID:   1,
+					State:    model.TransactionStateRollback,
+					Currency: model.CurrencyEUR,
+				}, nil)
+			},
+			wantErr: ErrInvalidTransaction,
+		},
+		{
+			name: "refuses to roll back a manual adjustment",
+			setupMock: func(m *MockRepository) {
+				manual := *original
+				manual.SourceType = model.SourceTypeManual
+
+				m.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(110), nil)
+				m.On("GetRollbackByOriginalID", originalID).Return(nil, repository.ErrTransactionNotFound)
+				m.On("GetTransactionByID", originalID).Return(&manual, nil)
+			},
+			wantErr: ErrInvalidTransaction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetTransactionByID", rollbackID).Return(nil, repository.ErrTransactionNotFound).Once()
+			repo.On("WithDBTransaction", mock.Anything).Return(nil)
+			tt.setupMock(repo)
+			svc := newTestService(repo)
+
+			tx := rollback()
+			processed, err := svc.ProcessTransaction(context.Background(), tx)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, tt.wantAmount.Equal(processed.Amount))
+				assert.True(t, tt.wantBalance.Equal(processed.Balance.Decimal))
+				assert.Equal(t, &originalID, processed.OriginalTransactionID)
+
+				if tt.wantAmount.IsZero() {
+					assert.Empty(t, repo.journalEntries, "a tombstone moves no money")
+				} else {
+					require.Len(t, repo.journalEntries, 1)
+					entry := repo.journalEntries[0]
+					require.NoError(t, entry.Validate(), "journal entry should be balanced")
+					assert.Equal(t, model.HouseAccount(model.SourceTypeGame, processed.Currency), entry.Postings[1].Account)
+					assert.True(t, tt.wantAmount.Equal(entry.Postings[1].Amount), "the house should get the win back")
+				}
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProcessTransactionAfterRollback(t *testing.T) {
+	txID := uuid.New()
+
+	repo := &MockRepository{}
+	repo.On("GetTransactionByID", txID).Return(nil, repository.ErrTransactionNotFound)
+	repo.On("WithDBTransaction", mock.Anything).Return(nil)
+	repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(10)).Return(decimal.NewFromInt(110), nil)
+	repo.On("GetRollbackByOriginalID", txID).Return(&model.Transaction{
+		ID:                    uuid.New(),
+		UserID:                1,
+		State:                 model.TransactionStateRollback,
+		OriginalTransactionID: &txID,
+	}, nil)
+	svc := newTestService(repo)
+
+	_, err := svc.ProcessTransaction(context.Background(), &model.Transaction{
+		ID:     txID,
+		UserID: 1,
+		State:  model.TransactionStateWin,
+		Amount: decimal.NewFromInt(10),
+	})
+
+	require.ErrorIs(t, err, ErrTransactionRolledBack)
+	repo.AssertExpectations(t)
+}
+
+func TestProcessTransactionWithReservationID(t *testing.T) {
+	txID := uuid.New()
+
+	repo := &MockRepository{}
+	repo.On("GetTransactionByID", txID).Return(nil, repository.ErrTransactionNotFound)
+	repo.On("WithDBTransaction", mock.Anything).Return(nil)
+	repo.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(100), nil)
+	repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(-30)).Return(decimal.NewFromInt(70), nil)
+	repo.On("ListUserLimits", 1).Return(nil, nil)
+	repo.On("GetRollbackByOriginalID", txID).Return(nil, repository.ErrTransactionNotFound)
+	repo.On("GetReservation", txID).Return(&model.Reservation{
+		ID:       txID,
+		UserID:   1,
+		Currency: model.CurrencyEUR,
+		Amount:   decimal.NewFromInt(30),
+		Status:   model.ReservationHeld,
+	}, nil)
+	svc := newTestService(repo)
+
+	_, err := svc.ProcessTransaction(context.Background(), &model.Transaction{
+		ID:     txID,
+		UserID: 1,
+		State:  model.TransactionStateLose,
+		Amount: decimal.NewFromInt(30),
+	})
+
+	require.ErrorIs(t, err, ErrTransactionReserved)
+	repo.AssertNotCalled(t, "InsertTransaction", mock.Anything)
+	repo.AssertExpectations(t)
+}
+
+func TestProcessTransactionUserStatus(t *testing.T) {
+	process := func(repo *MockRepository, state model.TransactionState, opts ...Option) error {
+		_, err := newTestService(repo, opts...).ProcessTransaction(context.Background(), &model.Transaction{
+			ID:     uuid.New(),
+			UserID: 1,
+			State:  state,
+			Amount: decimal.NewFromInt(10),
+		})
+
+		return err
+	}
+
+	rejecting := func(status model.UserStatus) *MockRepository {
+		repo := &MockRepository{userStatuses: map[int]model.UserStatus{1: status}}
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+
+		return repo
+	}
+
+	t.Run("suspended user cannot lose", func(t *testing.T) {
+		repo := rejecting(model.UserStatusSuspended)
+
+		require.ErrorIs(t, process(repo, model.TransactionStateLose), ErrUserSuspended)
+		repo.AssertNotCalled(t, "LockWallet", mock.Anything, mock.Anything)
+	})
+
+	t.Run("wins still land on suspended users", func(t *testing.T) {
+		repo := rejecting(model.UserStatusSuspended)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(10)).
+			Return(decimal.NewFromInt(110), nil)
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		require.NoError(t, process(repo, model.TransactionStateWin))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("closed user cannot win", func(t *testing.T) {
+		repo := rejecting(model.UserStatusClosed)
+
+		require.ErrorIs(t, process(repo, model.TransactionStateWin), ErrUserClosed)
+	})
+
+	t.Run("configured policy", func(t *testing.T) {
+		repo := rejecting(model.UserStatusSuspended)
+		policy := model.UserStatusPolicy{model.UserStatusSuspended: {model.TransactionStateRollback}}
+
+		require.ErrorIs(t, process(repo, model.TransactionStateWin, WithUserStatusPolicy(policy)), ErrUserSuspended)
+	})
+}
+
+func TestUserService(t *testing.T) {
+	user := func(status model.UserStatus) *model.User {
+		return &model.User{ID: 5, Status: status, Wallets: []model.Wallet{}}
+	}
+
+	t.Run("create user with a wallet", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("InsertUser", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*model.User).ID = 5
+		}).Return(nil)
+		repo.On("CreateWallet", 5, model.CurrencyEUR).Return(nil)
+		repo.On("GetUser", 5).Return(user(model.UserStatusActive), nil)
+
+		created, err := NewUserService(repo, model.CurrencyEUR).CreateUser(context.Background(), "")
+
+		require.NoError(t, err)
+		assert.Equal(t, 5, created.ID)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("suspend", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockUser", 5).Return(user(model.UserStatusActive), nil)
+		repo.On("UpdateUserStatus", mock.MatchedBy(func(u *model.User) bool {
+			return u.ID == 5 && u.Status == model.UserStatusSuspended
+		})).Return(nil)
+		repo.On("GetUser", 5).Return(user(model.UserStatusSuspended), nil)
+
+		updated, err := NewUserService(repo, model.CurrencyEUR).
+			SetUserStatus(context.Background(), 5, model.UserStatusSuspended)
+
+		require.NoError(t, err)
+		assert.Equal(t, model.UserStatusSuspended, updated.Status)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("same status is a no-op", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockUser", 5).Return(user(model.UserStatusClosed), nil)
+		repo.On("GetUser", 5).Return(user(model.UserStatusClosed), nil)
+
+		_, err := NewUserService(repo, model.CurrencyEUR).SetUserStatus(context.Background(), 5, model.UserStatusClosed)
+
+		require.NoError(t, err)
+		repo.AssertNotCalled(t, "UpdateUserStatus", mock.Anything)
+	})
+
+	t.Run("closed user cannot be reopened", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockUser", 5).Return(user(model.UserStatusClosed), nil)
+
+		_, err := NewUserService(repo, model.CurrencyEUR).SetUserStatus(context.Background(), 5, model.UserStatusActive)
+
+		require.ErrorIs(t, err, ErrUserClosed)
+		repo.AssertNotCalled(t, "UpdateUserStatus", mock.Anything)
+	})
+}
+
+func TestProcessBatch(t *testing.T) {
+	newWin := func(userID int, amount int64) *model.Transaction {
+		return &model.Transaction{
+			ID:         uuid.New(),
+			UserID:     userID,
+			State:      model.TransactionStateWin,
+			Amount:     decimal.NewFromInt(amount),
+			SourceType: model.SourceTypeGame,
+		}
+	}
+
+	t.Run("atomic applies all transactions in one database transaction", func(t *testing.T) {
+		txs := []*model.Transaction{newWin(2, 5), newWin(1, 10)}
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil).Once()
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(10)).Return(decimal.NewFromInt(110), nil)
+		repo.On("UpdateWalletBalance", 2, model.CurrencyEUR, decimal.NewFromInt(5)).Return(decimal.NewFromInt(205), nil)
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		results, err := newTestService(repo).ProcessBatch(context.Background(), txs, model.BatchModeAtomic)
+
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, txs[0].ID, results[0].Transaction.TransactionID)
+		assert.Equal(t, txs[1].ID, results[1].Transaction.TransactionID)
+		require.Len(t, repo.balanceUpdates, 2)
+		assert.Equal(t, 1, repo.balanceUpdates[0].userID, "users should be locked in ascending order")
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("atomic reports the failing item", func(t *testing.T) {
+		txs := []*model.Transaction{newWin(1, 10), newWin(9, 10)}
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil).Once()
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(10)).Return(decimal.NewFromInt(110), nil)
+		repo.On("UpdateWalletBalance", 9, model.CurrencyEUR, decimal.NewFromInt(10)).
+			Return(decimal.Zero, repository.ErrUserNotFound)
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		results, err := newTestService(repo).ProcessBatch(context.Background(), txs, model.BatchModeAtomic)
+
+		require.ErrorIs(t, err, ErrUserNotFound)
+		assert.Nil(t, results)
+
+		var itemErr *BatchItemError
+		require.ErrorAs(t, err, &itemErr)
+		assert.Equal(t, 1, itemErr.Index)
+		assert.Equal(t, txs[1].ID, itemErr.TransactionID)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("independent reports a result per item", func(t *testing.T) {
+		txs := []*model.Transaction{newWin(1, 10), newWin(9, 10)}
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil).Twice()
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(10)).Return(decimal.NewFromInt(110), nil)
+		repo.On("UpdateWalletBalance", 9, model.CurrencyEUR, decimal.NewFromInt(10)).
+			Return(decimal.Zero, repository.ErrUserNotFound)
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		results, err := newTestService(repo).ProcessBatch(context.Background(), txs, model.BatchModeIndependent)
+
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.NoError(t, results[0].Err)
+		assert.Equal(t, txs[0].ID, results[0].Transaction.TransactionID)
+		require.ErrorIs(t, results[1].Err, ErrUserNotFound)
+		assert.Nil(t, results[1].Transaction)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestGetBalance(t *testing.T) {
+	tests := []struct {
+		name         string
+		userID       int
+		currency     model.Currency
+		setupMock    func(m *MockRepository)
+		wantErr      bool
+		wantCurrency model.Currency
+		wantValue    decimal.Decimal
+	}{
+		{
+			name:   "default currency",
+			userID: 1,
+			setupMock: func(m *MockRepository) {
+				m.On("GetWallet", 1, model.CurrencyEUR).Return(&model.Wallet{
+					UserID:   1,
+					Currency: model.CurrencyEUR,
+					Balance:  decimal.RequireFromString("42.50"),
+				}, nil)
+			},
+			wantErr:      false,
+			wantCurrency: model.CurrencyEUR,
+			wantValue:    decimal.RequireFromString("42.50"),
+		},
+		{
+			name:     "requested currency",
+			userID:   1,
+			currency: model.CurrencyUSD,
+			setupMock: func(m *MockRepository) {
+				m.On("GetWallet", 1, model.CurrencyUSD).Return(&model.Wallet{
+					UserID:   1,
+					Currency: model.CurrencyUSD,
+					Balance:  decimal.RequireFromString("7.00"),
+				}, nil)
+			},
+			wantErr:      false,
+			wantCurrency: model.CurrencyUSD,
+			wantValue:    decimal.RequireFromString("7.00"),
+		},
+		{
+			name:   "repo error",
+			userID: 2,
+			setupMock: func(m *MockRepository) {
+				m.On("GetWallet", 2, model.CurrencyEUR).Return(nil, errors.New("db error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			repo := &MockRepository{}
+			tt.setupMock(repo)
+			svc := newTestService(repo)
+			wallet, err := svc.GetBalance(ctx, tt.userID, tt.currency)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantCurrency, wallet.Currency)
+				assert.True(t, tt.wantValue.Equal(wallet.Balance))
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListWallets(t *testing.T) {
+	wallets := []model.Wallet{
+		{UserID: 1, Currency: model.CurrencyEUR, Balance: decimal.NewFromInt(100)},
+		{UserID: 1, Currency: model.CurrencyUSD, Balance: decimal.NewFromInt(5)},
+	}
+
+	repo := &MockRepository{}
+	repo.On("GetUser", 1).Return(&model.User{ID: 1, Wallets: wallets}, nil)
+	repo.On("GetUser", 9).Return(nil, repository.ErrUserNotFound)
+	svc := newTestService(repo)
+
+	got, err := svc.ListWallets(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, wallets, got)
+
+	_, err = svc.ListWallets(context.Background(), 9)
+	require.ErrorIs(t, err, ErrUserNotFound)
+
+	repo.AssertExpectations(t)
+}
+
+func TestProcessTransactionMissingWallet(t *testing.T) {
+	newWin := func() *model.Transaction {
+		return &model.Transaction{
+			ID:       uuid.New(),
+			UserID:   1,
+			State:    model.TransactionStateWin,
+			Amount:   decimal.NewFromInt(10),
+			Currency: model.CurrencyGBP,
+		}
+	}
+
+	t.Run("rejected without auto-creation", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyGBP, decimal.NewFromInt(10)).
+			Return(decimal.Zero, repository.ErrWalletNotFound)
+
+		_, err := newTestService(repo).ProcessTransaction(context.Background(), newWin())
+
+		require.ErrorIs(t, err, ErrWalletNotFound)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("created with auto-creation", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyGBP, decimal.NewFromInt(10)).
+			Return(decimal.Zero, repository.ErrWalletNotFound).Once()
+		repo.On("CreateWallet", 1, model.CurrencyGBP).Return(nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyGBP, decimal.NewFromInt(10)).
+			Return(decimal.NewFromInt(10), nil).Once()
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		svc := newTestService(repo, WithWalletAutoCreate(true))
+		processed, err := svc.ProcessTransaction(context.Background(), newWin())
+
+		require.NoError(t, err)
+		assert.Equal(t, model.CurrencyGBP, processed.Currency)
+		assert.True(t, processed.Balance.Decimal.Equal(decimal.NewFromInt(10)))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("default currency applies when none is given", func(t *testing.T) {
+		tx := newWin()
+		tx.Currency = ""
+
+		repo := &MockRepository{}
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyUSD, decimal.NewFromInt(10)).
+			Return(decimal.NewFromInt(20), nil)
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		svc := newTestService(repo, WithDefaultCurrency(model.CurrencyUSD))
+		processed, err := svc.ProcessTransaction(context.Background(), tx)
+
+		require.NoError(t, err)
+		assert.Equal(t, model.CurrencyUSD, processed.Currency)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestListTransactions(t *testing.T) {
+	base := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	history := make([]model.Transaction, 3)
+	for i := range history {
+		history[i] = model.Transaction{
+			ID:        uuid.New(),
+			UserID:    1,
+			State:     model.TransactionStateWin,
+			Amount:    decimal.NewFromInt(int64(i + 1)),
+			CreatedAt: base.Add(-time.Duration(i) * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		filter         model.TransactionFilter
+		setupMock      func(m *MockRepository)
+		wantErr        error
+		wantCount      int
+		wantNextCursor *model.TransactionCursor
+	}{
+		{
+			name:   "last page",
+			filter: model.TransactionFilter{UserID: 1, Limit: 3},
+			setupMock: func(m *MockRepository) {
+				m.On("GetUser", 1).Return(&model.User{ID: 1}, nil)
+				m.On("ListTransactionsByUser", model.TransactionFilter{UserID: 1, Limit: 4}).Return(history, nil)
+			},
+			wantCount: 3,
+		},
+		{
+			name:   "more pages available",
+			filter: model.TransactionFilter{UserID: 1, Limit: 2},
+			setupMock: func(m *MockRepository) {
+				m.On("GetUser", 1).Return(&model.User{ID: 1}, nil)
+				m.On("ListTransactionsByUser", model.TransactionFilter{UserID: 1, Limit: 3}).Return(history, nil)
+			},
+			wantCount:      2,
+			wantNextCursor: &model.TransactionCursor{CreatedAt: history[1].CreatedAt, ID: history[1].ID},
+		},
+		{
+			name:   "default limit",
+			filter: model.TransactionFilter{UserID: 1},
+			setupMock: func(m *MockRepository) {
+				m.On("GetUser", 1).Return(&model.User{ID: 1}, nil)
+				m.On("ListTransactionsByUser", model.TransactionFilter{UserID: 1, Limit: DefaultPageSize + 1}).
+					Return([]model.Transaction{}, nil)
+			},
+			wantCount: 0,
+		},
+		{
+			name:   "unknown user",
+			filter: model.TransactionFilter{UserID: 9, Limit: 2},
+			setupMock: func(m *MockRepository) {
+				m.On("GetUser", 9).Return(nil, repository.ErrUserNotFound)
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			tt.setupMock(repo)
+			svc := newTestService(repo)
+
+			page, err := svc.ListTransactions(context.Background(), tt.filter)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Len(t, page.Transactions, tt.wantCount)
+
+				if tt.wantNextCursor == nil {
+					assert.Empty(t, page.NextCursor)
+				} else {
+					cursor, err := model.DecodeTransactionCursor(page.NextCursor)
+					require.NoError(t, err)
+					assert.True(t, tt.wantNextCursor.CreatedAt.Equal(cursor.CreatedAt))
+					assert.Equal(t, tt.wantNextCursor.ID, cursor.ID)
+				}
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetUserTransaction(t *testing.T) {
+	txID := uuid.New()
+	stored := &model.Transaction{ID: txID, UserID: 1, State: model.TransactionStateWin, Amount: decimal.NewFromInt(5)}
+
+	tests := []struct {
+		name    string
+		userID  int
+		stored  *model.Transaction
+		repoErr error
+		wantErr error
+	}{
+		{name: "owned by user", userID: 1, stored: stored},
+		{name: "owned by another user", userID: 2, stored: stored, wantErr: ErrTransactionNotFound},
+		{name: "unknown", userID: 1, repoErr: repository.ErrTransactionNotFound, wantErr: ErrTransactionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("GetTransactionByID", txID).Return(tt.stored, tt.repoErr)
+			svc := newTestService(repo)
+
+			tx, err := svc.GetUserTransaction(context.Background(), tt.userID, txID)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, tx)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, stored, tx)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	amount := func(value int64) decimal.Decimal { return decimal.NewFromInt(value) }
+
+	drifts := func() []model.BalanceDrift {
+		return []model.BalanceDrift{
+			{
+				UserID:     1,
+				Currency:   model.CurrencyEUR,
+				Actual:     model.Balances{Real: amount(120), Bonus: amount(5)},
+				Expected:   model.Balances{Real: amount(100), Bonus: amount(10)},
+				Difference: model.Balances{Real: amount(20), Bonus: amount(-5)},
+			},
+			{
+				UserID:     2,
+				Currency:   model.CurrencyUSD,
+				Actual:     model.Balances{Real: amount(5)},
+				Expected:   model.Balances{Real: amount(10)},
+				Difference: model.Balances{Real: amount(-5)},
+			},
+		}
+	}
+
+	t.Run("reports drift from the history and from the ledger without adjusting", func(t *testing.T) {
+		ledgerDrifts := drifts()[1:]
+
+		repo := &MockRepository{}
+		repo.On("FindBalanceDrifts").Return(drifts(), nil)
+		repo.On("FindLedgerDrifts").Return(ledgerDrifts, nil)
+
+		report, err := NewReconciler(repo).Reconcile(context.Background(), false, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, drifts(), report.Drifts)
+		assert.Equal(t, ledgerDrifts, report.LedgerDrifts)
+		assert.True(t, report.Drifted())
+		assert.Empty(t, repo.balanceUpdates)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("adjusts every drifted balance to the history", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("FindBalanceDrifts").Return(drifts(), nil)
+		repo.On("FindLedgerDrifts").Return([]model.BalanceDrift{}, nil)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 1, model.CurrencyEUR).
+			Return(&model.Wallet{Balance: amount(120), BonusBalance: amount(5), HeldBalance: amount(3)}, nil)
+		repo.On("GetExpectedBalances", 1, model.CurrencyEUR).
+			Return(model.Balances{Real: amount(100), Bonus: amount(10), Held: amount(3)}, nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, amount(-20)).Return(amount(100), nil)
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyEUR, amount(5)).Return(&model.Wallet{}, nil)
+		repo.On("InsertBalanceAdjustment", mock.MatchedBy(func(a *model.BalanceAdjustment) bool {
+			return a.UserID == 1 && a.BalanceType == model.BalanceReal && a.Reason == "nightly fix" &&
+				a.NewBalance.Equal(amount(100))
+		})).Return(nil).Once()
+		repo.On("InsertBalanceAdjustment", mock.MatchedBy(func(a *model.BalanceAdjustment) bool {
+			return a.UserID == 1 && a.BalanceType == model.BalanceBonus && a.PreviousBalance.Equal(amount(5)) &&
+				a.NewBalance.Equal(amount(10))
+		})).Return(nil).Once()
+		// The ledger booked the drift along with the wallet.
+		repo.On("GetLedgerBalances", 1, model.CurrencyEUR).
+			Return(model.Balances{Real: amount(120), Bonus: amount(5), Held: amount(3)}, nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+		// The second wallet was corrected concurrently.
+		repo.On("LockWallet", 2, model.CurrencyUSD).Return(amount(10), nil)
+		repo.On("GetExpectedBalances", 2, model.CurrencyUSD).Return(model.Balances{Real: amount(10)}, nil)
+		repo.On("GetLedgerBalances", 2, model.CurrencyUSD).Return(model.Balances{Real: amount(10)}, nil)
+
+		report, err := NewReconciler(repo).Reconcile(context.Background(), true, "nightly fix")
+
+		require.NoError(t, err)
+		require.Len(t, report.Drifts, 2)
+		assert.True(t, report.Drifts[0].Adjusted)
+		assert.True(t, report.Drifts[1].Adjusted)
+		require.Len(t, repo.balanceUpdates, 1)
+		require.Len(t, repo.journalEntries, 1)
+		require.NoError(t, repo.journalEntries[0].Validate())
+		assert.Equal(t, []model.Posting{
+			{Account: model.WalletAccount(1, model.CurrencyEUR), Amount: amount(-20)},
+			{Account: model.BonusAccount(1, model.CurrencyEUR), Amount: amount(5)},
+			{Account: model.EquityAccount(model.CurrencyEUR), Amount: amount(15)},
+		}, repo.journalEntries[0].Postings)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("books the correction of a wallet the ledger did not follow", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("FindBalanceDrifts").Return(drifts()[1:], nil)
+		repo.On("FindLedgerDrifts").Return(drifts()[1:], nil)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 2, model.CurrencyUSD).Return(amount(5), nil)
+		repo.On("GetExpectedBalances", 2, model.CurrencyUSD).Return(model.Balances{Real: amount(10)}, nil)
+		repo.On("UpdateWalletBalance", 2, model.CurrencyUSD, amount(5)).Return(amount(10), nil)
+		repo.On("InsertBalanceAdjustment", mock.Anything).Return(nil)
+		repo.On("GetLedgerBalances", 2, model.CurrencyUSD).Return(model.Balances{Real: amount(10)}, nil)
+
+		report, err := NewReconciler(repo).Reconcile(context.Background(), true, "nightly fix")
+
+		require.NoError(t, err)
+		assert.True(t, report.Drifts[0].Adjusted)
+		assert.Empty(t, repo.journalEntries, "the ledger already holds the expected balance")
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("only reports drift from the ledger", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("FindBalanceDrifts").Return([]model.BalanceDrift{}, nil)
+		repo.On("FindLedgerDrifts").Return(drifts(), nil)
+
+		report, err := NewReconciler(repo).Reconcile(context.Background(), true, "nightly fix")
+
+		require.NoError(t, err)
+		assert.True(t, report.Drifted())
+		assert.False(t, report.LedgerDrifts[0].Adjusted)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("reports failed adjustments per wallet", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("FindBalanceDrifts").Return(drifts()[:1], nil)
+		repo.On("FindLedgerDrifts").Return([]model.BalanceDrift{}, nil)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.Zero, repository.ErrUnavailable)
+
+		report, err := NewReconciler(repo).Reconcile(context.Background(), true, "nightly fix")
+
+		require.NoError(t, err)
+		assert.False(t, report.Drifts[0].Adjusted)
+		assert.NotEmpty(t, report.Drifts[0].Error)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("requires a reason to adjust", func(t *testing.T) {
+		_, err := NewReconciler(&MockRepository{}).Reconcile(context.Background(), true, "")
+
+		require.ErrorIs(t, err, ErrMissingReason)
+	})
+}
+
+func TestSourceTypeCheck(t *testing.T) {
+	registry := []model.SourceTypeSettings{
+		{
+			Name:          model.SourceTypeGame,
+			DisplayName:   "Game",
+			Enabled:       true,
+			AllowedStates: []model.TransactionState{model.TransactionStateWin, model.TransactionStateLose},
+		},
+		{
+			Name:          model.SourceTypePayment,
+			DisplayName:   "Payment",
+			Enabled:       false,
+			AllowedStates: []model.TransactionState{model.TransactionStateWin},
+		},
+		{
+			Name:          model.SourceTypeManual,
+			DisplayName:   "Manual adjustment",
+			Enabled:       true,
+			AllowedStates: []model.TransactionState{model.TransactionStateWin, model.TransactionStateLose},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		sourceType model.SourceType
+		state      model.TransactionState
+		wantErr    error
+	}{
+		{"registered and enabled", model.SourceTypeGame, model.TransactionStateWin, nil},
+		{"disabled", model.SourceTypePayment, model.TransactionStateWin, ErrInvalidTransaction},
+		{"unknown", "sportsbook", model.TransactionStateWin, ErrInvalidTransaction},
+		{"reserved for adjustments", model.SourceTypeManual, model.TransactionStateWin, ErrInvalidTransaction},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("ListSourceTypes").Return(registry, nil)
+
+			err := NewSourceTypeService(repo).Check(context.Background(), tc.sourceType, tc.state)
+
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("state not allowed", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("ListSourceTypes").Return(registry, nil)
+
+		err := NewSourceTypeService(repo).Check(context.Background(), model.SourceTypeGame, model.TransactionStateRollback)
+
+		var violation *RuleViolation
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, rules.CodeStateNotAllowed, violation.Code)
+	})
+
+	t.Run("registry is cached until it changes", func(t *testing.T) {
+		ctx := context.Background()
+		sportsbook := &model.SourceTypeSettings{
+			Name:          "sportsbook",
+			DisplayName:   "Sportsbook",
+			Enabled:       true,
+			AllowedStates: []model.TransactionState{model.TransactionStateWin},
+		}
+
+		repo := &MockRepository{}
+		repo.On("ListSourceTypes").Return(registry, nil).Once()
+		repo.On("InsertSourceType", sportsbook).Return(nil)
+		repo.On("ListSourceTypes").Return(append(registry, *sportsbook), nil).Once()
+
+		svc := NewSourceTypeService(repo)
+
+		require.NoError(t, svc.Check(ctx, model.SourceTypeGame, model.TransactionStateWin))
+		require.Error(t, svc.Check(ctx, sportsbook.Name, model.TransactionStateWin))
+		require.NoError(t, svc.CreateSourceType(ctx, sportsbook))
+		require.NoError(t, svc.Check(ctx, sportsbook.Name, model.TransactionStateWin))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("invalid settings are rejected", func(t *testing.T) {
+		svc := NewSourceTypeService(&MockRepository{})
+
+		err := svc.CreateSourceType(context.Background(), &model.SourceTypeSettings{Name: "Sports Book"})
+		require.ErrorIs(t, err, ErrInvalidSourceType)
+
+		empty := ""
+		_, err = svc.UpdateSourceType(context.Background(), model.SourceTypeGame, model.SourceTypeUpdate{DisplayName: &empty})
+		require.ErrorIs(t, err, ErrInvalidSourceType)
+	})
+
+	t.Run("transactions of unregistered source types are not applied", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("ListSourceTypes").Return(registry, nil)
+
+		_, err := NewTransactionService(repo).ProcessTransaction(context.Background(), &model.Transaction{
+			ID:         uuid.New(),
+			UserID:     1,
+			State:      model.TransactionStateWin,
+			Amount:     decimal.NewFromInt(10),
+			SourceType: "sportsbook",
+		})
+
+		require.ErrorIs(t, err, ErrInvalidTransaction)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestProcessTransactionRules(t *testing.T) {
+	maxPayment, err := rules.New([]rules.Rule{
+		{SourceType: model.SourceTypePayment, MaxAmount: decimal.NewNullDecimal(decimal.NewFromInt(5000))},
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		tx       model.Transaction
+		wantCode rules.Code
+	}{
+		{
+			name:     "amount above maximum",
+			tx:       model.Transaction{SourceType: model.SourceTypePayment, Amount: decimal.RequireFromString("5000.01")},
+			wantCode: rules.CodeAmountTooLarge,
+		},
+		{
+			name:     "too many decimal places",
+			tx:       model.Transaction{SourceType: model.SourceTypeGame, Amount: decimal.RequireFromString("1.005")},
+			wantCode: rules.CodeTooManyDecimalPlaces,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := tc.tx
+			tx.ID = uuid.New()
+			tx.UserID = 1
+			tx.State = model.TransactionStateWin
+
+			// The repository has no expectations: rejected transactions must not reach it.
+			repo := &MockRepository{}
+
+			_, err := newTestService(repo, WithRules(maxPayment)).ProcessTransaction(context.Background(), &tx)
+
+			var violation *RuleViolation
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, tc.wantCode, violation.Code)
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChangeLimit(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(LimitCoolingOff)
+	daily := func(amount int64) *model.UserLimit {
+		return &model.UserLimit{
+			UserID:   1,
+			Currency: model.CurrencyEUR,
+			Period:   model.LimitPeriodDaily,
+			Amount:   decimal.NewFromInt(amount),
+		}
+	}
+
+	cases := []struct {
+		name    string
+		stored  *model.UserLimit
+		amount  decimal.NullDecimal
+		want    *model.UserLimit
+		wantErr error
+	}{
+		{
+			name:   "new limit applies immediately",
+			amount: decimal.NewNullDecimal(decimal.NewFromInt(100)),
+			want:   daily(100),
+		},
+		{
+			name:   "decrease applies immediately",
+			stored: daily(100),
+			amount: decimal.NewNullDecimal(decimal.NewFromInt(50)),
+			want:   daily(50),
+		},
+		{
+			name:   "increase is deferred",
+			stored: daily(100),
+			amount: decimal.NewNullDecimal(decimal.NewFromInt(200)),
+			want: &model.UserLimit{
+				UserID:        1,
+				Currency:      model.CurrencyEUR,
+				Period:        model.LimitPeriodDaily,
+				Amount:        decimal.NewFromInt(100),
+				PendingAmount: decimal.NewNullDecimal(decimal.NewFromInt(200)),
+				PendingFrom:   &later,
+			},
+		},
+		{
+			name: "decrease cancels a pending increase",
+			stored: &model.UserLimit{
+				UserID:        1,
+				Currency:      model.CurrencyEUR,
+				Period:        model.LimitPeriodDaily,
+				Amount:        decimal.NewFromInt(100),
+				PendingAmount: decimal.NewNullDecimal(decimal.NewFromInt(200)),
+				PendingFrom:   &later,
+			},
+			amount: decimal.NewNullDecimal(decimal.NewFromInt(80)),
+			want:   daily(80),
+		},
+		{
+			name:   "removal is deferred",
+			stored: daily(100),
+			want: &model.UserLimit{
+				UserID:      1,
+				Currency:    model.CurrencyEUR,
+				Period:      model.LimitPeriodDaily,
+				Amount:      decimal.NewFromInt(100),
+				PendingFrom: &later,
+			},
+		},
+		{
+			name:    "removal without limit",
+			wantErr: ErrUserLimitNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("WithDBTransaction", mock.Anything).Return(nil)
+			repo.On("GetWallet", 1, model.CurrencyEUR).Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR}, nil)
+
+			if tc.stored != nil {
+				repo.On("LockUserLimit", 1, model.CurrencyEUR, model.LimitPeriodDaily).Return(tc.stored, nil)
+			} else {
+				repo.On("LockUserLimit", 1, model.CurrencyEUR, model.LimitPeriodDaily).
+					Return(nil, repository.ErrUserLimitNotFound)
+			}
+
+			if tc.want != nil {
+				repo.On("SaveUserLimit", tc.want).Return(nil)
+			}
+
+			svc := NewLimitService(repo, model.CurrencyEUR)
+			svc.now = func() time.Time { return now }
+
+			limit, err := svc.changeLimit(context.Background(), 1, "", model.LimitPeriodDaily, tc.amount)
+
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, limit)
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProcessTransactionBonus(t *testing.T) {
+	wallet := func(real, bonus int64) *model.Wallet {
+		return &model.Wallet{
+			UserID:       1,
+			Currency:     model.CurrencyEUR,
+			Balance:      decimal.NewFromInt(real),
+			BonusBalance: decimal.NewFromInt(bonus),
+		}
+	}
+
+	lose := func(amount int64) *model.Transaction {
+		return &model.Transaction{
+			ID:         uuid.New(),
+			UserID:     1,
+			State:      model.TransactionStateLose,
+			Amount:     decimal.NewFromInt(amount),
+			SourceType: model.SourceTypeGame,
+		}
+	}
+
+	setup := func(repo *MockRepository) {
+		repo.On("GetTransactionByID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("ListUserLimits", 1).Return(nil, nil)
+		repo.On("GetRollbackByOriginalID", mock.Anything).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetReservation", mock.Anything).Return(nil, repository.ErrReservationNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+	}
+
+	t.Run("converts grant once wagered", func(t *testing.T) {
+		repo := &MockRepository{}
+		setup(repo)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(wallet(30, 40), nil)
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyEUR, decimal.NewFromInt(-20)).Return(wallet(30, 20), nil).Once()
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(-30)).Return(wallet(0, 20), nil)
+		repo.On("LockActiveBonusGrants", 1, model.CurrencyEUR).Return([]model.BonusGrant{{
+			ID:                  7,
+			UserID:              1,
+			Currency:            model.CurrencyEUR,
+			Amount:              decimal.NewFromInt(40),
+			WageringRequirement: decimal.NewFromInt(60),
+			Wagered:             decimal.NewFromInt(20),
+			Status:              model.BonusGrantActive,
+		}}, nil)
+		// Only the 20 left of the grant are converted.
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyEUR, decimal.NewFromInt(-20)).Return(wallet(0, 0), nil).Once()
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(20)).Return(wallet(20, 0), nil)
+		repo.On("UpdateBonusGrant", mock.MatchedBy(func(grant *model.BonusGrant) bool {
+			return grant.ID == 7 && grant.Status == model.BonusGrantConverted &&
+				grant.ConvertedAmount.Decimal.Equal(decimal.NewFromInt(20)) && grant.CompletedAt != nil
+		})).Return(nil)
+
+		tx := lose(50)
+		processed, err := newTestService(repo).ProcessTransaction(context.Background(), tx)
+		require.NoError(t, err)
+
+		assert.True(t, tx.BonusAmount.Equal(decimal.NewFromInt(20)), "real balance is spent first")
+		assert.True(t, processed.Balance.Decimal.Equal(decimal.NewFromInt(20)))
+
+		require.Len(t, repo.journalEntries, 2)
+		conversion, entry := repo.journalEntries[0], repo.journalEntries[1]
+		assert.Nil(t, conversion.TransactionID)
+		require.NoError(t, conversion.Validate())
+		require.NoError(t, entry.Validate())
+		assert.Equal(t, []model.Posting{
+			{Account: model.WalletAccount(1, model.CurrencyEUR), Amount: decimal.NewFromInt(-30)},
+			{Account: model.BonusAccount(1, model.CurrencyEUR), Amount: decimal.NewFromInt(-20)},
+			{Account: model.HouseAccount(model.SourceTypeGame, model.CurrencyEUR), Amount: decimal.NewFromInt(50)},
+		}, entry.Postings)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("forfeits grants when bonus is used up", func(t *testing.T) {
+		repo := &MockRepository{}
+		setup(repo)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(wallet(50, 10), nil)
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyEUR, decimal.NewFromInt(-10)).Return(wallet(50, 0), nil)
+		repo.On("LockActiveBonusGrants", 1, model.CurrencyEUR).Return([]model.BonusGrant{{
+			ID:                  8,
+			Amount:              decimal.NewFromInt(10),
+			WageringRequirement: decimal.NewFromInt(100),
+			Status:              model.BonusGrantActive,
+		}}, nil)
+		repo.On("UpdateBonusGrant", mock.MatchedBy(func(grant *model.BonusGrant) bool {
+			return grant.Status == model.BonusGrantForfeited && grant.Wagered.Equal(decimal.NewFromInt(10))
+		})).Return(nil)
+
+		tx := lose(10)
+		processed, err := newTestService(repo, WithBonusSpendOrder(model.BonusSpendOrderBonusFirst)).
+			ProcessTransaction(context.Background(), tx)
+		require.NoError(t, err)
+
+		assert.True(t, tx.BonusAmount.Equal(decimal.NewFromInt(10)), "bonus balance is spent first")
+		assert.True(t, processed.Balance.Decimal.Equal(decimal.NewFromInt(50)))
+		repo.AssertNotCalled(t, "UpdateWalletBalance", mock.Anything, mock.Anything, mock.Anything)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("rollback gives the bonus part back", func(t *testing.T) {
+		original := lose(50)
+		original.Currency = model.CurrencyEUR
+		original.BonusAmount = decimal.NewFromInt(20)
+
+		repo := &MockRepository{}
+		repo.On("GetTransactionByID", original.ID).Return(original, nil)
+		setup(repo)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(wallet(0, 0), nil)
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyEUR, decimal.NewFromInt(20)).Return(wallet(0, 20), nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(30)).Return(wallet(30, 20), nil)
+
+		tx := &model.Transaction{
+			ID:                    uuid.New(),
+			UserID:                1,
+			State:                 model.TransactionStateRollback,
+			SourceType:            model.SourceTypeGame,
+			OriginalTransactionID: &original.ID,
+		}
+
+		processed, err := newTestService(repo).ProcessTransaction(context.Background(), tx)
+		require.NoError(t, err)
+
+		assert.True(t, tx.BonusAmount.Equal(decimal.NewFromInt(20)))
+		assert.True(t, processed.Balance.Decimal.Equal(decimal.NewFromInt(50)))
+		require.Len(t, repo.journalEntries, 1)
+		require.NoError(t, repo.journalEntries[0].Validate())
+		repo.AssertNotCalled(t, "LockActiveBonusGrants", mock.Anything, mock.Anything)
+	})
+}
+
+func TestGrantBonus(t *testing.T) {
+	grantID := uuid.New()
+
+	newGrant := func(currency model.Currency, amount, wageringRequirement int64) *model.BonusGrant {
+		return &model.BonusGrant{
+			GrantID:             grantID,
+			UserID:              1,
+			Currency:            currency,
+			Amount:              decimal.NewFromInt(amount),
+			WageringRequirement: decimal.NewFromInt(wageringRequirement),
+		}
+	}
+
+	t.Run("credits bonus balance", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetBonusGrant", grantID).Return(nil, repository.ErrBonusGrantNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyEUR, decimal.NewFromInt(25)).
+			Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR, BonusBalance: decimal.NewFromInt(25)}, nil)
+		repo.On("InsertBonusGrant", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		grant, err := NewBonusService(repo, model.CurrencyEUR).GrantBonus(context.Background(), newGrant("", 25, 250))
+		require.NoError(t, err)
+
+		assert.Equal(t, model.CurrencyEUR, grant.Currency)
+		require.Len(t, repo.journalEntries, 1)
+		assert.Equal(t, []model.Posting{
+			{Account: model.BonusAccount(1, model.CurrencyEUR), Amount: decimal.NewFromInt(25)},
+			{Account: model.PromotionAccount(model.CurrencyEUR), Amount: decimal.NewFromInt(-25)},
+		}, repo.journalEntries[0].Postings)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("replays a retried grant", func(t *testing.T) {
+		existing := newGrant(model.CurrencyEUR, 25, 250)
+		existing.ID = 7
+
+		repo := &MockRepository{}
+		repo.On("GetBonusGrant", grantID).Return(existing, nil)
+
+		svc := NewBonusService(repo, model.CurrencyEUR)
+
+		grant, err := svc.GrantBonus(context.Background(), newGrant("", 25, 250))
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), grant.ID)
+
+		_, err = svc.GrantBonus(context.Background(), newGrant("", 30, 250))
+		require.ErrorIs(t, err, ErrDuplicateTransaction)
+		repo.AssertNotCalled(t, "WithDBTransaction", mock.Anything)
+	})
+
+	t.Run("rejects invalid grants", func(t *testing.T) {
+		svc := NewBonusService(&MockRepository{}, model.CurrencyEUR)
+
+		grant := newGrant("", 10, 1)
+		grant.Amount = decimal.RequireFromString("0.001")
+		_, err := svc.GrantBonus(context.Background(), grant)
+		require.ErrorIs(t, err, ErrInvalidBonus)
+
+		_, err = svc.GrantBonus(context.Background(), newGrant("", 10, 0))
+		require.ErrorIs(t, err, ErrInvalidBonus)
+
+		grant = newGrant("", 10, 100)
+		grant.GrantID = uuid.Nil
+		_, err = svc.GrantBonus(context.Background(), grant)
+		require.ErrorIs(t, err, ErrInvalidBonus)
+	})
+
+	t.Run("rejects inactive users", func(t *testing.T) {
+		for status, want := range map[model.UserStatus]error{
+			model.UserStatusSuspended: ErrUserSuspended,
+			model.UserStatusClosed:    ErrUserClosed,
+		} {
+			repo := &MockRepository{userStatuses: map[int]model.UserStatus{1: status}}
+			repo.On("GetBonusGrant", grantID).Return(nil, repository.ErrBonusGrantNotFound)
+			repo.On("WithDBTransaction", mock.Anything).Return(nil)
+
+			_, err := NewBonusService(repo, model.CurrencyEUR).GrantBonus(context.Background(), newGrant("", 5, 50))
+			require.ErrorIs(t, err, want)
+			repo.AssertNotCalled(t, "UpdateWalletBonusBalance", mock.Anything, mock.Anything, mock.Anything)
+		}
+	})
+
+	t.Run("missing wallet", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetBonusGrant", grantID).Return(nil, repository.ErrBonusGrantNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("UpdateWalletBonusBalance", 1, model.CurrencyGBP, decimal.NewFromInt(5)).
+			Return(nil, repository.ErrWalletNotFound)
+
+		_, err := NewBonusService(repo, model.CurrencyEUR).
+			GrantBonus(context.Background(), newGrant(model.CurrencyGBP, 5, 50))
+		require.ErrorIs(t, err, ErrWalletNotFound)
+	})
+}
+
+func TestReservations(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	amount := decimal.NewFromInt(30)
+
+	held := func() *model.Reservation {
+		return &model.Reservation{
+			ID:         id,
+			UserID:     1,
+			Currency:   model.CurrencyEUR,
+			SourceType: model.SourceTypeGame,
+			Amount:     amount,
+			Status:     model.ReservationHeld,
+			ExpiresAt:  now.Add(DefaultReservationTTL),
+		}
+	}
+
+	newService := func(repo *MockRepository) *ReservationServiceImpl {
+		svc := NewReservationService(repo, allowAllSourceTypes{}, &rules.Engine{}, model.CurrencyEUR,
+			DefaultReservationTTL, DefaultUserStatusPolicy())
+		svc.now = func() time.Time { return now }
+
+		return svc
+	}
+
+	// settling expects the locks taken before a reservation is settled.
+	settling := func(repo *MockRepository, locked *model.Reservation) {
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(70), nil)
+		repo.On("LockReservation", locked.ID).Return(locked, nil)
+	}
+
+	t.Run("reserve holds the amount", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(nil, repository.ErrReservationNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(100), nil)
+		repo.On("GetTransactionByID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetRollbackByOriginalID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("ListUserLimits", 1).Return([]model.UserLimit{}, nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, amount.Neg()).Return(decimal.NewFromInt(70), nil)
+		repo.On("UpdateWalletHeldBalance", 1, model.CurrencyEUR, amount).
+			Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR, HeldBalance: amount}, nil)
+		repo.On("InsertReservation", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		reservation, err := newService(repo).Reserve(context.Background(), &model.Reservation{
+			ID:         id,
+			UserID:     1,
+			SourceType: model.SourceTypeGame,
+			Amount:     amount,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, model.CurrencyEUR, reservation.Currency)
+		assert.Equal(t, now.Add(DefaultReservationTTL), reservation.ExpiresAt)
+		require.Len(t, repo.journalEntries, 1)
+		assert.Nil(t, repo.journalEntries[0].TransactionID)
+		assert.Equal(t, []model.Posting{
+			{Account: model.HeldAccount(1, model.CurrencyEUR), Amount: amount},
+			{Account: model.WalletAccount(1, model.CurrencyEUR), Amount: amount.Neg()},
+		}, repo.journalEntries[0].Postings)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("suspended user cannot reserve", func(t *testing.T) {
+		repo := &MockRepository{userStatuses: map[int]model.UserStatus{1: model.UserStatusSuspended}}
+		repo.On("GetReservation", id).Return(nil, repository.ErrReservationNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+
+		_, err := newService(repo).Reserve(context.Background(), &model.Reservation{
+			ID:         id,
+			UserID:     1,
+			SourceType: model.SourceTypeGame,
+			Amount:     amount,
+		})
+
+		require.ErrorIs(t, err, ErrUserSuspended)
+		repo.AssertNotCalled(t, "LockWallet", mock.Anything, mock.Anything)
+	})
+
+	t.Run("reserve replays a retry", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(held(), nil)
+
+		svc := newService(repo)
+
+		reservation, err := svc.Reserve(context.Background(), &model.Reservation{
+			ID: id, UserID: 1, SourceType: model.SourceTypeGame, Amount: amount,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, held(), reservation)
+
+		_, err = svc.Reserve(context.Background(), &model.Reservation{
+			ID: id, UserID: 1, SourceType: model.SourceTypeGame, Amount: decimal.NewFromInt(31),
+		})
+		require.ErrorIs(t, err, ErrDuplicateTransaction)
+	})
+
+	t.Run("held money counts towards loss limits", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(nil, repository.ErrReservationNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(&model.Wallet{
+			UserID:      1,
+			Currency:    model.CurrencyEUR,
+			Balance:     decimal.NewFromInt(100),
+			HeldBalance: decimal.NewFromInt(40),
+		}, nil)
+		repo.On("GetTransactionByID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("GetRollbackByOriginalID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("ListUserLimits", 1).Return([]model.UserLimit{{
+			UserID:   1,
+			Currency: model.CurrencyEUR,
+			Period:   model.LimitPeriodDaily,
+			Amount:   decimal.NewFromInt(50),
+		}}, nil)
+		repo.On("GetNetLoss", 1, model.CurrencyEUR, now.Add(-24*time.Hour)).Return(decimal.Zero, nil)
+
+		_, err := newService(repo).Reserve(context.Background(), &model.Reservation{
+			ID: id, UserID: 1, SourceType: model.SourceTypeGame, Amount: amount,
+		})
+		require.ErrorIs(t, err, ErrLossLimitExceeded)
+	})
+
+	t.Run("commit stores a lose transaction", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(held(), nil)
+		settling(repo, held())
+		repo.On("UpdateWalletHeldBalance", 1, model.CurrencyEUR, amount.Neg()).
+			Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR, Balance: decimal.NewFromInt(70)}, nil)
+		repo.On("GetRollbackByOriginalID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("InsertTransaction", mock.Anything).Return(nil)
+		repo.On("UpdateReservation", mock.MatchedBy(func(r *model.Reservation) bool {
+			return r.Status == model.ReservationCommitted && r.SettledAt.Equal(now)
+		})).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		processed, err := newService(repo).Commit(context.Background(), 1, id, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, model.TransactionStateLose, processed.State)
+		assert.True(t, processed.Amount.Equal(amount))
+		assert.True(t, processed.Balance.Decimal.Equal(decimal.NewFromInt(70)))
+		assert.False(t, processed.Replayed)
+		require.Len(t, repo.journalEntries, 1)
+		assert.Equal(t, id, *repo.journalEntries[0].TransactionID)
+		assert.Equal(t, []model.Posting{
+			{Account: model.HeldAccount(1, model.CurrencyEUR), Amount: amount.Neg()},
+			{Account: model.HouseAccount(model.SourceTypeGame, model.CurrencyEUR), Amount: amount},
+		}, repo.journalEntries[0].Postings)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("commit replays a committed reservation", func(t *testing.T) {
+		committed := held()
+		committed.Status = model.ReservationCommitted
+
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(held(), nil)
+		settling(repo, committed)
+		repo.On("GetTransactionByID", id).Return(committed.Transaction(), nil)
+
+		processed, err := newService(repo).Commit(context.Background(), 1, id, "")
+		require.NoError(t, err)
+		assert.True(t, processed.Replayed)
+	})
+
+	t.Run("commit of a released reservation", func(t *testing.T) {
+		released := held()
+		released.Status = model.ReservationReleased
+
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(held(), nil)
+		settling(repo, released)
+
+		_, err := newService(repo).Commit(context.Background(), 1, id, "")
+		require.ErrorIs(t, err, ErrReservationSettled)
+	})
+
+	t.Run("commit of an expired reservation", func(t *testing.T) {
+		expired := held()
+		expired.ExpiresAt = now
+
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(expired, nil)
+		settling(repo, expired)
+
+		_, err := newService(repo).Commit(context.Background(), 1, id, "")
+		require.ErrorIs(t, err, ErrReservationSettled)
+		repo.AssertNotCalled(t, "UpdateWalletHeldBalance", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("reservation of another provider", func(t *testing.T) {
+		placed := held()
+		placed.Provider = "games"
+
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(placed, nil)
+
+		svc := newService(repo)
+
+		_, err := svc.Commit(context.Background(), 1, id, "casino")
+		require.ErrorIs(t, err, ErrSourceTypeForbidden)
+
+		_, err = svc.Release(context.Background(), 1, id, "casino")
+		require.ErrorIs(t, err, ErrSourceTypeForbidden)
+		repo.AssertNotCalled(t, "WithDBTransaction", mock.Anything)
+	})
+
+	t.Run("reservation of another user", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(held(), nil)
+
+		_, err := newService(repo).Release(context.Background(), 2, id, "")
+		require.ErrorIs(t, err, ErrReservationNotFound)
+	})
+
+	t.Run("release gives the amount back", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetReservation", id).Return(held(), nil)
+		settling(repo, held())
+		repo.On("UpdateWalletHeldBalance", 1, model.CurrencyEUR, amount.Neg()).
+			Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR}, nil)
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, amount).Return(decimal.NewFromInt(100), nil)
+		repo.On("UpdateReservation", mock.Anything).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+
+		reservation, err := newService(repo).Release(context.Background(), 1, id, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, model.ReservationReleased, reservation.Status)
+		require.Len(t, repo.journalEntries, 1)
+		assert.Equal(t, []model.Posting{
+			{Account: model.HeldAccount(1, model.CurrencyEUR), Amount: amount.Neg()},
+			{Account: model.WalletAccount(1, model.CurrencyEUR), Amount: amount},
+		}, repo.journalEntries[0].Postings)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("expire releases held reservations", func(t *testing.T) {
+		settled := held()
+		settled.Status = model.ReservationCommitted
+
+		repo := &MockRepository{}
+		repo.On("ListExpiredReservations", now, expiryBatchSize).
+			Return([]model.Reservation{*held(), *held()}, nil)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockWallet", 1, model.CurrencyEUR).Return(decimal.NewFromInt(70), nil)
+		// The second reservation was committed after it was listed.
+		repo.On("LockReservation", id).Return(held(), nil).Once()
+		repo.On("LockReservation", id).Return(settled, nil).Once()
+		repo.On("UpdateWalletHeldBalance", 1, model.CurrencyEUR, amount.Neg()).
+			Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR}, nil).Once()
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, amount).Return(decimal.NewFromInt(100), nil).Once()
+		repo.On("UpdateReservation", mock.MatchedBy(func(r *model.Reservation) bool {
+			return r.Status == model.ReservationExpired
+		})).Return(nil).Once()
+		repo.On("PostJournalEntry", mock.Anything).Return(nil).Once()
+
+		expired, err := newService(repo).ExpireReservations(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, expired)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestAdjustments(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	threshold := decimal.NewFromInt(500)
+
+	requested := func(amount int64) *model.ManualAdjustment {
+		return &model.ManualAdjustment{
+			ID:          id,
+			UserID:      1,
+			Type:        model.AdjustmentCredit,
+			Amount:      decimal.NewFromInt(amount),
+			ReasonCode:  model.AdjustmentReasonGoodwill,
+			Comment:     "compensation for outage",
+			RequestedBy: "alice",
+		}
+	}
+
+	pending := func() *model.ManualAdjustment {
+		adjustment := requested(800)
+		adjustment.Currency = model.CurrencyEUR
+		adjustment.Status = model.AdjustmentPending
+
+		return adjustment
+	}
+
+	newService := func(repo *MockRepository) *AdjustmentServiceImpl {
+		svc := NewAdjustmentService(repo, model.CurrencyEUR, threshold)
+		svc.now = func() time.Time { return now }
+
+		return svc
+	}
+
+	// requesting expects the checks made before an adjustment is stored.
+	requesting := func(repo *MockRepository) {
+		repo.On("GetAdjustment", id).Return(nil, repository.ErrAdjustmentNotFound)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("GetWallet", 1, model.CurrencyEUR).Return(&model.Wallet{UserID: 1, Currency: model.CurrencyEUR}, nil)
+		repo.On("GetTransactionByID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("InsertAdjustment", mock.Anything).Return(nil)
+	}
+
+	// applying expects the adjustment to be booked as a manual transaction moving delta.
+	applying := func(repo *MockRepository, delta int64) {
+		repo.On("UpdateWalletBalance", 1, model.CurrencyEUR, decimal.NewFromInt(delta)).
+			Return(decimal.NewFromInt(100+delta), nil)
+		repo.On("GetRollbackByOriginalID", id).Return(nil, repository.ErrTransactionNotFound)
+		repo.On("InsertTransaction", mock.MatchedBy(func(tx *model.Transaction) bool {
+			return tx.ID == id && tx.SourceType == model.SourceTypeManual
+		})).Return(nil)
+		repo.On("PostJournalEntry", mock.Anything).Return(nil)
+		repo.On("UpdateAdjustment", mock.Anything).Return(nil)
+	}
+
+	t.Run("small adjustment is applied immediately", func(t *testing.T) {
+		repo := &MockRepository{}
+		requesting(repo)
+		applying(repo, 50)
+
+		adjustment, err := newService(repo).RequestAdjustment(context.Background(), requested(50))
+		require.NoError(t, err)
+
+		assert.Equal(t, model.AdjustmentApplied, adjustment.Status)
+		assert.Equal(t, &now, adjustment.DecidedAt)
+
+		require.Len(t, repo.journalEntries, 1)
+		entry := repo.journalEntries[0]
+		require.NoError(t, entry.Validate(), "journal entry should be balanced")
+		assert.Equal(t, model.HouseAccount(model.SourceTypeManual, model.CurrencyEUR), entry.Postings[1].Account)
+
+		require.Len(t, repo.auditEvents, 2)
+		assert.Equal(t, model.AuditAdjustmentRequested, repo.auditEvents[0].Action)
+		assert.Equal(t, model.AuditAdjustmentApplied, repo.auditEvents[1].Action)
+		assert.Equal(t, "alice", repo.auditEvents[1].Operator)
+		assert.Equal(t, "150.00", repo.auditEvents[1].Details["balanceAfter"])
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("adjustment above the threshold waits for approval", func(t *testing.T) {
+		repo := &MockRepository{}
+		requesting(repo)
+
+		adjustment, err := newService(repo).RequestAdjustment(context.Background(), requested(800))
+		require.NoError(t, err)
+
+		assert.Equal(t, model.AdjustmentPending, adjustment.Status)
+		require.Len(t, repo.auditEvents, 1)
+		repo.AssertNotCalled(t, "UpdateWalletBalance", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("second operator approves", func(t *testing.T) {
+		debit := pending()
+		debit.Type = model.AdjustmentDebit
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAdjustment", id).Return(debit, nil)
+		applying(repo, -800)
+
+		adjustment, err := newService(repo).
+			ApproveAdjustment(context.Background(), id, model.Operator{Name: "bob"}, "checked")
+		require.NoError(t, err)
+
+		assert.Equal(t, model.AdjustmentApplied, adjustment.Status)
+		assert.Equal(t, "bob", adjustment.ReviewedBy)
+		require.Len(t, repo.auditEvents, 1)
+		assert.Equal(t, "bob", repo.auditEvents[0].Operator)
+		assert.Equal(t, "checked", repo.auditEvents[0].Details["comment"])
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("second operator rejects", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAdjustment", id).Return(pending(), nil)
+		repo.On("UpdateAdjustment", mock.Anything).Return(nil)
+
+		adjustment, err := newService(repo).
+			RejectAdjustment(context.Background(), id, model.Operator{Name: "bob"}, "no ticket")
+		require.NoError(t, err)
+
+		assert.Equal(t, model.AdjustmentRejected, adjustment.Status)
+		require.Len(t, repo.auditEvents, 1)
+		assert.Equal(t, model.AuditAdjustmentRejected, repo.auditEvents[0].Action)
+		repo.AssertNotCalled(t, "UpdateWalletBalance", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("requester cannot review", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAdjustment", id).Return(pending(), nil)
+
+		_, err := newService(repo).ApproveAdjustment(context.Background(), id, model.Operator{Name: "alice"}, "")
+
+		require.ErrorIs(t, err, ErrSelfReview)
+		assert.Empty(t, repo.auditEvents)
+	})
+
+	t.Run("requester key cannot review under another name", func(t *testing.T) {
+		key := uuid.New()
+		adjustment := pending()
+		adjustment.RequestedByKey = key
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAdjustment", id).Return(adjustment, nil)
+
+		_, err := newService(repo).ApproveAdjustment(context.Background(), id, model.Operator{Name: "bob", KeyID: key}, "")
+
+		require.ErrorIs(t, err, ErrSelfReview)
+		assert.Empty(t, repo.auditEvents)
+	})
+
+	t.Run("reviewer key is recorded", func(t *testing.T) {
+		key := uuid.New()
+		adjustment := pending()
+		adjustment.RequestedByKey = uuid.New()
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAdjustment", id).Return(adjustment, nil)
+		repo.On("UpdateAdjustment", mock.Anything).Return(nil)
+
+		rejected, err := newService(repo).
+			RejectAdjustment(context.Background(), id, model.Operator{Name: "bob", KeyID: key}, "no ticket")
+		require.NoError(t, err)
+
+		assert.Equal(t, key, rejected.ReviewedByKey)
+		require.Len(t, repo.auditEvents, 1)
+		assert.Equal(t, key.String(), repo.auditEvents[0].Details["apiKeyId"])
+	})
+
+	t.Run("decided adjustment cannot be decided otherwise", func(t *testing.T) {
+		rejected := pending()
+		rejected.Status = model.AdjustmentRejected
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAdjustment", id).Return(rejected, nil)
+
+		_, err := newService(repo).ApproveAdjustment(context.Background(), id, model.Operator{Name: "bob"}, "")
+		require.ErrorIs(t, err, ErrAdjustmentDecided)
+
+		_, err = newService(repo).RejectAdjustment(context.Background(), id, model.Operator{Name: "bob"}, "")
+		require.NoError(t, err, "repeating the decision should be a no-op")
+		assert.Empty(t, repo.auditEvents)
+	})
+
+	t.Run("retries are replayed", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetAdjustment", id).Return(pending(), nil)
+
+		adjustment, err := newService(repo).RequestAdjustment(context.Background(), requested(800))
+		require.NoError(t, err)
+		assert.Equal(t, model.AdjustmentPending, adjustment.Status)
+
+		_, err = newService(repo).RequestAdjustment(context.Background(), requested(900))
+		require.ErrorIs(t, err, ErrDuplicateTransaction)
+		repo.AssertNotCalled(t, "WithDBTransaction", mock.Anything)
+	})
+
+	t.Run("comment is required", func(t *testing.T) {
+		adjustment := requested(50)
+		adjustment.Comment = " "
+
+		_, err := newService(&MockRepository{}).RequestAdjustment(context.Background(), adjustment)
+
+		require.ErrorIs(t, err, ErrInvalidAdjustment)
+	})
+}
+
+func TestProviderService(t *testing.T) {
+	registry := []model.SourceTypeSettings{
+		{Name: model.SourceTypeGame, Enabled: true},
+		{Name: model.SourceTypeManual, Enabled: true},
+	}
+
+	t.Run("provider is registered with a generated secret", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("ListSourceTypes").Return(registry, nil)
+		repo.On("InsertProvider", mock.Anything).Return(nil)
+
+		provider, err := NewProviderService(repo, 0, nil).
+			CreateProvider(context.Background(), "acme", []model.SourceType{model.SourceTypeGame})
+		require.NoError(t, err)
+
+		assert.Equal(t, "acme", provider.Name)
+		assert.Len(t, provider.Secret, 2*providerSecretBytes)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("secret is stored encrypted", func(t *testing.T) {
+		secrets, err := NewSecretCipher(make([]byte, SecretKeySize))
+		require.NoError(t, err)
+
+		var stored model.Provider
+
+		repo := &MockRepository{}
+		repo.On("ListSourceTypes").Return(registry, nil)
+		repo.On("InsertProvider", mock.Anything).Run(func(args mock.Arguments) {
+			stored = *args.Get(0).(*model.Provider)
+		}).Return(nil)
+
+		svc := NewProviderService(repo, 0, secrets)
+
+		provider, err := svc.CreateProvider(context.Background(), "acme", []model.SourceType{model.SourceTypeGame})
+		require.NoError(t, err)
+		assert.Len(t, provider.Secret, 2*providerSecretBytes, "the caller gets the secret in plaintext")
+		assert.NotContains(t, stored.Secret, provider.Secret)
+
+		for range 2 {
+			repo.On("GetProvider", "acme").
+				Return(&model.Provider{Name: "acme", Secret: stored.Secret, Enabled: true}, nil).Once()
+		}
+
+		loaded, err := svc.GetProvider(context.Background(), "acme")
+		require.NoError(t, err)
+		assert.Equal(t, provider.Secret, loaded.Secret)
+
+		_, err = NewProviderService(repo, 0, nil).GetProvider(context.Background(), "acme")
+		require.ErrorIs(t, err, ErrSecretKeyMissing)
+	})
+
+	cases := []struct {
+		name        string
+		provider    string
+		sourceTypes []model.SourceType
+	}{
+		{"invalid name", "Acme Games", []model.SourceType{model.SourceTypeGame}},
+		{"no source types", "acme", nil},
+		{"reserved source type", "acme", []model.SourceType{model.SourceTypeManual}},
+		{"unknown source type", "acme", []model.SourceType{"sportsbook"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			repo.On("ListSourceTypes").Return(registry, nil)
+
+			_, err := NewProviderService(repo, 0, nil).CreateProvider(context.Background(), tc.provider, tc.sourceTypes)
+			require.ErrorIs(t, err, ErrInvalidProvider)
+			repo.AssertNotCalled(t, "InsertProvider", mock.Anything)
+		})
+	}
+
+	t.Run("disabled provider is not found", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProvider", "acme").Return(&model.Provider{Name: "acme", Enabled: false}, nil)
+
+		_, err := NewProviderService(repo, 0, nil).GetProvider(context.Background(), "acme")
+		require.ErrorIs(t, err, ErrProviderNotFound)
+	})
+
+	t.Run("provider is cached for the TTL", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetProvider", "acme").Return(&model.Provider{Name: "acme", Enabled: true}, nil).Once()
+		repo.On("GetProvider", "unknown").Return(nil, repository.ErrProviderNotFound).Twice()
+
+		svc := NewProviderService(repo, time.Minute, nil)
+
+		for range 2 {
+			provider, err := svc.GetProvider(context.Background(), "acme")
+			require.NoError(t, err)
+			assert.Equal(t, "acme", provider.Name)
+
+			_, err = svc.GetProvider(context.Background(), "unknown")
+			require.ErrorIs(t, err, ErrProviderNotFound)
+		}
+
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestSecretCipher(t *testing.T) {
+	secrets, err := NewSecretCipher([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	sealed, err := secrets.Seal("acme", "acme-provider-secret")
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "acme-provider-secret")
+
+	secret, err := secrets.Open("acme", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "acme-provider-secret", secret)
+
+	_, err = secrets.Open("other", sealed)
+	require.Error(t, err, "a secret is bound to its provider")
+
+	secret, err = secrets.Open("acme", "legacy-plaintext-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-plaintext-secret", secret, "secrets stored in plaintext stay readable")
+
+	_, err = NewSecretCipher([]byte("short"))
+	require.Error(t, err)
+}
+
+func TestNonceService(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("local nonces are used once until they expire", func(t *testing.T) {
+		svc := NewLocalNonceService()
+		svc.now = func() time.Time { return now.Add(time.Minute) }
+
+		for _, unused := range []bool{true, false} {
+			ok, err := svc.Use(context.Background(), "acme\n1", now.Add(time.Minute), now)
+			require.NoError(t, err)
+			assert.Equal(t, unused, ok)
+		}
+
+		ok, err := svc.Use(context.Background(), "acme\n1", now.Add(2*time.Minute), now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, ok, "expired nonces are recorded again")
+
+		_, err = svc.Use(context.Background(), "acme\n2", now, now)
+		require.NoError(t, err)
+
+		swept, err := svc.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, swept)
+	})
+
+	t.Run("shared nonces are kept in the database", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("InsertNonce", "acme\n1", now.Add(time.Minute), now).Return(false, nil)
+		repo.On("DeleteNonces", now).Return(3, nil)
+
+		svc := NewNonceService(repo)
+		svc.now = func() time.Time { return now }
+
+		ok, err := svc.Use(context.Background(), "acme\n1", now.Add(time.Minute), now)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		swept, err := svc.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, swept)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestAPIKeyService(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	acme := &model.Provider{Name: "acme", Enabled: true}
+
+	stored := func(key string) *model.APIKey {
+		return &model.APIKey{
+			ID:       id,
+			Provider: "acme",
+			Hash:     hashAPIKey(key),
+			Scopes:   []model.APIKeyScope{model.ScopeBalanceRead},
+		}
+	}
+
+	newService := func(repo *MockRepository, ttl time.Duration) *APIKeyServiceImpl {
+		svc := NewAPIKeyService(repo, NewProviderService(repo, 0, nil), ttl)
+		svc.now = func() time.Time { return now }
+
+		return svc
+	}
+
+	t.Run("issued key is stored hashed", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("InsertAPIKey", mock.Anything).Return(nil)
+
+		apiKey, key, err := newService(repo, 0).
+			IssueAPIKey(context.Background(), "acme", []model.APIKeyScope{model.ScopeBalanceRead})
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(key, apiKeyPrefix))
+		assert.Equal(t, hashAPIKey(key), apiKey.Hash)
+		assert.NotContains(t, apiKey.Hash, key)
+		assert.True(t, strings.HasPrefix(key, apiKey.Prefix))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown scope is rejected", func(t *testing.T) {
+		_, _, err := newService(&MockRepository{}, 0).
+			IssueAPIKey(context.Background(), "acme", []model.APIKeyScope{"root"})
+		require.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("key authenticates its provider and records the use", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetAPIKeyByHash", hashAPIKey("wk_valid")).Return(stored("wk_valid"), nil).Once()
+		repo.On("GetProvider", "acme").Return(acme, nil)
+		repo.On("TouchAPIKey", id, now).Return(nil).Once()
+
+		svc := newService(repo, time.Minute)
+
+		for range 2 {
+			apiKey, provider, err := svc.Authenticate(context.Background(), "wk_valid")
+			require.NoError(t, err)
+			assert.Equal(t, id, apiKey.ID)
+			assert.Equal(t, "acme", provider.Name)
+		}
+
+		repo.AssertExpectations(t)
+	})
+
+	cases := []struct {
+		name      string
+		setupMock func(repo *MockRepository)
+	}{
+		{
+			"unknown key",
+			func(repo *MockRepository) {
+				repo.On("GetAPIKeyByHash", mock.Anything).Return(nil, repository.ErrAPIKeyNotFound)
+			},
+		},
+		{
+			"revoked key",
+			func(repo *MockRepository) {
+				revoked := stored("wk_key")
+				revoked.RevokedAt = &now
+				repo.On("GetAPIKeyByHash", mock.Anything).Return(revoked, nil)
+			},
+		},
+		{
+			"disabled provider",
+			func(repo *MockRepository) {
+				repo.On("GetAPIKeyByHash", mock.Anything).Return(stored("wk_key"), nil)
+				repo.On("GetProvider", "acme").Return(&model.Provider{Name: "acme"}, nil)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &MockRepository{}
+			tc.setupMock(repo)
+
+			_, _, err := newService(repo, 0).Authenticate(context.Background(), "wk_key")
+			require.ErrorIs(t, err, ErrUnauthenticated)
+			repo.AssertNotCalled(t, "TouchAPIKey", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("rotation revokes the old key at once", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("GetAPIKeyByHash", hashAPIKey("wk_old")).Return(stored("wk_old"), nil).Once()
+		repo.On("GetProvider", "acme").Return(acme, nil)
+		repo.On("TouchAPIKey", id, now).Return(nil)
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAPIKey", id).Return(stored("wk_old"), nil)
+		repo.On("RevokeAPIKey", mock.MatchedBy(func(key *model.APIKey) bool {
+			return key.ID == id && key.RevokedAt.Equal(now)
+		})).Return(nil)
+		repo.On("InsertAPIKey", mock.MatchedBy(func(key *model.APIKey) bool {
+			return key.ID != id && key.Provider == "acme" && key.HasScope(model.ScopeBalanceRead)
+		})).Return(nil)
+
+		svc := newService(repo, time.Hour)
+
+		_, _, err := svc.Authenticate(context.Background(), "wk_old")
+		require.NoError(t, err)
+
+		rotated, key, err := svc.RotateAPIKey(context.Background(), id, "acme")
+		require.NoError(t, err)
+		assert.Equal(t, hashAPIKey(key), rotated.Hash)
+
+		revoked := stored("wk_old")
+		revoked.RevokedAt = &now
+		repo.On("GetAPIKeyByHash", hashAPIKey("wk_old")).Return(revoked, nil)
+
+		_, _, err = svc.Authenticate(context.Background(), "wk_old")
+		require.ErrorIs(t, err, ErrUnauthenticated, "the cached key should be dropped")
+	})
+
+	t.Run("revoked key cannot be rotated", func(t *testing.T) {
+		revoked := stored("wk_old")
+		revoked.RevokedAt = &now
+
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAPIKey", id).Return(revoked, nil)
+
+		_, _, err := newService(repo, 0).RotateAPIKey(context.Background(), id, "")
+		require.ErrorIs(t, err, ErrAPIKeyRevoked)
+
+		apiKey, err := newService(repo, 0).RevokeAPIKey(context.Background(), id, "")
+		require.NoError(t, err, "revoking twice should succeed")
+		assert.Equal(t, &now, apiKey.RevokedAt)
+		repo.AssertNotCalled(t, "RevokeAPIKey", mock.Anything)
+	})
+
+	t.Run("keys of another provider are not found", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockAPIKey", id).Return(stored("wk_old"), nil)
+
+		_, _, err := newService(repo, 0).RotateAPIKey(context.Background(), id, "games")
+		require.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+		_, err = newService(repo, 0).RevokeAPIKey(context.Background(), id, "games")
+		require.ErrorIs(t, err, ErrAPIKeyNotFound)
+		repo.AssertNotCalled(t, "RevokeAPIKey", mock.Anything)
+		repo.AssertNotCalled(t, "InsertAPIKey", mock.Anything)
+	})
+}
+
+func TestRateLimitService(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	limit := model.RateLimit{Rate: 1, Burst: 2}
+	acme := []model.RateLimitKey{{Key: "provider:acme", Limit: limit}}
+
+	t.Run("local buckets are kept per key", func(t *testing.T) {
+		svc := NewLocalRateLimitService()
+		svc.now = func() time.Time { return now }
+
+		for _, allowed := range []bool{true, true, false} {
+			decisions, err := svc.Take(context.Background(), []model.RateLimitKey{{Key: "user:1", Limit: limit}})
+			require.NoError(t, err)
+			assert.Equal(t, allowed, decisions[0].Allowed)
+		}
+
+		decisions, err := svc.Take(context.Background(), []model.RateLimitKey{{Key: "user:2", Limit: limit}})
+		require.NoError(t, err)
+		assert.True(t, decisions[0].Allowed, "other keys have their own bucket")
+
+		svc.now = func() time.Time { return now.Add(time.Minute) }
+
+		swept, err := svc.Sweep(context.Background(), 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 2, swept)
+	})
+
+	t.Run("local bucket keeps its token when another rejects", func(t *testing.T) {
+		svc := NewLocalRateLimitService()
+		svc.now = func() time.Time { return now }
+
+		user := []model.RateLimitKey{{Key: "user:1", Limit: model.RateLimit{Rate: 1, Burst: 1}}}
+		_, err := svc.Take(context.Background(), user)
+		require.NoError(t, err)
+
+		decisions, err := svc.Take(context.Background(), append(acme, user...))
+		require.NoError(t, err)
+		assert.True(t, decisions[0].Allowed)
+		assert.False(t, decisions[1].Allowed)
+
+		decisions, err = svc.Take(context.Background(), acme)
+		require.NoError(t, err)
+		assert.Equal(t, 1, decisions[0].Remaining, "the rejected request should not take a provider token")
+	})
+
+	t.Run("shared bucket is created full", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockRateLimitBucket", "provider:acme").Return(nil, repository.ErrRateLimitBucketNotFound)
+		repo.On("SaveRateLimitBucket", &model.RateLimitBucket{Key: "provider:acme", Tokens: 1, UpdatedAt: now}).
+			Return(nil)
+
+		svc := NewRateLimitService(repo)
+		svc.now = func() time.Time { return now }
+
+		decisions, err := svc.Take(context.Background(), acme)
+		require.NoError(t, err)
+		assert.True(t, decisions[0].Allowed)
+		assert.Equal(t, 1, decisions[0].Remaining)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("shared bucket is refilled", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockRateLimitBucket", "provider:acme").
+			Return(&model.RateLimitBucket{Key: "provider:acme", Tokens: 0.5, UpdatedAt: now.Add(-time.Second)}, nil)
+		repo.On("SaveRateLimitBucket", &model.RateLimitBucket{Key: "provider:acme", Tokens: 0.5, UpdatedAt: now}).
+			Return(nil)
+
+		svc := NewRateLimitService(repo)
+		svc.now = func() time.Time { return now }
+
+		decisions, err := svc.Take(context.Background(), acme)
+		require.NoError(t, err)
+		assert.True(t, decisions[0].Allowed)
+		assert.Equal(t, 0, decisions[0].Remaining)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("shared buckets are only saved if all allow", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockRateLimitBucket", "provider:acme").Return(nil, repository.ErrRateLimitBucketNotFound)
+		repo.On("LockRateLimitBucket", "user:1").
+			Return(&model.RateLimitBucket{Key: "user:1", Tokens: 0, UpdatedAt: now}, nil)
+
+		svc := NewRateLimitService(repo)
+		svc.now = func() time.Time { return now }
+
+		decisions, err := svc.Take(context.Background(),
+			append(acme, model.RateLimitKey{Key: "user:1", Limit: limit}))
+		require.NoError(t, err)
+		assert.True(t, decisions[0].Allowed)
+		assert.False(t, decisions[1].Allowed)
+		repo.AssertNotCalled(t, "SaveRateLimitBucket", mock.Anything)
+	})
+
+	t.Run("shared bucket errors are returned", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("WithDBTransaction", mock.Anything).Return(nil)
+		repo.On("LockRateLimitBucket", "provider:acme").Return(nil, ErrUnavailable)
+
+		_, err := NewRateLimitService(repo).Take(context.Background(), acme)
+		require.ErrorIs(t, err, ErrUnavailable)
+	})
+
+	t.Run("shared buckets are swept", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("DeleteRateLimitBuckets", now.Add(-time.Minute)).Return(3, nil)
+
+		svc := NewRateLimitService(repo)
+		svc.now = func() time.Time { return now }
+
+		swept, err := svc.Sweep(context.Background(), time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, 3, swept)
+	})
+}
+
+func TestHealthService(t *testing.T) {
+	checks := func(report *model.HealthReport) map[string]model.HealthCheck {
+		byName := make(map[string]model.HealthCheck)
+		for _, check := range report.Checks {
+			byName[check.Name] = check
+		}
+
+		return byName
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("Ping").Return(nil)
+		repo.On("SchemaVersion").Return(uint(16), false, nil)
+		repo.On("PoolStats").Return(sql.DBStats{MaxOpenConnections: 10, InUse: 3, Idle: 2})
+
+		report := NewHealthService(repo, 16, time.Second).Readiness(context.Background())
+		assert.True(t, report.Ready())
+		assert.Equal(t, model.HealthPass, report.Status())
+
+		byName := checks(report)
+		assert.Len(t, byName, 3)
+		assert.Equal(t, "schema version 16", byName[HealthCheckMigrations].Message)
+		assert.Equal(t, "3 of 10 connections in use, 2 idle, 0 waits so far", byName[HealthCheckPool].Message)
+	})
+
+	t.Run("saturated pool only warns", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("Ping").Return(nil)
+		repo.On("SchemaVersion").Return(uint(16), false, nil)
+		repo.On("PoolStats").Return(sql.DBStats{MaxOpenConnections: 10, InUse: 10, WaitCount: 4})
+
+		report := NewHealthService(repo, 16, time.Second).Readiness(context.Background())
+		assert.True(t, report.Ready())
+		assert.Equal(t, model.HealthWarn, report.Status())
+		assert.Equal(t, model.HealthWarn, checks(report)[HealthCheckPool].Status)
+	})
+
+	t.Run("unreachable database", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("Ping").Return(ErrUnavailable)
+		repo.On("PoolStats").Return(sql.DBStats{})
+
+		report := NewHealthService(repo, 16, time.Second).Readiness(context.Background())
+		assert.False(t, report.Ready())
+		assert.Equal(t, model.HealthFail, checks(report)[HealthCheckDatabase].Status)
+		assert.Equal(t, model.HealthFail, checks(report)[HealthCheckMigrations].Status)
+		repo.AssertNotCalled(t, "SchemaVersion")
+	})
+
+	t.Run("schema version mismatch", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			version uint
+			dirty   bool
+			message string
+		}{
+			"behind":          {version: 15, message: "schema version 15, expected 16"},
+			"dirty":           {version: 16, dirty: true, message: "migration 16 failed halfway"},
+			"newer and dirty": {version: 17, dirty: true, message: "migration 17 failed halfway"},
+		} {
+			repo := &MockRepository{}
+			repo.On("Ping").Return(nil)
+			repo.On("SchemaVersion").Return(tt.version, tt.dirty, nil)
+			repo.On("PoolStats").Return(sql.DBStats{})
+
+			report := NewHealthService(repo, 16, time.Second).Readiness(context.Background())
+			assert.False(t, report.Ready(), name)
+			assert.Equal(t, tt.message, checks(report)[HealthCheckMigrations].Message, name)
+		}
+	})
+
+	t.Run("newer schema version", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("Ping").Return(nil)
+		repo.On("SchemaVersion").Return(uint(17), false, nil)
+		repo.On("PoolStats").Return(sql.DBStats{})
+
+		report := NewHealthService(repo, 16, time.Second).Readiness(context.Background())
+		assert.True(t, report.Ready(), "instances of the previous release stay ready after a migration")
+
+		migrations := checks(report)[HealthCheckMigrations]
+		assert.Equal(t, model.HealthWarn, migrations.Status)
+		assert.Equal(t, "schema version 17 is newer than 16", migrations.Message)
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		repo := &MockRepository{}
+		repo.On("Ping").Return(nil)
+		repo.On("SchemaVersion").Return(uint(16), false, nil)
+		repo.On("PoolStats").Return(sql.DBStats{})
+
+		svc := NewHealthService(repo, 16, time.Second)
+		require.True(t, svc.Readiness(context.Background()).Ready())
+
+		svc.Drain()
+
+		report := svc.Readiness(context.Background())
+		assert.False(t, report.Ready(), "a draining service is not ready even with healthy dependencies")
+		assert.Equal(t, model.HealthFail, checks(report)[HealthCheckShutdown].Status)
+	})
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/rules"
+)
+
+// Errors returned by SourceTypeService.
+var (
+	ErrSourceTypeNotFound = repository.ErrSourceTypeNotFound
+	ErrSourceTypeExists   = repository.ErrSourceTypeExists
+	ErrInvalidSourceType  = errors.New("invalid source type")
+)
+
+// DefaultSourceTypeCacheTTL is how long the registry is cached before it is read again. Changes made
+// through another instance of the service become visible after at most this long.
+const DefaultSourceTypeCacheTTL = 30 * time.Second
+
+// SourceTypeService manages the registry of the sources transactions may come from.
+type SourceTypeService interface {
+	// Check returns an error wrapping ErrInvalidTransaction unless sourceType is registered and
+	// enabled, and a *RuleViolation if it is not allowed to send transactions in state.
+	Check(ctx context.Context, sourceType model.SourceType, state model.TransactionState) error
+	// ListSourceTypes returns all registered source types, including disabled ones.
+	ListSourceTypes(ctx context.Context) ([]model.SourceTypeSettings, error)
+	// CreateSourceType registers a new source type.
+	CreateSourceType(ctx context.Context, settings *model.SourceTypeSettings) error
+	// UpdateSourceType changes the registry entry of name and returns the updated settings.
+	UpdateSourceType(
+		ctx context.Context,
+		name model.SourceType,
+		update model.SourceTypeUpdate,
+	) (*model.SourceTypeSettings, error)
+}
+
+// SourceTypeServiceImpl caches the registry in memory. The cache is dropped on every change
+// made through it and expires after the configured TTL.
+type SourceTypeServiceImpl struct {
+	repo repository.Repository
+	ttl  time.Duration
+
+	mu       sync.RWMutex
+	cache    map[model.SourceType]model.SourceTypeSettings
+	loadedAt time.Time
+	// generation is incremented by every change, so that a load racing with a change
+	// does not cache the registry as it was before the change.
+	generation uint64
+}
+
+// SourceTypeOption configures a SourceTypeServiceImpl.
+type SourceTypeOption func(*SourceTypeServiceImpl)
+
+// WithSourceTypeCacheTTL sets how long the registry is cached. A zero TTL disables caching.
+func WithSourceTypeCacheTTL(ttl time.Duration) SourceTypeOption {
+	return func(s *SourceTypeServiceImpl) {
+		s.ttl = ttl
+	}
+}
+
+func NewSourceTypeService(repo repository.Repository, opts ...SourceTypeOption) *SourceTypeServiceImpl {
+	s := &SourceTypeServiceImpl{repo: repo, ttl: DefaultSourceTypeCacheTTL}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *SourceTypeServiceImpl) Check(
+	ctx context.Context,
+	sourceType model.SourceType,
+	state model.TransactionState,
+) error {
+	registry, err := s.registry(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load source types: %w", err)
+	}
+
+	settings, ok := registry[sourceType]
+
+	switch {
+	case sourceType == model.SourceTypeManual:
+		return fmt.Errorf("%w: source type %s is reserved for operator adjustments", ErrInvalidTransaction, sourceType)
+	case !ok:
+		return fmt.Errorf("%w: unknown source type: %s", ErrInvalidTransaction, sourceType)
+	case !settings.Enabled:
+		return fmt.Errorf("%w: source type %s is disabled", ErrInvalidTransaction, sourceType)
+	case !settings.Allows(state):
+		return &RuleViolation{
+			Code:    rules.CodeStateNotAllowed,
+			Message: fmt.Sprintf("source type %s does not send %s transactions", sourceType, state),
+		}
+	}
+
+	return nil
+}
+
+func (s *SourceTypeServiceImpl) ListSourceTypes(ctx context.Context) ([]model.SourceTypeSettings, error) {
+	return s.repo.ListSourceTypes(ctx)
+}
+
+func (s *SourceTypeServiceImpl) CreateSourceType(ctx context.Context, settings *model.SourceTypeSettings) error {
+	if err := settings.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSourceType, err)
+	}
+
+	if err := s.repo.InsertSourceType(ctx, settings); err != nil {
+		return err
+	}
+
+	s.invalidate()
+
+	return nil
+}
+
+func (s *SourceTypeServiceImpl) UpdateSourceType(
+	ctx context.Context,
+	name model.SourceType,
+	update model.SourceTypeUpdate,
+) (*model.SourceTypeSettings, error) {
+	if update.DisplayName != nil && strings.TrimSpace(*update.DisplayName) == "" {
+		return nil, fmt.Errorf("%w: display name is required", ErrInvalidSourceType)
+	}
+
+	if update.AllowedStates != nil {
+		if len(update.AllowedStates) == 0 {
+			return nil, fmt.Errorf("%w: at least one allowed state is required", ErrInvalidSourceType)
+		}
+
+		for _, state := range update.AllowedStates {
+			if _, err := model.ToTransactionState(string(state)); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidSourceType, err)
+			}
+		}
+	}
+
+	settings, err := s.repo.UpdateSourceType(ctx, name, update)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate()
+
+	return settings, nil
+}
+
+// registry returns the cached registry, reading it from the repository once the cache expired.
+func (s *SourceTypeServiceImpl) registry(ctx context.Context) (map[model.SourceType]model.SourceTypeSettings, error) {
+	s.mu.RLock()
+	cache, loadedAt, generation := s.cache, s.loadedAt, s.generation
+	s.mu.RUnlock()
+
+	if cache != nil && time.Since(loadedAt) < s.ttl {
+		return cache, nil
+	}
+
+	sourceTypes, err := s.repo.ListSourceTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache = make(map[model.SourceType]model.SourceTypeSettings, len(sourceTypes))
+	for _, settings := range sourceTypes {
+		cache[settings.Name] = settings
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.cache, s.loadedAt = cache, time.Now()
+	}
+	s.mu.Unlock()
+
+	return cache, nil
+}
+
+func (s *SourceTypeServiceImpl) invalidate() {
+	s.mu.Lock()
+	s.cache = nil
+	s.generation++
+	s.mu.Unlock()
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+)
+
+var (
+	// ErrUserSuspended is returned for transactions of suspended users that the status policy rejects.
+	ErrUserSuspended = errors.New("user is suspended")
+	// ErrUserClosed is returned for transactions of closed users that the status policy rejects,
+	// and for attempts to reopen a closed account.
+	ErrUserClosed = errors.New("user is closed")
+)
+
+// DefaultUserStatusPolicy lets wins and rollbacks of bets placed before a suspension still land
+// on the account, and rejects all transactions of closed accounts.
+func DefaultUserStatusPolicy() model.UserStatusPolicy {
+	return model.UserStatusPolicy{
+		model.UserStatusSuspended: {model.TransactionStateWin, model.TransactionStateRollback},
+	}
+}
+
+// UserService manages the lifecycle of user accounts.
+type UserService interface {
+	// CreateUser creates an active user with an empty wallet in currency, or in the default
+	// currency if it is empty.
+	CreateUser(ctx context.Context, currency model.Currency) (*model.User, error)
+	// GetUser returns the user with its status and all of its wallets.
+	GetUser(ctx context.Context, userID int) (*model.User, error)
+	// SetUserStatus moves userID to status and returns the updated user. Setting the current status
+	// is a no-op, a closed account cannot be reopened.
+	SetUserStatus(ctx context.Context, userID int, status model.UserStatus) (*model.User, error)
+}
+
+type UserServiceImpl struct {
+	repo            repository.Repository
+	defaultCurrency model.Currency
+}
+
+func NewUserService(repo repository.Repository, defaultCurrency model.Currency) *UserServiceImpl {
+	return &UserServiceImpl{repo: repo, defaultCurrency: defaultCurrency}
+}
+
+func (s *UserServiceImpl) CreateUser(ctx context.Context, currency model.Currency) (*model.User, error) {
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	var user model.User
+
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		if err := tr.InsertUser(ctx, &user); err != nil {
+			return err
+		}
+
+		return tr.CreateWallet(ctx, user.ID, currency)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUser(ctx, user.ID)
+}
+
+func (s *UserServiceImpl) GetUser(ctx context.Context, userID int) (*model.User, error) {
+	return s.repo.GetUser(ctx, userID)
+}
+
+func (s *UserServiceImpl) SetUserStatus(
+	ctx context.Context,
+	userID int,
+	status model.UserStatus,
+) (*model.User, error) {
+	err := s.repo.WithDBTransaction(ctx, func(ctx context.Context, tr repository.Repository) error {
+		user, err := tr.LockUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if user.Status == status {
+			return nil
+		}
+
+		if !user.Status.CanChangeTo(status) {
+			return fmt.Errorf("%w: user %d cannot be %s", ErrUserClosed, userID, status)
+		}
+
+		user.Status = status
+
+		return tr.UpdateUserStatus(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUser(ctx, userID)
+}
+
+// checkUserStatus rejects a transaction in state of userID unless policy allows it for the status
+// of the user. The status cannot change until tr ends.
+func checkUserStatus(
+	ctx context.Context,
+	tr repository.Repository,
+	policy model.UserStatusPolicy,
+	userID int,
+	state model.TransactionState,
+) error {
+	status, err := tr.LockUserStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if policy.Allows(status, state) {
+		return nil
+	}
+
+	if status == model.UserStatusSuspended {
+		return fmt.Errorf("%w: user %d cannot send %s transactions", ErrUserSuspended, userID, state)
+	}
+
+	return fmt.Errorf("%w: user %d cannot send %s transactions", ErrUserClosed, userID, state)
+}
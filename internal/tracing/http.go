@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span per request, continuing the trace of the W3C traceparent header
+// of a provider, and names it after the route once the request was served. It has to be used on
+// the chi router, so that the route is known by then.
+func Middleware(next http.Handler) http.Handler {
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+	})
+
+	// chi sets the pattern of the request once it was routed, the span is renamed with it then.
+	return otelhttp.NewHandler(routed, "HTTP request", otelhttp.WithSpanNameFormatter(
+		func(_ string, r *http.Request) string {
+			if r.Pattern == "" {
+				return r.Method
+			}
+
+			return r.Method + " " + r.Pattern
+		},
+	))
+}
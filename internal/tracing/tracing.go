@@ -0,0 +1,232 @@
+// Package tracing sets up OpenTelemetry tracing and holds the helpers the handler, service and
+// repository layers create their spans with.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the application.
+const instrumentationName = "github.com/VladislavsPerkanuks/Entain-test-task"
+
+// Attributes of the spans of the application.
+const (
+	UserIDKey        = attribute.Key("wallet.user_id")
+	TransactionIDKey = attribute.Key("wallet.transaction_id")
+	SourceTypeKey    = attribute.Key("wallet.source_type")
+	// OutcomeKey is processed, replayed or rejected for transactions and commit or rollback for
+	// database transactions.
+	OutcomeKey = attribute.Key("wallet.outcome")
+	// ErrorCodeKey is the code of an error response.
+	ErrorCodeKey = attribute.Key("wallet.error_code")
+)
+
+// Outcomes of transactions and database transactions.
+const (
+	OutcomeProcessed = "processed"
+	OutcomeReplayed  = "replayed"
+	OutcomeRejected  = "rejected"
+	OutcomeCommit    = "commit"
+	OutcomeRollback  = "rollback"
+)
+
+// Exporters spans can be sent to.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Config selects where spans are exported to.
+type Config struct {
+	// Exporter is none, otlp, stdout or file.
+	Exporter string
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector. Empty uses the OTEL_EXPORTER_OTLP_*
+	// environment variables of the exporter, or http://localhost:4318.
+	OTLPEndpoint string
+	// File is the file spans are appended to by the file exporter, one JSON document per span.
+	File string
+	// SampleRatio is the share of traces sampled that do not continue a trace of a provider. Traces
+	// of providers are sampled as the provider decided.
+	SampleRatio float64
+	// ServiceName names the application in the traces.
+	ServiceName string
+}
+
+// Setup installs the global tracer provider exporting to the exporter of cfg and the W3C trace
+// context propagator. The returned function flushes the remaining spans and stops the exporter.
+// With the none exporter nothing is installed and spans are not recorded.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	exporter, closeExporter, err := newExporter(ctx, cfg)
+	if err != nil || exporter == nil {
+		return noop, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("failed to describe the tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeExporter())
+	}, nil
+}
+
+// newExporter creates the exporter of cfg, or nil for the none exporter, together with the function
+// releasing what the exporter writes to.
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, func() error, error) {
+	noop := func() error { return nil }
+
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return nil, noop, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+		}
+
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+		}
+
+		return exporter, noop, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to create the stdout exporter: %w", err)
+		}
+
+		return exporter, noop, nil
+	case ExporterFile:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to open the trace file: %w", err)
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+
+			return nil, noop, fmt.Errorf("failed to create the file exporter: %w", err)
+		}
+
+		return exporter, file.Close, nil
+	default:
+		return nil, noop, fmt.Errorf("invalid tracing exporter: %s", cfg.Exporter)
+	}
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(
+	ctx context.Context,
+	name string,
+	opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End sets the outcome of span, records err on it and ends it.
+func End(span trace.Span, outcome string, err error) {
+	span.SetAttributes(OutcomeKey.String(outcome))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// TransactionAttributes describes tx for its spans.
+func TransactionAttributes(tx *model.Transaction) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		UserIDKey.Int(tx.UserID),
+		TransactionIDKey.String(tx.ID.String()),
+		SourceTypeKey.String(string(tx.SourceType)),
+	}
+}
+
+// TransactionOutcome returns whether a transaction was processed, replayed or rejected.
+func TransactionOutcome(processed *model.ProcessedTransaction, err error) string {
+	switch {
+	case err != nil:
+		return OutcomeRejected
+	case processed.Replayed:
+		return OutcomeReplayed
+	default:
+		return OutcomeProcessed
+	}
+}
+
+// DBTransactionOutcome returns whether a database transaction was committed or rolled back.
+func DBTransactionOutcome(err error) string {
+	if err != nil {
+		return OutcomeRollback
+	}
+
+	return OutcomeCommit
+}
+
+// StartStatement starts a client span of the SQL statement query, named after its operation.
+func StartStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+
+	return Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(strings.TrimSpace(query)),
+		),
+	)
+}
+
+// EndStatement records err on the span of a statement, if any, and ends it.
+func EndStatement(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
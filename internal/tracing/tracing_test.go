@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/model"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// record installs a tracer provider recording every span for the duration of the test.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return recorder
+}
+
+// attributes returns the attributes of span by key.
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+
+	return values
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+
+	router := chi.NewRouter()
+	router.Use(Middleware)
+	router.Post("/user/{userID}/transaction", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "Handler.ProcessTransaction")
+		span.End()
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/user/1/transaction", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	handlerSpan, serverSpan := spans[0], spans[1]
+	assert.Equal(t, "POST /user/{userID}/transaction", serverSpan.Name(), "the span is named after the route")
+	assert.Equal(t, "/user/{userID}/transaction", attributes(serverSpan)[semconv.HTTPRouteKey].AsString())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext().TraceID().String(),
+		"the trace of the provider is continued")
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), handlerSpan.Parent().SpanID())
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	spans = recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, http.MethodGet, spans[2].Name(), "unmatched requests are named after their method")
+	assert.False(t, spans[2].Parent().IsValid())
+}
+
+func TestStatement(t *testing.T) {
+	recorder := record(t)
+
+	_, span := StartStatement(context.Background(), `
+select balance FROM wallets WHERE user_id = $1`)
+	EndStatement(span, nil)
+
+	_, span = StartStatement(context.Background(), "UPDATE wallets SET balance = $1")
+	EndStatement(span, errors.New("boom"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "SELECT", spans[0].Name())
+	assert.Equal(t, "SELECT", attributes(spans[0])[semconv.DBOperationNameKey].AsString())
+	assert.Equal(t, "select balance FROM wallets WHERE user_id = $1",
+		attributes(spans[0])[semconv.DBQueryTextKey].AsString())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "UPDATE", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Len(t, spans[1].Events(), 1, "the error is recorded")
+}
+
+func TestEnd(t *testing.T) {
+	recorder := record(t)
+
+	tests := []struct {
+		name      string
+		processed *model.ProcessedTransaction
+		err       error
+		outcome   string
+	}{
+		{name: "processed", processed: &model.ProcessedTransaction{}, outcome: OutcomeProcessed},
+		{name: "replayed", processed: &model.ProcessedTransaction{Replayed: true}, outcome: OutcomeReplayed},
+		{name: "rejected", err: errors.New("insufficient funds"), outcome: OutcomeRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, span := Start(context.Background(), tt.name)
+			End(span, TransactionOutcome(tt.processed, tt.err), tt.err)
+
+			spans := recorder.Ended()
+			ended := spans[len(spans)-1]
+
+			assert.Equal(t, tt.outcome, attributes(ended)[OutcomeKey].AsString())
+
+			if tt.err != nil {
+				assert.Equal(t, codes.Error, ended.Status().Code)
+			} else {
+				assert.Equal(t, codes.Unset, ended.Status().Code)
+			}
+		})
+	}
+
+	assert.Equal(t, OutcomeCommit, DBTransactionOutcome(nil))
+	assert.Equal(t, OutcomeRollback, DBTransactionOutcome(errors.New("boom")))
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), Config{Exporter: "jaeger"})
+	require.ErrorContains(t, err, "invalid tracing exporter")
+}
@@ -0,0 +1 @@
+ALTER TABLE transactions ADD COLUMN balance_after DECIMAL(20, 2);
@@ -0,0 +1 @@
+DROP INDEX transactions_user_id_created_at_id_idx;
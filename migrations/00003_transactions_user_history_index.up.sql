@@ -0,0 +1,2 @@
+CREATE INDEX transactions_user_id_created_at_id_idx
+ON transactions (user_id, created_at DESC, id DESC);
@@ -0,0 +1,10 @@
+DELETE FROM transactions WHERE state = 'rollback';
+
+DROP INDEX transactions_original_transaction_id_key;
+ALTER TABLE transactions DROP CONSTRAINT transactions_rollback_reference;
+ALTER TABLE transactions DROP COLUMN original_transaction_id;
+
+ALTER TABLE transactions DROP CONSTRAINT transactions_state_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_state_check CHECK (
+    state IN ('win', 'lose')
+);
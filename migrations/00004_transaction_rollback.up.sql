@@ -0,0 +1,16 @@
+ALTER TABLE transactions DROP CONSTRAINT transactions_state_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_state_check CHECK (
+    state IN ('win', 'lose', 'rollback')
+);
+
+-- A rollback references the transaction it reverses. There is deliberately no
+-- foreign key: a rollback that arrives before its original is stored as a
+-- zero-amount tombstone so that the late original can be rejected.
+ALTER TABLE transactions ADD COLUMN original_transaction_id UUID;
+
+ALTER TABLE transactions ADD CONSTRAINT transactions_rollback_reference CHECK (
+    (state = 'rollback') = (original_transaction_id IS NOT NULL)
+);
+
+CREATE UNIQUE INDEX transactions_original_transaction_id_key
+ON transactions (original_transaction_id);
@@ -0,0 +1,14 @@
+-- Only EUR balances can be represented without wallets, other currencies are lost.
+ALTER TABLE transactions DROP COLUMN currency;
+
+ALTER TABLE users ADD COLUMN balance DECIMAL(20, 2) NOT NULL DEFAULT 0.00;
+ALTER TABLE users ADD CONSTRAINT users_balance_non_negative CHECK (
+    balance >= 0
+);
+
+UPDATE users
+SET balance = wallets.balance
+FROM wallets
+WHERE wallets.user_id = users.id AND wallets.currency = 'EUR';
+
+DROP TABLE wallets;
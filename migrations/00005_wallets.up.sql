@@ -0,0 +1,21 @@
+-- Balances are held per user and currency. Existing balances were kept in EUR.
+CREATE TABLE wallets (
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    currency CHAR(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    balance DECIMAL(20, 2) NOT NULL DEFAULT 0.00,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, currency)
+);
+
+ALTER TABLE wallets ADD CONSTRAINT wallets_balance_non_negative CHECK (
+    balance >= 0
+);
+
+INSERT INTO wallets (user_id, currency, balance)
+SELECT id, 'EUR', balance FROM users;
+
+ALTER TABLE users DROP CONSTRAINT users_balance_non_negative;
+ALTER TABLE users DROP COLUMN balance;
+
+ALTER TABLE transactions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'EUR';
+ALTER TABLE transactions ALTER COLUMN currency DROP DEFAULT;
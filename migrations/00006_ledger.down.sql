@@ -0,0 +1,4 @@
+DROP TABLE postings;
+DROP FUNCTION check_journal_entry_balanced;
+DROP TABLE journal_entries;
+DROP TABLE ledger_accounts;
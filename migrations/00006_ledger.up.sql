@@ -0,0 +1,82 @@
+-- Double-entry ledger. Every movement of money is a journal entry whose postings sum
+-- to zero per currency; wallets.balance is a projection of the wallet account postings.
+CREATE TABLE ledger_accounts (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(10) NOT NULL CHECK (type IN ('wallet', 'house', 'equity')),
+    user_id INTEGER REFERENCES users (id),
+    source_type VARCHAR(20),
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT ledger_accounts_owner CHECK (
+        (type = 'wallet') = (user_id IS NOT NULL)
+        AND (type = 'house') = (source_type IS NOT NULL)
+    ),
+    CONSTRAINT ledger_accounts_owner_key UNIQUE NULLS NOT DISTINCT (
+        type, user_id, source_type, currency
+    )
+);
+
+CREATE TABLE journal_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id UUID UNIQUE REFERENCES transactions (id),
+    description TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE postings (
+    id BIGSERIAL PRIMARY KEY,
+    journal_entry_id BIGINT NOT NULL REFERENCES journal_entries (id),
+    account_id BIGINT NOT NULL REFERENCES ledger_accounts (id),
+    amount DECIMAL(20, 2) NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX postings_journal_entry_id_idx ON postings (journal_entry_id);
+CREATE INDEX postings_account_id_idx ON postings (account_id);
+
+-- Checked at commit time, once all postings of an entry have been inserted.
+CREATE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM postings p
+        JOIN ledger_accounts a ON a.id = p.account_id
+        WHERE p.journal_entry_id = NEW.journal_entry_id
+        GROUP BY a.currency
+        HAVING SUM(p.amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal entry % is not balanced', NEW.journal_entry_id
+            USING ERRCODE = 'check_violation', CONSTRAINT = 'postings_balanced';
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+AFTER INSERT OR UPDATE ON postings
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Balances that predate the ledger are booked against an opening balance equity account.
+INSERT INTO ledger_accounts (type, user_id, currency)
+SELECT 'wallet', user_id, currency FROM wallets;
+
+INSERT INTO ledger_accounts (type, currency)
+SELECT DISTINCT 'equity', currency FROM wallets WHERE balance <> 0;
+
+WITH entry AS (
+    INSERT INTO journal_entries (description) VALUES ('Opening balances')
+    RETURNING id
+)
+INSERT INTO postings (journal_entry_id, account_id, amount)
+SELECT entry.id, a.id, w.balance
+FROM entry, wallets w
+JOIN ledger_accounts a
+    ON a.type = 'wallet' AND a.user_id = w.user_id AND a.currency = w.currency
+WHERE w.balance <> 0
+UNION ALL
+SELECT entry.id, e.id, -SUM(w.balance)
+FROM entry, wallets w
+JOIN ledger_accounts e ON e.type = 'equity' AND e.currency = w.currency
+WHERE w.balance <> 0
+GROUP BY entry.id, e.id;
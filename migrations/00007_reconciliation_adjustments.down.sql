@@ -0,0 +1 @@
+DROP TABLE reconciliation_adjustments;
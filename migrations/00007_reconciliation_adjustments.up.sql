@@ -0,0 +1,11 @@
+-- Corrections of wallet balances that drifted from the ledger, written by the reconcile command.
+CREATE TABLE reconciliation_adjustments (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    previous_balance DECIMAL(20, 2) NOT NULL,
+    new_balance DECIMAL(20, 2) NOT NULL,
+    reason TEXT NOT NULL CHECK (reason <> ''),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id, currency) REFERENCES wallets (user_id, currency)
+);
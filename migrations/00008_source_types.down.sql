@@ -0,0 +1,6 @@
+ALTER TABLE transactions DROP CONSTRAINT transactions_source_type_fkey;
+ALTER TABLE transactions ADD CONSTRAINT transactions_source_type_check CHECK (
+    source_type IN ('game', 'server', 'payment')
+);
+
+DROP TABLE source_types;
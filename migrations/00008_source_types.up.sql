@@ -0,0 +1,23 @@
+-- Registry of the sources transactions may come from. New sources are added and old ones
+-- disabled through the admin API; disabled sources are kept for the transactions they sent.
+CREATE TABLE source_types (
+    name VARCHAR(20) PRIMARY KEY CHECK (name ~ '^[a-z][a-z0-9_-]*$'),
+    display_name TEXT NOT NULL CHECK (display_name <> ''),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    allowed_states TEXT [] NOT NULL DEFAULT ARRAY['win', 'lose', 'rollback'],
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT source_types_allowed_states CHECK (
+        cardinality(allowed_states) > 0
+        AND allowed_states <@ ARRAY['win', 'lose', 'rollback']
+    )
+);
+
+INSERT INTO source_types (name, display_name) VALUES
+('game', 'Game'),
+('server', 'Server'),
+('payment', 'Payment');
+
+ALTER TABLE transactions DROP CONSTRAINT transactions_source_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_source_type_fkey
+FOREIGN KEY (source_type) REFERENCES source_types (name);
@@ -0,0 +1,15 @@
+-- Responsible gaming net loss limits. An increase or removal only takes effect after a cooling-off
+-- period: until pending_from the limit stays at amount, afterwards it is pending_amount, or removed
+-- if pending_amount is NULL.
+CREATE TABLE user_limits (
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    period VARCHAR(10) NOT NULL CHECK (period IN ('daily', 'weekly', 'monthly')),
+    amount DECIMAL(20, 2) NOT NULL CHECK (amount >= 0),
+    pending_amount DECIMAL(20, 2) CHECK (pending_amount >= 0),
+    pending_from TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, currency, period),
+    FOREIGN KEY (user_id, currency) REFERENCES wallets (user_id, currency),
+    CONSTRAINT user_limits_pending CHECK (pending_amount IS NULL OR pending_from IS NOT NULL)
+);
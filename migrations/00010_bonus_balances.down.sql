@@ -0,0 +1,32 @@
+-- Bonus money cannot be booked without bonus accounts. Dropping only the bonus postings would leave
+-- their journal entries unbalanced, and dropping the entries would also drop the real money moved by
+-- bonus losses and conversions, so downgrading is refused once bonus money was booked.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM postings p
+        JOIN ledger_accounts a ON a.id = p.account_id
+        WHERE a.type IN ('bonus', 'promotion')
+    ) THEN
+        RAISE EXCEPTION 'bonus money was booked in the ledger, it cannot be removed by a downgrade';
+    END IF;
+END
+$$;
+
+DELETE FROM ledger_accounts WHERE type IN ('bonus', 'promotion');
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_owner;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_owner CHECK (
+    (type = 'wallet') = (user_id IS NOT NULL)
+    AND (type = 'house') = (source_type IS NOT NULL)
+);
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check
+    CHECK (type IN ('wallet', 'house', 'equity'));
+
+DROP TABLE bonus_grants;
+
+ALTER TABLE transactions DROP COLUMN bonus_amount;
+ALTER TABLE wallets DROP COLUMN bonus_balance;
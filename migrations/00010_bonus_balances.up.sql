@@ -0,0 +1,36 @@
+-- Bonus money is held apart from the real balance until its wagering requirement is met.
+-- wallets.balance stays the real, withdrawable balance.
+ALTER TABLE wallets ADD COLUMN bonus_balance DECIMAL(20, 2) NOT NULL DEFAULT 0.00;
+ALTER TABLE wallets ADD CONSTRAINT wallets_bonus_balance_non_negative CHECK (bonus_balance >= 0);
+
+-- The part of a lose paid from the bonus balance, given back to it by a rollback.
+ALTER TABLE transactions ADD COLUMN bonus_amount DECIMAL(20, 2) NOT NULL DEFAULT 0.00;
+
+CREATE TABLE bonus_grants (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    amount DECIMAL(20, 2) NOT NULL CHECK (amount > 0),
+    wagering_requirement DECIMAL(20, 2) NOT NULL CHECK (wagering_requirement > 0),
+    wagered DECIMAL(20, 2) NOT NULL DEFAULT 0.00 CHECK (wagered >= 0),
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'converted', 'forfeited')),
+    converted_amount DECIMAL(20, 2) CHECK (converted_amount >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+    FOREIGN KEY (user_id, currency) REFERENCES wallets (user_id, currency),
+    CONSTRAINT bonus_grants_completion CHECK ((status = 'active') = (completed_at IS NULL))
+);
+
+-- Wagering progresses the active grants of a wallet oldest first.
+CREATE INDEX bonus_grants_active_idx ON bonus_grants (user_id, currency, id) WHERE status = 'active';
+
+-- Bonus accounts hold the bonus balances of users, funded from the promotion account.
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check
+    CHECK (type IN ('wallet', 'bonus', 'house', 'equity', 'promotion'));
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_owner;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_owner CHECK (
+    (type IN ('wallet', 'bonus')) = (user_id IS NOT NULL)
+    AND (type = 'house') = (source_type IS NOT NULL)
+);
@@ -0,0 +1,25 @@
+-- Held money goes back to the real balances before the reservations are dropped. Moving the
+-- held postings to the wallet accounts keeps the ledger in line with the balances.
+UPDATE wallets SET balance = balance + held_balance WHERE held_balance <> 0;
+
+UPDATE postings p
+SET account_id = w.id
+FROM ledger_accounts h
+JOIN ledger_accounts w ON w.type = 'wallet' AND w.user_id = h.user_id AND w.currency = h.currency
+WHERE h.type = 'held' AND p.account_id = h.id;
+
+DELETE FROM ledger_accounts WHERE type = 'held';
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_owner;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_owner CHECK (
+    (type IN ('wallet', 'bonus')) = (user_id IS NOT NULL)
+    AND (type = 'house') = (source_type IS NOT NULL)
+);
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check
+    CHECK (type IN ('wallet', 'bonus', 'house', 'equity', 'promotion'));
+
+DROP TABLE reservations;
+
+ALTER TABLE wallets DROP COLUMN held_balance;
@@ -0,0 +1,33 @@
+-- Two-phase bets. A reservation moves real money from wallets.balance to wallets.held_balance
+-- until it is committed as a lose transaction with the same ID or released back.
+ALTER TABLE wallets ADD COLUMN held_balance DECIMAL(20, 2) NOT NULL DEFAULT 0.00;
+ALTER TABLE wallets ADD CONSTRAINT wallets_held_balance_non_negative CHECK (held_balance >= 0);
+
+CREATE TABLE reservations (
+    id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    source_type VARCHAR(20) NOT NULL REFERENCES source_types (name),
+    amount DECIMAL(20, 2) NOT NULL CHECK (amount > 0),
+    status VARCHAR(10) NOT NULL DEFAULT 'held'
+        CHECK (status IN ('held', 'committed', 'released', 'expired')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    settled_at TIMESTAMPTZ,
+    FOREIGN KEY (user_id, currency) REFERENCES wallets (user_id, currency),
+    CONSTRAINT reservations_settlement CHECK ((status = 'held') = (settled_at IS NULL))
+);
+
+-- The sweeper looks up the held reservations that are past their expiry.
+CREATE INDEX reservations_held_expires_at_idx ON reservations (expires_at) WHERE status = 'held';
+
+-- Held accounts hold the reserved money of users until their reservations are settled.
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check
+    CHECK (type IN ('wallet', 'bonus', 'held', 'house', 'equity', 'promotion'));
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_owner;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_owner CHECK (
+    (type IN ('wallet', 'bonus', 'held')) = (user_id IS NOT NULL)
+    AND (type = 'house') = (source_type IS NOT NULL)
+);
@@ -0,0 +1,6 @@
+-- Accounts can be suspended and closed. Transactions of users that are not active are
+-- rejected, except for the states the configured policy allows.
+ALTER TABLE users ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'suspended', 'closed'));
+ALTER TABLE users ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,5 @@
+DROP TABLE audit_log;
+DROP TABLE manual_adjustments;
+
+-- Applied adjustments are kept as transactions, so the source type stays registered but disabled.
+UPDATE source_types SET enabled = FALSE, updated_at = NOW() WHERE name = 'manual';
@@ -0,0 +1,41 @@
+-- Operators credit and debit wallets by hand through the admin API. An applied adjustment is
+-- stored as a transaction of the reserved manual source type with the same ID. Adjustments above
+-- the approval threshold stay pending until a second operator approves or rejects them.
+INSERT INTO source_types (name, display_name, allowed_states) VALUES
+('manual', 'Manual adjustment', ARRAY['win', 'lose'])
+ON CONFLICT (name) DO UPDATE SET enabled = TRUE, updated_at = NOW();
+
+CREATE TABLE manual_adjustments (
+    id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    type VARCHAR(10) NOT NULL CHECK (type IN ('credit', 'debit')),
+    amount DECIMAL(20, 2) NOT NULL CHECK (amount > 0),
+    reason_code VARCHAR(20) NOT NULL
+        CHECK (reason_code IN ('goodwill', 'correction', 'chargeback', 'fraud', 'other')),
+    comment TEXT NOT NULL CHECK (comment <> ''),
+    requested_by VARCHAR(100) NOT NULL CHECK (requested_by <> ''),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'applied', 'rejected')),
+    reviewed_by VARCHAR(100),
+    review_comment TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    decided_at TIMESTAMPTZ,
+    FOREIGN KEY (user_id, currency) REFERENCES wallets (user_id, currency),
+    CONSTRAINT manual_adjustments_decision CHECK ((status = 'pending') = (decided_at IS NULL)),
+    CONSTRAINT manual_adjustments_four_eyes CHECK (reviewed_by <> requested_by)
+);
+
+CREATE INDEX manual_adjustments_status_idx ON manual_adjustments (status, created_at);
+
+-- Append-only trail of operator actions.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    operator VARCHAR(100) NOT NULL CHECK (operator <> ''),
+    action VARCHAR(50) NOT NULL,
+    subject_type VARCHAR(30) NOT NULL,
+    subject_id VARCHAR(100) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_log_subject_idx ON audit_log (subject_type, subject_id, id);
@@ -0,0 +1,4 @@
+ALTER TABLE reservations DROP COLUMN provider;
+ALTER TABLE transactions DROP COLUMN provider;
+
+DROP TABLE providers;
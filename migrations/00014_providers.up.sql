@@ -0,0 +1,13 @@
+-- Providers send transactions signed with a shared secret. Each provider may only send
+-- transactions of its own source types, and the provider is recorded on what it sent.
+CREATE TABLE providers (
+    name VARCHAR(50) PRIMARY KEY,
+    secret TEXT NOT NULL CHECK (length(secret) >= 32),
+    source_types TEXT [] NOT NULL CHECK (cardinality(source_types) > 0),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE transactions ADD COLUMN provider VARCHAR(50) REFERENCES providers (name);
+ALTER TABLE reservations ADD COLUMN provider VARCHAR(50) REFERENCES providers (name);
@@ -0,0 +1,14 @@
+-- Bearer API keys of the providers. Only the SHA-256 of a key is stored; the prefix identifies
+-- the key in listings. Revoked keys are kept for their history.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL REFERENCES providers (name),
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT [] NOT NULL CHECK (cardinality(scopes) > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_keys_provider_idx ON api_keys (provider, created_at);
@@ -0,0 +1,9 @@
+-- Token buckets of the rate limits shared by all instances. A bucket left alone long enough is
+-- full again, so idle buckets are deleted rather than kept.
+CREATE TABLE rate_limit_buckets (
+    key VARCHAR(200) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
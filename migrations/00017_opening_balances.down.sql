@@ -0,0 +1,3 @@
+ALTER TABLE reconciliation_adjustments DROP COLUMN balance_type;
+
+DROP TABLE opening_balances;
@@ -0,0 +1,21 @@
+-- Balances that predate the transaction history, recorded apart from the ledger so that the
+-- reconcile command can recompute every balance from the history alone.
+CREATE TABLE opening_balances (
+    user_id INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    balance DECIMAL(20, 2) NOT NULL,
+    PRIMARY KEY (user_id, currency),
+    FOREIGN KEY (user_id, currency) REFERENCES wallets (user_id, currency) ON DELETE CASCADE
+);
+
+INSERT INTO opening_balances (user_id, currency, balance)
+SELECT a.user_id, a.currency, SUM(p.amount)
+FROM journal_entries e
+JOIN postings p ON p.journal_entry_id = e.id
+JOIN ledger_accounts a ON a.id = p.account_id
+WHERE e.transaction_id IS NULL AND e.description = 'Opening balances' AND a.type = 'wallet'
+GROUP BY a.user_id, a.currency;
+
+-- A correction sets one of the real, bonus and held balances of a wallet.
+ALTER TABLE reconciliation_adjustments ADD COLUMN balance_type VARCHAR(5) NOT NULL DEFAULT 'real'
+    CHECK (balance_type IN ('real', 'bonus', 'held'));
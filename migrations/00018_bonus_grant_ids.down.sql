@@ -0,0 +1 @@
+ALTER TABLE bonus_grants DROP COLUMN grant_id;
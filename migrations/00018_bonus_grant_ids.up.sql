@@ -0,0 +1,4 @@
+-- Grant IDs are chosen by the caller so that a retried grant is credited only once. Grants made
+-- before they were required have none.
+ALTER TABLE bonus_grants ADD COLUMN grant_id UUID;
+ALTER TABLE bonus_grants ADD CONSTRAINT bonus_grants_grant_id_key UNIQUE (grant_id);
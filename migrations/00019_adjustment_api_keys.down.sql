@@ -0,0 +1,2 @@
+ALTER TABLE manual_adjustments DROP COLUMN reviewed_by_key;
+ALTER TABLE manual_adjustments DROP COLUMN requested_by_key;
@@ -0,0 +1,7 @@
+-- The API keys operators requested and reviewed adjustments with. Operators name themselves in a
+-- header, so the four-eyes rule also holds for the keys: a key cannot approve its own request.
+-- Both are NULL for adjustments made without API keys.
+ALTER TABLE manual_adjustments ADD COLUMN requested_by_key UUID;
+ALTER TABLE manual_adjustments ADD COLUMN reviewed_by_key UUID;
+ALTER TABLE manual_adjustments ADD CONSTRAINT manual_adjustments_four_eyes_key
+    CHECK (reviewed_by_key <> requested_by_key);
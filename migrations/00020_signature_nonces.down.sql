@@ -0,0 +1 @@
+DROP TABLE signature_nonces;
@@ -0,0 +1,9 @@
+-- Nonces of signed requests shared by all instances, so that a request cannot be replayed against
+-- another instance. A nonce is only kept until the timestamp of its request is too old to be
+-- accepted, expired nonces are deleted rather than kept.
+CREATE TABLE signature_nonces (
+    key VARCHAR(200) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX signature_nonces_expires_at_idx ON signature_nonces (expires_at);
@@ -0,0 +1,49 @@
+// Package migrations embeds the database migrations into the binary.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// FS holds the migrations as 000NN_name.up.sql and 000NN_name.down.sql files.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Source returns the migration source reading FS.
+func Source() (source.Driver, error) {
+	return iofs.New(FS, ".")
+}
+
+// Latest returns the version of the last migration, the schema version the binary expects.
+func Latest() (uint, error) {
+	src, err := Source()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+
+		version = next
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type AdjustmentTestSuite struct {
+	APITestSuite
+}
+
+type adjustmentResponse struct {
+	TransactionID string `json:"transactionId"`
+	Status        string `json:"status"`
+	RequestedBy   string `json:"requestedBy"`
+	ReviewedBy    string `json:"reviewedBy"`
+	Audit         []struct {
+		Operator string `json:"operator"`
+		Action   string `json:"action"`
+	} `json:"audit"`
+}
+
+func (s *AdjustmentTestSuite) adjustment(resp apiResponse) adjustmentResponse {
+	var adjustment adjustmentResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &adjustment))
+
+	return adjustment
+}
+
+func (s *AdjustmentTestSuite) request(operator, adjustmentType, amount string) (string, apiResponse) {
+	id := uuid.New().String()
+
+	return id, s.Adjustments(s.T(), http.MethodPost, operator, "", map[string]any{
+		"transactionId": id,
+		"userId":        1,
+		"type":          adjustmentType,
+		"amount":        amount,
+		"reasonCode":    "goodwill",
+		"comment":       "compensation for an outage",
+	})
+}
+
+func (s *AdjustmentTestSuite) balance() string {
+	resp := s.GetBalance(s.T(), 1)
+	s.Require().Equal(200, resp.StatusCode)
+
+	var balance BalanceResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &balance))
+
+	return balance.Balance
+}
+
+func (s *AdjustmentTestSuite) TestSmallAdjustmentIsApplied() {
+	id, resp := s.request("alice", "credit", "50.00")
+	s.Require().Equal(201, resp.StatusCode, "Should apply adjustments below the threshold")
+	s.Equal("applied", s.adjustment(resp).Status)
+	s.Equal("150.00", s.balance())
+
+	resp = s.GetTransaction(s.T(), 1, id)
+	s.Require().Equal(200, resp.StatusCode, "Should store the adjustment as a transaction")
+	s.Contains(string(resp.Body), `"sourceType":"manual"`)
+
+	s.assertLedgerConsistent()
+}
+
+func (s *AdjustmentTestSuite) TestLargeAdjustmentNeedsApproval() {
+	id, resp := s.request("alice", "credit", "1500.00")
+	s.Require().Equal(202, resp.StatusCode, "Should hold adjustments above the threshold")
+	s.Equal("pending", s.adjustment(resp).Status)
+	s.Equal("100.00", s.balance(), "Pending adjustments should not move money")
+
+	resp = s.Adjustments(s.T(), http.MethodPost, "alice", id+"/approve", nil)
+	s.Equal(403, resp.StatusCode, "Operators should not approve their own adjustments")
+	s.JSONEq(`"self_review"`, s.problemCode(resp))
+
+	resp = s.Adjustments(s.T(), http.MethodPost, "bob", id+"/approve", map[string]string{"comment": "ticket 42"})
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal("bob", s.adjustment(resp).ReviewedBy)
+	s.Equal("1600.00", s.balance())
+
+	resp = s.Adjustments(s.T(), http.MethodGet, "", id, nil)
+	s.Require().Equal(200, resp.StatusCode)
+
+	audit := s.adjustment(resp).Audit
+	s.Require().Len(audit, 2, "Should record the request and the approval")
+	s.Equal("adjustment_requested", audit[0].Action)
+	s.Equal("alice", audit[0].Operator)
+	s.Equal("adjustment_applied", audit[1].Action)
+	s.Equal("bob", audit[1].Operator)
+
+	s.assertLedgerConsistent()
+}
+
+func (s *AdjustmentTestSuite) TestRequesterKeyCannotApproveUnderAnotherName() {
+	id, resp := s.request("alice", "credit", "1500.00")
+	s.Require().Equal(202, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, s.BaseURL+"/admin/adjustments/"+id+"/approve", http.NoBody)
+	s.Require().NoError(err)
+	req.Header.Set("Operator-ID", "mallory")
+	req.Header.Set("Authorization", "Bearer "+s.operatorAPIKey("alice"))
+
+	resp = s.performRequest(req)
+	s.Equal(403, resp.StatusCode, "The API key of the requester should not approve under another name")
+	s.JSONEq(`"self_review"`, s.problemCode(resp))
+	s.Equal("100.00", s.balance())
+}
+
+func (s *AdjustmentTestSuite) TestRejectedAdjustment() {
+	id, resp := s.request("alice", "debit", "1500.00")
+	s.Require().Equal(202, resp.StatusCode)
+
+	resp = s.Adjustments(s.T(), http.MethodPost, "bob", id+"/reject", map[string]string{"comment": "no ticket"})
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal("rejected", s.adjustment(resp).Status)
+
+	resp = s.Adjustments(s.T(), http.MethodPost, "carol", id+"/approve", nil)
+	s.Equal(409, resp.StatusCode, "Rejected adjustments should not be applied")
+	s.JSONEq(`"adjustment_decided"`, s.problemCode(resp))
+
+	resp = s.Adjustments(s.T(), http.MethodGet, "", "?status=rejected", nil)
+	s.Require().Equal(200, resp.StatusCode)
+	s.Contains(string(resp.Body), id)
+	s.Equal("100.00", s.balance())
+}
+
+func (s *AdjustmentTestSuite) TestDebitKeepsBalanceInvariants() {
+	_, resp := s.request("alice", "debit", "150.00")
+
+	s.Equal(422, resp.StatusCode, "Should not debit more than the balance")
+	s.JSONEq(`"insufficient_funds"`, s.problemCode(resp))
+	s.Equal("100.00", s.balance())
+}
+
+func (s *AdjustmentTestSuite) TestAdjustmentIsIdempotent() {
+	body := map[string]any{
+		"transactionId": uuid.New().String(),
+		"userId":        1,
+		"type":          "credit",
+		"amount":        "10.00",
+		"reasonCode":    "correction",
+		"comment":       "missing win",
+	}
+
+	resp := s.Adjustments(s.T(), http.MethodPost, "alice", "", body)
+	s.Require().Equal(201, resp.StatusCode)
+
+	resp = s.Adjustments(s.T(), http.MethodPost, "alice", "", body)
+	s.Equal(201, resp.StatusCode, "Retries should return the stored adjustment")
+	s.Equal("110.00", s.balance(), "Retries should not apply the adjustment twice")
+
+	body["amount"] = "20.00"
+	resp = s.Adjustments(s.T(), http.MethodPost, "alice", "", body)
+	s.Equal(409, resp.StatusCode)
+	s.JSONEq(`"duplicate_transaction"`, s.problemCode(resp))
+}
+
+func (s *AdjustmentTestSuite) TestManualSourceTypeIsReserved() {
+	id, resp := s.request("alice", "credit", "10.00")
+	s.Require().Equal(201, resp.StatusCode)
+
+	resp = s.ProcessTransaction(s.T(), 1, "manual", TransactionRequest{
+		State:         "win",
+		Amount:        "10.00",
+		TransactionID: uuid.New().String(),
+	})
+	s.Equal(400, resp.StatusCode, "Providers should not send manual transactions")
+
+	resp = s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:                 "rollback",
+		TransactionID:         uuid.New().String(),
+		OriginalTransactionID: id,
+	})
+	s.Equal(400, resp.StatusCode, "Adjustments should not be rolled back")
+}
+
+func (s *AdjustmentTestSuite) TestAdjustmentErrors() {
+	_, resp := s.request("", "credit", "10.00")
+	s.Equal(400, resp.StatusCode, "The operator should be required")
+
+	resp = s.Adjustments(s.T(), http.MethodPost, "alice", "", map[string]any{
+		"transactionId": uuid.New().String(),
+		"userId":        1,
+		"type":          "credit",
+		"amount":        "10.00",
+		"reasonCode":    "goodwill",
+	})
+	s.Equal(400, resp.StatusCode, "The comment should be required")
+
+	resp = s.Adjustments(s.T(), http.MethodGet, "", uuid.New().String(), nil)
+	s.Equal(404, resp.StatusCode)
+	s.JSONEq(`"adjustment_not_found"`, s.problemCode(resp))
+}
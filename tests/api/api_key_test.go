@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type APIKeyTestSuite struct {
+	APITestSuite
+}
+
+type apiKeyResponse struct {
+	KeyID      string   `json:"keyId"`
+	Provider   string   `json:"provider"`
+	Scopes     []string `json:"scopes"`
+	LastUsedAt string   `json:"lastUsedAt"`
+	RevokedAt  string   `json:"revokedAt"`
+	Key        string   `json:"key"`
+}
+
+// keys performs a request against /admin/providers/test/keys, or against /admin/keys/{path} if
+// path is not empty.
+func (s *APIKeyTestSuite) keys(method, path string, body any) apiResponse {
+	url := strings.TrimRight(s.BaseURL, "/") + "/admin/providers/" + testProvider + "/keys"
+	if path != "" {
+		url = strings.TrimRight(s.BaseURL, "/") + "/admin/keys/" + path
+	}
+
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err)
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return s.performRequest(req)
+}
+
+func (s *APIKeyTestSuite) key(resp apiResponse) apiKeyResponse {
+	var key apiKeyResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &key))
+
+	return key
+}
+
+// issue issues a key of the test provider granting scopes.
+func (s *APIKeyTestSuite) issue(scopes ...string) apiKeyResponse {
+	resp := s.keys(http.MethodPost, "", map[string]any{"scopes": scopes})
+	s.Require().Equal(201, resp.StatusCode, "Should issue the key")
+
+	return s.key(resp)
+}
+
+// balance reads the balance of user 1 with authorization as the Authorization header.
+func (s *APIKeyTestSuite) balance(authorization string) apiResponse {
+	url := fmt.Sprintf("%s/user/1/balance", strings.TrimRight(s.BaseURL, "/"))
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	s.Require().NoError(err)
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	// The request is sent directly, performRequest would add the key of the test provider.
+	resp, err := s.httpClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+
+	return apiResponse{StatusCode: resp.StatusCode, Headers: resp.Header.Clone(), Body: body}
+}
+
+func (s *APIKeyTestSuite) TestMissingKey() {
+	resp := s.balance("")
+	s.Equal(401, resp.StatusCode, "Requests without a key should be rejected")
+	s.JSONEq(`"unauthenticated"`, s.problemCode(resp))
+	s.NotEmpty(resp.Headers.Get("WWW-Authenticate"))
+
+	resp = s.balance("Bearer wk_unknown")
+	s.Equal(401, resp.StatusCode, "Unknown keys should be rejected")
+}
+
+func (s *APIKeyTestSuite) TestScopes() {
+	issued := s.issue("balance:read")
+	s.Equal(testProvider, issued.Provider)
+	s.NotEmpty(issued.Key)
+
+	resp := s.balance("Bearer " + issued.Key)
+	s.Equal(200, resp.StatusCode, "Read keys should read balances")
+
+	url := fmt.Sprintf("%s/user/1/transaction", strings.TrimRight(s.BaseURL, "/"))
+	body := []byte(fmt.Sprintf(`{"state":"win","amount":"1.00","transactionId":%q}`, uuid.New().String()))
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	s.Require().NoError(err)
+
+	req.Header.Set("Source-Type", "game")
+	req.Header.Set("Authorization", "Bearer "+issued.Key)
+	s.sign(req, body)
+
+	resp = s.performRequest(req)
+	s.Equal(403, resp.StatusCode, "Read keys should not send transactions")
+	s.JSONEq(`"insufficient_scope"`, s.problemCode(resp))
+
+	resp = s.keys(http.MethodGet, "", nil)
+	s.Require().Equal(200, resp.StatusCode)
+
+	var list struct {
+		Keys []apiKeyResponse `json:"keys"`
+	}
+	s.Require().NoError(json.Unmarshal(resp.Body, &list))
+	s.Require().NotEmpty(list.Keys)
+	s.Equal(issued.KeyID, list.Keys[0].KeyID, "Keys should be listed newest first")
+	s.NotEmpty(list.Keys[0].LastUsedAt, "The last use should be recorded")
+	s.Empty(list.Keys[0].Key, "Listed keys should not be shown")
+}
+
+func (s *APIKeyTestSuite) TestRotateAndRevoke() {
+	issued := s.issue("balance:read")
+
+	resp := s.keys(http.MethodPost, issued.KeyID+"/rotate", nil)
+	s.Require().Equal(201, resp.StatusCode, "Should rotate the key")
+
+	rotated := s.key(resp)
+	s.NotEqual(issued.KeyID, rotated.KeyID)
+	s.Equal([]string{"balance:read"}, rotated.Scopes, "The new key should keep the scopes")
+
+	s.Equal(401, s.balance("Bearer "+issued.Key).StatusCode, "Rotated keys should be rejected")
+	s.Equal(200, s.balance("Bearer "+rotated.Key).StatusCode)
+
+	resp = s.keys(http.MethodPost, issued.KeyID+"/rotate", nil)
+	s.Equal(409, resp.StatusCode, "Revoked keys should not be rotated again")
+	s.JSONEq(`"api_key_revoked"`, s.problemCode(resp))
+
+	resp = s.keys(http.MethodDelete, rotated.KeyID, nil)
+	s.Require().Equal(200, resp.StatusCode, "Should revoke the key")
+	s.NotEmpty(s.key(resp).RevokedAt)
+
+	s.Equal(401, s.balance("Bearer "+rotated.Key).StatusCode, "Revoked keys should be rejected")
+
+	resp = s.keys(http.MethodDelete, uuid.New().String(), nil)
+	s.Equal(404, resp.StatusCode)
+}
+
+func (s *APIKeyTestSuite) TestIssueErrors() {
+	resp := s.keys(http.MethodPost, "", map[string]any{"scopes": []string{"root"}})
+	s.Equal(400, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.BaseURL, "/")+"/admin/providers/unknown/keys",
+		strings.NewReader(`{"scopes":["balance:read"]}`))
+	s.Require().NoError(err)
+
+	resp = s.performRequest(req)
+	s.Equal(403, resp.StatusCode, "Keys should only issue keys of their own provider")
+	s.JSONEq(`"insufficient_scope"`, s.problemCode(resp))
+}
+
+// as performs a request against path with the API key key.
+func (s *APIKeyTestSuite) as(key, method, path, body string) apiResponse {
+	req, err := http.NewRequest(method, strings.TrimRight(s.BaseURL, "/")+path, strings.NewReader(body))
+	s.Require().NoError(err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	return s.performRequest(req)
+}
+
+func (s *APIKeyTestSuite) TestKeysOfAnotherProvider() {
+	s.gamesProvider()
+	games := s.createAPIKey("games", "admin")
+	issued := s.issue("balance:read")
+
+	resp := s.as(games, http.MethodGet, "/admin/providers/"+testProvider+"/keys", "")
+	s.Equal(403, resp.StatusCode, "Keys of other providers should not be listed")
+	s.JSONEq(`"insufficient_scope"`, s.problemCode(resp))
+
+	resp = s.as(games, http.MethodPost, "/admin/providers/"+testProvider+"/keys", `{"scopes":["admin"]}`)
+	s.Equal(403, resp.StatusCode, "Keys of other providers should not be issued")
+
+	resp = s.as(games, http.MethodPost, "/admin/keys/"+issued.KeyID+"/rotate", "")
+	s.Equal(404, resp.StatusCode, "Keys of other providers should not be rotated")
+
+	resp = s.as(games, http.MethodDelete, "/admin/keys/"+issued.KeyID, "")
+	s.Equal(404, resp.StatusCode, "Keys of other providers should not be revoked")
+
+	s.Equal(200, s.balance("Bearer "+issued.Key).StatusCode, "The key should still be active")
+
+	resp = s.as(games, http.MethodPost, "/admin/providers/games/keys", `{"scopes":["balance:read"]}`)
+	s.Equal(201, resp.StatusCode, "Keys of the own provider should be issued")
+}
+
+func (s *APIKeyTestSuite) TestTransactionsOfAnotherProvider() {
+	s.gamesProvider()
+	games := s.createAPIKey("games", "balance:read")
+	id := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{State: "win", Amount: "10.00", TransactionID: id})
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.as(games, http.MethodGet, "/transaction/"+id, "")
+	s.Equal(404, resp.StatusCode, "Transactions of other providers should not be found")
+	s.JSONEq(`"transaction_not_found"`, s.problemCode(resp))
+
+	resp = s.as(games, http.MethodGet, "/user/1/transaction/"+id, "")
+	s.Equal(404, resp.StatusCode, "Transactions of other providers should not be found")
+
+	resp = s.as(games, http.MethodGet, "/user/1/transactions", "")
+	s.Require().Equal(200, resp.StatusCode)
+	s.NotContains(string(resp.Body), id, "History should leave out transactions of other providers")
+
+	resp = s.GetTransaction(s.T(), 0, id)
+	s.Equal(200, resp.StatusCode, "The sending provider should read its transaction")
+}
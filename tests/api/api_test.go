@@ -3,24 +3,37 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/VladislavsPerkanuks/Entain-test-task/internal/config"
+	httpServer "github.com/VladislavsPerkanuks/Entain-test-task/internal/http"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
+// The provider that signs the transaction requests of the tests. It may send the seeded source types,
+// and its API key grants every scope.
+const (
+	testProvider       = "test"
+	testProviderSecret = "test-provider-secret-0123456789abcdef"
+	testAPIKey         = "wk_test-api-key"
+)
+
 // APITestSuite provides test setup and teardown for All API integration tests.
 type APITestSuite struct {
 	suite.Suite
@@ -40,20 +53,65 @@ type apiResponse struct {
 
 // TransactionRequest represents the payload sent to the transaction endpoint in tests.
 type TransactionRequest struct {
-	State         string `json:"state"`
-	Amount        string `json:"amount"`
-	TransactionID string `json:"transactionId"`
+	State                 string `json:"state"`
+	Amount                string `json:"amount,omitempty"`
+	Currency              string `json:"currency,omitempty"`
+	TransactionID         string `json:"transactionId"`
+	OriginalTransactionID string `json:"originalTransactionId,omitempty"`
+}
+
+// BatchItemRequest is one transaction of a batch request.
+type BatchItemRequest struct {
+	TransactionRequest
+
+	UserID     int    `json:"userId"`
+	SourceType string `json:"sourceType"`
+}
+
+// BatchRequest represents the payload sent to the batch endpoint in tests.
+type BatchRequest struct {
+	Mode         string             `json:"mode"`
+	Transactions []BatchItemRequest `json:"transactions"`
+}
+
+// BatchResponse mirrors the public contract of the batch endpoint.
+type BatchResponse struct {
+	Results []struct {
+		Index  int    `json:"index"`
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	} `json:"results"`
+}
+
+// TransactionPageResponse mirrors the public contract of the transaction history endpoint.
+type TransactionPageResponse struct {
+	UserID       int `json:"userId"`
+	Transactions []struct {
+		TransactionID string `json:"transactionId"`
+		State         string `json:"state"`
+		Amount        string `json:"amount"`
+		SourceType    string `json:"sourceType"`
+		BalanceAfter  string `json:"balanceAfter"`
+	} `json:"transactions"`
+	NextCursor string `json:"nextCursor"`
 }
 
 // BalanceResponse mirrors the public contract of the balance endpoint.
 type BalanceResponse struct {
-	UserID  int    `json:"userId"`
-	Balance string `json:"balance"`
+	UserID       int    `json:"userId"`
+	Currency     string `json:"currency"`
+	Balance      string `json:"balance"`
+	RealBalance  string `json:"realBalance"`
+	BonusBalance string `json:"bonusBalance"`
+	HeldBalance  string `json:"heldBalance"`
 }
 
 // SetupSuite runs once before all tests in the suite.
 func (s *APITestSuite) SetupSuite() {
-	s.testConfig = config.DefaultConfig()
+	testConfig, err := config.Load("api", nil)
+	s.Require().NoError(err, "invalid test configuration")
+
+	s.testConfig = testConfig
 	s.BaseURL = "http://localhost:3000"
 
 	s.httpClient = &http.Client{
@@ -67,16 +125,7 @@ func (s *APITestSuite) SetupSuite() {
 
 	s.Require().NoError(s.waitForServer(s.BaseURL, 30*time.Second), "server not ready")
 
-	hostPort := net.JoinHostPort(s.testConfig.DatabaseHost, s.testConfig.DatabasePort)
-	connectionString := fmt.Sprintf(
-		"postgres://%s:%s@%s/%s?sslmode=disable",
-		s.testConfig.DatabaseUser,
-		s.testConfig.DatabasePassword,
-		hostPort,
-		s.testConfig.DatabaseName,
-	)
-
-	conn, err := sql.Open("postgres", connectionString)
+	conn, err := sql.Open("postgres", s.testConfig.DSN())
 	s.Require().NoError(err, "failed to open test database connection")
 	s.testDB = conn
 }
@@ -94,6 +143,70 @@ func TestGetBalanceTestSuite(t *testing.T) {
 	suite.Run(t, new(GetBalanceTestSuite))
 }
 
+func TestWalletTestSuite(t *testing.T) {
+	suite.Run(t, new(WalletTestSuite))
+}
+
+func TestListTransactionsTestSuite(t *testing.T) {
+	suite.Run(t, new(ListTransactionsTestSuite))
+}
+
+func TestGetTransactionTestSuite(t *testing.T) {
+	suite.Run(t, new(GetTransactionTestSuite))
+}
+
+func TestLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitTestSuite))
+}
+
+func TestBonusTestSuite(t *testing.T) {
+	suite.Run(t, new(BonusTestSuite))
+}
+
+func TestUserTestSuite(t *testing.T) {
+	suite.Run(t, new(UserTestSuite))
+}
+
+func TestReservationTestSuite(t *testing.T) {
+	suite.Run(t, new(ReservationTestSuite))
+}
+
+func TestAdjustmentTestSuite(t *testing.T) {
+	suite.Run(t, new(AdjustmentTestSuite))
+}
+
+func TestSourceTypeTestSuite(t *testing.T) {
+	suite.Run(t, new(SourceTypeTestSuite))
+}
+
+func TestSignatureTestSuite(t *testing.T) {
+	suite.Run(t, new(SignatureTestSuite))
+}
+
+func TestAPIKeyTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeyTestSuite))
+}
+
+func TestRateLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitTestSuite))
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
+
+func TestRequestIDTestSuite(t *testing.T) {
+	suite.Run(t, new(RequestIDTestSuite))
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(BatchTestSuite))
+}
+
 func TestPerformanceTestSuite(t *testing.T) {
 	if _, ok := os.LookupEnv("RUN_PERFORMANCE_TESTS"); !ok {
 		t.Skip("Skipping performance tests. Set RUN_PERFORMANCE_TESTS=1 to run.")
@@ -114,6 +227,37 @@ func (s *APITestSuite) GetBalance(tb testing.TB, userID int) apiResponse {
 	return s.performRequest(req)
 }
 
+// GetWalletBalance calls the GET /user/{id}/balance endpoint for the given currency.
+func (s *APITestSuite) GetWalletBalance(tb testing.TB, userID int, currency string) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/user/%d/balance?currency=%s", strings.TrimRight(s.BaseURL, "/"), userID, currency)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(tb, err, "Failed to create GET request for user %d", userID)
+
+	return s.performRequest(req)
+}
+
+// ListWallets calls the GET /user/{id}/wallets endpoint.
+func (s *APITestSuite) ListWallets(tb testing.TB, userID int) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/user/%d/wallets", strings.TrimRight(s.BaseURL, "/"), userID)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(tb, err, "Failed to create GET request for user %d wallets", userID)
+
+	return s.performRequest(req)
+}
+
+// createWallet adds an empty wallet in currency for userID directly in the database.
+func (s *APITestSuite) createWallet(userID int, currency string) {
+	_, err := s.testDB.ExecContext(context.Background(),
+		"INSERT INTO wallets (user_id, currency) VALUES ($1, $2)", userID, currency)
+	s.Require().NoError(err, "failed to create wallet")
+}
+
 // ProcessTransaction performs a POST /user/{id}/transaction request with the provided payload and source type.
 func (s *APITestSuite) ProcessTransaction(
 	tb testing.TB,
@@ -136,10 +280,297 @@ func (s *APITestSuite) ProcessTransaction(
 		req.Header.Set("Source-Type", sourceType)
 	}
 
+	s.sign(req, payload)
+
+	return s.performRequest(req)
+}
+
+// ListTransactions calls the GET /user/{id}/transactions endpoint with the given raw query string.
+func (s *APITestSuite) ListTransactions(tb testing.TB, userID int, query string) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/user/%d/transactions%s", strings.TrimRight(s.BaseURL, "/"), userID, query)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(tb, err, "Failed to create GET request for user %d transactions", userID)
+
+	return s.performRequest(req)
+}
+
+// GetTransaction calls GET /transaction/{id}, or GET /user/{userId}/transaction/{id} when userID is positive.
+func (s *APITestSuite) GetTransaction(tb testing.TB, userID int, transactionID string) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/transaction/%s", strings.TrimRight(s.BaseURL, "/"), transactionID)
+	if userID > 0 {
+		url = fmt.Sprintf("%s/user/%d/transaction/%s", strings.TrimRight(s.BaseURL, "/"), userID, transactionID)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(tb, err, "Failed to create GET request for transaction %s", transactionID)
+
+	return s.performRequest(req)
+}
+
+// ProcessBatch performs a POST /transactions/batch request with the provided payload.
+func (s *APITestSuite) ProcessBatch(tb testing.TB, body BatchRequest) apiResponse {
+	tb.Helper()
+
+	url := strings.TrimRight(s.BaseURL, "/") + "/transactions/batch"
+
+	payload, err := json.Marshal(body)
+	s.Require().NoError(err, "failed to marshal batch request body")
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	s.Require().NoError(err, "failed to create POST request for batch")
+
+	req.Header.Set("Content-Type", "application/json")
+	s.sign(req, payload)
+
+	return s.performRequest(req)
+}
+
+// Limits performs a request with a JSON body against /user/{id}/limits, or against the limit
+// of period if it is not empty.
+func (s *APITestSuite) Limits(tb testing.TB, method string, userID int, period string, body any) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/user/%d/limits", strings.TrimRight(s.BaseURL, "/"), userID)
+	if period != "" {
+		url += "/" + period
+	}
+
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err, "failed to marshal limit request body")
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err, "failed to create %s request for limits of user %d", method, userID)
+
+	req.Header.Set("Content-Type", "application/json")
+
 	return s.performRequest(req)
 }
 
+// Bonuses performs a request with a JSON body against /user/{id}/bonuses.
+func (s *APITestSuite) Bonuses(tb testing.TB, method string, userID int, body any) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/user/%d/bonuses", strings.TrimRight(s.BaseURL, "/"), userID)
+
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err, "failed to marshal bonus request body")
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err, "failed to create %s request for bonuses of user %d", method, userID)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return s.performRequest(req)
+}
+
+// Users performs a request with a JSON body against /user, or against the path below it if path
+// is not empty.
+func (s *APITestSuite) Users(tb testing.TB, method, path string, body any) apiResponse {
+	tb.Helper()
+
+	url := strings.TrimRight(s.BaseURL, "/") + "/user"
+	if path != "" {
+		url += "/" + path
+	}
+
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err, "failed to marshal user request body")
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err, "failed to create %s request for users", method)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return s.performRequest(req)
+}
+
+// Reservations performs a request for the game source type against /user/{id}/reservations, or
+// against the path below it if path is not empty.
+func (s *APITestSuite) Reservations(tb testing.TB, method string, userID int, path string, body any) apiResponse {
+	tb.Helper()
+
+	url := fmt.Sprintf("%s/user/%d/reservations", strings.TrimRight(s.BaseURL, "/"), userID)
+	if path != "" {
+		url += "/" + path
+	}
+
+	var (
+		payload io.Reader = http.NoBody
+		data    []byte
+	)
+
+	if body != nil {
+		var err error
+
+		data, err = json.Marshal(body)
+		s.Require().NoError(err, "failed to marshal reservation request body")
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err, "failed to create %s request for reservations of user %d", method, userID)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Source-Type", "game")
+	s.sign(req, data)
+
+	return s.performRequest(req)
+}
+
+// Adjustments performs a request on behalf of operator against /admin/adjustments, or against the
+// path below it if path is not empty. Every operator acts with an admin API key of its own.
+func (s *APITestSuite) Adjustments(tb testing.TB, method, operator, path string, body any) apiResponse {
+	tb.Helper()
+
+	url := strings.TrimRight(s.BaseURL, "/") + "/admin/adjustments"
+	if path != "" {
+		url += "/" + path
+	}
+
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err, "failed to marshal adjustment request body")
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err, "failed to create %s request for adjustments", method)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if operator != "" {
+		req.Header.Set("Operator-ID", operator)
+		req.Header.Set("Authorization", "Bearer "+s.operatorAPIKey(operator))
+	}
+
+	return s.performRequest(req)
+}
+
+// SourceTypeAdmin performs a request with a JSON body against /admin/source-types, or against the
+// source type name if it is not empty.
+func (s *APITestSuite) SourceTypeAdmin(tb testing.TB, method, name string, body any) apiResponse {
+	tb.Helper()
+
+	url := strings.TrimRight(s.BaseURL, "/") + "/admin/source-types"
+	if name != "" {
+		url += "/" + name
+	}
+
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		s.Require().NoError(err, "failed to marshal source type request body")
+
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	s.Require().NoError(err, "failed to create %s request for source types", method)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return s.performRequest(req)
+}
+
+// sign signs req with body as the test provider.
+func (s *APITestSuite) sign(req *http.Request, body []byte) {
+	s.signAs(req, body, testProvider, testProviderSecret, uuid.New().String(), time.Now())
+}
+
+// signAs signs req with body as provider, using nonce and the timestamp signedAt.
+func (s *APITestSuite) signAs(req *http.Request, body []byte, provider, secret, nonce string, signedAt time.Time) {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+
+	req.Header.Set(httpServer.ProviderHeader, provider)
+	req.Header.Set(httpServer.TimestampHeader, timestamp)
+	req.Header.Set(httpServer.NonceHeader, nonce)
+	req.Header.Set(httpServer.SignatureHeader,
+		httpServer.Sign(secret, req.Method, req.URL.EscapedPath(), timestamp, nonce, body))
+}
+
+// gamesProvider registers the provider games, which may only send game transactions, and returns
+// its secret.
+func (s *APITestSuite) gamesProvider() string {
+	secret := "games-provider-secret-0123456789abcdef"
+
+	_, err := s.testDB.ExecContext(context.Background(),
+		"INSERT INTO providers (name, secret, source_types) VALUES ('games', $1, '{game}')",
+		s.storedSecret("games", secret))
+	s.Require().NoError(err, "failed to create provider")
+
+	return secret
+}
+
+// createAPIKey stores an API key of provider granting scopes directly in the database and returns it.
+func (s *APITestSuite) createAPIKey(provider string, scopes ...string) string {
+	key := "wk_" + uuid.New().String()
+
+	_, err := s.testDB.ExecContext(context.Background(),
+		"INSERT INTO api_keys (id, provider, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4, $5)",
+		uuid.New(), provider, key[:11], hashAPIKey(key), "{"+strings.Join(scopes, ",")+"}")
+	s.Require().NoError(err, "failed to create API key")
+
+	return key
+}
+
+// operatorAPIKey returns the admin API key of the test provider that operator acts with, creating it
+// on first use.
+func (s *APITestSuite) operatorAPIKey(operator string) string {
+	key := "wk_operator-" + operator
+
+	_, err := s.testDB.ExecContext(context.Background(), `
+INSERT INTO api_keys (id, provider, prefix, key_hash, scopes)
+VALUES ($1, $2, $3, $4, '{admin}')
+ON CONFLICT (key_hash) DO NOTHING`, uuid.New(), testProvider, key[:11], hashAPIKey(key))
+	s.Require().NoError(err, "failed to create API key of operator %s", operator)
+
+	return key
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// problemCode extracts the raw JSON "code" member of a problem+json response body.
+func (s *APITestSuite) problemCode(resp apiResponse) string {
+	var body map[string]json.RawMessage
+	s.Require().NoError(json.Unmarshal(resp.Body, &body), "response should be a problem+json document")
+
+	return string(body["code"])
+}
+
+// performRequest sends req, authenticated with the API key of the test provider unless it carries
+// another one.
 func (s *APITestSuite) performRequest(req *http.Request) apiResponse {
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	}
+
 	resp, err := s.httpClient.Do(req)
 	s.Require().NoError(err)
 
@@ -159,7 +590,34 @@ func (s *APITestSuite) resetDatabaseState(ctx context.Context) {
 	statements := []string{
 		"TRUNCATE TABLE transactions RESTART IDENTITY CASCADE",
 		"TRUNCATE TABLE users RESTART IDENTITY CASCADE",
-		"INSERT INTO users (balance) VALUES (100.00), (200.00), (50.00), (33.33)",
+		"TRUNCATE TABLE audit_log RESTART IDENTITY",
+		"DELETE FROM api_keys",
+		"DELETE FROM providers WHERE name <> '" + testProvider + "'",
+		"DELETE FROM source_types WHERE name NOT IN ('game', 'server', 'payment', 'manual')",
+		"INSERT INTO providers (name, secret, source_types) VALUES ('" + testProvider + "', '" +
+			s.storedSecret(testProvider, testProviderSecret) + "', '{game,server,payment}') ON CONFLICT (name) DO UPDATE SET " +
+			"secret = EXCLUDED.secret, source_types = EXCLUDED.source_types, enabled = TRUE",
+		"INSERT INTO api_keys (id, provider, prefix, key_hash, scopes) VALUES ('" + uuid.New().String() + "', '" +
+			testProvider + "', 'wk_test', '" + hashAPIKey(testAPIKey) + "', " +
+			"'{balance:read,transactions:write,admin}')",
+		"INSERT INTO users (id) VALUES (1), (2), (3), (4)",
+		"SELECT setval('users_id_seq', 4)",
+		"INSERT INTO wallets (user_id, currency, balance) VALUES " +
+			"(1, 'EUR', 100.00), (2, 'EUR', 200.00), (3, 'EUR', 50.00), (4, 'EUR', 33.33)",
+		"INSERT INTO opening_balances (user_id, currency, balance) SELECT user_id, currency, balance FROM wallets",
+		"INSERT INTO ledger_accounts (type, user_id, currency) SELECT 'wallet', user_id, currency FROM wallets",
+		"INSERT INTO ledger_accounts (type, currency) VALUES ('equity', 'EUR')",
+		`WITH entry AS (
+			INSERT INTO journal_entries (description) VALUES ('Opening balances') RETURNING id
+		)
+		INSERT INTO postings (journal_entry_id, account_id, amount)
+		SELECT entry.id, a.id, w.balance
+		FROM entry, wallets w
+		JOIN ledger_accounts a ON a.type = 'wallet' AND a.user_id = w.user_id AND a.currency = w.currency
+		UNION ALL
+		SELECT entry.id, e.id, -(SELECT SUM(balance) FROM wallets)
+		FROM entry, ledger_accounts e
+		WHERE e.type = 'equity'`,
 	}
 
 	tx, err := s.testDB.BeginTx(ctx, nil)
@@ -178,6 +636,25 @@ func (s *APITestSuite) resetDatabaseState(ctx context.Context) {
 	s.Require().NoError(tx.Commit(), "failed to commit reset transaction")
 }
 
+// storedSecret returns the secret of provider name as the application stores it, encrypted under
+// the PROVIDER_SECRET_KEY of the test configuration if it is set.
+func (s *APITestSuite) storedSecret(name, secret string) string {
+	var secrets *service.SecretCipher
+
+	if s.testConfig.ProviderSecretKey != "" {
+		key, err := hex.DecodeString(s.testConfig.ProviderSecretKey)
+		s.Require().NoError(err, "invalid PROVIDER_SECRET_KEY")
+
+		secrets, err = service.NewSecretCipher(key)
+		s.Require().NoError(err, "invalid PROVIDER_SECRET_KEY")
+	}
+
+	stored, err := secrets.Seal(name, secret)
+	s.Require().NoError(err, "failed to encrypt provider secret")
+
+	return stored
+}
+
 func (s *APITestSuite) waitForServer(baseURL string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type BatchTestSuite struct {
+	APITestSuite
+}
+
+func batchItem(userID int, state, amount string) BatchItemRequest {
+	return BatchItemRequest{
+		TransactionRequest: TransactionRequest{State: state, Amount: amount, TransactionID: uuid.New().String()},
+		UserID:             userID,
+		SourceType:         "game",
+	}
+}
+
+// TestBatchAtomicAllOrNothing checks that one failing item leaves every balance untouched.
+func (s *BatchTestSuite) TestBatchAtomicAllOrNothing() {
+	resp := s.ProcessBatch(s.T(), BatchRequest{
+		Mode: "atomic",
+		Transactions: []BatchItemRequest{
+			batchItem(1, "win", "10.00"),
+			batchItem(2, "lose", "500.00"), // more than user 2's balance of 200.00
+		},
+	})
+	s.Equal(422, resp.StatusCode, "Atomic batch should fail with the status of the failing item")
+	s.JSONEq(`"insufficient_funds"`, s.problemCode(resp))
+
+	balanceResp := s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(balanceResp.Body), "No item should be applied")
+}
+
+// TestBatchAtomicSuccess checks that all items of a valid atomic batch are applied.
+func (s *BatchTestSuite) TestBatchAtomicSuccess() {
+	resp := s.ProcessBatch(s.T(), BatchRequest{
+		Mode: "atomic",
+		Transactions: []BatchItemRequest{
+			batchItem(1, "win", "10.00"),
+			batchItem(2, "lose", "50.00"),
+			batchItem(1, "lose", "5.00"),
+		},
+	})
+	s.Equal(200, resp.StatusCode, "Atomic batch should succeed")
+
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "105.00", "realBalance": "105.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(s.GetBalance(s.T(), 1).Body))
+	s.JSONEq(`{"userId": 2, "currency": "EUR", "balance": "150.00", "realBalance": "150.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(s.GetBalance(s.T(), 2).Body))
+}
+
+// TestBatchIndependent checks per-item results and exactly-once processing on resubmission.
+func (s *BatchTestSuite) TestBatchIndependent() {
+	batch := BatchRequest{
+		Mode: "independent",
+		Transactions: []BatchItemRequest{
+			batchItem(1, "win", "10.00"),
+			batchItem(999, "win", "10.00"),
+			batchItem(3, "lose", "60.00"), // more than user 3's balance of 50.00
+		},
+	}
+
+	for range 2 {
+		resp := s.ProcessBatch(s.T(), batch)
+		s.Equal(200, resp.StatusCode, "Independent batch should return 200 OK")
+
+		var body BatchResponse
+		s.Require().NoError(json.Unmarshal(resp.Body, &body))
+		s.Require().Len(body.Results, 3)
+		s.Equal(200, body.Results[0].Status)
+		s.Equal(404, body.Results[1].Status)
+		s.Equal("user_not_found", body.Results[1].Code)
+		s.Equal(422, body.Results[2].Status)
+		s.Equal("insufficient_funds", body.Results[2].Code)
+	}
+
+	balanceResp := s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "110.00", "realBalance": "110.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(balanceResp.Body), "Resubmitted items should be replayed")
+}
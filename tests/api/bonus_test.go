@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type BonusTestSuite struct {
+	APITestSuite
+}
+
+func (s *BonusTestSuite) grant(userID int, amount, wageringRequirement string) {
+	resp := s.Bonuses(s.T(), http.MethodPost, userID, map[string]string{
+		"grantId":             uuid.New().String(),
+		"amount":              amount,
+		"wageringRequirement": wageringRequirement,
+	})
+	s.Require().Equal(201, resp.StatusCode, "Should grant the bonus")
+}
+
+func (s *BonusTestSuite) lose(userID int, amount string) apiResponse {
+	return s.ProcessTransaction(s.T(), userID, "game", TransactionRequest{
+		State:         "lose",
+		Amount:        amount,
+		TransactionID: uuid.New().String(),
+	})
+}
+
+func (s *BonusTestSuite) balance(userID int) BalanceResponse {
+	resp := s.GetBalance(s.T(), userID)
+	s.Require().Equal(200, resp.StatusCode, "Should return the balance")
+
+	var balance BalanceResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &balance))
+
+	return balance
+}
+
+func (s *BonusTestSuite) TestBonusIsSpentAfterRealMoney() {
+	s.grant(1, "50.00", "200.00")
+
+	s.Equal(BalanceResponse{
+		UserID: 1, Currency: "EUR", Balance: "150.00", RealBalance: "100.00", BonusBalance: "50.00", HeldBalance: "0.00",
+	}, s.balance(1), "Bonus should be held apart from the real balance")
+
+	resp := s.lose(1, "120.00")
+	s.Require().Equal(200, resp.StatusCode, "Lose transaction should be accepted")
+	s.Contains(string(resp.Body), `"balance":"30.00"`, "Response should carry the total balance")
+
+	s.Equal(BalanceResponse{
+		UserID: 1, Currency: "EUR", Balance: "30.00", RealBalance: "0.00", BonusBalance: "30.00", HeldBalance: "0.00",
+	}, s.balance(1), "Real money should be spent before bonus money")
+
+	resp = s.lose(1, "30.01")
+	s.Equal(422, resp.StatusCode, "Loss beyond both balances should be rejected")
+	s.JSONEq(`"insufficient_funds"`, s.problemCode(resp))
+
+	s.assertLedgerConsistent()
+}
+
+func (s *BonusTestSuite) TestBonusConvertsWhenWagered() {
+	s.grant(1, "20.00", "30.00")
+
+	s.Require().Equal(200, s.lose(1, "10.00").StatusCode)
+	s.Require().Equal(200, s.lose(1, "20.00").StatusCode)
+
+	s.Equal(BalanceResponse{
+		UserID: 1, Currency: "EUR", Balance: "90.00", RealBalance: "90.00", BonusBalance: "0.00", HeldBalance: "0.00",
+	}, s.balance(1), "Wagered bonus should become real money")
+
+	resp := s.Bonuses(s.T(), http.MethodGet, 1, nil)
+	s.Require().Equal(200, resp.StatusCode)
+
+	var body struct {
+		Bonuses []map[string]any `json:"bonuses"`
+	}
+	s.Require().NoError(json.Unmarshal(resp.Body, &body))
+	s.Require().Len(body.Bonuses, 1)
+	s.Equal("converted", body.Bonuses[0]["status"])
+	s.Equal("30.00", body.Bonuses[0]["wagered"])
+	s.Equal("20.00", body.Bonuses[0]["convertedAmount"])
+
+	s.assertLedgerConsistent()
+}
+
+func (s *BonusTestSuite) TestBonusIsForfeitedWhenLost() {
+	s.grant(4, "10.00", "100.00")
+
+	s.Require().Equal(200, s.lose(4, "43.33").StatusCode)
+
+	resp := s.Bonuses(s.T(), http.MethodGet, 4, nil)
+	s.Require().Equal(200, resp.StatusCode)
+	s.Contains(string(resp.Body), `"status":"forfeited"`, "Lost bonus should be forfeited")
+
+	// A later grant is wagered on its own.
+	s.grant(4, "5.00", "5.00")
+	s.Require().Equal(200, s.ProcessTransaction(s.T(), 4, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "10.00",
+		TransactionID: uuid.New().String(),
+	}).StatusCode)
+	s.Require().Equal(200, s.lose(4, "5.00").StatusCode)
+
+	s.Equal(BalanceResponse{
+		UserID: 4, Currency: "EUR", Balance: "10.00", RealBalance: "10.00", BonusBalance: "0.00", HeldBalance: "0.00",
+	}, s.balance(4))
+	s.assertLedgerConsistent()
+}
+
+func (s *BonusTestSuite) TestRollbackRestoresBonus() {
+	s.grant(3, "40.00", "1000.00")
+
+	loseID := uuid.New().String()
+	resp := s.ProcessTransaction(s.T(), 3, "game", TransactionRequest{
+		State:         "lose",
+		Amount:        "70.00",
+		TransactionID: loseID,
+	})
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal("20.00", s.balance(3).BonusBalance)
+
+	resp = s.ProcessTransaction(s.T(), 3, "game", TransactionRequest{
+		State:                 "rollback",
+		TransactionID:         uuid.New().String(),
+		OriginalTransactionID: loseID,
+	})
+	s.Require().Equal(200, resp.StatusCode)
+
+	s.Equal(BalanceResponse{
+		UserID: 3, Currency: "EUR", Balance: "90.00", RealBalance: "50.00", BonusBalance: "40.00", HeldBalance: "0.00",
+	}, s.balance(3), "Rollback should give each balance its part back")
+	s.assertLedgerConsistent()
+}
+
+func (s *BonusTestSuite) TestGrantBonusIsIdempotent() {
+	body := map[string]string{
+		"grantId":             uuid.New().String(),
+		"amount":              "15.00",
+		"wageringRequirement": "150.00",
+	}
+
+	first := s.Bonuses(s.T(), http.MethodPost, 1, body)
+	s.Require().Equal(201, first.StatusCode)
+
+	retry := s.Bonuses(s.T(), http.MethodPost, 1, body)
+	s.Require().Equal(201, retry.StatusCode, "Retry should answer with the stored grant")
+	s.JSONEq(string(first.Body), string(retry.Body))
+	s.Equal("15.00", s.balance(1).BonusBalance, "Retry should not credit the bonus again")
+
+	body["amount"] = "16.00"
+	resp := s.Bonuses(s.T(), http.MethodPost, 1, body)
+	s.Equal(409, resp.StatusCode, "Reusing a grant ID with a different payload should be rejected")
+
+	s.assertLedgerConsistent()
+}
+
+func (s *BonusTestSuite) TestGrantBonusRequiresActiveUser() {
+	resp := s.Users(s.T(), http.MethodPatch, "1/status", map[string]string{"status": "suspended"})
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.Bonuses(s.T(), http.MethodPost, 1, map[string]string{
+		"grantId":             uuid.New().String(),
+		"amount":              "10",
+		"wageringRequirement": "10",
+	})
+	s.Equal(403, resp.StatusCode)
+	s.JSONEq(`"user_suspended"`, s.problemCode(resp))
+	s.Equal("0.00", s.balance(1).BonusBalance)
+}
+
+func (s *BonusTestSuite) TestGrantBonusErrors() {
+	grant := func(body map[string]string) map[string]string {
+		body["grantId"] = uuid.New().String()
+		return body
+	}
+
+	resp := s.Bonuses(s.T(), http.MethodPost, 1, grant(map[string]string{"amount": "10.00"}))
+	s.Equal(400, resp.StatusCode, "Should require a wagering requirement")
+
+	resp = s.Bonuses(s.T(), http.MethodPost, 1, map[string]string{"amount": "10", "wageringRequirement": "10"})
+	s.Equal(400, resp.StatusCode, "Should require a grant ID")
+
+	resp = s.Bonuses(s.T(), http.MethodPost, 1, grant(map[string]string{"amount": "0.001", "wageringRequirement": "10"}))
+	s.Equal(400, resp.StatusCode, "Should reject sub-cent amounts")
+
+	resp = s.Bonuses(s.T(), http.MethodPost, 999, grant(map[string]string{"amount": "10", "wageringRequirement": "10"}))
+	s.Equal(404, resp.StatusCode)
+	s.JSONEq(`"user_not_found"`, s.problemCode(resp))
+
+	resp = s.Bonuses(s.T(), http.MethodPost, 1, grant(map[string]string{
+		"amount":              "10",
+		"wageringRequirement": "10",
+		"currency":            "USD",
+	}))
+	s.Equal(404, resp.StatusCode)
+	s.JSONEq(`"wallet_not_found"`, s.problemCode(resp))
+}
@@ -11,7 +11,11 @@ func (s *GetBalanceTestSuite) TestGetBalanceUser1() {
 	expected := `
 {
 	"userId": 1,
-	"balance": "100.00"
+	"currency": "EUR",
+	"balance": "100.00",
+	"realBalance": "100.00",
+	"bonusBalance": "0.00",
+	"heldBalance": "0.00"
 }`
 
 	s.Equal(200, resp.StatusCode, "Should return 200 OK")
@@ -25,7 +29,11 @@ func (s *GetBalanceTestSuite) TestGetBalanceUser2() {
 	expected := `
 {
 	"userId": 2,
-	"balance": "200.00"
+	"currency": "EUR",
+	"balance": "200.00",
+	"realBalance": "200.00",
+	"bonusBalance": "0.00",
+	"heldBalance": "0.00"
 }`
 
 	s.Equal(200, resp.StatusCode, "Should return 200 OK")
@@ -39,7 +47,11 @@ func (s *GetBalanceTestSuite) TestGetBalanceUser3() {
 	expected := `
 {
 	"userId": 3,
-	"balance": "50.00"
+	"currency": "EUR",
+	"balance": "50.00",
+	"realBalance": "50.00",
+	"bonusBalance": "0.00",
+	"heldBalance": "0.00"
 }`
 
 	s.Equal(200, resp.StatusCode, "Should return 200 OK")
@@ -53,7 +65,11 @@ func (s *GetBalanceTestSuite) TestGetBalanceUser4() {
 	expected := `
 {
 	"userId": 4,
-	"balance": "33.33"
+	"currency": "EUR",
+	"balance": "33.33",
+	"realBalance": "33.33",
+	"bonusBalance": "0.00",
+	"heldBalance": "0.00"
 }`
 
 	s.Equal(200, resp.StatusCode, "Should return 200 OK")
@@ -64,5 +80,6 @@ func (s *GetBalanceTestSuite) TestGetBalanceUser4() {
 func (s *GetBalanceTestSuite) TestGetBalanceNonExistentUser() {
 	resp := s.GetBalance(s.T(), 999)
 
-	s.NotEqual(200, resp.StatusCode, "Should return error status for non-existent user")
+	s.Equal(404, resp.StatusCode, "Should return 404 for non-existent user")
+	s.JSONEq(`"user_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
 }
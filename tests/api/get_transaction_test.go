@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type GetTransactionTestSuite struct {
+	APITestSuite
+}
+
+// TestGetTransaction checks that a processed transaction can be looked up with its outcome.
+func (s *GetTransactionTestSuite) TestGetTransaction() {
+	transactionID := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 3, "payment", TransactionRequest{
+		State:         "lose",
+		Amount:        "20.00",
+		TransactionID: transactionID,
+	})
+	s.Equal(200, resp.StatusCode, "Lose transaction should return 200 OK")
+
+	for _, userID := range []int{0, 3} {
+		resp = s.GetTransaction(s.T(), userID, transactionID)
+		s.Equal(200, resp.StatusCode, "Transaction lookup should return 200 OK")
+
+		var body map[string]any
+		s.Require().NoError(json.Unmarshal(resp.Body, &body))
+		s.Equal(transactionID, body["transactionId"])
+		s.InDelta(3, body["userId"], 0)
+		s.Equal("lose", body["state"])
+		s.Equal("20.00", body["amount"])
+		s.Equal("payment", body["sourceType"])
+		s.Equal("30.00", body["balanceAfter"], "Balance after 50.00 - 20.00 should be stored")
+		s.NotEmpty(body["createdAt"])
+	}
+}
+
+func (s *GetTransactionTestSuite) TestGetTransactionOfAnotherUser() {
+	transactionID := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "1.00",
+		TransactionID: transactionID,
+	})
+	s.Equal(200, resp.StatusCode, "Win transaction should return 200 OK")
+
+	resp = s.GetTransaction(s.T(), 2, transactionID)
+	s.Equal(404, resp.StatusCode, "Transactions of other users should not be visible")
+}
+
+func (s *GetTransactionTestSuite) TestGetTransactionUnknown() {
+	resp := s.GetTransaction(s.T(), 0, uuid.New().String())
+
+	s.Equal(404, resp.StatusCode, "Should return 404 for an unknown transaction")
+	s.JSONEq(`"transaction_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type HealthTestSuite struct {
+	APITestSuite
+}
+
+func (s *HealthTestSuite) probe(path string) apiResponse {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(s.BaseURL, "/")+path, nil)
+	s.Require().NoError(err)
+
+	return s.performRequest(req)
+}
+
+func (s *HealthTestSuite) TestLivez() {
+	resp := s.probe("/livez")
+	s.Require().Equal(200, resp.StatusCode, "Should be live")
+}
+
+func (s *HealthTestSuite) TestReadyz() {
+	resp := s.probe("/readyz")
+	s.Require().Equal(200, resp.StatusCode, "Should be ready: %s", resp.Body)
+
+	var body struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Status string `json:"status"`
+		} `json:"checks"`
+	}
+	s.Require().NoError(json.Unmarshal(resp.Body, &body))
+
+	s.NotEqual("fail", body.Status)
+	s.Equal("pass", body.Checks["database"].Status)
+	s.Equal("pass", body.Checks["migrations"].Status, "Should run the schema version the binary expects")
+	s.Contains(body.Checks, "connection_pool")
+}
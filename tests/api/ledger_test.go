@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/repository"
+	"github.com/VladislavsPerkanuks/Entain-test-task/internal/service"
+	"github.com/google/uuid"
+)
+
+// assertLedgerConsistent checks that every journal entry is balanced and that every
+// real, bonus and held balance of a wallet equals the sum of the postings on its ledger account
+// and the balance the reconcile command recomputes from its history.
+func (s *APITestSuite) assertLedgerConsistent() {
+	ctx := context.Background()
+
+	var unbalanced int
+	err := s.testDB.QueryRowContext(ctx, `
+SELECT COUNT(*) FROM (
+	SELECT p.journal_entry_id
+	FROM postings p
+	JOIN ledger_accounts a ON a.id = p.account_id
+	GROUP BY p.journal_entry_id, a.currency
+	HAVING SUM(p.amount) <> 0
+) unbalanced`).Scan(&unbalanced)
+	s.Require().NoError(err, "failed to check journal entries")
+	s.Zero(unbalanced, "all journal entries should be balanced")
+
+	var drifted int
+	err = s.testDB.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM wallets w
+WHERE w.balance <> (
+	SELECT COALESCE(SUM(p.amount), 0)
+	FROM ledger_accounts a
+	JOIN postings p ON p.account_id = a.id
+	WHERE a.type = 'wallet' AND a.user_id = w.user_id AND a.currency = w.currency
+) OR w.bonus_balance <> (
+	SELECT COALESCE(SUM(p.amount), 0)
+	FROM ledger_accounts a
+	JOIN postings p ON p.account_id = a.id
+	WHERE a.type = 'bonus' AND a.user_id = w.user_id AND a.currency = w.currency
+) OR w.held_balance <> (
+	SELECT COALESCE(SUM(p.amount), 0)
+	FROM ledger_accounts a
+	JOIN postings p ON p.account_id = a.id
+	WHERE a.type = 'held' AND a.user_id = w.user_id AND a.currency = w.currency
+)`).Scan(&drifted)
+	s.Require().NoError(err, "failed to compare wallets with the ledger")
+	s.Zero(drifted, "wallet balances should match the ledger")
+
+	report, err := service.NewReconciler(repository.NewRepository(s.testDB)).Reconcile(ctx, false, "")
+	s.Require().NoError(err, "failed to reconcile")
+	s.Empty(report.Drifts, "wallet balances should match their history")
+	s.Empty(report.LedgerDrifts, "the reconcile command should agree with the ledger")
+}
+
+func (s *TransactionTestSuite) TestLedgerBooksTransactions() {
+	originalID := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "10.00",
+		TransactionID: originalID,
+	})
+	s.Equal(200, resp.StatusCode, "Win transaction should return 200 OK")
+
+	resp = s.ProcessTransaction(s.T(), 2, "payment", TransactionRequest{
+		State:         "lose",
+		Amount:        "20.00",
+		TransactionID: uuid.New().String(),
+	})
+	s.Equal(200, resp.StatusCode, "Lose transaction should return 200 OK")
+
+	resp = s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:                 "rollback",
+		TransactionID:         uuid.New().String(),
+		OriginalTransactionID: originalID,
+	})
+	s.Equal(200, resp.StatusCode, "Rollback should return 200 OK")
+
+	s.assertLedgerConsistent()
+
+	var houseBalance string
+	err := s.testDB.QueryRowContext(context.Background(), `
+SELECT COALESCE(SUM(p.amount), 0)::TEXT
+FROM postings p
+JOIN ledger_accounts a ON a.id = p.account_id
+WHERE a.type = 'house' AND a.source_type = 'payment' AND a.currency = 'EUR'`).Scan(&houseBalance)
+	s.Require().NoError(err, "failed to read house account")
+	s.Equal("20.00", houseBalance, "the payment house account should hold the lost amount")
+}
+
+func (s *TransactionTestSuite) TestReconcileFindsDriftBookedInTheLedger() {
+	ctx := context.Background()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "lose",
+		Amount:        "10.00",
+		TransactionID: uuid.New().String(),
+	})
+	s.Equal(200, resp.StatusCode, "Lose transaction should return 200 OK")
+
+	// A booking bug that moves the wallet and its ledger account alike, without a transaction.
+	_, err := s.testDB.ExecContext(ctx, `
+WITH entry AS (
+	INSERT INTO journal_entries (description) VALUES ('faulty booking') RETURNING id
+)
+INSERT INTO postings (journal_entry_id, account_id, amount)
+SELECT entry.id, a.id, CASE a.type WHEN 'wallet' THEN 5.00 ELSE -5.00 END
+FROM entry, ledger_accounts a
+WHERE (a.type = 'wallet' AND a.user_id = 1 AND a.currency = 'EUR') OR (a.type = 'equity' AND a.currency = 'EUR')`)
+	s.Require().NoError(err, "failed to book the faulty entry")
+
+	_, err = s.testDB.ExecContext(ctx, "UPDATE wallets SET balance = balance + 5.00 WHERE user_id = 1")
+	s.Require().NoError(err, "failed to apply the faulty entry")
+
+	reconciler := service.NewReconciler(repository.NewRepository(s.testDB))
+
+	report, err := reconciler.Reconcile(ctx, true, "faulty booking")
+	s.Require().NoError(err, "failed to reconcile")
+	s.Empty(report.LedgerDrifts, "the wallet should still match the ledger")
+	s.Require().Len(report.Drifts, 1, "the wallet should have drifted from its history")
+	s.Equal("90", report.Drifts[0].Expected.Real.String())
+	s.Equal("95", report.Drifts[0].Actual.Real.String())
+	s.True(report.Drifts[0].Adjusted, "the balance should be corrected to its history")
+
+	report, err = reconciler.Reconcile(ctx, false, "")
+	s.Require().NoError(err, "failed to reconcile")
+	s.Empty(report.Drifts, "the wallet should match its history again")
+	s.Empty(report.LedgerDrifts, "the correction should be booked in the ledger")
+	s.assertLedgerConsistent()
+}
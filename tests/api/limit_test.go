@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+type LimitTestSuite struct {
+	APITestSuite
+}
+
+func (s *LimitTestSuite) lose(amount string) apiResponse {
+	return s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "lose",
+		Amount:        amount,
+		TransactionID: uuid.New().String(),
+	})
+}
+
+func (s *LimitTestSuite) TestLossLimitIsEnforced() {
+	resp := s.Limits(s.T(), http.MethodPut, 1, "daily", map[string]string{"amount": "30.00"})
+	s.Require().Equal(200, resp.StatusCode, "Should set the limit")
+	s.JSONEq(`{"currency": "EUR", "period": "daily", "amount": "30.00"}`, string(resp.Body),
+		"A new limit should apply immediately")
+
+	s.Equal(200, s.lose("20.00").StatusCode, "Loss within the limit should be accepted")
+
+	resp = s.lose("20.00")
+	s.Equal(422, resp.StatusCode, "Loss beyond the limit should be rejected")
+	s.JSONEq(`"loss_limit_exceeded"`, s.problemCode(resp), "Should return a machine-readable error code")
+
+	// Wins count against the losses of the window.
+	resp = s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "15.00",
+		TransactionID: uuid.New().String(),
+	})
+	s.Require().Equal(200, resp.StatusCode, "Win should be accepted")
+	s.Equal(200, s.lose("20.00").StatusCode, "Net loss of 25.00 should be within the limit")
+
+	balanceResp := s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "75.00", "realBalance": "75.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(balanceResp.Body),
+		"Rejected loss should not change the balance")
+}
+
+func (s *LimitTestSuite) TestLimitIncreaseCoolsOff() {
+	resp := s.Limits(s.T(), http.MethodPut, 1, "weekly", map[string]string{"amount": "30.00"})
+	s.Require().Equal(200, resp.StatusCode, "Should set the limit")
+
+	resp = s.Limits(s.T(), http.MethodPut, 1, "weekly", map[string]string{"amount": "80.00"})
+	s.Require().Equal(200, resp.StatusCode, "Should accept the increase")
+
+	var limit map[string]any
+	s.Require().NoError(json.Unmarshal(resp.Body, &limit))
+	s.Equal("30.00", limit["amount"], "Increase should not apply immediately")
+	s.Equal("80.00", limit["pendingAmount"], "Increase should be pending")
+	s.NotEmpty(limit["pendingFrom"], "Increase should apply after the cooling-off period")
+
+	resp = s.lose("50.00")
+	s.Equal(422, resp.StatusCode, "The previous limit should still be enforced")
+
+	resp = s.Limits(s.T(), http.MethodPut, 1, "weekly", map[string]string{"amount": "10.00"})
+	s.JSONEq(`{"currency": "EUR", "period": "weekly", "amount": "10.00"}`, string(resp.Body),
+		"Decrease should apply immediately and cancel the pending increase")
+}
+
+func (s *LimitTestSuite) TestRemoveLimit() {
+	resp := s.Limits(s.T(), http.MethodDelete, 1, "monthly", nil)
+	s.Equal(404, resp.StatusCode, "Should return 404 without a limit")
+	s.JSONEq(`"limit_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
+
+	resp = s.Limits(s.T(), http.MethodPut, 1, "monthly", map[string]string{"amount": "5.00"})
+	s.Require().Equal(200, resp.StatusCode, "Should set the limit")
+
+	resp = s.Limits(s.T(), http.MethodDelete, 1, "monthly", nil)
+	s.Equal(202, resp.StatusCode, "Removal should be scheduled")
+
+	resp = s.Limits(s.T(), http.MethodGet, 1, "", nil)
+	s.Contains(string(resp.Body), `"amount":"5.00"`, "Limit should stay in force while cooling off")
+	s.Equal(422, s.lose("10.00").StatusCode, "Limit should still be enforced")
+}
+
+func (s *LimitTestSuite) TestLimitOfUnknownUser() {
+	resp := s.Limits(s.T(), http.MethodPut, 999, "daily", map[string]string{"amount": "5.00"})
+
+	s.Equal(404, resp.StatusCode, "Should return 404 for non-existent user")
+}
+
+// TestConcurrentLossesCannotBypassLimit sends more losses at once than the limit allows.
+func (s *LimitTestSuite) TestConcurrentLossesCannotBypassLimit() {
+	const (
+		requests = 10
+		allowed  = 5
+	)
+
+	resp := s.Limits(s.T(), http.MethodPut, 1, "daily", map[string]string{"amount": "50.00"})
+	s.Require().Equal(200, resp.StatusCode, "Should set the limit")
+
+	url := fmt.Sprintf("%s/user/1/transaction", strings.TrimRight(s.BaseURL, "/"))
+
+	var (
+		wg       sync.WaitGroup
+		accepted atomic.Int32
+		rejected atomic.Int32
+	)
+
+	for range requests {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			body := fmt.Sprintf(`{"state":"lose","amount":"10.00","transactionId":%q}`, uuid.New().String())
+
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+			if err != nil {
+				return
+			}
+
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Source-Type", "game")
+			req.Header.Set("Authorization", "Bearer "+testAPIKey)
+			s.sign(req, []byte(body))
+
+			resp, err := s.httpClient.Do(req)
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+
+			switch resp.StatusCode {
+			case http.StatusOK:
+				accepted.Add(1)
+			case http.StatusUnprocessableEntity:
+				rejected.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	s.Equal(int32(allowed), accepted.Load(), "Exactly the losses within the limit should be accepted")
+	s.Equal(int32(requests-allowed), rejected.Load(), "All other losses should be rejected")
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+type ListTransactionsTestSuite struct {
+	APITestSuite
+}
+
+// TestListTransactionsPagination walks the history of user 1 page by page, newest first.
+func (s *ListTransactionsTestSuite) TestListTransactionsPagination() {
+	ids := make([]string, 0, 3)
+	for _, amount := range []string{"1.00", "2.00", "3.00"} {
+		id := uuid.New().String()
+		ids = append(ids, id)
+
+		resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+			State:         "win",
+			Amount:        amount,
+			TransactionID: id,
+		})
+		s.Equal(200, resp.StatusCode, "Win transaction should return 200 OK")
+	}
+
+	resp := s.ListTransactions(s.T(), 1, "?limit=2")
+	s.Equal(200, resp.StatusCode, "History request should return 200 OK")
+
+	var firstPage TransactionPageResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &firstPage))
+	s.Require().Len(firstPage.Transactions, 2)
+	s.Equal(ids[2], firstPage.Transactions[0].TransactionID, "Newest transaction should come first")
+	s.Equal("106.00", firstPage.Transactions[0].BalanceAfter, "Balance after the last win should be stored")
+	s.Equal(ids[1], firstPage.Transactions[1].TransactionID)
+	s.NotEmpty(firstPage.NextCursor, "A cursor should be returned while more transactions exist")
+
+	resp = s.ListTransactions(s.T(), 1, "?limit=2&cursor="+url.QueryEscape(firstPage.NextCursor))
+	s.Equal(200, resp.StatusCode, "History request should return 200 OK")
+
+	var secondPage TransactionPageResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &secondPage))
+	s.Require().Len(secondPage.Transactions, 1)
+	s.Equal(ids[0], secondPage.Transactions[0].TransactionID)
+	s.Empty(secondPage.NextCursor, "No cursor should be returned on the last page")
+}
+
+// TestListTransactionsFilters checks that state, source type and amount filters are applied.
+func (s *ListTransactionsTestSuite) TestListTransactionsFilters() {
+	requests := []struct {
+		sourceType string
+		state      string
+		amount     string
+	}{
+		{"game", "win", "10.00"},
+		{"payment", "win", "50.00"},
+		{"game", "lose", "5.00"},
+	}
+
+	for _, r := range requests {
+		resp := s.ProcessTransaction(s.T(), 2, r.sourceType, TransactionRequest{
+			State:         r.state,
+			Amount:        r.amount,
+			TransactionID: uuid.New().String(),
+		})
+		s.Equal(200, resp.StatusCode, "Transaction should return 200 OK")
+	}
+
+	resp := s.ListTransactions(s.T(), 2, "?state=win&sourceType=game")
+	var page TransactionPageResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &page))
+	s.Require().Len(page.Transactions, 1)
+	s.Equal("10.00", page.Transactions[0].Amount)
+
+	resp = s.ListTransactions(s.T(), 2, "?minAmount=6&maxAmount=20")
+	page = TransactionPageResponse{}
+	s.Require().NoError(json.Unmarshal(resp.Body, &page))
+	s.Require().Len(page.Transactions, 1)
+	s.Equal("game", page.Transactions[0].SourceType)
+}
+
+func (s *ListTransactionsTestSuite) TestListTransactionsNonExistentUser() {
+	resp := s.ListTransactions(s.T(), 999, "")
+
+	s.Equal(404, resp.StatusCode, "Should return 404 for non-existent user")
+}
+
+func (s *ListTransactionsTestSuite) TestListTransactionsInvalidFilter() {
+	resp := s.ListTransactions(s.T(), 1, "?limit=0")
+
+	s.Equal(400, resp.StatusCode, "Should return 400 for an invalid limit")
+}
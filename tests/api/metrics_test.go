@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type MetricsTestSuite struct {
+	APITestSuite
+}
+
+func (s *MetricsTestSuite) metrics() string {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(s.BaseURL, "/")+"/metrics", nil)
+	s.Require().NoError(err)
+
+	resp := s.performRequest(req)
+	s.Require().Equal(200, resp.StatusCode, "Should serve the metrics")
+
+	return string(resp.Body)
+}
+
+func (s *MetricsTestSuite) TestMetrics() {
+	s.Require().Equal(200, s.GetBalance(s.T(), 1).StatusCode)
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "1.00",
+		TransactionID: uuid.New().String(),
+	})
+	s.Require().Equal(200, resp.StatusCode)
+
+	metrics := s.metrics()
+	s.Contains(metrics, `wallet_http_requests_total{method="GET",route="/user/{userID}/balance",status="200"}`)
+	s.Contains(metrics, `wallet_transactions_processed_total{source_type="game",state="win"}`)
+	s.Contains(metrics, `wallet_db_transactions_total{outcome="commit"}`)
+	s.Contains(metrics, "go_sql_in_use_connections", "Should expose the connection pool statistics")
+}
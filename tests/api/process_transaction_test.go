@@ -1,6 +1,8 @@
 package api
 
 import (
+	"strings"
+
 	"github.com/google/uuid"
 )
 
@@ -23,7 +25,8 @@ func (s *TransactionTestSuite) TestProcessTransactionWinGame() {
 	balanceResp := s.GetBalance(s.T(), 1)
 	s.Equal(200, balanceResp.StatusCode, "Balance request should return 200 OK")
 
-	expected := `{"userId": 1, "balance": "110.15"}`
+	expected := `{"userId": 1, "currency": "EUR", "balance": "110.15", "realBalance": "110.15",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body), "Balance should be increased by win amount")
 }
 
@@ -39,7 +42,8 @@ func (s *TransactionTestSuite) TestProcessTransactionWinServer() {
 
 	// Check balance was updated correctly (200.00 + 25.50 = 225.50)
 	balanceResp := s.GetBalance(s.T(), 2)
-	expected := `{"userId": 2, "balance": "225.50"}`
+	expected := `{"userId": 2, "currency": "EUR", "balance": "225.50", "realBalance": "225.50",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body), "Balance should be increased by win amount")
 }
 
@@ -55,7 +59,8 @@ func (s *TransactionTestSuite) TestProcessTransactionWinPayment() {
 
 	// Check balance was updated correctly (50.00 + 5.99 = 55.99)
 	balanceResp := s.GetBalance(s.T(), 3)
-	expected := `{"userId": 3, "balance": "55.99"}`
+	expected := `{"userId": 3, "currency": "EUR", "balance": "55.99", "realBalance": "55.99",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body), "Balance should be increased by win amount")
 }
 
@@ -72,7 +77,8 @@ func (s *TransactionTestSuite) TestProcessTransactionLose() {
 
 	// Check balance was updated correctly (100.00 - 15.25 = 84.75)
 	balanceResp := s.GetBalance(s.T(), 1)
-	expected := `{"userId": 1, "balance": "84.75"}`
+	expected := `{"userId": 1, "currency": "EUR", "balance": "84.75", "realBalance": "84.75",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body), "Balance should be decreased by lose amount")
 }
 
@@ -81,15 +87,18 @@ func (s *TransactionTestSuite) TestProcessTransactionLoseInsufficientBalance() {
 	transactionReq := TransactionRequest{
 		State:         "lose",
 		Amount:        "150.00", // More than user 1's balance of 100.00
-		TransactionID: "test-lose-insufficient-001",
+		TransactionID: uuid.New().String(),
 	}
 
 	resp := s.ProcessTransaction(s.T(), 1, "game", transactionReq)
-	s.NotEqual(200, resp.StatusCode, "Should return error for insufficient balance")
+	s.Equal(422, resp.StatusCode, "Should return 422 for insufficient balance")
+	s.Equal("application/problem+json", resp.Headers.Get("Content-Type"))
+	s.JSONEq(`"insufficient_funds"`, s.problemCode(resp), "Should return a machine-readable error code")
 
 	// Balance should remain unchanged
 	balanceResp := s.GetBalance(s.T(), 1)
-	expected := `{"userId": 1, "balance": "100.00"}`
+	expected := `{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body), "Balance should remain unchanged on failed transaction")
 }
 
@@ -106,17 +115,43 @@ func (s *TransactionTestSuite) TestProcessTransactionDuplicateTransactionId() {
 
 	// Check balance after first transaction (100.00 + 10.00 = 110.00)
 	balanceResp := s.GetBalance(s.T(), 1)
-	expected := `{"userId": 1, "balance": "110.00"}`
+	expected := `{"userId": 1, "currency": "EUR", "balance": "110.00", "realBalance": "110.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body), "Balance should be updated after first transaction")
 
-	// Process same transaction again (should be ignored)
-	s.ProcessTransaction(s.T(), 1, "game", transactionReq)
+	// Process same transaction again (should be replayed, not applied)
+	resp2 := s.ProcessTransaction(s.T(), 1, "game", transactionReq)
+	s.Equal(200, resp2.StatusCode, "Retried transaction should return the original outcome")
+	s.Equal("true", resp2.Headers.Get("Idempotent-Replayed"), "Retried transaction should be marked as replayed")
+	s.JSONEq(string(resp1.Body), strings.Replace(string(resp2.Body), `"replayed":true`, `"replayed":false`, 1),
+		"Replayed response should match the original outcome")
 
 	// Check balance remains the same (shouldn't double-process)
 	balanceResp2 := s.GetBalance(s.T(), 1)
 	s.JSONEq(expected, string(balanceResp2.Body), "Balance should not change on duplicate transaction")
 }
 
+func (s *TransactionTestSuite) TestProcessTransactionDuplicateTransactionIdDifferentPayload() {
+	transactionReq := TransactionRequest{
+		State:         "win",
+		Amount:        "10.00",
+		TransactionID: uuid.New().String(),
+	}
+
+	resp1 := s.ProcessTransaction(s.T(), 1, "game", transactionReq)
+	s.Equal(200, resp1.StatusCode, "First transaction should succeed")
+
+	transactionReq.Amount = "20.00"
+	resp2 := s.ProcessTransaction(s.T(), 1, "game", transactionReq)
+	s.Equal(409, resp2.StatusCode, "Reusing a transactionId with a different payload should conflict")
+	s.JSONEq(`"duplicate_transaction"`, s.problemCode(resp2), "Should return a machine-readable error code")
+
+	balanceResp := s.GetBalance(s.T(), 1)
+	expected := `{"userId": 1, "currency": "EUR", "balance": "110.00", "realBalance": "110.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
+	s.JSONEq(expected, string(balanceResp.Body), "Balance should not change on conflicting transaction")
+}
+
 func (s *TransactionTestSuite) TestProcessTransactionNonExistingUserId() {
 	transactionReq := TransactionRequest{
 		State:         "win",
@@ -125,7 +160,8 @@ func (s *TransactionTestSuite) TestProcessTransactionNonExistingUserId() {
 	}
 
 	resp := s.ProcessTransaction(s.T(), 999, "game", transactionReq)
-	s.NotEqual(200, resp.StatusCode, "Should return error for non-existent user")
+	s.Equal(404, resp.StatusCode, "Should return 404 for non-existent user")
+	s.JSONEq(`"user_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
 }
 
 func (s *TransactionTestSuite) TestProcessTransactionMissingSourceType() {
@@ -181,7 +217,8 @@ func (s *TransactionTestSuite) TestProcessTransactionWorkflow() {
 	// Initial balance for user 1 should be 100.00
 	balanceResp := s.GetBalance(s.T(), 1)
 	s.Equal(200, balanceResp.StatusCode)
-	expected := `{"userId": 1, "balance": "100.00"}`
+	expected := `{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body))
 
 	// Win 25.50
@@ -195,7 +232,8 @@ func (s *TransactionTestSuite) TestProcessTransactionWorkflow() {
 
 	// Check balance: 100.00 + 25.50 = 125.50
 	balanceResp = s.GetBalance(s.T(), 1)
-	expected = `{"userId": 1, "balance": "125.50"}`
+	expected = `{"userId": 1, "currency": "EUR", "balance": "125.50", "realBalance": "125.50",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body))
 
 	// Lose 15.25
@@ -209,7 +247,8 @@ func (s *TransactionTestSuite) TestProcessTransactionWorkflow() {
 
 	// Check final balance: 125.50 - 15.25 = 110.25
 	balanceResp = s.GetBalance(s.T(), 1)
-	expected = `{"userId": 1, "balance": "110.25"}`
+	expected = `{"userId": 1, "currency": "EUR", "balance": "110.25", "realBalance": "110.25",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body))
 }
 
@@ -226,6 +265,24 @@ func (s *TransactionTestSuite) TestProcessTransactionDecimalPrecision() {
 
 	// Check balance: 100.00 + 0.01 = 100.01
 	balanceResp := s.GetBalance(s.T(), 1)
-	expected := `{"userId": 1, "balance": "100.01"}`
+	expected := `{"userId": 1, "currency": "EUR", "balance": "100.01", "realBalance": "100.01",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
 	s.JSONEq(expected, string(balanceResp.Body))
 }
+
+func (s *TransactionTestSuite) TestProcessTransactionExcessPrecision() {
+	transactionReq := TransactionRequest{
+		State:         "win",
+		Amount:        "0.005",
+		TransactionID: uuid.New().String(),
+	}
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", transactionReq)
+	s.Equal(422, resp.StatusCode, "Should reject amounts with more than 2 decimal places")
+	s.JSONEq(`"too_many_decimal_places"`, s.problemCode(resp), "Should return a machine-readable error code")
+
+	balanceResp := s.GetBalance(s.T(), 1)
+	expected := `{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`
+	s.JSONEq(expected, string(balanceResp.Body), "Balance should be unchanged")
+}
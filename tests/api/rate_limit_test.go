@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+type RateLimitTestSuite struct {
+	APITestSuite
+}
+
+// limitedUserID is not used by other tests, so that running out of its requests affects no other test.
+const limitedUserID = 999
+
+func (s *RateLimitTestSuite) TestRateLimitHeaders() {
+	resp := s.GetBalance(s.T(), 1)
+	s.Require().Equal(200, resp.StatusCode)
+
+	limit, err := strconv.Atoi(resp.Headers.Get("RateLimit-Limit"))
+	s.Require().NoError(err, "Responses should carry the limit")
+
+	remaining, err := strconv.Atoi(resp.Headers.Get("RateLimit-Remaining"))
+	s.Require().NoError(err)
+	s.Less(remaining, limit)
+	s.NotEmpty(resp.Headers.Get("RateLimit-Reset"))
+}
+
+func (s *RateLimitTestSuite) TestUserRateLimit() {
+	var resp apiResponse
+
+	// The default burst of a user is 40 requests, refilled at 20 per second.
+	for range 100 {
+		if resp = s.GetBalance(s.T(), limitedUserID); resp.StatusCode == http.StatusTooManyRequests {
+			break
+		}
+
+		s.Require().Equal(404, resp.StatusCode, "Requests within the limit should reach the handler")
+	}
+
+	s.Require().Equal(429, resp.StatusCode, "Requests over the limit should be rejected")
+	s.JSONEq(`"rate_limited"`, s.problemCode(resp))
+	s.Equal("0", resp.Headers.Get("RateLimit-Remaining"))
+
+	retryAfter, err := strconv.Atoi(resp.Headers.Get("Retry-After"))
+	s.Require().NoError(err, "Rejected requests should say when to retry")
+	s.Positive(retryAfter)
+
+	s.Equal(200, s.GetBalance(s.T(), 2).StatusCode, "Other users should not be limited")
+}
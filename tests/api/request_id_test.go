@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type RequestIDTestSuite struct {
+	APITestSuite
+}
+
+func (s *RequestIDTestSuite) TestRequestID() {
+	url := fmt.Sprintf("%s/user/%d/balance", strings.TrimRight(s.BaseURL, "/"), 1)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	s.Require().NoError(err)
+	req.Header.Set("X-Request-ID", "provider-request-1")
+
+	resp := s.performRequest(req)
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal("provider-request-1", resp.Headers.Get("X-Request-ID"), "Should keep the request ID of the client")
+
+	resp = s.GetBalance(s.T(), 1)
+	s.Require().Equal(200, resp.StatusCode)
+	s.NoError(uuid.Validate(resp.Headers.Get("X-Request-ID")), "Should generate a request ID")
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type ReservationTestSuite struct {
+	APITestSuite
+}
+
+type reservationResponse struct {
+	TransactionID string  `json:"transactionId"`
+	Amount        string  `json:"amount"`
+	Status        string  `json:"status"`
+	SettledAt     *string `json:"settledAt"`
+}
+
+func (s *ReservationTestSuite) reserve(userID int, transactionID, amount string) apiResponse {
+	return s.Reservations(s.T(), http.MethodPost, userID, "", map[string]string{
+		"transactionId": transactionID,
+		"amount":        amount,
+	})
+}
+
+func (s *ReservationTestSuite) reservation(resp apiResponse) reservationResponse {
+	var reservation reservationResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &reservation))
+
+	return reservation
+}
+
+func (s *ReservationTestSuite) TestReserveAndCommit() {
+	id := uuid.New().String()
+
+	resp := s.reserve(1, id, "30.00")
+	s.Require().Equal(200, resp.StatusCode, "Reservation should be accepted")
+	s.Equal(reservationResponse{TransactionID: id, Amount: "30.00", Status: "held"}, s.reservation(resp))
+
+	balance := s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "70.00", "realBalance": "70.00",
+		"bonusBalance": "0.00", "heldBalance": "30.00"}`, string(balance.Body), "Stake should be held")
+
+	resp = s.Reservations(s.T(), http.MethodPost, 1, id+"/commit", nil)
+	s.Require().Equal(200, resp.StatusCode, "Commit should be accepted")
+	s.Contains(string(resp.Body), `"state":"lose"`)
+	s.Contains(string(resp.Body), `"balance":"70.00"`)
+
+	resp = s.Reservations(s.T(), http.MethodPost, 1, id+"/commit", nil)
+	s.Require().Equal(200, resp.StatusCode, "Repeated commit should be replayed")
+	s.Equal("true", resp.Headers.Get("Idempotent-Replayed"))
+
+	resp = s.GetTransaction(s.T(), 1, id)
+	s.Equal(200, resp.StatusCode, "Committed reservation should be stored as a transaction")
+
+	resp = s.Reservations(s.T(), http.MethodGet, 1, id, nil)
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal("committed", s.reservation(resp).Status)
+	s.NotNil(s.reservation(resp).SettledAt)
+
+	balance = s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "70.00", "realBalance": "70.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`, string(balance.Body), "Held stake should be lost")
+	s.assertLedgerConsistent()
+}
+
+func (s *ReservationTestSuite) TestReserveAndRelease() {
+	id := uuid.New().String()
+
+	resp := s.reserve(2, id, "50.00")
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.Reservations(s.T(), http.MethodPost, 2, id+"/release", nil)
+	s.Require().Equal(200, resp.StatusCode, "Release should be accepted")
+	s.Equal("released", s.reservation(resp).Status)
+
+	resp = s.Reservations(s.T(), http.MethodPost, 2, id+"/release", nil)
+	s.Equal(200, resp.StatusCode, "Repeated release should be accepted")
+
+	resp = s.Reservations(s.T(), http.MethodPost, 2, id+"/commit", nil)
+	s.Equal(409, resp.StatusCode, "Released reservation should not be committed")
+	s.JSONEq(`"reservation_settled"`, s.problemCode(resp))
+
+	balance := s.GetBalance(s.T(), 2)
+	s.JSONEq(`{"userId": 2, "currency": "EUR", "balance": "200.00", "realBalance": "200.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`, string(balance.Body), "Stake should be given back")
+	s.assertLedgerConsistent()
+}
+
+func (s *ReservationTestSuite) TestReserveIsIdempotent() {
+	id := uuid.New().String()
+
+	resp := s.reserve(1, id, "10.00")
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.reserve(1, id, "10.00")
+	s.Equal(200, resp.StatusCode, "Repeated reservation should be replayed")
+
+	resp = s.reserve(1, id, "20.00")
+	s.Equal(409, resp.StatusCode, "Reservation with another payload should be rejected")
+	s.JSONEq(`"duplicate_transaction"`, s.problemCode(resp))
+
+	balance := s.GetBalance(s.T(), 1)
+	s.Contains(string(balance.Body), `"heldBalance":"10.00"`, "Stake should be held once")
+}
+
+func (s *ReservationTestSuite) TestTransactionCannotReuseReservationID() {
+	id := uuid.New().String()
+
+	resp := s.reserve(1, id, "30.00")
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{State: "lose", Amount: "30.00", TransactionID: id})
+	s.Equal(409, resp.StatusCode, "A lose with the ID of an open reservation should be rejected")
+	s.JSONEq(`"transaction_reserved"`, s.problemCode(resp))
+
+	resp = s.Reservations(s.T(), http.MethodPost, 1, id+"/commit", nil)
+	s.Require().Equal(200, resp.StatusCode, "The reservation should still be committed")
+
+	balance := s.GetBalance(s.T(), 1)
+	s.Contains(string(balance.Body), `"balance":"70.00"`, "The stake should be paid once")
+	s.assertLedgerConsistent()
+}
+
+func (s *ReservationTestSuite) TestReservationErrors() {
+	resp := s.reserve(3, uuid.New().String(), "50.01")
+	s.Equal(422, resp.StatusCode, "Should not hold more than the real balance")
+	s.JSONEq(`"insufficient_funds"`, s.problemCode(resp))
+
+	resp = s.reserve(1, uuid.New().String(), "0")
+	s.Equal(400, resp.StatusCode)
+
+	id := uuid.New().String()
+	resp = s.Reservations(s.T(), http.MethodPost, 1, id+"/commit", nil)
+	s.Equal(404, resp.StatusCode)
+	s.JSONEq(`"reservation_not_found"`, s.problemCode(resp))
+
+	resp = s.reserve(1, id, "10.00")
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.Reservations(s.T(), http.MethodGet, 2, id, nil)
+	s.Equal(404, resp.StatusCode, "Reservation of another user should not be found")
+}
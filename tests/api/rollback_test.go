@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/google/uuid"
+)
+
+// TestRollbackReversesWin checks that a rollback restores the balance and is idempotent.
+func (s *TransactionTestSuite) TestRollbackReversesWin() {
+	winID := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "10.00",
+		TransactionID: winID,
+	})
+	s.Equal(200, resp.StatusCode, "Win transaction should return 200 OK")
+
+	rollbackReq := TransactionRequest{
+		State:                 "rollback",
+		TransactionID:         uuid.New().String(),
+		OriginalTransactionID: winID,
+	}
+
+	resp = s.ProcessTransaction(s.T(), 1, "game", rollbackReq)
+	s.Equal(200, resp.StatusCode, "Rollback should return 200 OK")
+
+	balanceResp := s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(balanceResp.Body), "Rollback should restore the balance")
+
+	// Retrying the same rollback is replayed without touching the balance
+	resp = s.ProcessTransaction(s.T(), 1, "game", rollbackReq)
+	s.Equal(200, resp.StatusCode, "Retried rollback should return the original outcome")
+	s.Equal("true", resp.Headers.Get("Idempotent-Replayed"))
+
+	// A second rollback of the same transaction is refused
+	rollbackReq.TransactionID = uuid.New().String()
+	resp = s.ProcessTransaction(s.T(), 1, "game", rollbackReq)
+	s.Equal(409, resp.StatusCode, "Second rollback should be refused")
+	s.JSONEq(`"already_rolled_back"`, s.problemCode(resp))
+
+	balanceResp = s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(balanceResp.Body), "Balance should not change again")
+}
+
+// TestRollbackBeforeOriginal checks that a late original is rejected after its rollback arrived.
+func (s *TransactionTestSuite) TestRollbackBeforeOriginal() {
+	loseID := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 2, "game", TransactionRequest{
+		State:                 "rollback",
+		TransactionID:         uuid.New().String(),
+		OriginalTransactionID: loseID,
+	})
+	s.Equal(200, resp.StatusCode, "Rollback of an unknown transaction should be stored")
+
+	resp = s.ProcessTransaction(s.T(), 2, "game", TransactionRequest{
+		State:         "lose",
+		Amount:        "20.00",
+		TransactionID: loseID,
+	})
+	s.Equal(409, resp.StatusCode, "Late original should be rejected")
+	s.JSONEq(`"transaction_rolled_back"`, s.problemCode(resp))
+
+	balanceResp := s.GetBalance(s.T(), 2)
+	s.JSONEq(`{"userId": 2, "currency": "EUR", "balance": "200.00", "realBalance": "200.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(balanceResp.Body), "Balance should remain unchanged")
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SignatureTestSuite struct {
+	APITestSuite
+}
+
+// transaction returns an unsigned win request of 10.00 for user 1.
+func (s *SignatureTestSuite) transaction(sourceType string) (*http.Request, []byte) {
+	url := fmt.Sprintf("%s/user/1/transaction", strings.TrimRight(s.BaseURL, "/"))
+
+	body, err := json.Marshal(TransactionRequest{State: "win", Amount: "10.00", TransactionID: uuid.New().String()})
+	s.Require().NoError(err)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	s.Require().NoError(err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Source-Type", sourceType)
+
+	return req, body
+}
+
+func (s *SignatureTestSuite) TestProviderIsRecorded() {
+	id := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{State: "win", Amount: "10.00", TransactionID: id})
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.GetTransaction(s.T(), 1, id)
+	s.Require().Equal(200, resp.StatusCode)
+
+	var body map[string]any
+	s.Require().NoError(json.Unmarshal(resp.Body, &body))
+	s.Equal(testProvider, body["provider"])
+}
+
+func (s *SignatureTestSuite) TestUnsignedRequest() {
+	req, _ := s.transaction("game")
+
+	resp := s.performRequest(req)
+	s.Equal(401, resp.StatusCode, "Unsigned requests should be rejected")
+	s.JSONEq(`"invalid_signature"`, s.problemCode(resp))
+}
+
+func (s *SignatureTestSuite) TestInvalidSignatures() {
+	cases := []struct {
+		name     string
+		provider string
+		secret   string
+		signedAt time.Time
+	}{
+		{"wrong secret", testProvider, strings.Repeat("x", 32), time.Now()},
+		{"unknown provider", "unknown", testProviderSecret, time.Now()},
+		{"stale timestamp", testProvider, testProviderSecret, time.Now().Add(-time.Hour)},
+	}
+
+	for _, tc := range cases {
+		s.Run(tc.name, func() {
+			req, body := s.transaction("game")
+			s.signAs(req, body, tc.provider, tc.secret, uuid.New().String(), tc.signedAt)
+
+			resp := s.performRequest(req)
+			s.Equal(401, resp.StatusCode)
+			s.JSONEq(`"invalid_signature"`, s.problemCode(resp))
+		})
+	}
+
+	s.Equal("100.00", s.balance(), "Rejected requests should not move money")
+}
+
+func (s *SignatureTestSuite) TestReplayedRequest() {
+	req, body := s.transaction("game")
+	nonce := uuid.New().String()
+	signedAt := time.Now()
+
+	s.signAs(req, body, testProvider, testProviderSecret, nonce, signedAt)
+	resp := s.performRequest(req)
+	s.Require().Equal(200, resp.StatusCode)
+
+	replay, err := http.NewRequest(req.Method, req.URL.String(), bytes.NewReader(body))
+	s.Require().NoError(err)
+
+	replay.Header = req.Header.Clone()
+
+	resp = s.performRequest(replay)
+	s.Equal(401, resp.StatusCode, "Replayed requests should be rejected")
+	s.JSONEq(`"invalid_signature"`, s.problemCode(resp))
+}
+
+func (s *SignatureTestSuite) TestForbiddenSourceType() {
+	secret := s.gamesProvider()
+
+	req, body := s.transaction("payment")
+	req.Header.Set("Authorization", "Bearer "+s.createAPIKey("games", "transactions:write"))
+	s.signAs(req, body, "games", secret, uuid.New().String(), time.Now())
+
+	resp := s.performRequest(req)
+	s.Equal(403, resp.StatusCode, "Providers should only send their own source types")
+	s.JSONEq(`"source_type_forbidden"`, s.problemCode(resp))
+}
+
+func (s *SignatureTestSuite) TestRollbackOfAnotherSender() {
+	secret := s.gamesProvider()
+	winID := uuid.New().String()
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{State: "win", Amount: "10.00", TransactionID: winID})
+	s.Require().Equal(200, resp.StatusCode)
+
+	rollback := TransactionRequest{State: "rollback", TransactionID: uuid.New().String(), OriginalTransactionID: winID}
+
+	body, err := json.Marshal(rollback)
+	s.Require().NoError(err)
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.BaseURL, "/")+"/user/1/transaction",
+		bytes.NewReader(body))
+	s.Require().NoError(err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Source-Type", "game")
+	req.Header.Set("Authorization", "Bearer "+s.createAPIKey("games", "transactions:write"))
+	s.signAs(req, body, "games", secret, uuid.New().String(), time.Now())
+
+	resp = s.performRequest(req)
+	s.Equal(403, resp.StatusCode, "Providers should not roll back transactions of other providers")
+	s.JSONEq(`"source_type_forbidden"`, s.problemCode(resp))
+
+	rollback.TransactionID = uuid.New().String()
+	resp = s.ProcessTransaction(s.T(), 1, "payment", rollback)
+	s.Equal(403, resp.StatusCode, "Rollbacks should have the source type of their original")
+	s.JSONEq(`"source_type_forbidden"`, s.problemCode(resp))
+
+	s.Equal("110.00", s.balance(), "The win should not be rolled back")
+}
+
+func (s *SignatureTestSuite) TestSettleReservationOfAnotherProvider() {
+	secret := s.gamesProvider()
+	id := uuid.New().String()
+
+	resp := s.Reservations(s.T(), http.MethodPost, 1, "", map[string]string{"transactionId": id, "amount": "30.00"})
+	s.Require().Equal(200, resp.StatusCode)
+
+	for _, action := range []string{"commit", "release"} {
+		req, err := http.NewRequest(http.MethodPost,
+			fmt.Sprintf("%s/user/1/reservations/%s/%s", strings.TrimRight(s.BaseURL, "/"), id, action), http.NoBody)
+		s.Require().NoError(err)
+
+		req.Header.Set("Authorization", "Bearer "+s.createAPIKey("games", "transactions:write"))
+		s.signAs(req, nil, "games", secret, uuid.New().String(), time.Now())
+
+		resp = s.performRequest(req)
+		s.Equal(403, resp.StatusCode, "Providers should not %s reservations of other providers", action)
+		s.JSONEq(`"source_type_forbidden"`, s.problemCode(resp))
+	}
+
+	s.Equal("70.00", s.balance(), "The stake should still be held")
+}
+
+func (s *SignatureTestSuite) balance() string {
+	resp := s.GetBalance(s.T(), 1)
+	s.Require().Equal(200, resp.StatusCode)
+
+	var balance BalanceResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &balance))
+
+	return balance.Balance
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type SourceTypeTestSuite struct {
+	APITestSuite
+}
+
+// uniqueSourceType returns a source type name no other test uses, as the server caches the registry.
+func uniqueSourceType() string {
+	return "src-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+}
+
+func (s *SourceTypeTestSuite) win() TransactionRequest {
+	return TransactionRequest{State: "win", Amount: "10.00", TransactionID: uuid.New().String()}
+}
+
+func (s *SourceTypeTestSuite) TestBuiltInSourceTypesAreRegistered() {
+	resp := s.SourceTypeAdmin(s.T(), http.MethodGet, "", nil)
+	s.Equal(200, resp.StatusCode, "Should list source types")
+
+	for _, name := range []string{"game", "server", "payment"} {
+		s.Contains(string(resp.Body), `"name":"`+name+`"`, "Built-in source type %s should be registered", name)
+	}
+}
+
+func (s *SourceTypeTestSuite) TestUnknownSourceTypeIsRejected() {
+	resp := s.ProcessTransaction(s.T(), 1, uniqueSourceType(), s.win())
+
+	s.Equal(400, resp.StatusCode, "Should reject transactions of unregistered source types")
+	s.JSONEq(`"invalid_request"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
+
+func (s *SourceTypeTestSuite) TestAddedSourceTypeAcceptsTransactions() {
+	name := uniqueSourceType()
+
+	resp := s.SourceTypeAdmin(s.T(), http.MethodPost, "", map[string]any{"name": name, "displayName": "Sportsbook"})
+	s.Equal(201, resp.StatusCode, "Should register the source type")
+
+	resp = s.ProcessTransaction(s.T(), 1, name, s.win())
+	s.Equal(200, resp.StatusCode, "Should accept transactions of the new source type")
+
+	resp = s.ListTransactions(s.T(), 1, "?sourceType="+name)
+	s.Equal(200, resp.StatusCode, "Should filter history by the new source type")
+	s.Contains(string(resp.Body), `"sourceType":"`+name+`"`, "History should contain the transaction")
+}
+
+func (s *SourceTypeTestSuite) TestDuplicateSourceType() {
+	resp := s.SourceTypeAdmin(s.T(), http.MethodPost, "", map[string]any{"name": "game", "displayName": "Game"})
+
+	s.Equal(409, resp.StatusCode, "Should reject registering a source type twice")
+	s.JSONEq(`"source_type_exists"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
+
+func (s *SourceTypeTestSuite) TestDisabledSourceTypeIsRejected() {
+	name := uniqueSourceType()
+
+	resp := s.SourceTypeAdmin(s.T(), http.MethodPost, "", map[string]any{"name": name, "displayName": "Poker"})
+	s.Require().Equal(201, resp.StatusCode, "Should register the source type")
+
+	resp = s.ProcessTransaction(s.T(), 1, name, s.win())
+	s.Require().Equal(200, resp.StatusCode, "Should accept transactions while enabled")
+
+	resp = s.SourceTypeAdmin(s.T(), http.MethodPatch, name, map[string]any{"enabled": false})
+	s.Equal(200, resp.StatusCode, "Should disable the source type")
+
+	resp = s.ProcessTransaction(s.T(), 1, name, s.win())
+	s.Equal(400, resp.StatusCode, "Should reject transactions of a disabled source type")
+
+	resp = s.ListTransactions(s.T(), 1, "?sourceType="+name)
+	s.Contains(string(resp.Body), `"sourceType":"`+name+`"`, "History of a disabled source type should be kept")
+}
+
+func (s *SourceTypeTestSuite) TestStateNotAllowed() {
+	name := uniqueSourceType()
+
+	resp := s.SourceTypeAdmin(s.T(), http.MethodPost, "", map[string]any{
+		"name":          name,
+		"displayName":   "Deposits",
+		"allowedStates": []string{"win"},
+	})
+	s.Require().Equal(201, resp.StatusCode, "Should register the source type")
+
+	lose := s.win()
+	lose.State = "lose"
+
+	resp = s.ProcessTransaction(s.T(), 1, name, lose)
+	s.Equal(422, resp.StatusCode, "Should reject states the source type does not send")
+	s.JSONEq(`"state_not_allowed"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
+
+func (s *SourceTypeTestSuite) TestUpdateUnknownSourceType() {
+	resp := s.SourceTypeAdmin(s.T(), http.MethodPatch, uniqueSourceType(), map[string]any{"enabled": false})
+
+	s.Equal(404, resp.StatusCode, "Should return 404 for an unregistered source type")
+	s.JSONEq(`"source_type_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+type UserTestSuite struct {
+	APITestSuite
+}
+
+type userResponse struct {
+	UserID  int    `json:"userId"`
+	Status  string `json:"status"`
+	Wallets []struct {
+		Currency string `json:"currency"`
+		Balance  string `json:"balance"`
+	} `json:"wallets"`
+}
+
+func (s *UserTestSuite) user(resp apiResponse) userResponse {
+	var user userResponse
+	s.Require().NoError(json.Unmarshal(resp.Body, &user))
+
+	return user
+}
+
+func (s *UserTestSuite) setStatus(userID int, status string) apiResponse {
+	return s.Users(s.T(), http.MethodPatch, strconv.Itoa(userID)+"/status", map[string]string{"status": status})
+}
+
+func (s *UserTestSuite) transaction(userID int, state string) apiResponse {
+	return s.ProcessTransaction(s.T(), userID, "game", TransactionRequest{
+		State:         state,
+		Amount:        "10.00",
+		TransactionID: uuid.New().String(),
+	})
+}
+
+func (s *UserTestSuite) TestCreateUser() {
+	resp := s.Users(s.T(), http.MethodPost, "", map[string]string{"currency": "USD"})
+	s.Require().Equal(201, resp.StatusCode, "Should create the user")
+
+	created := s.user(resp)
+	s.Equal(5, created.UserID, "Should continue after the seeded users")
+	s.Equal("active", created.Status)
+	s.Require().Len(created.Wallets, 1)
+	s.Equal("USD", created.Wallets[0].Currency)
+	s.Equal("0.00", created.Wallets[0].Balance)
+
+	resp = s.Users(s.T(), http.MethodGet, "5", nil)
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal(created, s.user(resp))
+
+	resp = s.Users(s.T(), http.MethodPost, "", nil)
+	s.Require().Equal(201, resp.StatusCode, "Should create a user without a body")
+	s.Equal("EUR", s.user(resp).Wallets[0].Currency, "Should use the default currency")
+}
+
+func (s *UserTestSuite) TestSuspendedUser() {
+	resp := s.setStatus(1, "suspended")
+	s.Require().Equal(200, resp.StatusCode)
+	s.Equal("suspended", s.user(resp).Status)
+
+	resp = s.transaction(1, "lose")
+	s.Equal(403, resp.StatusCode, "Suspended users should not lose")
+	s.JSONEq(`"user_suspended"`, s.problemCode(resp))
+
+	resp = s.transaction(1, "win")
+	s.Equal(200, resp.StatusCode, "Wins should still land on suspended users")
+
+	resp = s.Reservations(s.T(), http.MethodPost, 1, "", map[string]string{
+		"transactionId": uuid.New().String(),
+		"amount":        "10.00",
+	})
+	s.Equal(403, resp.StatusCode, "Suspended users should not reserve")
+
+	resp = s.setStatus(1, "active")
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.transaction(1, "lose")
+	s.Equal(200, resp.StatusCode, "Reactivated users should lose again")
+}
+
+func (s *UserTestSuite) TestClosedUser() {
+	resp := s.setStatus(2, "closed")
+	s.Require().Equal(200, resp.StatusCode)
+
+	resp = s.transaction(2, "win")
+	s.Equal(403, resp.StatusCode, "Closed users should not receive transactions")
+	s.JSONEq(`"user_closed"`, s.problemCode(resp))
+
+	resp = s.setStatus(2, "active")
+	s.Equal(403, resp.StatusCode, "Closed users should not be reopened")
+	s.JSONEq(`"user_closed"`, s.problemCode(resp))
+
+	resp = s.GetBalance(s.T(), 2)
+	s.Equal(200, resp.StatusCode, "The balance of closed users should stay readable")
+}
+
+func (s *UserTestSuite) TestUserErrors() {
+	resp := s.Users(s.T(), http.MethodGet, "999", nil)
+	s.Equal(404, resp.StatusCode)
+	s.JSONEq(`"user_not_found"`, s.problemCode(resp))
+
+	resp = s.setStatus(999, "suspended")
+	s.Equal(404, resp.StatusCode)
+
+	resp = s.setStatus(1, "deleted")
+	s.Equal(400, resp.StatusCode)
+
+	resp = s.Users(s.T(), http.MethodPost, "", map[string]string{"currency": "JPY"})
+	s.Equal(400, resp.StatusCode)
+}
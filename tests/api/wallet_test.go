@@ -0,0 +1,108 @@
+package api
+
+import (
+	"github.com/google/uuid"
+)
+
+type WalletTestSuite struct {
+	APITestSuite
+}
+
+func (s *WalletTestSuite) TestListWallets() {
+	s.createWallet(1, "USD")
+
+	resp := s.ListWallets(s.T(), 1)
+	s.Equal(200, resp.StatusCode, "Should return 200 OK")
+
+	expected := `
+{
+	"userId": 1,
+	"wallets": [
+		{"currency": "EUR", "balance": "100.00", "realBalance": "100.00", "bonusBalance": "0.00", "heldBalance": "0.00"},
+		{"currency": "USD", "balance": "0.00", "realBalance": "0.00", "bonusBalance": "0.00", "heldBalance": "0.00"}
+	]
+}`
+	s.JSONEq(expected, string(resp.Body), "Should list all wallets ordered by currency")
+}
+
+func (s *WalletTestSuite) TestListWalletsNonExistentUser() {
+	resp := s.ListWallets(s.T(), 999)
+
+	s.Equal(404, resp.StatusCode, "Should return 404 for non-existent user")
+	s.JSONEq(`"user_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
+
+func (s *WalletTestSuite) TestGetBalanceMissingWallet() {
+	resp := s.GetWalletBalance(s.T(), 1, "GBP")
+
+	s.Equal(404, resp.StatusCode, "Should return 404 for a currency without wallet")
+	s.JSONEq(`"wallet_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
+
+func (s *WalletTestSuite) TestGetBalanceUnsupportedCurrency() {
+	resp := s.GetWalletBalance(s.T(), 1, "JPY")
+
+	s.Equal(400, resp.StatusCode, "Should reject unsupported currencies")
+}
+
+func (s *WalletTestSuite) TestTransactionInOtherCurrency() {
+	s.createWallet(1, "USD")
+
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "12.50",
+		Currency:      "USD",
+		TransactionID: uuid.New().String(),
+	})
+	s.Equal(200, resp.StatusCode, "Win transaction should return 200 OK")
+
+	usdResp := s.GetWalletBalance(s.T(), 1, "USD")
+	s.JSONEq(`{"userId": 1, "currency": "USD", "balance": "12.50", "realBalance": "12.50",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(usdResp.Body),
+		"USD wallet should be credited")
+
+	eurResp := s.GetBalance(s.T(), 1)
+	s.JSONEq(`{"userId": 1, "currency": "EUR", "balance": "100.00", "realBalance": "100.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(eurResp.Body),
+		"EUR wallet should be unchanged")
+}
+
+func (s *WalletTestSuite) TestTransactionWithoutWallet() {
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "10.00",
+		Currency:      "GBP",
+		TransactionID: uuid.New().String(),
+	})
+
+	s.Equal(404, resp.StatusCode, "Should reject transactions in a currency without wallet")
+	s.JSONEq(`"wallet_not_found"`, s.problemCode(resp), "Should return a machine-readable error code")
+}
+
+func (s *WalletTestSuite) TestRollbackUsesOriginalCurrency() {
+	s.createWallet(1, "USD")
+
+	originalID := uuid.New().String()
+	resp := s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:         "win",
+		Amount:        "7.00",
+		Currency:      "USD",
+		TransactionID: originalID,
+	})
+	s.Equal(200, resp.StatusCode, "Win transaction should return 200 OK")
+
+	resp = s.ProcessTransaction(s.T(), 1, "game", TransactionRequest{
+		State:                 "rollback",
+		TransactionID:         uuid.New().String(),
+		OriginalTransactionID: originalID,
+	})
+	s.Equal(200, resp.StatusCode, "Rollback should return 200 OK")
+
+	usdResp := s.GetWalletBalance(s.T(), 1, "USD")
+	s.JSONEq(`{"userId": 1, "currency": "USD", "balance": "0.00", "realBalance": "0.00",
+		"bonusBalance": "0.00", "heldBalance": "0.00"}`,
+		string(usdResp.Body),
+		"Rollback should be applied to the wallet of the original transaction")
+}